@@ -45,6 +45,8 @@ var (
 	parallelNum = flag.Int("parallel", 1, "Number of parallel instances to start")
 	iterNum     = flag.Int("iter", 1, "Number of iterations to run")
 	funcName    = flag.String("funcName", "helloworld", "Name of the function to benchmark")
+	// samplesFormat is one of metrics.ExportFormat
+	samplesFormat = flag.String("samplesFormat", "", "Also export the raw samples with the run's metadata (jsonl or parquet)")
 )
 
 func TestBenchParallelServe(t *testing.T) {
@@ -276,6 +278,45 @@ func fusePrintMetrics(t *testing.T, serveMetrics, upfMetrics []*metrics.Metric,
 
 	err := metrics.PrintMeanStd(outFileName, funcName, serveMetrics...)
 	require.NoError(t, err, "Failed to dump stats")
+
+	err = metrics.PrintPercentiles(getOutFile(trimExt(outfile)+"_percentiles.csv"), funcName, serveMetrics...)
+	require.NoError(t, err, "Failed to dump percentiles")
+
+	exportSamples(t, funcName, outfile, serveMetrics...)
+}
+
+// exportSamples Exports the raw samples to a file named after outfile, if a samples format is set
+func exportSamples(t *testing.T, funcName, outfile string, metricsList ...*metrics.Metric) {
+	if *samplesFormat == "" {
+		return
+	}
+
+	format, err := metrics.ParseExportFormat(*samplesFormat)
+	require.NoError(t, err, "Invalid samples format")
+
+	run := metrics.NewRunInfo(funcName, map[string]string{
+		"snapshots": strconv.FormatBool(*isSnapshotsEnabledTest),
+		"upf":       strconv.FormatBool(*isUPFEnabledTest),
+		"lazy":      strconv.FormatBool(*isLazyModeTest),
+		"withCache": strconv.FormatBool(*isWithCache),
+	})
+
+	err = metrics.ExportSamples(getOutFile(trimExt(outfile)+"."+string(format)), format, run, metricsList...)
+	require.NoError(t, err, "Failed to export samples")
+}
+
+// exportMetricMaps Exports the raw samples of the metric maps, see exportSamples
+func exportMetricMaps(t *testing.T, funcName, outfile string, metricMaps []map[string]float64) {
+	metricsList := make([]*metrics.Metric, 0, len(metricMaps))
+	for _, m := range metricMaps {
+		metricsList = append(metricsList, &metrics.Metric{MetricMap: m})
+	}
+
+	exportSamples(t, funcName, outfile, metricsList...)
+}
+
+func trimExt(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
 }
 
 func createSnapshots(t *testing.T, concurrency, vmID int, imageName string, isSyncOffload bool) {
@@ -0,0 +1,294 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	hpb "github.com/ease-lab/vhive/examples/protobuf/helloworld"
+	pb "github.com/ease-lab/vhive/proto"
+)
+
+const usage = `vhivectl is a command-line client for the vHive orchestrator service
+and for the function forwarder.
+
+Usage:
+  vhivectl [flags] <command> [command flags] [args]
+
+Commands:
+  start <function-id> <image>       Start an instance of a function in the function
+                                    pool and serve its first request
+  stop <function-id>                Stop the instances of a function in the function pool
+  stop-all                          Stop all VMs
+  list                              List the VMs
+  get <vm-id>                       Show a VM
+  pause <vm-id>                     Pause a VM
+  resume <vm-id>                    Resume a VM
+  snapshot <vm-id>                  Create a snapshot of a paused VM
+  load <vm-id>                      Load the snapshot of an offloaded VM
+  offload <vm-id>                   Offload a VM
+  functions                         List the functions of the function pool
+  stats [-upf] [function-id]        Show the function pool, snapshot and image stats
+  invoke [-method m] [-payload p | -payloadFile f] <function-id> <image>
+                                    Invoke a function through the forwarder,
+                                    the raw payload is forwarded to the method
+                                    if any, FwdHello is called otherwise
+
+Flags:
+`
+
+var (
+	orchAddr = flag.String("addr", "localhost:3333", "Address of the orchestrator service")
+	fwdAddr  = flag.String("fwdAddr", "localhost:3334", "Address of the function forwarder")
+	format   = flag.String("o", formatTable, "Output format: table or json")
+	timeout  = flag.Duration("timeout", 5*time.Minute, "Deadline of the command")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *format != formatTable && *format != formatJSON {
+		fmt.Fprintf(os.Stderr, "vhivectl: unknown output format %q\n", *format)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	p := &printer{w: os.Stdout, format: *format}
+	if err := run(ctx, p, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "vhivectl:", err)
+		os.Exit(1)
+	}
+}
+
+// commandArgs is the number of arguments of each command, -1 for at most one
+var commandArgs = map[string]int{
+	"start":     2,
+	"stop":      1,
+	"stop-all":  0,
+	"list":      0,
+	"get":       1,
+	"pause":     1,
+	"resume":    1,
+	"snapshot":  1,
+	"load":      1,
+	"offload":   1,
+	"functions": 0,
+	"stats":     -1,
+	"invoke":    2,
+}
+
+func dial(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", addr)
+	}
+	return conn, nil
+}
+
+func run(ctx context.Context, p *printer, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	nArgs, ok := commandArgs[cmd]
+	if !ok {
+		return errors.Errorf("unknown command %q, see vhivectl -h", cmd)
+	}
+
+	var (
+		isUPF       *bool
+		method      *string
+		payload     *string
+		payloadFile *string
+	)
+
+	switch cmd {
+	case "stats":
+		isUPF = fs.Bool("upf", false, "Get the UPF page and latency stats of the function")
+	case "invoke":
+		method = fs.String("method", "", "Method or path to forward a raw payload to, FwdHello is used if empty")
+		payload = fs.String("payload", "world", "Payload of the request")
+		payloadFile = fs.String("payloadFile", "", "File with the payload of the request, overrides -payload")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(err, "%s", cmd)
+	}
+
+	if nArgs >= 0 && fs.NArg() != nArgs || nArgs < 0 && fs.NArg() > 1 {
+		return errors.Errorf("wrong number of arguments to %s, see vhivectl -h", cmd)
+	}
+
+	if cmd == "invoke" {
+		return invoke(ctx, p, fs.Arg(0), fs.Arg(1), *method, *payload, *payloadFile)
+	}
+
+	conn, err := dial(ctx, *orchAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := pb.NewOrchestratorClient(conn)
+	vmReq := &pb.VMReq{Id: fs.Arg(0)}
+
+	switch cmd {
+	case "start":
+		resp, err := client.StartVM(ctx, &pb.StartVMReq{Id: fs.Arg(0), Image: fs.Arg(1)})
+		if err != nil {
+			return err
+		}
+		return p.printOpResp(resp, resp.GetMessage(), resp.GetMetrics())
+	case "stop":
+		resp, err := client.StopSingleVM(ctx, &pb.StopSingleVMReq{Id: fs.Arg(0)})
+		if err != nil {
+			return err
+		}
+		return p.printStatus(resp)
+	case "stop-all":
+		resp, err := client.StopVMs(ctx, &pb.StopVMsReq{AllVms: true})
+		if err != nil {
+			return err
+		}
+		return p.printStatus(resp)
+	case "list":
+		resp, err := client.ListVMs(ctx, &pb.ListVMsReq{})
+		if err != nil {
+			return err
+		}
+		return p.printVMs(resp)
+	case "get":
+		resp, err := client.GetVM(ctx, vmReq)
+		if err != nil {
+			return err
+		}
+		return p.printVMs(&pb.ListVMsResp{Vms: []*pb.VM{resp}})
+	case "pause":
+		resp, err := client.PauseVM(ctx, vmReq)
+		if err != nil {
+			return err
+		}
+		return p.printStatus(resp)
+	case "resume":
+		resp, err := client.ResumeVM(ctx, vmReq)
+		if err != nil {
+			return err
+		}
+		return p.printOpResp(resp, resp.GetMessage(), resp.GetMetrics())
+	case "snapshot":
+		resp, err := client.CreateSnapshot(ctx, vmReq)
+		if err != nil {
+			return err
+		}
+		return p.printStatus(resp)
+	case "load":
+		resp, err := client.LoadSnapshot(ctx, vmReq)
+		if err != nil {
+			return err
+		}
+		return p.printOpResp(resp, resp.GetMessage(), resp.GetMetrics())
+	case "offload":
+		resp, err := client.Offload(ctx, vmReq)
+		if err != nil {
+			return err
+		}
+		return p.printStatus(resp)
+	case "functions":
+		resp, err := client.ListFunctions(ctx, &pb.ListFunctionsReq{})
+		if err != nil {
+			return err
+		}
+		return p.printFunctions(resp)
+	case "stats":
+		resp, err := client.GetStats(ctx, &pb.GetStatsReq{FunctionId: fs.Arg(0), Upf: *isUPF})
+		if err != nil {
+			return err
+		}
+		return p.printStats(resp)
+	}
+
+	return nil
+}
+
+func invoke(ctx context.Context, p *printer, fID, imageName, method, payload, payloadFile string) error {
+	var (
+		reqPayload = []byte(payload)
+		err        error
+	)
+
+	if payloadFile != "" {
+		if reqPayload, err = readPayload(payloadFile); err != nil {
+			return err
+		}
+	}
+
+	conn, err := dial(ctx, *fwdAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := hpb.NewFwdGreeterClient(conn)
+
+	if method == "" {
+		resp, err := client.FwdHello(ctx, &hpb.FwdHelloReq{Id: fID, Image: imageName, Payload: string(reqPayload)})
+		if err != nil {
+			return err
+		}
+		return p.printInvoke(resp, resp.GetIsColdStart(), []byte(resp.GetPayload()))
+	}
+
+	resp, err := client.Invoke(ctx, &hpb.InvokeReq{Id: fID, Image: imageName, Method: method, Payload: reqPayload})
+	if err != nil {
+		return err
+	}
+	return p.printInvoke(resp, resp.GetIsColdStart(), resp.GetPayload())
+}
+
+func readPayload(path string) ([]byte, error) {
+	if path == "-" {
+		data, err := ioutil.ReadAll(os.Stdin)
+		return data, errors.Wrap(err, "failed to read the payload from stdin")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	return data, errors.Wrap(err, "failed to read the payload")
+}
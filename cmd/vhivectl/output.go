@@ -0,0 +1,221 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/ease-lab/vhive/proto"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// printer writes the responses either as tables or as the JSON encoding of the messages
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func (p *printer) printJSON(msg proto.Message) error {
+	m := jsonpb.Marshaler{OrigName: true, EmitDefaults: true, Indent: "  "}
+	if err := m.Marshal(p.w, msg); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(p.w)
+	return err
+}
+
+// print prints the message in JSON or calls table to print it in a table
+func (p *printer) print(msg proto.Message, table func(tw *tabwriter.Writer)) error {
+	if p.format == formatJSON {
+		return p.printJSON(msg)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 8, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+func (p *printer) printStatus(resp *pb.Status) error {
+	return p.print(resp, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, resp.GetMessage())
+	})
+}
+
+// printOpResp prints the message and the latency breakdown of a VM operation
+func (p *printer) printOpResp(resp proto.Message, message string, metrics []*pb.Metric) error {
+	return p.print(resp, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, message)
+		if len(metrics) == 0 {
+			return
+		}
+
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "METRIC\tLATENCY (us)")
+		for _, m := range metrics {
+			fmt.Fprintf(tw, "%s\t%.0f\n", m.GetName(), m.GetValue())
+		}
+	})
+}
+
+func (p *printer) printVMs(resp *pb.ListVMsResp) error {
+	return p.print(resp, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "ID\tIMAGE\tSTATE\tGUEST IP\tVCPUS\tMEMORY (MiB)\tSNAPSHOT\tFUNCTION")
+		for _, vm := range resp.GetVms() {
+			spec := vm.GetSpec()
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+				vm.GetId(), vm.GetImage(), vm.GetState(), vm.GetGuestIp(),
+				spec.GetVcpuCount(), spec.GetMemSizeMib(),
+				orNone(vm.GetSnapshotId()), orNone(vm.GetFunctionId()))
+		}
+	})
+}
+
+func (p *printer) printFunctions(resp *pb.ListFunctionsResp) error {
+	return p.print(resp, func(tw *tabwriter.Writer) {
+		writeFunctions(tw, resp.GetFunctions())
+	})
+}
+
+func (p *printer) printStats(resp *pb.GetStatsResp) error {
+	return p.print(resp, func(tw *tabwriter.Writer) {
+		writeFunctions(tw, resp.GetFunctions())
+
+		if s := resp.GetSnapshots(); s != nil {
+			fmt.Fprintln(tw)
+			fmt.Fprintln(tw, "SNAPSHOT STORE")
+			writeField(tw, "Quota (MiB)", toMib(s.GetQuotaBytes()))
+			writeField(tw, "Used (MiB)", toMib(s.GetUsedBytes()))
+			writeField(tw, "Shared (MiB)", toMib(s.GetSharedBytes()))
+			writeField(tw, "Shared snapshots", s.GetSharedSnapshots())
+			writeField(tw, "Pinned snapshots", s.GetPinnedSnapshots())
+			writeField(tw, "Evictions", s.GetEvictions())
+			writeField(tw, "Evicted (MiB)", toMib(s.GetEvictedBytes()))
+		}
+
+		if s := resp.GetImages(); s != nil {
+			fmt.Fprintln(tw)
+			fmt.Fprintln(tw, "IMAGE STORE")
+			writeField(tw, "Budget (MiB)", toMib(s.GetBudgetBytes()))
+			writeField(tw, "Used (MiB)", toMib(s.GetUsedBytes()))
+			writeField(tw, "Cached images", s.GetCachedImages())
+			writeField(tw, "Active images", s.GetActiveImages())
+			writeField(tw, "Pulls", s.GetPulls())
+			writeField(tw, "Pulls in flight", s.GetPullsInFlight())
+			writeField(tw, "Evictions", s.GetEvictions())
+		}
+
+		if s := resp.GetUpfPages(); s != nil {
+			fmt.Fprintln(tw)
+			fmt.Fprintln(tw, "UPF PAGES")
+			writeField(tw, "Lazy mode", s.GetIsLazyMode())
+			writeField(tw, "Recorded pages", s.GetRecordedPages())
+			writeField(tw, "Recorded regions", s.GetRecordedRegions())
+			fmt.Fprintln(tw)
+			writeSummaries(tw, "PAGES", []*pb.MetricSummary{
+				s.GetServedPages(),
+				s.GetReusedPages(),
+				s.GetUniquePages(),
+			})
+		}
+
+		if len(resp.GetUpfLatency()) > 0 {
+			fmt.Fprintln(tw)
+			writeSummaries(tw, "UPF LATENCY (us)", resp.GetUpfLatency())
+		}
+	})
+}
+
+func (p *printer) printInvoke(resp proto.Message, isColdStart bool, payload []byte) error {
+	if p.format == formatJSON {
+		return p.printJSON(resp)
+	}
+
+	if isColdStart {
+		fmt.Fprintln(p.w, "Cold start")
+	}
+	_, err := fmt.Fprintln(p.w, string(payload))
+	return err
+}
+
+func writeFunctions(tw *tabwriter.Writer, functions []*pb.Function) {
+	fmt.Fprintln(tw, "FUNCTION\tIMAGE\tPINNED\tSERVED\tQUEUED\tINSTANCES")
+	for _, f := range functions {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%d\t%d\t%d\n",
+			f.GetId(), f.GetImage(), f.GetIsPinned(), f.GetServed(), f.GetQueued(), len(f.GetInstances()))
+	}
+
+	var hasInstances bool
+	for _, f := range functions {
+		if len(f.GetInstances()) > 0 {
+			hasInstances = true
+		}
+	}
+
+	if !hasInstances {
+		return
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "FUNCTION\tVM\tSTATE\tIN-FLIGHT\tSERVED")
+	for _, f := range functions {
+		for _, inst := range f.GetInstances() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n",
+				f.GetId(), inst.GetVmId(), inst.GetState(), inst.GetInFlight(), inst.GetServed())
+		}
+	}
+}
+
+func writeSummaries(tw *tabwriter.Writer, title string, summaries []*pb.MetricSummary) {
+	fmt.Fprintf(tw, "%s\tMEAN\tSTD DEV\n", title)
+	for _, s := range summaries {
+		if s == nil {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%.1f\t%.1f\n", s.GetName(), s.GetMean(), s.GetStdDev())
+	}
+}
+
+func writeField(tw *tabwriter.Writer, name string, value interface{}) {
+	fmt.Fprintf(tw, "%s:\t%v\n", name, value)
+}
+
+func toMib(bytes int64) string {
+	return fmt.Sprintf("%.1f", float64(bytes)/(1<<20))
+}
+
+func orNone(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
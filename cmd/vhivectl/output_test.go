@@ -0,0 +1,126 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/ease-lab/vhive/proto"
+)
+
+func testVMs() *pb.ListVMsResp {
+	return &pb.ListVMsResp{Vms: []*pb.VM{
+		{
+			Id:         "vm-1",
+			Image:      "ghcr.io/ease-lab/helloworld:var_workload",
+			State:      "running",
+			GuestIp:    "190.128.0.2",
+			Spec:       &pb.VMSpec{VcpuCount: 1, MemSizeMib: 256},
+			FunctionId: "0",
+		},
+		{Id: "vm-2", Image: "ghcr.io/ease-lab/pyaes:var_workload", State: "offloaded"},
+	}}
+}
+
+func TestPrintVMsTable(t *testing.T) {
+	var buf bytes.Buffer
+	p := &printer{w: &buf, format: formatTable}
+
+	require.NoError(t, p.printVMs(testVMs()))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Equal(t, []string{"ID", "IMAGE", "STATE", "GUEST", "IP", "VCPUS", "MEMORY", "(MiB)", "SNAPSHOT", "FUNCTION"}, strings.Fields(lines[0]))
+	require.Equal(t, []string{"vm-1", "ghcr.io/ease-lab/helloworld:var_workload", "running", "190.128.0.2", "1", "256", "-", "0"}, strings.Fields(lines[1]))
+	require.Equal(t, []string{"vm-2", "ghcr.io/ease-lab/pyaes:var_workload", "offloaded", "0", "0", "-", "-"}, strings.Fields(lines[2]))
+	require.Equal(t, strings.Index(lines[0], "STATE"), strings.Index(lines[1], "running"), "Columns must be aligned")
+}
+
+func TestPrintVMsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	p := &printer{w: &buf, format: formatJSON}
+
+	require.NoError(t, p.printVMs(testVMs()))
+
+	var resp struct {
+		VMs []map[string]interface{} `json:"vms"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &resp))
+	require.Len(t, resp.VMs, 2)
+	require.Equal(t, "190.128.0.2", resp.VMs[0]["guest_ip"], "Fields must keep their proto names")
+	require.Equal(t, "", resp.VMs[1]["snapshot_id"], "Fields must be emitted with their default values")
+}
+
+func TestPrintStatsTable(t *testing.T) {
+	var buf bytes.Buffer
+	p := &printer{w: &buf, format: formatTable}
+
+	resp := &pb.GetStatsResp{
+		Functions: []*pb.Function{{
+			Id:        "0",
+			Image:     "ghcr.io/ease-lab/helloworld:var_workload",
+			Served:    3,
+			Instances: []*pb.Instance{{VmId: "0-0", State: "running", Served: 3}},
+		}},
+		Snapshots: &pb.SnapshotStoreStats{QuotaBytes: 1 << 30, UsedBytes: 1 << 29},
+		UpfPages: &pb.UPFPageStats{
+			IsLazyMode:    true,
+			RecordedPages: 1000,
+			ServedPages:   &pb.MetricSummary{Name: "ServedPages", Mean: 100, StdDev: 5},
+		},
+		UpfLatency: []*pb.MetricSummary{{Name: "Total", Mean: 1234.5, StdDev: 10}},
+	}
+
+	require.NoError(t, p.printStats(resp))
+
+	out := buf.String()
+	require.Contains(t, out, "0-0")
+	require.Regexp(t, `Quota \(MiB\):\s+1024\.0`, out)
+	require.Regexp(t, `Used \(MiB\):\s+512\.0`, out)
+	require.Regexp(t, `ServedPages\s+100\.0\s+5\.0`, out)
+	require.Regexp(t, `Total\s+1234\.5\s+10\.0`, out)
+	require.NotContains(t, out, "IMAGE STORE", "Missing stats must not be printed")
+}
+
+func TestRunArgs(t *testing.T) {
+	p := &printer{w: &bytes.Buffer{}, format: formatTable}
+
+	for _, args := range [][]string{
+		{"start", "vm-1"},
+		{"stop"},
+		{"list", "vm-1"},
+		{"stats", "0", "1"},
+		{"stop", "-upf", "vm-1"},
+		{"unknown"},
+		{"stats", "-unknown"},
+		{"invoke", "0"},
+	} {
+		require.Error(t, run(context.Background(), p, args[0], args[1:]), "%v must be rejected", args)
+	}
+}
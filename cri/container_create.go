@@ -25,8 +25,15 @@ package cri
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
 
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/tracing"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 )
 
@@ -37,6 +44,14 @@ const (
 	guestPortEnv      = "GUEST_PORT"
 	guestImageEnv     = "GUEST_IMAGE"
 	guestPortValue    = "50051"
+
+	// Pod annotations that override the resources of the function's VM.
+	// The kernel args and the rootfs are set by the operator only (-vmSpecs).
+	vcpuCountAnnotation   = "vhive.ease-lab.github.io/vcpu-count"
+	memSizeMibAnnotation  = "vhive.ease-lab.github.io/mem-size-mib"
+	bootTimeoutAnnotation = "vhive.ease-lab.github.io/boot-timeout-seconds"
+	cpuSharesPerCPU       = 1024
+	bytesPerMib           = 1024 * 1024
 )
 
 // CreateContainer starts a container or a VM, depending on the name
@@ -76,13 +91,25 @@ func (s *Service) createUserContainer(ctx context.Context, r *criapi.CreateConta
 	guestImage, err := getGuestImage(config)
 	if err != nil {
 		log.WithError(err).Error()
-		return nil, err
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	vmSpec, err := getVMSpec(r, s.orch.GetVMSpec(guestImage))
+	if err != nil {
+		log.WithError(err).Error()
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	funcInst, err := s.coordinator.startVM(context.Background(), guestImage)
+	// The VM outlives the request, but its start is traced as a part of the request
+	vmCtx := tracing.Detach(ctx)
+	if auths := s.takePodPullAuths(r.GetSandboxConfig().GetMetadata().GetUid()); len(auths) > 0 {
+		// The guest image is pulled with the credentials of the pod, which are then dropped
+		vmCtx = ctriface.WithPullAuths(vmCtx, auths)
+	}
+	funcInst, err := s.coordinator.startVM(vmCtx, guestImage, vmSpec)
 	if err != nil {
 		log.WithError(err).Error("failed to start VM")
-		return nil, err
+		return nil, misc.ToGRPCError(err)
 	}
 
 	vmConfig := &VMConfig{guestIP: funcInst.startVMResponse.GuestIP, guestPort: guestPortValue}
@@ -96,22 +123,25 @@ func (s *Service) createUserContainer(ctx context.Context, r *criapi.CreateConta
 		log.WithError(stockErr).Error("failed to create container")
 		return nil, stockErr
 	}
-	
+
 	containerdID := stockResp.ContainerId
 	err = s.coordinator.insertActive(containerdID, funcInst)
 	if err != nil {
 		log.WithError(err).Error("failed to insert active VM")
-		return nil, err
+		return nil, misc.ToGRPCError(err)
 	}
 
 	return stockResp, stockErr
 }
 
 func (s *Service) createQueueProxy(ctx context.Context, r *criapi.CreateContainerRequest) (*criapi.CreateContainerResponse, error) {
+	// The pod's VM is created, drop the credentials that the queue-proxy was pulled with
+	s.takePodPullAuths(r.GetSandboxConfig().GetMetadata().GetUid())
+
 	vmConfig, err := s.getPodVMConfig(r.GetPodSandboxId())
 	if err != nil {
 		log.WithError(err).Error()
-		return nil, err
+		return nil, misc.ToGRPCError(err)
 	}
 
 	s.removePodVMConfig(r.GetPodSandboxId())
@@ -141,3 +171,58 @@ func getGuestImage(config *criapi.ContainerConfig) (string, error) {
 	return "", errors.New("failed to provide non empty guest image in user container config")
 
 }
+
+// getVMSpec Derives the spec of the function's VM from the resources of the user container,
+// the annotations of the pod and the container take precedence over the resources
+// but cannot exceed them, i.e., the limits of the container or the operator's spec.
+// Note that CRI conveys the memory limit but not the memory request of the container.
+func getVMSpec(r *criapi.CreateContainerRequest, spec ctriface.VMSpec) (ctriface.VMSpec, error) {
+	resources := r.GetConfig().GetLinux().GetResources()
+
+	if quota, period := resources.GetCpuQuota(), resources.GetCpuPeriod(); quota > 0 && period > 0 {
+		spec.VcpuCount = uint32((quota + period - 1) / period)
+	} else if shares := resources.GetCpuShares(); shares > cpuSharesPerCPU {
+		spec.VcpuCount = uint32((shares + cpuSharesPerCPU - 1) / cpuSharesPerCPU)
+	}
+
+	if limit := resources.GetMemoryLimitInBytes(); limit > 0 {
+		spec.MemSizeMib = uint32((limit + bytesPerMib - 1) / bytesPerMib)
+	}
+
+	annotations := make(map[string]string)
+	for k, v := range r.GetSandboxConfig().GetAnnotations() {
+		annotations[k] = v
+	}
+	for k, v := range r.GetConfig().GetAnnotations() {
+		annotations[k] = v
+	}
+
+	// The annotations can lower the resources that the pod is accounted for, but not raise them
+	maxValues := map[string]uint32{
+		vcpuCountAnnotation:  spec.VcpuCount,
+		memSizeMibAnnotation: spec.MemSizeMib,
+	}
+
+	for key, field := range map[string]*uint32{
+		vcpuCountAnnotation:   &spec.VcpuCount,
+		memSizeMibAnnotation:  &spec.MemSizeMib,
+		bootTimeoutAnnotation: &spec.TimeoutSeconds,
+	} {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || n == 0 {
+			return spec, fmt.Errorf("invalid value %q of annotation %s", value, key)
+		}
+
+		if maxValue, ok := maxValues[key]; ok && n > uint64(maxValue) {
+			return spec, fmt.Errorf("value %d of annotation %s exceeds the limit %d of the container", n, key, maxValue)
+		}
+		*field = uint32(n)
+	}
+
+	return spec, nil
+}
@@ -0,0 +1,86 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestGetVMSpec(t *testing.T) {
+	newRequest := func(resources *criapi.LinuxContainerResources, annotations map[string]string) *criapi.CreateContainerRequest {
+		return &criapi.CreateContainerRequest{
+			Config: &criapi.ContainerConfig{
+				Linux: &criapi.LinuxContainerConfig{Resources: resources},
+			},
+			SandboxConfig: &criapi.PodSandboxConfig{Annotations: annotations},
+		}
+	}
+
+	defaults := ctriface.DefaultVMSpec()
+
+	spec, err := getVMSpec(newRequest(nil, nil), defaults)
+	require.NoError(t, err)
+	require.Equal(t, defaults, spec, "Spec must not change without resources")
+
+	spec, err = getVMSpec(newRequest(&criapi.LinuxContainerResources{
+		CpuShares:          1536, // 1500m requested
+		MemoryLimitInBytes: 1000 * 1024 * 1024,
+	}, nil), defaults)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), spec.VcpuCount)
+	require.Equal(t, uint32(1000), spec.MemSizeMib)
+
+	spec, err = getVMSpec(newRequest(&criapi.LinuxContainerResources{
+		CpuPeriod:          100000,
+		CpuQuota:           300000,
+		MemoryLimitInBytes: 4096 * 1024 * 1024,
+	}, map[string]string{
+		memSizeMibAnnotation:                   "2048",
+		"vhive.ease-lab.github.io/rootfs":      "/etc/shadow",
+		"vhive.ease-lab.github.io/kernel-args": "init=/bin/sh",
+	}), defaults)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), spec.VcpuCount)
+	require.Equal(t, uint32(2048), spec.MemSizeMib)
+	require.Equal(t, defaults.RootDrive, spec.RootDrive, "Pod must not set the rootfs")
+	require.Equal(t, defaults.KernelArgs, spec.KernelArgs, "Pod must not set the kernel args")
+
+	_, err = getVMSpec(newRequest(nil, map[string]string{vcpuCountAnnotation: "two"}), defaults)
+	require.Error(t, err, "Accepted invalid vCPU count")
+
+	_, err = getVMSpec(newRequest(&criapi.LinuxContainerResources{
+		CpuPeriod: 100000,
+		CpuQuota:  200000,
+	}, map[string]string{vcpuCountAnnotation: "3"}), defaults)
+	require.Error(t, err, "Accepted vCPU count above the container's limit")
+
+	_, err = getVMSpec(newRequest(nil, map[string]string{
+		memSizeMibAnnotation: fmt.Sprint(defaults.MemSizeMib + 1),
+	}), defaults)
+	require.Error(t, err, "Accepted memory above the operator's spec of a container without limits")
+}
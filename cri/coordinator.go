@@ -24,13 +24,14 @@ package cri
 
 import (
 	"context"
-	"errors"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -41,6 +42,8 @@ type coordinator struct {
 
 	activeInstances     map[string]*funcInstance
 	idleInstances       map[string][]*funcInstance
+	warmPool            *warmPool
+	warmPoolMemMib      uint64
 	withoutOrchestrator bool
 }
 
@@ -53,6 +56,13 @@ func withoutOrchestrator() coordinatorOption {
 	}
 }
 
+// withWarmPoolMemory Sets the guest memory budget of the warm pool, unlimited if zero
+func withWarmPoolMemory(memBudgetMib uint64) coordinatorOption {
+	return func(c *coordinator) {
+		c.warmPoolMemMib = memBudgetMib
+	}
+}
+
 func newCoordinator(orch *ctriface.Orchestrator, opts ...coordinatorOption) *coordinator {
 	c := &coordinator{
 		activeInstances: make(map[string]*funcInstance),
@@ -64,10 +74,13 @@ func newCoordinator(orch *ctriface.Orchestrator, opts ...coordinatorOption) *coo
 		opt(c)
 	}
 
+	c.warmPool = newWarmPool(c.warmPoolMemMib, c.createInstance, c.orchStopVM)
+
 	return c
 }
 
-func (c *coordinator) getIdleInstance(image string) *funcInstance {
+// getIdleInstance Returns an idle instance of the image that runs in a VM with the spec
+func (c *coordinator) getIdleInstance(image string, spec ctriface.VMSpec) *funcInstance {
 	c.Lock()
 	defer c.Unlock()
 
@@ -77,10 +90,11 @@ func (c *coordinator) getIdleInstance(image string) *funcInstance {
 		return nil
 	}
 
-	if len(idles) != 0 {
-		fi := idles[0]
-		c.idleInstances[image] = idles[1:]
-		return fi
+	for i, fi := range idles {
+		if fi.vmSpec == spec {
+			c.idleInstances[image] = append(idles[:i:i], idles[i+1:]...)
+			return fi
+		}
 	}
 
 	return nil
@@ -98,13 +112,32 @@ func (c *coordinator) setIdleInstance(fi *funcInstance) {
 	c.idleInstances[fi.image] = append(c.idleInstances[fi.image], fi)
 }
 
-func (c *coordinator) startVM(ctx context.Context, image string) (*funcInstance, error) {
-	if fi := c.getIdleInstance(image); c.orch != nil && c.orch.GetSnapshotsEnabled() && fi != nil {
+// startVM Returns an instance of the image from the warm pool or creates one
+func (c *coordinator) startVM(ctx context.Context, image string, spec ctriface.VMSpec) (*funcInstance, error) {
+	if fi := c.warmPool.get(image, spec); fi != nil {
+		return fi, nil
+	}
+
+	return c.createInstance(ctx, image, spec)
+}
+
+// createInstance Loads an idle instance of the image or starts a VM for it,
+// from the snapshot of the image if there is one
+func (c *coordinator) createInstance(ctx context.Context, image string, spec ctriface.VMSpec) (*funcInstance, error) {
+	if fi := c.getIdleInstance(image, spec); c.orch != nil && c.orch.GetSnapshotsEnabled() && fi != nil {
 		err := c.orchLoadInstance(ctx, fi)
 		return fi, err
 	}
 
-	return c.orchStartVM(ctx, image)
+	if c.orch != nil && c.orch.GetSnapshotsEnabled() && !c.withoutOrchestrator {
+		if _, err := c.orch.GetSnapshot(image, spec); err == nil {
+			if fi, err := c.orchStartVMFromSnapshot(ctx, image, spec); err == nil {
+				return fi, nil
+			}
+		}
+	}
+
+	return c.orchStartVM(ctx, image, spec)
 }
 
 func (c *coordinator) stopVM(ctx context.Context, containerID string) error {
@@ -142,15 +175,15 @@ func (c *coordinator) insertActive(containerID string, fi *funcInstance) error {
 	logger := log.WithFields(log.Fields{"containerID": containerID, "vmID": fi.vmID})
 
 	if fi, present := c.activeInstances[containerID]; present {
-		logger.Errorf("entry for container already exists with vmID %s" + fi.vmID)
-		return errors.New("entry for container already exists")
+		logger.Errorf("entry for container already exists with vmID %s", fi.vmID)
+		return misc.AlreadyExistErr("entry for container " + containerID)
 	}
 
 	c.activeInstances[containerID] = fi
 	return nil
 }
 
-func (c *coordinator) orchStartVM(ctx context.Context, image string) (*funcInstance, error) {
+func (c *coordinator) orchStartVM(ctx context.Context, image string, spec ctriface.VMSpec) (*funcInstance, error) {
 	vmID := strconv.Itoa(int(atomic.AddUint64(&c.nextID, 1)))
 	logger := log.WithFields(
 		log.Fields{
@@ -170,17 +203,49 @@ func (c *coordinator) orchStartVM(ctx context.Context, image string) (*funcInsta
 	defer cancel()
 
 	if !c.withoutOrchestrator {
-		resp, _, err = c.orch.StartVM(ctxTimeout, vmID, image)
+		resp, _, err = c.orch.StartVMWithSpec(ctxTimeout, vmID, image, spec)
 		if err != nil {
 			logger.WithError(err).Error("coordinator failed to start VM")
 		}
 	}
 
-	fi := newFuncInstance(vmID, image, resp)
+	fi := newFuncInstance(vmID, image, spec, resp)
 	logger.Debug("successfully created fresh instance")
 	return fi, err
 }
 
+func (c *coordinator) orchStartVMFromSnapshot(ctx context.Context, image string, spec ctriface.VMSpec) (*funcInstance, error) {
+	vmID := strconv.Itoa(int(atomic.AddUint64(&c.nextID, 1)))
+	logger := log.WithFields(
+		log.Fields{
+			"vmID":  vmID,
+			"image": image,
+		},
+	)
+
+	logger.Debug("creating instance from snapshot")
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*40)
+	defer cancel()
+
+	resp, _, err := c.orch.StartVMFromSnapshot(ctxTimeout, vmID, image, spec)
+	if err != nil {
+		if errors.Cause(err) == ctriface.ErrNotSupported {
+			logger.Debug("cannot create instance from snapshot")
+		} else {
+			logger.WithError(err).Warn("coordinator failed to start VM from snapshot")
+		}
+		return nil, err
+	}
+
+	fi := newFuncInstance(vmID, image, spec, resp)
+	// the instance's own snapshot is a copy of the shared one
+	fi.onceCreateSnapInstance.Do(func() {})
+
+	logger.Debug("successfully created instance from snapshot")
+	return fi, nil
+}
+
 func (c *coordinator) orchLoadInstance(ctx context.Context, fi *funcInstance) error {
 	fi.logger.Debug("found idle instance to load")
 
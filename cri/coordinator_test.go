@@ -28,12 +28,15 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/taps"
 	"github.com/stretchr/testify/require"
 )
 
 func TestStartStop(t *testing.T) {
 	containerID := "1"
-	fi, err := coord.startVM(context.Background(), containerID)
+	fi, err := coord.startVM(context.Background(), containerID, ctriface.DefaultVMSpec())
 	require.NoError(t, err, "could not start VM")
 
 	err = coord.insertActive(containerID, fi)
@@ -60,7 +63,7 @@ func TestParallelStartStop(t *testing.T) {
 			defer wg.Done()
 
 			containerID := strconv.Itoa(i)
-			fi, err := coord.startVM(context.Background(), containerID)
+			fi, err := coord.startVM(context.Background(), containerID, ctriface.DefaultVMSpec())
 			require.NoError(t, err, "could not start VM")
 
 			err = coord.insertActive(containerID, fi)
@@ -79,3 +82,88 @@ func TestParallelStartStop(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestStartStopSnapshotsFakeVMM(t *testing.T) {
+	orch := ctriface.NewOrchestrator(
+		"devmapper",
+		"",
+		ctriface.WithTestModeOn(true),
+		ctriface.WithSnapshots(true),
+		ctriface.WithSnapshotsDir(t.TempDir()),
+		ctriface.WithVMM(ctriface.NewFakeVMM(ctriface.FakeVMMCfg{})),
+		ctriface.WithVMPool(misc.NewVMPoolWithTapManager(taps.NewFakeTapManager())),
+	)
+	defer func() {
+		_ = orch.StopActiveVMs()
+		orch.Cleanup()
+	}()
+
+	fakeCoord := newCoordinator(orch)
+	image := "ghcr.io/ease-lab/helloworld:var_workload"
+
+	for i := 0; i < 2; i++ {
+		containerID := strconv.Itoa(i)
+
+		fi, err := fakeCoord.startVM(context.Background(), image, ctriface.DefaultVMSpec())
+		require.NoError(t, err, "could not start VM")
+
+		err = fakeCoord.insertActive(containerID, fi)
+		require.NoError(t, err, "could not insert mapping")
+
+		// the instance is offloaded on stop and reused on the next start
+		err = fakeCoord.stopVM(context.Background(), containerID)
+		require.NoError(t, err, "could not stop VM")
+		require.Len(t, fakeCoord.idleInstances[image], 1)
+	}
+}
+
+func TestScaleOutFromSnapshotFakeVMM(t *testing.T) {
+	orch := ctriface.NewOrchestrator(
+		"devmapper",
+		"",
+		ctriface.WithTestModeOn(true),
+		ctriface.WithSnapshots(true),
+		ctriface.WithSnapshotsDir(t.TempDir()),
+		ctriface.WithVMM(ctriface.NewFakeVMM(ctriface.FakeVMMCfg{})),
+		ctriface.WithVMPool(misc.NewVMPoolWithTapManager(taps.NewFakeTapManager())),
+	)
+	defer func() {
+		_ = orch.StopActiveVMs()
+		orch.Cleanup()
+	}()
+
+	fakeCoord := newCoordinator(orch)
+	image := "ghcr.io/ease-lab/helloworld:var_workload"
+	spec := ctriface.DefaultVMSpec()
+
+	// the first instance records the snapshot when it is stopped
+	fi, err := fakeCoord.startVM(context.Background(), image, spec)
+	require.NoError(t, err, "could not start VM")
+
+	err = fakeCoord.insertActive("0", fi)
+	require.NoError(t, err, "could not insert mapping")
+
+	err = fakeCoord.stopVM(context.Background(), "0")
+	require.NoError(t, err, "could not stop VM")
+
+	_, err = orch.GetSnapshot(image, spec)
+	require.NoError(t, err, "snapshot is not in the catalog")
+
+	// the idle instance is reused first, then new instances start from the snapshot
+	vmIDs := make(map[string]bool)
+	for i := 1; i <= 3; i++ {
+		fi, err := fakeCoord.startVM(context.Background(), image, spec)
+		require.NoError(t, err, "could not start VM")
+		require.False(t, vmIDs[fi.vmID], "instance is used twice")
+		vmIDs[fi.vmID] = true
+
+		err = fakeCoord.insertActive(strconv.Itoa(i), fi)
+		require.NoError(t, err, "could not insert mapping")
+	}
+
+	for i := 1; i <= 3; i++ {
+		err = fakeCoord.stopVM(context.Background(), strconv.Itoa(i))
+		require.NoError(t, err, "could not stop VM")
+	}
+	require.Len(t, fakeCoord.idleInstances[image], 3)
+}
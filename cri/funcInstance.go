@@ -32,15 +32,17 @@ import (
 type funcInstance struct {
 	vmID                   string
 	image                  string
+	vmSpec                 ctriface.VMSpec
 	logger                 *log.Entry
 	onceCreateSnapInstance *sync.Once
 	startVMResponse        *ctriface.StartVMResponse
 }
 
-func newFuncInstance(vmID, image string, startVMResponse *ctriface.StartVMResponse) *funcInstance {
+func newFuncInstance(vmID, image string, vmSpec ctriface.VMSpec, startVMResponse *ctriface.StartVMResponse) *funcInstance {
 	f := &funcInstance{
 		vmID:                   vmID,
 		image:                  image,
+		vmSpec:                 vmSpec,
 		onceCreateSnapInstance: new(sync.Once),
 		startVMResponse:        startVMResponse,
 	}
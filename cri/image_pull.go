@@ -0,0 +1,82 @@
+// MIT License
+//
+// Copyright (c) 2020 Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+
+	"github.com/ease-lab/vhive/ctriface"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// PullImage pulls an image with authentication config.
+// The credentials are also used to pull the guest image of the pod's function
+// from the same registry, unless the registry's credentials are configured.
+func (s *Service) PullImage(ctx context.Context, r *criapi.PullImageRequest) (*criapi.PullImageResponse, error) {
+	imageName := r.GetImage().GetImage()
+	log.Debugf("PullImage %q", imageName)
+
+	if podUID := r.GetSandboxConfig().GetMetadata().GetUid(); r.GetAuth() != nil && podUID != "" {
+		registry, auth, err := getRegistryAuth(imageName, r.GetAuth())
+		if err != nil {
+			log.WithError(err).Error("invalid registry credentials")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		log.Debugf("Keeping the credentials of image %q for registry %s until pod %s creates its VM", imageName, registry, podUID)
+		s.insertPodPullAuth(podUID, registry, auth)
+	}
+
+	return s.stockImageClient.PullImage(ctx, r)
+}
+
+// getRegistryAuth Returns the registry that the credentials are for,
+// the image's registry unless the server address is set, and the credentials
+func getRegistryAuth(imageName string, authConfig *criapi.AuthConfig) (string, ctriface.RegistryAuth, error) {
+	auth := ctriface.RegistryAuth{
+		Username:      authConfig.GetUsername(),
+		Password:      authConfig.GetPassword(),
+		IdentityToken: authConfig.GetIdentityToken(),
+		RegistryToken: authConfig.GetRegistryToken(),
+	}
+
+	if basicAuth := authConfig.GetAuth(); basicAuth != "" {
+		var err error
+		if auth.Username, auth.Password, err = ctriface.DecodeBasicAuth(basicAuth); err != nil {
+			return "", auth, err
+		}
+	}
+
+	registry := authConfig.GetServerAddress()
+	if registry == "" {
+		var err error
+		if registry, err = ctriface.GetImageRegistry(imageName); err != nil {
+			return "", auth, err
+		}
+	}
+
+	return registry, auth, nil
+}
@@ -0,0 +1,62 @@
+// MIT License
+//
+// Copyright (c) 2020 Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestGetRegistryAuth(t *testing.T) {
+	registry, auth, err := getRegistryAuth("ghcr.io/ease-lab/helloworld", &criapi.AuthConfig{
+		Auth: base64.StdEncoding.EncodeToString([]byte("user:pa:ss")),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "ghcr.io", registry)
+	require.Equal(t, ctriface.RegistryAuth{Username: "user", Password: "pa:ss"}, auth)
+
+	registry, auth, err = getRegistryAuth("helloworld", &criapi.AuthConfig{
+		ServerAddress: "registry.example.com",
+		RegistryToken: "token",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "registry.example.com", registry, "Server address must take precedence")
+	require.Equal(t, "token", auth.RegistryToken)
+
+	_, _, err = getRegistryAuth("helloworld", &criapi.AuthConfig{Auth: "not base64"})
+	require.Error(t, err, "Accepted invalid credentials")
+}
+
+func TestPodPullAuths(t *testing.T) {
+	s := &Service{}
+	auth := ctriface.RegistryAuth{Username: "user", Password: "pass"}
+
+	s.insertPodPullAuth("pod1", "ghcr.io", auth)
+	require.Nil(t, s.takePodPullAuths("pod2"), "Credentials must not be shared by the pods")
+	require.Equal(t, map[string]ctriface.RegistryAuth{"ghcr.io": auth}, s.takePodPullAuths("pod1"))
+	require.Nil(t, s.takePodPullAuths("pod1"), "Credentials must be dropped once taken")
+}
@@ -120,12 +120,6 @@ func (s *Service) UpdateContainerResources(ctx context.Context, r *criapi.Update
 	return s.stockRuntimeClient.UpdateContainerResources(ctx, r)
 }
 
-// PullImage pulls an image with authentication config.
-func (s *Service) PullImage(ctx context.Context, r *criapi.PullImageRequest) (*criapi.PullImageResponse, error) {
-	log.Debugf("PullImage %q", r.GetImage().GetImage())
-	return s.stockImageClient.PullImage(ctx, r)
-}
-
 // ListImages lists existing images.
 func (s *Service) ListImages(ctx context.Context, r *criapi.ListImagesRequest) (*criapi.ListImagesResponse, error) {
 	log.Tracef("ListImages with filter %+v", r.GetFilter())
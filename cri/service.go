@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/misc"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
@@ -56,6 +57,9 @@ type Service struct {
 
 	// to store mapping from pod to guest image and port temporarily
 	podVMConfigs map[string]*VMConfig
+	// to store the credentials that a pod pulled its images with until the pod creates its VM,
+	// pod UID -> registry -> credentials
+	podPullAuths map[string]map[string]ctriface.RegistryAuth
 }
 
 // VMConfig wraps the IP and port of the guest VM
@@ -64,8 +68,23 @@ type VMConfig struct {
 	guestPort string
 }
 
+// ServiceOption Options to pass to Service
+type ServiceOption func(*serviceConfig)
+
+type serviceConfig struct {
+	warmPoolMemMib uint64
+}
+
+// WithWarmPoolMemory Sets the maximum guest memory of the instances
+// in the warm pool, unlimited if zero
+func WithWarmPoolMemory(memBudgetMib uint64) ServiceOption {
+	return func(cfg *serviceConfig) {
+		cfg.warmPoolMemMib = memBudgetMib
+	}
+}
+
 // NewService initializes the host orchestration state.
-func NewService(orch *ctriface.Orchestrator) (*Service, error) {
+func NewService(orch *ctriface.Orchestrator, opts ...ServiceOption) (*Service, error) {
 	if orch == nil {
 		return nil, errors.New("orch must be non nil")
 	}
@@ -82,12 +101,18 @@ func NewService(orch *ctriface.Orchestrator) (*Service, error) {
 		return nil, err
 	}
 
+	var cfg serviceConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	cs := &Service{
 		orch:               orch,
 		stockRuntimeClient: stockRuntimeClient,
 		stockImageClient:   stockImageClient,
-		coordinator:        newCoordinator(orch),
+		coordinator:        newCoordinator(orch, withWarmPoolMemory(cfg.warmPoolMemMib)),
 		podVMConfigs:       make(map[string]*VMConfig),
+		podPullAuths:       make(map[string]map[string]ctriface.RegistryAuth),
 	}
 
 	return cs, nil
@@ -157,8 +182,33 @@ func (s *Service) getPodVMConfig(podID string) (*VMConfig, error) {
 	vmConfig, isPresent := s.podVMConfigs[podID]
 	if !isPresent {
 		log.Errorf("VM config for pod %s does not exist", podID)
-		return nil, errors.New("VM config for pod does not exist")
+		return nil, misc.NonExistErr("VM config for pod " + podID)
 	}
 
 	return vmConfig, nil
 }
+
+func (s *Service) insertPodPullAuth(podUID, registry string, auth ctriface.RegistryAuth) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.podPullAuths == nil {
+		s.podPullAuths = make(map[string]map[string]ctriface.RegistryAuth)
+	}
+	if s.podPullAuths[podUID] == nil {
+		s.podPullAuths[podUID] = make(map[string]ctriface.RegistryAuth)
+	}
+	s.podPullAuths[podUID][registry] = auth
+}
+
+// takePodPullAuths Returns the credentials that the pod pulled its images with
+// and forgets them, so that they are not used for the pulls of other pods
+func (s *Service) takePodPullAuths(podUID string) map[string]ctriface.RegistryAuth {
+	s.Lock()
+	defer s.Unlock()
+
+	auths := s.podPullAuths[podUID]
+	delete(s.podPullAuths, podUID)
+
+	return auths
+}
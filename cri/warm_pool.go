@@ -0,0 +1,263 @@
+// MIT License
+//
+// Copyright (c) 2020 Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	log "github.com/sirupsen/logrus"
+)
+
+// warmPoolRetryDelay Time to wait before booting an instance again after a failed boot
+const warmPoolRetryDelay = 5 * time.Second
+
+// WarmPoolTarget Number of instances of an image to keep ready in the warm pool
+type WarmPoolTarget struct {
+	Image string `json:"image"`
+	// Spec Spec of the VMs of the instances, the image's spec if not set
+	Spec *ctriface.VMSpec `json:"spec,omitempty"`
+	Size int              `json:"size"`
+}
+
+// WarmPoolStats State of the warm pool of an image and a VM spec
+type WarmPoolStats struct {
+	Image   string          `json:"image"`
+	Spec    ctriface.VMSpec `json:"spec"`
+	Target  int             `json:"target"`
+	Ready   int             `json:"ready"`
+	Booting int             `json:"booting"`
+	// MemSizeMib Guest memory of the ready and the booting instances
+	MemSizeMib uint64 `json:"memSizeMib"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	Failures   uint64 `json:"failures"`
+}
+
+type warmPoolKey struct {
+	image string
+	spec  ctriface.VMSpec
+}
+
+// warmPoolEntry The instances of an image and a VM spec in the warm pool
+type warmPoolEntry struct {
+	target   int
+	ready    []*funcInstance
+	booting  int
+	hits     uint64
+	misses   uint64
+	failures uint64
+}
+
+// warmPool Keeps pre-booted, or pre-restored, instances of the images ready
+// for the coordinator to hand out. The pool is refilled in the background
+// whenever an instance is handed out, as long as the guest memory of the
+// pooled instances fits in the memory budget.
+type warmPool struct {
+	sync.Mutex
+	entries      map[warmPoolKey]*warmPoolEntry
+	memBudgetMib uint64
+	memUsedMib   uint64
+	createFn     func(ctx context.Context, image string, spec ctriface.VMSpec) (*funcInstance, error)
+	stopFn       func(ctx context.Context, fi *funcInstance) error
+}
+
+func newWarmPool(memBudgetMib uint64,
+	createFn func(ctx context.Context, image string, spec ctriface.VMSpec) (*funcInstance, error),
+	stopFn func(ctx context.Context, fi *funcInstance) error) *warmPool {
+	return &warmPool{
+		entries:      make(map[warmPoolKey]*warmPoolEntry),
+		memBudgetMib: memBudgetMib,
+		createFn:     createFn,
+		stopFn:       stopFn,
+	}
+}
+
+// setTarget Sets the number of the instances of the image to keep ready,
+// the extra instances are stopped
+func (p *warmPool) setTarget(image string, spec ctriface.VMSpec, size int) {
+	key := warmPoolKey{image: image, spec: spec}
+
+	p.Lock()
+	e := p.getEntry(key)
+	e.target = size
+
+	var extra []*funcInstance
+	if len(e.ready) > size {
+		extra = e.ready[size:]
+		e.ready = e.ready[:size:size]
+		p.memUsedMib -= uint64(len(extra)) * getMemSizeMib(spec)
+	}
+	p.Unlock()
+
+	log.WithFields(log.Fields{"image": image}).Infof("Setting the warm pool size to %d", size)
+
+	for _, fi := range extra {
+		go p.stop(fi)
+	}
+
+	p.refill(key)
+}
+
+// get Hands out a ready instance of the image, if any
+func (p *warmPool) get(image string, spec ctriface.VMSpec) *funcInstance {
+	key := warmPoolKey{image: image, spec: spec}
+
+	p.Lock()
+	e, ok := p.entries[key]
+	if !ok || e.target == 0 {
+		p.Unlock()
+		return nil
+	}
+
+	if len(e.ready) == 0 {
+		e.misses++
+		p.Unlock()
+		return nil
+	}
+
+	fi := e.ready[0]
+	e.ready = e.ready[1:]
+	e.hits++
+	p.memUsedMib -= getMemSizeMib(spec)
+	p.Unlock()
+
+	fi.logger.Debug("Handing out instance from the warm pool")
+
+	p.refill(key)
+
+	return fi
+}
+
+// refill Boots instances in the background until the pool reaches the target
+// or the memory budget
+func (p *warmPool) refill(key warmPoolKey) {
+	memSizeMib := getMemSizeMib(key.spec)
+
+	p.Lock()
+	defer p.Unlock()
+
+	e := p.getEntry(key)
+	for len(e.ready)+e.booting < e.target {
+		if p.memBudgetMib > 0 && p.memUsedMib+memSizeMib > p.memBudgetMib {
+			log.WithFields(log.Fields{"image": key.image}).Debugf(
+				"Warm pool uses %d of %d MiB, not booting more instances", p.memUsedMib, p.memBudgetMib)
+			return
+		}
+
+		e.booting++
+		p.memUsedMib += memSizeMib
+
+		go p.boot(key)
+	}
+}
+
+// boot Boots an instance and adds it to the pool
+func (p *warmPool) boot(key warmPoolKey) {
+	fi, err := p.createFn(context.Background(), key.image, key.spec)
+
+	p.Lock()
+	e := p.getEntry(key)
+	e.booting--
+
+	if err != nil {
+		e.failures++
+		p.memUsedMib -= getMemSizeMib(key.spec)
+		p.Unlock()
+
+		log.WithFields(log.Fields{"image": key.image}).WithError(err).Errorf(
+			"Failed to boot instance for the warm pool, retrying in %s", warmPoolRetryDelay)
+		time.AfterFunc(warmPoolRetryDelay, func() { p.refill(key) })
+
+		return
+	}
+
+	if len(e.ready) >= e.target {
+		// The target was lowered during the boot
+		p.memUsedMib -= getMemSizeMib(key.spec)
+		p.Unlock()
+
+		p.stop(fi)
+
+		return
+	}
+
+	e.ready = append(e.ready, fi)
+	p.Unlock()
+
+	fi.logger.Debug("Added instance to the warm pool")
+}
+
+func (p *warmPool) stop(fi *funcInstance) {
+	if err := p.stopFn(context.Background(), fi); err != nil {
+		fi.logger.WithError(err).Error("Failed to stop instance of the warm pool")
+	}
+}
+
+// getStats Returns the state of the pools, sorted by image
+func (p *warmPool) getStats() []WarmPoolStats {
+	p.Lock()
+	defer p.Unlock()
+
+	stats := make([]WarmPoolStats, 0, len(p.entries))
+	for key, e := range p.entries {
+		stats = append(stats, WarmPoolStats{
+			Image:      key.image,
+			Spec:       key.spec,
+			Target:     e.target,
+			Ready:      len(e.ready),
+			Booting:    e.booting,
+			MemSizeMib: uint64(len(e.ready)+e.booting) * getMemSizeMib(key.spec),
+			Hits:       e.hits,
+			Misses:     e.misses,
+			Failures:   e.failures,
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Image != stats[j].Image {
+			return stats[i].Image < stats[j].Image
+		}
+		return stats[i].Spec.MemSizeMib < stats[j].Spec.MemSizeMib
+	})
+
+	return stats
+}
+
+// getEntry Returns the entry of the pool, the caller must hold the lock
+func (p *warmPool) getEntry(key warmPoolKey) *warmPoolEntry {
+	e, ok := p.entries[key]
+	if !ok {
+		e = new(warmPoolEntry)
+		p.entries[key] = e
+	}
+
+	return e
+}
+
+func getMemSizeMib(spec ctriface.VMSpec) uint64 {
+	return uint64(spec.WithDefaults().MemSizeMib)
+}
@@ -0,0 +1,103 @@
+// MIT License
+//
+// Copyright (c) 2020 Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// SetWarmPoolTarget Sets the number of the instances of the image to keep ready.
+// The instances are handed out to the user containers whose VM spec matches
+// the spec of the target.
+func (s *Service) SetWarmPoolTarget(target WarmPoolTarget) error {
+	if target.Image == "" {
+		return errors.New("warm pool target must have an image")
+	}
+
+	if target.Size < 0 {
+		return errors.Errorf("invalid warm pool size %d", target.Size)
+	}
+
+	spec := s.orch.GetVMSpec(target.Image)
+	if target.Spec != nil {
+		spec = target.Spec.WithDefaults()
+	}
+
+	s.coordinator.warmPool.setTarget(target.Image, spec, target.Size)
+
+	return nil
+}
+
+// GetWarmPoolStats Returns the state of the warm pool
+func (s *Service) GetWarmPoolStats() []WarmPoolStats {
+	return s.coordinator.warmPool.getStats()
+}
+
+// LoadWarmPoolTargets Reads the warm pool targets from a JSON file
+func LoadWarmPoolTargets(path string) ([]WarmPoolTarget, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read warm pool file")
+	}
+
+	var targets []WarmPoolTarget
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, errors.Wrap(err, "failed to parse warm pool file")
+	}
+
+	return targets, nil
+}
+
+// WarmPoolHandler Returns an HTTP handler that returns the state of the warm pool
+// on GET and sets the target that is in the JSON body of a PUT or a POST
+func (s *Service) WarmPoolHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var target WarmPoolTarget
+			if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+				http.Error(w, "invalid warm pool target: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := s.SetWarmPoolTarget(target); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.GetWarmPoolStats()); err != nil {
+			log.WithError(err).Error("failed to write warm pool stats")
+		}
+	})
+}
@@ -0,0 +1,152 @@
+// MIT License
+//
+// Copyright (c) 2020 Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/taps"
+	"github.com/stretchr/testify/require"
+)
+
+const testWarmPoolImage = "ghcr.io/ease-lab/helloworld:var_workload"
+
+func requireWarmPool(t *testing.T, p *warmPool, ready, booting int) {
+	require.Eventually(t, func() bool {
+		stats := p.getStats()
+		return len(stats) == 1 && stats[0].Ready == ready && stats[0].Booting == booting
+	}, time.Second, time.Millisecond, "Warm pool must have %d ready and %d booting instances", ready, booting)
+}
+
+func TestWarmPool(t *testing.T) {
+	c := newCoordinator(nil, withoutOrchestrator())
+	spec := ctriface.DefaultVMSpec()
+
+	fi, err := c.startVM(context.Background(), testWarmPoolImage, spec)
+	require.NoError(t, err, "could not start VM")
+	require.Empty(t, c.warmPool.getStats(), "Images without a target must not be pooled")
+
+	c.warmPool.setTarget(testWarmPoolImage, spec, 2)
+	requireWarmPool(t, c.warmPool, 2, 0)
+
+	pooled := c.warmPool.getStats()
+	fi, err = c.startVM(context.Background(), testWarmPoolImage, spec)
+	require.NoError(t, err, "could not start VM")
+	require.Contains(t, []string{"2", "3"}, fi.vmID, "Instance must come from the warm pool")
+	require.Equal(t, uint64(2*spec.MemSizeMib), pooled[0].MemSizeMib)
+
+	requireWarmPool(t, c.warmPool, 2, 0)
+	require.Equal(t, uint64(1), c.warmPool.getStats()[0].Hits)
+
+	c.warmPool.setTarget(testWarmPoolImage, spec, 0)
+	requireWarmPool(t, c.warmPool, 0, 0)
+	require.Zero(t, c.warmPool.memUsedMib)
+}
+
+func TestWarmPoolMemoryBudget(t *testing.T) {
+	spec := ctriface.DefaultVMSpec()
+	c := newCoordinator(nil, withoutOrchestrator(), withWarmPoolMemory(uint64(3*spec.MemSizeMib/2)))
+
+	c.warmPool.setTarget(testWarmPoolImage, spec, 3)
+	requireWarmPool(t, c.warmPool, 1, 0)
+
+	_, err := c.startVM(context.Background(), testWarmPoolImage, spec)
+	require.NoError(t, err, "could not start VM")
+	requireWarmPool(t, c.warmPool, 1, 0)
+	require.Equal(t, uint64(spec.MemSizeMib), c.warmPool.memUsedMib, "Handed out instances must not count against the budget")
+}
+
+func TestWarmPoolFailure(t *testing.T) {
+	var numBoots int64
+
+	p := newWarmPool(0,
+		func(ctx context.Context, image string, spec ctriface.VMSpec) (*funcInstance, error) {
+			atomic.AddInt64(&numBoots, 1)
+			return nil, errors.New("injected")
+		},
+		func(ctx context.Context, fi *funcInstance) error { return nil },
+	)
+
+	p.setTarget(testWarmPoolImage, ctriface.DefaultVMSpec(), 1)
+	require.Eventually(t, func() bool {
+		return p.getStats()[0].Failures == 1
+	}, time.Second, time.Millisecond, "Boot must fail")
+
+	requireWarmPool(t, p, 0, 0)
+	require.Nil(t, p.get(testWarmPoolImage, ctriface.DefaultVMSpec()))
+	require.Equal(t, uint64(1), p.getStats()[0].Misses)
+	require.Zero(t, p.memUsedMib)
+}
+
+func TestWarmPoolFakeVMM(t *testing.T) {
+	orch := ctriface.NewOrchestrator(
+		"devmapper",
+		"",
+		ctriface.WithTestModeOn(true),
+		ctriface.WithSnapshotsDir(t.TempDir()),
+		ctriface.WithVMM(ctriface.NewFakeVMM(ctriface.FakeVMMCfg{})),
+		ctriface.WithVMPool(misc.NewVMPoolWithTapManager(taps.NewFakeTapManager())),
+	)
+	defer func() {
+		_ = orch.StopActiveVMs()
+		orch.Cleanup()
+	}()
+
+	s := &Service{orch: orch, coordinator: newCoordinator(orch)}
+	handler := s.WarmPoolHandler()
+
+	req := httptest.NewRequest(http.MethodPut, "/warmpool", strings.NewReader(`{"image": "`+testWarmPoolImage+`", "size": 2}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	requireWarmPool(t, s.coordinator.warmPool, 2, 0)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/warmpool", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var stats []WarmPoolStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.Len(t, stats, 1)
+	require.Equal(t, 2, stats[0].Target)
+	require.Equal(t, orch.GetVMSpec(testWarmPoolImage), stats[0].Spec)
+
+	fi, err := s.coordinator.startVM(context.Background(), testWarmPoolImage, orch.GetVMSpec(testWarmPoolImage))
+	require.NoError(t, err, "could not start VM")
+	require.NotEmpty(t, fi.startVMResponse.GuestIP, "Pooled instance must be booted")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/warmpool", strings.NewReader(`{"size": 1}`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code, "Accepted a target without an image")
+}
@@ -24,27 +24,14 @@ package ctriface
 
 import (
 	"context"
-	"fmt"
-	"net"
-	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/containerd/containerd"
-	"github.com/containerd/containerd/cio"
-	"github.com/containerd/containerd/namespaces"
-	"github.com/containerd/containerd/oci"
-	"github.com/containerd/containerd/remotes/docker"
-
-	"github.com/firecracker-microvm/firecracker-containerd/proto" // note: from the original repo
-	"github.com/firecracker-microvm/firecracker-containerd/runtime/firecrackeroci"
 	"github.com/pkg/errors"
 
 	_ "google.golang.org/grpc/codes"  //tmp
@@ -53,6 +40,8 @@ import (
 	"github.com/ease-lab/vhive/memory/manager"
 	"github.com/ease-lab/vhive/metrics"
 	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/taps"
+	"github.com/ease-lab/vhive/tracing"
 	"github.com/go-multierror/multierror"
 
 	_ "github.com/davecgh/go-spew/spew" //tmp
@@ -69,15 +58,24 @@ const (
 	testImageName = "ghcr.io/ease-lab/helloworld:var_workload"
 )
 
-// StartVM Boots a VM if it does not exist
-func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
+// StartVM Boots a VM if it does not exist, using the VM spec configured for the image
+func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (*StartVMResponse, *metrics.Metric, error) {
+	return o.StartVMWithSpec(ctx, vmID, imageName, o.GetVMSpec(imageName))
+}
+
+// StartVMWithSpec Boots a VM with the given resources if it does not exist
+func (o *Orchestrator) StartVMWithSpec(ctx context.Context, vmID, imageName string, spec VMSpec) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
 	var (
 		startVMMetric *metrics.Metric = metrics.NewMetric()
-		tStart        time.Time
 	)
 
+	spec = spec.WithDefaults()
+
+	ctx, span := tracing.StartSpan(ctx, "Orchestrator.StartVM", tracing.VMIDKey.String(vmID), tracing.ImageKey.String(imageName))
+	defer func() { tracing.EndSpan(span, retErr) }()
+
 	logger := log.WithFields(log.Fields{"vmID": vmID, "image": imageName})
-	logger.Debug("StartVM: Received StartVM")
+	logger.Debugf("StartVM: Received StartVM with %d vCPUs and %d MiB of memory", spec.VcpuCount, spec.MemSizeMib)
 
 	vm, err := o.vmPool.Allocate(vmID, o.hostIface)
 	if err != nil {
@@ -94,260 +92,235 @@ func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (_ *
 		}
 	}()
 
-	ctx = namespaces.WithNamespace(ctx, namespaceName)
-	tStart = time.Now()
-	if vm.Image, err = o.getImage(ctx, imageName); err != nil {
-		return nil, nil, errors.Wrapf(err, "Failed to get/pull image")
-	}
-	startVMMetric.MetricMap[metrics.GetImage] = metrics.ToUS(time.Since(tStart))
-
-	tStart = time.Now()
-	conf := o.getVMConfig(vm)
-	resp, err := o.fcClient.CreateVM(ctx, conf)
-	startVMMetric.MetricMap[metrics.FcCreateVM] = metrics.ToUS(time.Since(tStart))
+	resp, err := o.vmm.CreateVM(ctx, vm, imageName, spec, startVMMetric)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to create the microVM in firecracker-containerd")
+		return nil, nil, misc.NewVMMErr(ctx, "create", vmID, err)
 	}
 
 	defer func() {
 		if retErr != nil {
-			if _, err := o.fcClient.StopVM(ctx, &proto.StopVMRequest{VMID: vmID}); err != nil {
-				logger.WithError(err).Errorf("failed to stop firecracker-containerd VM after failure")
+			if err := o.vmm.StopVM(ctx, vm, 0, metrics.NewMetric()); err != nil {
+				logger.WithError(err).Errorf("failed to stop VM after failure")
 			}
 		}
 	}()
 
-	logger.Debug("StartVM: Creating a new container")
-	tStart = time.Now()
-	container, err := o.client.NewContainer(
-		ctx,
-		vmID,
-		containerd.WithSnapshotter(o.snapshotter),
-		containerd.WithNewSnapshot(vmID, *vm.Image),
-		containerd.WithNewSpec(
-			oci.WithImageConfig(*vm.Image),
-			firecrackeroci.WithVMID(vmID),
-			firecrackeroci.WithVMNetwork,
-		),
-		containerd.WithRuntime("aws.firecracker", nil),
+	// The new VM replaces the snapshot of an earlier VM with the same ID
+	if err := os.RemoveAll(o.getVMBaseDir(vmID)); err != nil {
+		logger.Error("Failed to remove the snapshot of an earlier VM")
+		return nil, nil, err
+	}
+
+	if err := os.MkdirAll(o.getVMBaseDir(vmID), 0777); err != nil {
+		logger.Error("Failed to create VM base dir")
+		return nil, nil, err
+	}
+	if o.GetUPFEnabled() {
+		logger.Debug("Registering VM with the memory manager")
+
+		stateCfg := o.getSnapshotStateCfg(vmID, resp.MemSizeMib, resp.UPFSockPath, imageName, spec)
+		if err := o.memoryManager.RegisterVM(stateCfg); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to register VM with memory manager")
+			// NOTE (Plamen): Potentially need a defer(DeregisteVM) here if RegisterVM is not last to execute
+		}
+	}
+
+	o.vmConfigs.Store(vmID, &vmConfig{
+		imageName:   imageName,
+		imageDigest: resp.ImageDigest,
+		spec:        spec,
+	})
+
+	o.setVMState(vmID, VMRunning)
+
+	logger.Debug("Successfully started a VM")
+
+	return &StartVMResponse{GuestIP: vm.Ni.PrimaryAddress}, startVMMetric, nil
+}
+
+// StartVMFromSnapshot Starts a new VM from the shared snapshot of the image and the spec.
+// The VM gets its own network interface and copy-on-write copies of the snapshot files,
+// so that many VMs can be started from one snapshot.
+func (o *Orchestrator) StartVMFromSnapshot(ctx context.Context, vmID, imageName string, spec VMSpec) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
+	var (
+		startVMMetric *metrics.Metric = metrics.NewMetric()
+		tStart        time.Time
 	)
-	startVMMetric.MetricMap[metrics.NewContainer] = metrics.ToUS(time.Since(tStart))
-	vm.Container = &container
+
+	spec = spec.WithDefaults()
+
+	ctx, span := tracing.StartSpan(ctx, "Orchestrator.StartVMFromSnapshot", tracing.VMIDKey.String(vmID), tracing.ImageKey.String(imageName))
+	defer func() { tracing.EndSpan(span, retErr) }()
+
+	logger := log.WithFields(log.Fields{"vmID": vmID, "image": imageName})
+	logger.Debug("Orchestrator received StartVMFromSnapshot")
+
+	info, err := o.GetSnapshot(imageName, spec)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to create a container")
+		return nil, nil, err
 	}
 
-	defer func() {
-		if retErr != nil {
-			if err := container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
-				logger.WithError(err).Errorf("failed to delete container after failure")
-			}
+	// The VM gets the network interface of the guest in the snapshot, unless the interface
+	// is taken, e.g., by the VM that the snapshot was taken of. Otherwise, the VM gets
+	// a new network interface, which is connected to the guest when the snapshot is loaded.
+	var vm *misc.VM
+	if info.Network != nil {
+		vm, err = o.vmPool.AllocateWithNetwork(vmID, o.hostIface, info.Network)
+		if err != nil {
+			logger.WithError(err).Debug("Failed to allocate VM with the network interface of the snapshot")
 		}
-	}()
+	}
 
-	iologger := NewWorkloadIoWriter(vmID)
-	o.workloadIo.Store(vmID, &iologger)
-	logger.Debug("StartVM: Creating a new task")
-	tStart = time.Now()
-	task, err := container.NewTask(ctx, cio.NewCreator(cio.WithStreams(os.Stdin, iologger, iologger)))
-	startVMMetric.MetricMap[metrics.NewTask] = metrics.ToUS(time.Since(tStart))
-	vm.Task = &task
-	if err != nil {
-		return nil, nil, errors.Wrapf(err, "failed to create a task")
+	if vm == nil {
+		vm, err = o.vmPool.Allocate(vmID, o.hostIface)
+		if err != nil {
+			logger.Error("failed to allocate VM in VM pool")
+			return nil, nil, err
+		}
+	}
+
+	var guestNi *taps.NetworkInterface
+	if info.Network != nil && info.Network.PrimaryAddress != vm.Ni.PrimaryAddress {
+		guestNi = info.Network
 	}
 
 	defer func() {
 		if retErr != nil {
-			if _, err := task.Delete(ctx); err != nil {
-				logger.WithError(err).Errorf("failed to delete task after failure")
+			if err := o.vmPool.Free(vmID); err != nil {
+				logger.WithError(err).Errorf("failed to free VM from pool after failure")
 			}
 		}
 	}()
 
-	logger.Debug("StartVM: Waiting for the task to get ready")
 	tStart = time.Now()
-	ch, err := task.Wait(ctx)
-	startVMMetric.MetricMap[metrics.TaskWait] = metrics.ToUS(time.Since(tStart))
-	vm.TaskCh = ch
+	_, phaseSpan := tracing.StartSpan(ctx, metrics.FcCreateVM)
+	resp, err := o.vmm.CreateVMForSnapshot(ctx, vm, imageName, spec)
+	tracing.EndSpan(phaseSpan, err)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to wait for a task")
+		if errors.Cause(err) == ErrNotSupported {
+			return nil, nil, err
+		}
+		return nil, nil, misc.NewVMMErr(ctx, "create", vmID, err)
 	}
+	startVMMetric.MetricMap[metrics.FcCreateVM] = metrics.ToUS(time.Since(tStart))
 
 	defer func() {
 		if retErr != nil {
-			if err := task.Kill(ctx, syscall.SIGKILL); err != nil {
-				logger.WithError(err).Errorf("failed to kill task after failure")
+			if err := o.vmm.StopVM(ctx, vm, 0, metrics.NewMetric()); err != nil {
+				logger.WithError(err).Errorf("failed to stop VM after failure")
 			}
 		}
 	}()
 
-	logger.Debug("StartVM: Starting the task")
-	tStart = time.Now()
-	if err := task.Start(ctx); err != nil {
-		return nil, nil, errors.Wrap(err, "failed to start a task")
-	}
-	startVMMetric.MetricMap[metrics.TaskStart] = metrics.ToUS(time.Since(tStart))
+	// Registered before copying the snapshot, so that the snapshot is not evicted meanwhile
+	o.vmConfigs.Store(vmID, &vmConfig{
+		imageName:   imageName,
+		imageDigest: info.ImageDigest,
+		spec:        spec,
+		snapshotID:  info.ID,
+		guestNi:     guestNi,
+	})
 
 	defer func() {
 		if retErr != nil {
-			if err := task.Kill(ctx, syscall.SIGKILL); err != nil {
-				logger.WithError(err).Errorf("failed to kill task after failure")
-			}
+			o.vmConfigs.Delete(vmID)
+			o.vmStates.Delete(vmID)
 		}
 	}()
 
-	if err := os.MkdirAll(o.getVMBaseDir(vmID), 0777); err != nil {
-		logger.Error("Failed to create VM base dir")
+	if err := os.RemoveAll(o.getVMBaseDir(vmID)); err != nil {
+		logger.Error("Failed to remove the snapshot of an earlier VM")
 		return nil, nil, err
 	}
+
+	tStart = time.Now()
+	_, phaseSpan = tracing.StartSpan(ctx, metrics.CloneSnapshot)
+	err = o.snapshots.cloneTo(info.ID, o.getVMBaseDir(vmID))
+	tracing.EndSpan(phaseSpan, err)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to copy the snapshot")
+	}
+	startVMMetric.MetricMap[metrics.CloneSnapshot] = metrics.ToUS(time.Since(tStart))
+
 	if o.GetUPFEnabled() {
 		logger.Debug("Registering VM with the memory manager")
 
-		stateCfg := manager.SnapshotStateCfg{
-			VMID:             vmID,
-			GuestMemPath:     o.getMemoryFile(vmID),
-			BaseDir:          o.getVMBaseDir(vmID),
-			GuestMemSize:     int(conf.MachineCfg.MemSizeMib) * 1024 * 1024,
-			IsLazyMode:       o.isLazyMode,
-			VMMStatePath:     o.getSnapshotFile(vmID),
-			WorkingSetPath:   o.getWorkingSetFile(vmID),
-			InstanceSockAddr: resp.UPFSockPath,
-		}
+		stateCfg := o.getSnapshotStateCfg(vmID, resp.MemSizeMib, resp.UPFSockPath, imageName, spec)
 		if err := o.memoryManager.RegisterVM(stateCfg); err != nil {
 			return nil, nil, errors.Wrap(err, "failed to register VM with memory manager")
-			// NOTE (Plamen): Potentially need a defer(DeregisteVM) here if RegisterVM is not last to execute
 		}
-	}
-
-	logger.Debug("Successfully started a VM")
-
-	return &StartVMResponse{GuestIP: vm.Ni.PrimaryAddress}, startVMMetric, nil
-}
-
-// StopSingleVM Shuts down a VM
-// Note: VMs are not quisced before being stopped
-func (o *Orchestrator) StopSingleVM(ctx context.Context, vmID string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
-	logger.Debug("Orchestrator received StopVM")
-
-	ctx = namespaces.WithNamespace(ctx, namespaceName)
-	vm, err := o.vmPool.GetVM(vmID)
-	if err != nil {
-		if _, ok := err.(*misc.NonExistErr); ok {
-			logger.Panic("StopVM: VM does not exist")
-		}
-		logger.Panic("StopVM: GetVM() failed for an unknown reason")
-
-	}
-
-	logger = log.WithFields(log.Fields{"vmID": vmID})
-
-	task := *vm.Task
-	if err := task.Kill(ctx, syscall.SIGKILL); err != nil {
-		logger.WithError(err).Error("Failed to kill the task")
-		return err
-	}
 
-	<-vm.TaskCh
-	//FIXME: Seems like some tasks need some extra time to die Issue#15, lr_training
-	time.Sleep(500 * time.Millisecond)
-
-	if _, err := task.Delete(ctx); err != nil {
-		logger.WithError(err).Error("failed to delete task")
-		return err
+		defer func() {
+			if retErr != nil {
+				if err := o.memoryManager.DeregisterVM(vmID); err != nil {
+					logger.WithError(err).Errorf("failed to deregister VM from memory manager after failure")
+				}
+			}
+		}()
 	}
 
-	container := *vm.Container
-	if err := container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
-		logger.WithError(err).Error("failed to delete container")
-		return err
+	loadMetric, err := o.LoadSnapshot(ctx, vmID)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if _, err := o.fcClient.StopVM(ctx, &proto.StopVMRequest{VMID: vmID}); err != nil {
-		logger.WithError(err).Error("failed to stop firecracker-containerd VM")
-		return err
+	resumeMetric, err := o.ResumeVM(ctx, vmID)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if err := o.vmPool.Free(vmID); err != nil {
-		logger.Error("failed to free VM from VM pool")
-		return err
+	for _, m := range []*metrics.Metric{loadMetric, resumeMetric} {
+		for k, v := range m.MetricMap {
+			startVMMetric.MetricMap[k] = v
+		}
 	}
 
-	o.workloadIo.Delete(vmID)
+	logger.Debugf("Successfully started a VM from snapshot %s", info.ID)
 
-	logger.Debug("Stopped VM successfully")
+	return &StartVMResponse{GuestIP: vm.Ni.PrimaryAddress}, startVMMetric, nil
+}
 
-	return nil
+// StopSingleVM Shuts down a VM gracefully, see StopVM
+func (o *Orchestrator) StopSingleVM(ctx context.Context, vmID string) error {
+	_, err := o.StopVM(ctx, vmID)
+	return err
 }
 
-// Checks whether a URL has a .local domain
-func isLocalDomain(s string) (bool, error) {
-	if !strings.Contains(s, "://") {
-		s = "dummy://" + s
-	}
+// StopVM Shuts down a VM. The function in the VM is asked to terminate (SIGTERM)
+// and is killed (SIGKILL) if it does not exit within the orchestrator's stop timeout.
+// Returns the latency of each of the stop phases.
+func (o *Orchestrator) StopVM(ctx context.Context, vmID string) (*metrics.Metric, error) {
+	var (
+		stopVMMetric *metrics.Metric = metrics.NewMetric()
+	)
 
-	u, err := url.Parse(s)
-	if err != nil {
-		return false, err
-	}
+	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger.Debug("Orchestrator received StopVM")
 
-	host, _, err := net.SplitHostPort(u.Host)
+	vm, err := o.vmPool.GetVM(vmID)
 	if err != nil {
-		host = u.Host
+		return nil, err
 	}
 
-	i := strings.LastIndex(host, ".")
-	tld := host[i+1:]
-
-	return tld == "local", nil
-}
+	if err := o.vmm.StopVM(ctx, vm, o.stopTimeout, stopVMMetric); err != nil {
+		return nil, misc.NewVMMErr(ctx, "stop", vmID, err)
+	}
 
-// Converts an image name to a url if it is not a URL
-func getImageURL(image string) string {
-	// Pull from dockerhub by default if not specified (default k8s behavior)
-	if strings.Contains(image, ".") {
-		return image
+	if err := o.vmPool.Free(vmID); err != nil {
+		logger.Error("failed to free VM from VM pool")
+		return nil, err
 	}
-	return "docker.io/" + image
 
-}
+	o.vmConfigs.Delete(vmID)
+	o.vmStates.Delete(vmID)
 
-func (o *Orchestrator) getImage(ctx context.Context, imageName string) (*containerd.Image, error) {
-	image, found := o.cachedImages[imageName]
-	if !found {
-		var err error
-		log.Debug(fmt.Sprintf("Pulling image %s", imageName))
-
-		imageURL := getImageURL(imageName)
-		local, _ := isLocalDomain(imageURL)
-		if local {
-			// Pull local image using HTTP
-			resolver := docker.NewResolver(docker.ResolverOptions{
-				Client: http.DefaultClient,
-				Hosts: docker.ConfigureDefaultRegistries(
-					docker.WithPlainHTTP(docker.MatchAllHosts),
-				),
-			})
-			image, err = o.client.Pull(ctx, imageURL,
-				containerd.WithPullUnpack,
-				containerd.WithPullSnapshotter(o.snapshotter),
-				containerd.WithResolver(resolver),
-			)
-		} else {
-			// Pull remote image
-			image, err = o.client.Pull(ctx, imageURL,
-				containerd.WithPullUnpack,
-				containerd.WithPullSnapshotter(o.snapshotter),
-			)
-		}
-
-		if err != nil {
-			return &image, err
-		}
-		o.cachedImages[imageName] = image
+	if err := os.RemoveAll(o.getVMBaseDir(vmID)); err != nil {
+		logger.WithError(err).Warn("failed to remove the snapshot of the VM")
 	}
 
-	return &image, nil
+	logger.Debug("Stopped VM successfully")
+
+	return stopVMMetric, nil
 }
 
 func getK8sDNS() []string {
@@ -368,31 +341,6 @@ func getK8sDNS() []string {
 	return dnsIPs
 }
 
-func (o *Orchestrator) getVMConfig(vm *misc.VM) *proto.CreateVMRequest {
-	kernelArgs := "ro noapic reboot=k panic=1 pci=off nomodules systemd.log_color=false systemd.unit=firecracker.target init=/sbin/overlay-init tsc=reliable quiet 8250.nr_uarts=0 ipv6.disable=1"
-
-	return &proto.CreateVMRequest{
-		VMID:           vm.ID,
-		TimeoutSeconds: 100,
-		KernelArgs:     kernelArgs,
-		MachineCfg: &proto.FirecrackerMachineConfiguration{
-			VcpuCount:  1,
-			MemSizeMib: 256,
-		},
-		NetworkInterfaces: []*proto.FirecrackerNetworkInterface{{
-			StaticConfig: &proto.StaticNetworkConfiguration{
-				MacAddress:  vm.Ni.MacAddress,
-				HostDevName: vm.Ni.HostDevName,
-				IPConfig: &proto.IPConfiguration{
-					PrimaryAddr: vm.Ni.PrimaryAddress + vm.Ni.Subnet,
-					GatewayAddr: vm.Ni.GatewayAddress,
-					Nameservers: getK8sDNS(),
-				},
-			},
-		}},
-	}
-}
-
 // StopActiveVMs Shuts down all active VMs
 func (o *Orchestrator) StopActiveVMs() error {
 	var vmGroup sync.WaitGroup
@@ -412,12 +360,7 @@ func (o *Orchestrator) StopActiveVMs() error {
 	vmGroup.Wait()
 	log.Info("waiting done")
 
-	log.Info("Closing fcClient")
-	o.fcClient.Close()
-	log.Info("Closing containerd client")
-	o.client.Close()
-
-	return nil
+	return o.vmm.Close()
 }
 
 // PauseVM Pauses a VM
@@ -425,35 +368,38 @@ func (o *Orchestrator) PauseVM(ctx context.Context, vmID string) error {
 	logger := log.WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received PauseVM")
 
-	ctx = namespaces.WithNamespace(ctx, namespaceName)
-
-	if _, err := o.fcClient.PauseVM(ctx, &proto.PauseVMRequest{VMID: vmID}); err != nil {
+	if err := o.vmm.PauseVM(ctx, vmID); err != nil {
 		logger.WithError(err).Error("failed to pause the VM")
-		return err
+		return misc.NewVMMErr(ctx, "pause", vmID, err)
 	}
 
+	o.setVMState(vmID, VMPaused)
+
 	return nil
 }
 
 // ResumeVM Resumes a VM
-func (o *Orchestrator) ResumeVM(ctx context.Context, vmID string) (*metrics.Metric, error) {
+func (o *Orchestrator) ResumeVM(ctx context.Context, vmID string) (_ *metrics.Metric, retErr error) {
 	var (
 		resumeVMMetric *metrics.Metric = metrics.NewMetric()
 		tStart         time.Time
 	)
 
+	ctx, span := tracing.StartSpan(ctx, "Orchestrator.ResumeVM", tracing.VMIDKey.String(vmID))
+	defer func() { tracing.EndSpan(span, retErr) }()
+
 	logger := log.WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received ResumeVM")
 
-	ctx = namespaces.WithNamespace(ctx, namespaceName)
-
 	tStart = time.Now()
-	if _, err := o.fcClient.ResumeVM(ctx, &proto.ResumeVMRequest{VMID: vmID}); err != nil {
+	if err := o.vmm.ResumeVM(ctx, vmID); err != nil {
 		logger.WithError(err).Error("failed to resume the VM")
-		return nil, err
+		return nil, misc.NewVMMErr(ctx, "resume", vmID, err)
 	}
 	resumeVMMetric.MetricMap[metrics.FcResume] = metrics.ToUS(time.Since(tStart))
 
+	o.setVMState(vmID, VMRunning)
+
 	return resumeVMMetric, nil
 }
 
@@ -462,24 +408,53 @@ func (o *Orchestrator) CreateSnapshot(ctx context.Context, vmID string) error {
 	logger := log.WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received CreateSnapshot")
 
-	ctx = namespaces.WithNamespace(ctx, namespaceName)
+	if err := o.vmm.CreateSnapshot(ctx, vmID, o.getSnapshotFile(vmID), o.getMemoryFile(vmID)); err != nil {
+		logger.WithError(err).Error("failed to create snapshot of the VM")
+		return misc.NewVMMErr(ctx, "snapshot", vmID, err)
+	}
 
-	req := &proto.CreateSnapshotRequest{
-		VMID:             vmID,
-		SnapshotFilePath: o.getSnapshotFile(vmID),
-		MemFilePath:      o.getMemoryFile(vmID),
+	cfgValue, ok := o.vmConfigs.Load(vmID)
+	if !ok {
+		return nil
 	}
+	cfg := cfgValue.(*vmConfig)
 
-	if _, err := o.fcClient.CreateSnapshot(ctx, req); err != nil {
-		logger.WithError(err).Error("failed to create snapshot of the VM")
+	// The first snapshot of the image and the spec is shared with the VMs started later
+	info := &SnapshotInfo{
+		ID:          getSnapshotID(cfg.imageName, cfg.spec),
+		VMID:        vmID,
+		ImageName:   cfg.imageName,
+		ImageDigest: cfg.imageDigest,
+		VMSpec:      cfg.spec,
+		Network:     cfg.guestNi,
+		CreatedAt:   time.Now(),
+	}
+
+	if info.Network == nil {
+		if vm, err := o.vmPool.GetVM(vmID); err == nil {
+			info.Network = vm.Ni
+		}
+	}
+
+	isPublished, err := o.snapshots.publish(info, o.getVMBaseDir(vmID))
+	if err != nil {
+		logger.WithError(err).Error("failed to add the snapshot to the catalog")
 		return err
 	}
 
+	cfg.snapshotID = ""
+	if isPublished {
+		logger.Debugf("Added snapshot %s to the catalog", info.ID)
+		cfg.snapshotID = info.ID
+	}
+
+	o.collectSnapshots()
+
 	return nil
 }
 
 // LoadSnapshot Loads a snapshot of a VM
-func (o *Orchestrator) LoadSnapshot(ctx context.Context, vmID string) (*metrics.Metric, error) {
+func (o *Orchestrator) LoadSnapshot(ctx context.Context, vmID string) (_ *metrics.Metric, retErr error) {
 	var (
 		loadSnapshotMetric   *metrics.Metric = metrics.NewMetric()
 		tStart               time.Time
@@ -487,20 +462,24 @@ func (o *Orchestrator) LoadSnapshot(ctx context.Context, vmID string) (*metrics.
 		loadDone             = make(chan int)
 	)
 
+	ctx, span := tracing.StartSpan(ctx, "Orchestrator.LoadSnapshot", tracing.VMIDKey.String(vmID))
+	defer func() { tracing.EndSpan(span, retErr) }()
+
 	logger := log.WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received LoadSnapshot")
 
-	ctx = namespaces.WithNamespace(ctx, namespaceName)
-
-	req := &proto.LoadSnapshotRequest{
-		VMID:             vmID,
-		SnapshotFilePath: o.getSnapshotFile(vmID),
-		MemFilePath:      o.getMemoryFile(vmID),
-		EnableUserPF:     o.GetUPFEnabled(),
+	if cfg, ok := o.vmConfigs.Load(vmID); ok && cfg.(*vmConfig).guestNi != nil {
+		if err := o.vmPool.ConnectClone(vmID, cfg.(*vmConfig).guestNi.PrimaryAddress); err != nil {
+			logger.WithError(err).Error("Failed to connect the VM to the guest in the snapshot")
+			return nil, err
+		}
 	}
 
 	if o.GetUPFEnabled() {
-		if err := o.memoryManager.FetchState(vmID); err != nil {
+		_, fetchSpan := tracing.StartSpan(ctx, "MemoryManager.FetchState")
+		err := o.memoryManager.FetchState(vmID)
+		tracing.EndSpan(fetchSpan, err)
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -510,13 +489,21 @@ func (o *Orchestrator) LoadSnapshot(ctx context.Context, vmID string) (*metrics.
 	go func() {
 		defer close(loadDone)
 
-		if _, loadErr = o.fcClient.LoadSnapshot(ctx, req); loadErr != nil {
+		_, loadSpan := tracing.StartSpan(ctx, metrics.LoadVMM)
+		defer func() { tracing.EndSpan(loadSpan, loadErr) }()
+
+		loadErr = o.vmm.LoadSnapshot(ctx, vmID, o.getSnapshotFile(vmID), o.getMemoryFile(vmID), o.GetUPFEnabled())
+		if loadErr != nil {
 			logger.Error("Failed to load snapshot of the VM: ", loadErr)
+			loadErr = misc.NewVMMErr(ctx, "load snapshot of", vmID, loadErr)
 		}
 	}()
 
 	if o.GetUPFEnabled() {
-		if activateErr = o.memoryManager.Activate(vmID); activateErr != nil {
+		_, activateSpan := tracing.StartSpan(ctx, "MemoryManager.Activate")
+		activateErr = o.memoryManager.Activate(vmID)
+		tracing.EndSpan(activateSpan, activateErr)
+		if activateErr != nil {
 			logger.Warn("Failed to activate VM in the memory manager", activateErr)
 		}
 	}
@@ -525,11 +512,17 @@ func (o *Orchestrator) LoadSnapshot(ctx context.Context, vmID string) (*metrics.
 
 	loadSnapshotMetric.MetricMap[metrics.LoadVMM] = metrics.ToUS(time.Since(tStart))
 
+	if loadErr != nil && activateErr == nil {
+		return nil, loadErr
+	}
+
 	if loadErr != nil || activateErr != nil {
 		multierr := multierror.Of(loadErr, activateErr)
 		return nil, multierr
 	}
 
+	o.setVMState(vmID, VMPaused)
+
 	return loadSnapshotMetric, nil
 }
 
@@ -538,33 +531,55 @@ func (o *Orchestrator) Offload(ctx context.Context, vmID string) error {
 	logger := log.WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received Offload")
 
-	ctx = namespaces.WithNamespace(ctx, namespaceName)
-
-	_, err := o.vmPool.GetVM(vmID)
-	if err != nil {
-		if _, ok := err.(*misc.NonExistErr); ok {
-			logger.Panic("Offload: VM does not exist")
-		}
-		logger.Panic("Offload: GetVM() failed for an unknown reason")
-
+	if _, err := o.vmPool.GetVM(vmID); err != nil {
+		return err
 	}
 
+	// The VM is offloaded even if the memory manager fails, so that it can be stopped
+	var deactivateErr error
 	if o.GetUPFEnabled() {
-		if err := o.memoryManager.Deactivate(vmID); err != nil {
-			logger.Error("Failed to deactivate VM in the memory manager")
-			return err
+		if deactivateErr = o.memoryManager.Deactivate(vmID); deactivateErr != nil {
+			logger.WithError(deactivateErr).Error("Failed to deactivate VM in the memory manager")
 		}
 	}
 
-	if _, err := o.fcClient.Offload(ctx, &proto.OffloadRequest{VMID: vmID}); err != nil {
+	if err := o.vmm.Offload(ctx, vmID); err != nil {
 		logger.WithError(err).Error("failed to offload the VM")
-		return err
+		return misc.NewVMMErr(ctx, "offload", vmID, err)
 	}
 
+	o.setVMState(vmID, VMOffloaded)
+
 	if err := o.vmPool.RecreateTap(vmID, o.hostIface); err != nil {
 		logger.Error("Failed to recreate tap upon offloading")
 		return err
 	}
 
+	if deactivateErr != nil {
+		return deactivateErr
+	}
+
+	// The working set is recorded upon the first offload
+	if cfg, ok := o.vmConfigs.Load(vmID); ok && cfg.(*vmConfig).snapshotID != "" {
+		if err := o.snapshots.addWorkingSet(cfg.(*vmConfig).snapshotID, o.getVMBaseDir(vmID)); err != nil {
+			logger.WithError(err).Warn("Failed to add the working set to the snapshot in the catalog")
+		}
+	}
+
 	return nil
 }
+
+func (o *Orchestrator) getSnapshotStateCfg(vmID string, memSizeMib uint32, upfSockPath, imageName string, spec VMSpec) manager.SnapshotStateCfg {
+	return manager.SnapshotStateCfg{
+		VMID:             vmID,
+		GuestMemPath:     o.getMemoryFile(vmID),
+		BaseDir:          o.getVMBaseDir(vmID),
+		GuestMemSize:     int(memSizeMib) * 1024 * 1024,
+		IsLazyMode:       o.isLazyMode,
+		VMMStatePath:     o.getSnapshotFile(vmID),
+		WorkingSetPath:   o.getWorkingSetFile(vmID),
+		InstanceSockAddr: upfSockPath,
+		VMConfigHash:     getSnapshotID(imageName, spec),
+		VCPUs:            int(spec.WithDefaults().VcpuCount),
+	}
+}
@@ -0,0 +1,332 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/containerd/containerd"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// imagePullFunc Pulls the image into the image store, reporting the progress
+// in the pull, and returns the image along with its size in bytes
+type imagePullFunc func(ctx context.Context, imageName string, pull *imagePull) (containerd.Image, int64, error)
+
+// imageRemoveFunc Removes the image from the image store
+type imageRemoveFunc func(ctx context.Context, imageName string) error
+
+// ImagePullProgress Progress of an image pull
+type ImagePullProgress struct {
+	ImageName    string
+	FetchedBytes int64
+	// TotalBytes Size of the image content discovered so far,
+	// it grows as the manifests of the image are fetched
+	TotalBytes int64
+	Elapsed    time.Duration
+}
+
+// ImageStoreStats Usage of the image store
+type ImageStoreStats struct {
+	// BudgetBytes Size of the images above which the unused images are evicted,
+	// zero if unlimited
+	BudgetBytes  int64
+	UsedBytes    int64
+	CachedImages int
+	// ActiveImages Images that the VMs run
+	ActiveImages  int
+	Pulls         uint64
+	Evictions     uint64
+	PullsInFlight []ImagePullProgress
+}
+
+// imagePull An in-flight pull of an image
+type imagePull struct {
+	imageName    string
+	startedAt    time.Time
+	fetchedBytes int64 // atomic
+	totalBytes   int64 // atomic
+}
+
+// setProgress Updates the number of the fetched bytes of the image and of its known size
+func (p *imagePull) setProgress(fetchedBytes, totalBytes int64) {
+	atomic.StoreInt64(&p.fetchedBytes, fetchedBytes)
+	atomic.StoreInt64(&p.totalBytes, totalBytes)
+}
+
+func (p *imagePull) getProgress() ImagePullProgress {
+	return ImagePullProgress{
+		ImageName:    p.imageName,
+		FetchedBytes: atomic.LoadInt64(&p.fetchedBytes),
+		TotalBytes:   atomic.LoadInt64(&p.totalBytes),
+		Elapsed:      time.Since(p.startedAt),
+	}
+}
+
+// cachedImage An image in the image store
+type cachedImage struct {
+	image      containerd.Image
+	sizeBytes  int64
+	refCount   int
+	lastUsedAt time.Time
+}
+
+// imageManager Keeps track of the images that the VMs boot from.
+// Concurrent requests for an image that is not cached share a single pull,
+// and the images that no VM runs are evicted, least recently used first,
+// when the images exceed the budget.
+type imageManager struct {
+	sync.Mutex
+	budgetBytes int64
+	usedBytes   int64
+	images      map[string]*cachedImage
+	pulls       map[string]*imagePull
+	removals    map[string]chan struct{} // evicted images that are being removed, closed once removed
+	pullGroup   singleflight.Group
+	pullFn      imagePullFunc
+	removeFn    imageRemoveFunc
+	numPulls    uint64
+	evictions   uint64
+}
+
+// newImageManager Initializes an image manager, the images are unlimited if the budget is zero
+func newImageManager(budgetBytes int64, pullFn imagePullFunc, removeFn imageRemoveFunc) *imageManager {
+	m := new(imageManager)
+	m.budgetBytes = budgetBytes
+	m.images = make(map[string]*cachedImage)
+	m.pulls = make(map[string]*imagePull)
+	m.removals = make(map[string]chan struct{})
+	m.pullFn = pullFn
+	m.removeFn = removeFn
+
+	return m
+}
+
+// acquire Returns the image, pulling it unless it is cached, and keeps the image
+// from being evicted until it is released. The pull is not cancelled if the
+// context is done, so that the other requests for the image can still use it,
+// and uses the credentials of the pull in the context, if any.
+func (m *imageManager) acquire(ctx context.Context, imageName string) (containerd.Image, error) {
+	for {
+		m.Lock()
+		if img, ok := m.images[imageName]; ok {
+			img.refCount++
+			img.lastUsedAt = time.Now()
+			m.Unlock()
+			return img.image, nil
+		}
+
+		if removedCh, ok := m.removals[imageName]; ok {
+			// The image must not be pulled again before its removal deletes it
+			m.Unlock()
+			select {
+			case <-removedCh:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		m.Unlock()
+
+		pullCh := m.pullGroup.DoChan(imageName, func() (interface{}, error) {
+			return m.pull(detachPullAuths(ctx), imageName)
+		})
+
+		var res singleflight.Result
+		select {
+		case res = <-pullCh:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		m.Lock()
+		img, ok := m.images[imageName]
+		if ok && img == res.Val.(*cachedImage) {
+			img.refCount++
+			img.lastUsedAt = time.Now()
+			m.Unlock()
+			m.evict()
+			return img.image, nil
+		}
+		m.Unlock()
+
+		// The image was evicted before it could be acquired
+		log.WithFields(log.Fields{"image": imageName}).Debug("Pulled image was evicted, retrying")
+	}
+}
+
+// release Lets the image be evicted once no VM runs it
+func (m *imageManager) release(imageName string) {
+	m.Lock()
+	img, ok := m.images[imageName]
+	if !ok || img.refCount == 0 {
+		m.Unlock()
+		log.WithFields(log.Fields{"image": imageName}).Warn("Released an image that was not acquired")
+		return
+	}
+	img.refCount--
+	img.lastUsedAt = time.Now()
+	m.Unlock()
+
+	m.evict()
+}
+
+// pull Pulls the image and adds it to the cache
+func (m *imageManager) pull(ctx context.Context, imageName string) (*cachedImage, error) {
+	logger := log.WithFields(log.Fields{"image": imageName})
+
+	p := &imagePull{imageName: imageName, startedAt: time.Now()}
+
+	m.Lock()
+	if img, ok := m.images[imageName]; ok {
+		// Pulled by a previous pull that completed just before this one started
+		m.Unlock()
+		return img, nil
+	}
+	m.pulls[imageName] = p
+	m.numPulls++
+	m.Unlock()
+
+	defer func() {
+		m.Lock()
+		delete(m.pulls, imageName)
+		m.Unlock()
+	}()
+
+	logger.Debug("Pulling image")
+
+	image, sizeBytes, err := m.pullFn(ctx, imageName, p)
+	if err != nil {
+		logger.WithError(err).Error("Failed to pull image")
+		return nil, err
+	}
+
+	logger.Debugf("Pulled image of %d bytes in %s", sizeBytes, time.Since(p.startedAt))
+
+	img := &cachedImage{image: image, sizeBytes: sizeBytes, lastUsedAt: time.Now()}
+
+	m.Lock()
+	m.images[imageName] = img
+	m.usedBytes += sizeBytes
+	m.Unlock()
+
+	return img, nil
+}
+
+// evict Removes the least recently used images that no VM runs
+// until the images fit in the budget
+func (m *imageManager) evict() {
+	m.Lock()
+
+	if m.budgetBytes <= 0 || m.usedBytes <= m.budgetBytes {
+		m.Unlock()
+		return
+	}
+
+	var candidates []string
+	for imageName, img := range m.images {
+		if img.refCount == 0 {
+			candidates = append(candidates, imageName)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return m.images[candidates[i]].lastUsedAt.Before(m.images[candidates[j]].lastUsedAt)
+	})
+
+	var evicted []string
+	for _, imageName := range candidates {
+		if m.usedBytes <= m.budgetBytes {
+			break
+		}
+
+		m.usedBytes -= m.images[imageName].sizeBytes
+		m.evictions++
+		delete(m.images, imageName)
+		m.removals[imageName] = make(chan struct{})
+		evicted = append(evicted, imageName)
+	}
+
+	if m.usedBytes > m.budgetBytes {
+		log.Warnf("Images use %d bytes over the budget of %d bytes, but are all in use", m.usedBytes, m.budgetBytes)
+	}
+
+	m.Unlock()
+
+	for _, imageName := range evicted {
+		m.remove(imageName)
+	}
+}
+
+// remove Removes an evicted image from the image store and lets the requests
+// for the image that wait for the removal pull it again
+func (m *imageManager) remove(imageName string) {
+	logger := log.WithFields(log.Fields{"image": imageName})
+	logger.Debug("Evicting image")
+
+	if m.removeFn != nil {
+		if err := m.removeFn(context.Background(), imageName); err != nil {
+			logger.WithError(err).Error("Failed to remove evicted image")
+		}
+	}
+
+	m.Lock()
+	close(m.removals[imageName])
+	delete(m.removals, imageName)
+	m.Unlock()
+}
+
+// getStats Returns the usage of the image store
+func (m *imageManager) getStats() ImageStoreStats {
+	m.Lock()
+	defer m.Unlock()
+
+	stats := ImageStoreStats{
+		BudgetBytes:  m.budgetBytes,
+		UsedBytes:    m.usedBytes,
+		CachedImages: len(m.images),
+		Pulls:        m.numPulls,
+		Evictions:    m.evictions,
+	}
+
+	for _, img := range m.images {
+		if img.refCount > 0 {
+			stats.ActiveImages++
+		}
+	}
+
+	for _, p := range m.pulls {
+		stats.PullsInFlight = append(stats.PullsInFlight, p.getProgress())
+	}
+
+	return stats
+}
@@ -0,0 +1,261 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/stretchr/testify/require"
+)
+
+const testImageBytes = 100
+
+// testImageStore Counts the pulls and records the removals of the images
+type testImageStore struct {
+	sync.Mutex
+	pulls    int64 // atomic
+	removed  []string
+	pullCh   chan struct{}
+	failNext error
+}
+
+func (s *testImageStore) pull(ctx context.Context, imageName string, pull *imagePull) (containerd.Image, int64, error) {
+	atomic.AddInt64(&s.pulls, 1)
+	pull.setProgress(0, testImageBytes)
+
+	if s.pullCh != nil {
+		<-s.pullCh
+	}
+
+	s.Lock()
+	err := s.failNext
+	s.failNext = nil
+	s.Unlock()
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return nil, testImageBytes, nil
+}
+
+func (s *testImageStore) remove(ctx context.Context, imageName string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.removed = append(s.removed, imageName)
+
+	return nil
+}
+
+func TestImageManagerSinglePull(t *testing.T) {
+	store := &testImageStore{pullCh: make(chan struct{})}
+	m := newImageManager(0, store.pull, store.remove)
+
+	const numRequests = 10
+
+	var wg sync.WaitGroup
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.acquire(context.Background(), testImageName)
+			require.NoError(t, err, "Failed to acquire image")
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return len(m.getStats().PullsInFlight) == 1
+	}, time.Second, time.Millisecond, "Pull must be in flight")
+
+	progress := m.getStats().PullsInFlight[0]
+	require.Equal(t, testImageName, progress.ImageName)
+	require.Equal(t, int64(testImageBytes), progress.TotalBytes)
+
+	close(store.pullCh)
+	wg.Wait()
+
+	stats := m.getStats()
+	require.Equal(t, int64(1), atomic.LoadInt64(&store.pulls), "Concurrent requests must share a pull")
+	require.Equal(t, uint64(1), stats.Pulls)
+	require.Equal(t, 1, stats.ActiveImages)
+	require.Empty(t, stats.PullsInFlight)
+	require.Equal(t, numRequests, m.images[testImageName].refCount)
+}
+
+func TestImageManagerPullFailure(t *testing.T) {
+	store := &testImageStore{failNext: errors.New("injected")}
+	m := newImageManager(0, store.pull, store.remove)
+
+	_, err := m.acquire(context.Background(), testImageName)
+	require.Error(t, err, "Pull must fail")
+	require.Zero(t, m.getStats().CachedImages, "Failed pulls must not be cached")
+
+	_, err = m.acquire(context.Background(), testImageName)
+	require.NoError(t, err, "Failed pull must be retried")
+	require.Equal(t, int64(2), atomic.LoadInt64(&store.pulls))
+}
+
+func TestImageManagerCancelledRequest(t *testing.T) {
+	store := &testImageStore{pullCh: make(chan struct{})}
+	m := newImageManager(0, store.pull, store.remove)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := m.acquire(ctx, testImageName)
+	require.Equal(t, context.Canceled, err)
+
+	close(store.pullCh)
+
+	_, err = m.acquire(context.Background(), testImageName)
+	require.NoError(t, err, "Failed to acquire image")
+	require.Equal(t, int64(1), atomic.LoadInt64(&store.pulls), "Cancelled request must not cancel the pull")
+}
+
+func TestImageManagerPullAuths(t *testing.T) {
+	var pullAuth RegistryAuth
+	m := newImageManager(0, func(ctx context.Context, imageName string, pull *imagePull) (containerd.Image, int64, error) {
+		pullAuth, _ = getPullAuth(ctx, "ghcr.io")
+		return nil, testImageBytes, nil
+	}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	auth := RegistryAuth{Username: "pod-user", Password: "pod-pass"}
+
+	_, err := m.acquire(WithPullAuths(ctx, map[string]RegistryAuth{"ghcr.io": auth}), testImageName)
+	require.NoError(t, err, "Failed to acquire image")
+	require.Equal(t, auth, pullAuth, "Pull must use the credentials of the request")
+}
+
+func TestImageManagerEviction(t *testing.T) {
+	ctx := context.Background()
+	store := &testImageStore{}
+	m := newImageManager(2*testImageBytes, store.pull, store.remove)
+
+	for i := 0; i < 3; i++ {
+		_, err := m.acquire(ctx, fmt.Sprintf("image%d", i))
+		require.NoError(t, err, "Failed to acquire image")
+	}
+	require.Empty(t, store.removed, "Images in use must not be evicted")
+	require.Equal(t, int64(3*testImageBytes), m.getStats().UsedBytes)
+
+	m.release("image1")
+	m.release("image0")
+	require.Equal(t, []string{"image1"}, store.removed, "Least recently used image must be evicted")
+
+	stats := m.getStats()
+	require.Equal(t, int64(2*testImageBytes), stats.UsedBytes)
+	require.Equal(t, 2, stats.CachedImages)
+	require.Equal(t, 1, stats.ActiveImages)
+	require.Equal(t, uint64(1), stats.Evictions)
+
+	_, err := m.acquire(ctx, "image1")
+	require.NoError(t, err, "Failed to acquire evicted image")
+	require.Equal(t, []string{"image1", "image0"}, store.removed)
+	require.Equal(t, int64(4), atomic.LoadInt64(&store.pulls), "Evicted image must be pulled again")
+}
+
+func TestImageManagerAcquireWhileRemoved(t *testing.T) {
+	ctx := context.Background()
+	store := &testImageStore{}
+	removeCh := make(chan struct{})
+	m := newImageManager(testImageBytes, store.pull, func(ctx context.Context, imageName string) error {
+		<-removeCh
+		return store.remove(ctx, imageName)
+	})
+
+	for _, imageName := range []string{"image0", "image1"} {
+		_, err := m.acquire(ctx, imageName)
+		require.NoError(t, err, "Failed to acquire image")
+	}
+
+	go m.release("image0")
+	require.Eventually(t, func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return m.removals["image0"] != nil
+	}, time.Second, time.Millisecond, "Image must be being removed")
+
+	acquired := make(chan error)
+	go func() {
+		_, err := m.acquire(ctx, "image0")
+		acquired <- err
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Image must not be acquired while it is being removed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Equal(t, int64(2), atomic.LoadInt64(&store.pulls), "Image must not be pulled while it is being removed")
+
+	close(removeCh)
+	require.NoError(t, <-acquired, "Failed to acquire removed image")
+	require.Equal(t, int64(3), atomic.LoadInt64(&store.pulls), "Removed image must be pulled again")
+	require.Equal(t, []string{"image0"}, store.removed)
+}
+
+func TestFakeVMMOrchestratorImages(t *testing.T) {
+	ctx := context.Background()
+
+	vmm := NewFakeVMM(FakeVMMCfg{
+		Latencies:        map[FakeVMMOp]time.Duration{FakeOpPullImage: 20 * time.Millisecond},
+		ImageSizeBytes:   testImageBytes,
+		ImageBudgetBytes: testImageBytes,
+	})
+	orch := newTestGCOrchestrator(t, WithVMM(vmm))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(vmID string) {
+			defer wg.Done()
+			_, _, err := orch.StartVM(ctx, vmID, testImageName)
+			require.NoError(t, err, "Failed to start VM")
+		}(fmt.Sprintf("%d", i))
+	}
+	wg.Wait()
+
+	stats := orch.GetImageStoreStats()
+	require.Equal(t, uint64(1), stats.Pulls, "Parallel cold starts must share a pull")
+	require.Equal(t, 1, stats.ActiveImages)
+
+	_, _, err := orch.StartVM(ctx, "other", "other")
+	require.NoError(t, err, "Failed to start VM")
+	require.Equal(t, 2, orch.GetImageStoreStats().CachedImages, "Images in use must not be evicted")
+
+	require.NoError(t, orch.StopSingleVM(ctx, "other"), "Failed to stop VM")
+
+	stats = orch.GetImageStoreStats()
+	require.Equal(t, 1, stats.CachedImages, "Unused image must be evicted")
+	require.Equal(t, uint64(1), stats.Evictions)
+}
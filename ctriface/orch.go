@@ -33,17 +33,13 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/containerd/containerd"
-
-	fcclient "github.com/firecracker-microvm/firecracker-containerd/firecracker-control/client"
-	// note: from the original repo
-
 	_ "google.golang.org/grpc/codes"  //tmp
 	_ "google.golang.org/grpc/status" //tmp
 
 	"github.com/ease-lab/vhive/memory/manager"
 	"github.com/ease-lab/vhive/metrics"
 	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/taps"
 
 	_ "github.com/davecgh/go-spew/spew" //tmp
 )
@@ -52,6 +48,7 @@ const (
 	containerdAddress      = "/run/firecracker-containerd/containerd.sock"
 	containerdTTRPCAddress = containerdAddress + ".ttrpc"
 	namespaceName          = "firecracker-containerd"
+	defaultStopTimeout     = 5 * time.Second
 )
 
 type WorkloadIoWriter struct {
@@ -74,37 +71,59 @@ func (wio WorkloadIoWriter) Write(p []byte) (n int, err error) {
 // Orchestrator Drives all VMs
 type Orchestrator struct {
 	vmPool       *misc.VMPool
-	cachedImages map[string]containerd.Image
-	workloadIo   sync.Map // vmID string -> WorkloadIoWriter
-	snapshotter  string
-	client       *containerd.Client
-	fcClient     *fcclient.Client
+	vmm          VMM
+	imageVMSpecs sync.Map // image name string -> VMSpec
+	vmConfigs    sync.Map // vmID string -> *vmConfig
+	vmStates     sync.Map // vmID string -> VMState
+	snapshots    *snapshotCatalog
+	snapshotGC   *snapshotGC
 	// store *skv.KVStore
 	snapshotsEnabled bool
 	isUPFEnabled     bool
 	isLazyMode       bool
 	snapshotsDir     string
+	persistSnapshots bool
+	stopTimeout      time.Duration
+	imageBudgetBytes int64
+	registryConfig   RegistryConfig
+	registries       *registryHosts
 	isMetricsMode    bool
+	restoreCfg       manager.RestoreCfg
+	recordCfg        manager.RecordCfg
+	upfWorkers       int
 	hostIface        string
 
 	memoryManager *manager.MemoryManager
 }
 
+// vmConfig What a VM was started with, to be stored along with its snapshot
+type vmConfig struct {
+	imageName   string
+	imageDigest string
+	spec        VMSpec
+	// snapshotID Shared snapshot that the VM's own snapshot files are a copy of, if any
+	snapshotID string
+	// guestNi Network interface of the guest, if it differs from the VM's own,
+	// i.e., the guest was restored from the snapshot of another VM
+	guestNi *taps.NetworkInterface
+}
+
 // NewOrchestrator Initializes a new orchestrator
 func NewOrchestrator(snapshotter, hostIface string, opts ...OrchestratorOption) *Orchestrator {
-	var err error
-
 	o := new(Orchestrator)
-	o.vmPool = misc.NewVMPool()
-	o.cachedImages = make(map[string]containerd.Image)
-	o.snapshotter = snapshotter
 	o.snapshotsDir = "/fccd/snapshots"
+	o.snapshotGC = newSnapshotGC()
+	o.stopTimeout = defaultStopTimeout
 	o.hostIface = hostIface
 
 	for _, opt := range opts {
 		opt(o)
 	}
 
+	if o.vmPool == nil {
+		o.vmPool = misc.NewVMPool()
+	}
+
 	if _, err := os.Stat(o.snapshotsDir); err != nil {
 		if !os.IsNotExist(err) {
 			log.Panicf("Snapshot dir %s exists", o.snapshotsDir)
@@ -115,26 +134,33 @@ func NewOrchestrator(snapshotter, hostIface string, opts ...OrchestratorOption)
 		log.Panicf("Failed to create snapshots dir %s", o.snapshotsDir)
 	}
 
+	o.snapshots = newSnapshotCatalog(filepath.Join(o.snapshotsDir, sharedSnapshotsDirName))
+	if err := o.snapshots.load(); err != nil {
+		log.Panicf("Failed to load snapshots from %s", o.snapshotsDir)
+	}
+	log.Infof("Loaded %d snapshots from %s", len(o.snapshots.list()), o.snapshotsDir)
+	o.collectSnapshots()
+
 	if o.GetUPFEnabled() {
 		managerCfg := manager.MemoryManagerCfg{
 			MetricsModeOn: o.isMetricsMode,
+			Restore:       o.restoreCfg,
+			Record:        o.recordCfg,
+			FaultWorkers:  o.upfWorkers,
 		}
 		o.memoryManager = manager.NewMemoryManager(managerCfg)
 	}
 
-	log.Info("Creating containerd client")
-	o.client, err = containerd.New(containerdAddress)
+	registries, err := newRegistryHosts(o.registryConfig)
 	if err != nil {
-		log.Fatal("Failed to start containerd client", err)
+		log.WithError(err).Panic("Failed to load the registry config")
 	}
-	log.Info("Created containerd client")
+	o.registries = registries
 
-	log.Info("Creating firecracker client")
-	o.fcClient, err = fcclient.New(containerdTTRPCAddress)
-	if err != nil {
-		log.Fatal("Failed to start firecracker client", err)
+	if o.vmm == nil {
+		o.vmm = newFirecrackerVMM(snapshotter, o.imageBudgetBytes, o.registries)
 	}
-	log.Info("Created firecracker client")
+
 	return o
 }
 
@@ -151,9 +177,13 @@ func (o *Orchestrator) setupCloseHandler() {
 }
 
 // Cleanup Removes the bridges created by the VM pool's tap manager
-// Cleans up snapshots directory
+// Cleans up snapshots directory, unless the snapshots are persistent
 func (o *Orchestrator) Cleanup() {
 	o.vmPool.RemoveBridges()
+	if o.persistSnapshots {
+		log.Infof("Keeping snapshots in %s", o.snapshotsDir)
+		return
+	}
 	if err := os.RemoveAll(o.snapshotsDir); err != nil {
 		log.Panic("failed to delete snapshots dir", err)
 	}
@@ -186,6 +216,25 @@ func (o *Orchestrator) DumpUPFLatencyStats(vmID, functionName, latencyOutFilePat
 	return o.memoryManager.DumpUPFLatencyStats(vmID, functionName, latencyOutFilePath)
 }
 
+// GetUPFPageStats Returns the memory manager's stats about the number of
+// the unique pages and the number of the pages that are reused across invocations
+func (o *Orchestrator) GetUPFPageStats(vmID string) (*manager.UPFPageStats, error) {
+	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger.Debug("Orchestrator received GetUPFPageStats")
+
+	return o.memoryManager.GetUPFPageStats(vmID)
+}
+
+// GetPageFaultCounts Returns the numbers of the pages that the memory manager
+// installed in the VMs, zero if the user-level page faults are disabled
+func (o *Orchestrator) GetPageFaultCounts() manager.PageFaultCounts {
+	if o.memoryManager == nil {
+		return manager.PageFaultCounts{}
+	}
+
+	return o.memoryManager.GetPageFaultCounts()
+}
+
 // GetUPFLatencyStats Returns the memory manager's latency stats
 func (o *Orchestrator) GetUPFLatencyStats(vmID string) ([]*metrics.Metric, error) {
 	logger := log.WithFields(log.Fields{"vmID": vmID})
@@ -194,16 +243,52 @@ func (o *Orchestrator) GetUPFLatencyStats(vmID string) ([]*metrics.Metric, error
 	return o.memoryManager.GetUPFLatencyStats(vmID)
 }
 
+// GetVMSpec Returns the spec of the VMs that run the image
+func (o *Orchestrator) GetVMSpec(imageName string) VMSpec {
+	if spec, ok := o.imageVMSpecs.Load(imageName); ok {
+		return spec.(VMSpec).WithDefaults()
+	}
+
+	return DefaultVMSpec()
+}
+
+// SetVMSpec Sets the spec of the VMs that run the image
+func (o *Orchestrator) SetVMSpec(imageName string, spec VMSpec) {
+	o.imageVMSpecs.Store(imageName, spec)
+}
+
+// GetSnapshot Returns the metadata of the shared snapshot of the VMs
+// that run the image with the spec
+func (o *Orchestrator) GetSnapshot(imageName string, spec VMSpec) (*SnapshotInfo, error) {
+	return o.snapshots.get(getSnapshotID(imageName, spec))
+}
+
+// ListSnapshots Returns the metadata of all the shared snapshots, oldest first
+func (o *Orchestrator) ListSnapshots() []*SnapshotInfo {
+	return o.snapshots.list()
+}
+
+// RemoveSnapshot Deletes a shared snapshot. The VMs that were
+// started from the snapshot are not affected.
+func (o *Orchestrator) RemoveSnapshot(snapshotID string) error {
+	return o.snapshots.remove(snapshotID)
+}
+
+// GetImageStoreStats Returns the usage of the VMM's image store
+func (o *Orchestrator) GetImageStoreStats() ImageStoreStats {
+	return o.vmm.GetImageStoreStats()
+}
+
 func (o *Orchestrator) getSnapshotFile(vmID string) string {
-	return filepath.Join(o.getVMBaseDir(vmID), "snap_file")
+	return filepath.Join(o.getVMBaseDir(vmID), snapshotFileName)
 }
 
 func (o *Orchestrator) getMemoryFile(vmID string) string {
-	return filepath.Join(o.getVMBaseDir(vmID), "mem_file")
+	return filepath.Join(o.getVMBaseDir(vmID), memoryFileName)
 }
 
 func (o *Orchestrator) getWorkingSetFile(vmID string) string {
-	return filepath.Join(o.getVMBaseDir(vmID), "working_set_pages")
+	return filepath.Join(o.getVMBaseDir(vmID), workingSetFileName)
 }
 
 func (o *Orchestrator) getVMBaseDir(vmID string) string {
@@ -217,6 +302,13 @@ func (o *Orchestrator) setupHeartbeat() {
 		for {
 			<-heartbeat.C
 			log.Info("HEARTBEAT: number of active VMs: ", len(o.vmPool.GetVMMap()))
+			stats := o.GetSnapshotStoreStats()
+			log.Infof("HEARTBEAT: snapshots use %d of %d bytes, %d shared (%d pinned), %d evicted",
+				stats.UsedBytes, stats.QuotaBytes, stats.SharedSnapshots, stats.PinnedSnapshots, stats.Evictions)
+			imageStats := o.GetImageStoreStats()
+			log.Infof("HEARTBEAT: images use %d of %d bytes, %d cached (%d active), %d pulls in flight, %d evicted",
+				imageStats.UsedBytes, imageStats.BudgetBytes, imageStats.CachedImages, imageStats.ActiveImages,
+				len(imageStats.PullsInFlight), imageStats.Evictions)
 		} // for
 	}() // go func
 }
@@ -22,6 +22,13 @@
 
 package ctriface
 
+import (
+	"time"
+
+	"github.com/ease-lab/vhive/memory/manager"
+	"github.com/ease-lab/vhive/misc"
+)
+
 // OrchestratorOption Options to pass to Orchestrator
 type OrchestratorOption func(*Orchestrator)
 
@@ -57,6 +64,58 @@ func WithSnapshotsDir(snapshotsDir string) OrchestratorOption {
 	}
 }
 
+// WithPersistentSnapshots Keeps the snapshots when the orchestrator
+// is cleaned up, so that they can be loaded after a restart
+func WithPersistentSnapshots(persistSnapshots bool) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.persistSnapshots = persistSnapshots
+	}
+}
+
+// WithSnapshotQuota Sets the maximum size of the snapshots in bytes,
+// idle shared snapshots are evicted to stay under the quota.
+// The snapshots are unlimited if the quota is zero
+func WithSnapshotQuota(quotaBytes int64) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.snapshotGC.quotaBytes = quotaBytes
+	}
+}
+
+// WithSnapshotEvictionPolicy Sets the order in which the idle shared
+// snapshots are evicted, least recently used first by default
+func WithSnapshotEvictionPolicy(policy EvictionPolicy) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.snapshotGC.policy = policy
+	}
+}
+
+// WithStopTimeout Sets how long the functions are given to exit after SIGTERM
+// when their VMs are stopped, before they are killed with SIGKILL.
+// The functions are killed right away if the timeout is zero
+func WithStopTimeout(stopTimeout time.Duration) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.stopTimeout = stopTimeout
+	}
+}
+
+// WithImageBudget Sets the maximum size of the images in bytes that the
+// firecracker-containerd VMM keeps, the images that no VM runs are evicted,
+// least recently used first, to stay within the budget.
+// The images are unlimited if the budget is zero
+func WithImageBudget(budgetBytes int64) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.imageBudgetBytes = budgetBytes
+	}
+}
+
+// WithRegistryConfig Sets the credentials, the mirrors and the TLS settings
+// of the registries that the images are pulled from
+func WithRegistryConfig(cfg RegistryConfig) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.registryConfig = cfg
+	}
+}
+
 // WithLazyMode Sets the lazy paging mode on (or off),
 // where all guest memory pages are brought on demand.
 // Only works if snapshots are enabled
@@ -73,6 +132,32 @@ func WithMetricsMode(isMetricsMode bool) OrchestratorOption {
 	}
 }
 
+// WithWSRestore Sets how the working sets are fetched and installed
+// when the VMs are loaded from their snapshots.
+// Only works if user-level page faults are enabled and the lazy mode is off
+func WithWSRestore(cfg manager.RestoreCfg) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.restoreCfg = cfg
+	}
+}
+
+// WithWSRecord Sets how the working sets are recorded and when they are recorded again.
+// Only works if user-level page faults are enabled and the lazy mode is off
+func WithWSRecord(cfg manager.RecordCfg) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.recordCfg = cfg
+	}
+}
+
+// WithUPFWorkers Sets the number of the goroutines that serve the page faults
+// of each VM concurrently, 0 is one per vCPU of the VM.
+// Only works if user-level page faults are enabled
+func WithUPFWorkers(workers int) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.upfWorkers = workers
+	}
+}
+
 // WithCustomHostIface Sets the custom host net interface
 // for the VMs to link to
 func WithCustomHostIface(hostIface string) OrchestratorOption {
@@ -80,3 +165,29 @@ func WithCustomHostIface(hostIface string) OrchestratorOption {
 		o.hostIface = hostIface
 	}
 }
+
+// WithVMM Sets the VMM backend that hosts the VMs,
+// firecracker-containerd is used by default
+func WithVMM(vmm VMM) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.vmm = vmm
+	}
+}
+
+// WithVMPool Sets the pool of the VMs, e.g., with a fake tap manager
+// for the fake VMM, by default the taps are created on the host bridges
+func WithVMPool(vmPool *misc.VMPool) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.vmPool = vmPool
+	}
+}
+
+// WithVMSpecs Sets the per-image specs of the VMs,
+// images without a spec run in VMs with the default spec
+func WithVMSpecs(specs map[string]VMSpec) OrchestratorOption {
+	return func(o *Orchestrator) {
+		for imageName, spec := range specs {
+			o.SetVMSpec(imageName, spec)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	dockerref "github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRegistry   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// RegistryAuth Credentials for a registry
+type RegistryAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// IdentityToken Refresh token that is exchanged for the registry's access tokens
+	IdentityToken string `json:"identityToken,omitempty"`
+	// RegistryToken Bearer token that is sent to the registry as is
+	RegistryToken string `json:"registryToken,omitempty"`
+}
+
+// RegistryHostConfig Settings of a registry
+type RegistryHostConfig struct {
+	// Auth Credentials for the registry, they take precedence over the docker config
+	Auth *RegistryAuth `json:"auth,omitempty"`
+	// Mirrors Endpoints to pull the images from before the registry itself,
+	// e.g., "https://mirror.example.com"
+	Mirrors []string `json:"mirrors,omitempty"`
+	// PlainHTTP Talk to the registry over HTTP rather than HTTPS,
+	// the default for the registries in the .local domain
+	PlainHTTP bool `json:"plainHTTP,omitempty"`
+	// InsecureSkipVerify Do not verify the TLS certificate of the registry
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// CAFile PEM file with the CA certificates that the registry's certificate
+	// is verified with, in addition to the system's CA certificates
+	CAFile string `json:"caFile,omitempty"`
+}
+
+// RegistryConfig Settings of the registries that the images are pulled from
+type RegistryConfig struct {
+	// DockerConfig Path to a docker config.json with the credentials of the registries
+	DockerConfig string `json:"dockerConfig,omitempty"`
+	// Registries Per-registry settings, keyed by the registry's host, e.g., "ghcr.io"
+	Registries map[string]RegistryHostConfig `json:"registries,omitempty"`
+}
+
+// LoadRegistryConfig Reads the registry settings from a JSON file
+func LoadRegistryConfig(path string) (RegistryConfig, error) {
+	var cfg RegistryConfig
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, errors.Wrap(err, "failed to read registry config file")
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, errors.Wrap(err, "failed to parse registry config file")
+	}
+
+	return cfg, nil
+}
+
+// GetImageRegistry Returns the registry that the image is pulled from
+func GetImageRegistry(imageName string) (string, error) {
+	ref, err := dockerref.ParseDockerRef(imageName)
+	if err != nil {
+		return "", err
+	}
+
+	return dockerref.Domain(ref), nil
+}
+
+// getImageURL Converts an image name to a fully qualified reference,
+// images without a registry are pulled from Docker Hub (default k8s behavior)
+func getImageURL(imageName string) string {
+	ref, err := dockerref.ParseDockerRef(imageName)
+	if err != nil {
+		return imageName
+	}
+
+	return ref.String()
+}
+
+// normalizeRegistry Returns the name of the registry at the address
+// that is used as the key of the registry's settings and credentials
+func normalizeRegistry(address string) string {
+	registry := address
+	if i := strings.Index(registry, "://"); i >= 0 {
+		registry = registry[i+3:]
+	}
+	if i := strings.Index(registry, "/"); i >= 0 {
+		registry = registry[:i]
+	}
+
+	switch registry {
+	case "index.docker.io", dockerHubRegistry:
+		return defaultRegistry
+	}
+
+	return registry
+}
+
+// dockerConfigFile The part of a docker config.json with the credentials
+type dockerConfigFile struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		IdentityToken string `json:"identitytoken"`
+		RegistryToken string `json:"registrytoken"`
+	} `json:"auths"`
+}
+
+// loadDockerConfig Reads the credentials of the registries from a docker config.json
+func loadDockerConfig(path string) (map[string]RegistryAuth, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read docker config")
+	}
+
+	var cfg dockerConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Wrap(err, "failed to parse docker config")
+	}
+
+	auths := make(map[string]RegistryAuth)
+	for address, entry := range cfg.Auths {
+		auth := RegistryAuth{
+			Username:      entry.Username,
+			Password:      entry.Password,
+			IdentityToken: entry.IdentityToken,
+			RegistryToken: entry.RegistryToken,
+		}
+
+		if entry.Auth != "" {
+			auth.Username, auth.Password, err = DecodeBasicAuth(entry.Auth)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid credentials of registry %s in docker config", address)
+			}
+		}
+
+		auths[normalizeRegistry(address)] = auth
+	}
+
+	return auths, nil
+}
+
+// DecodeBasicAuth Decodes the base64-encoded "username:password" credentials
+func DecodeBasicAuth(basicAuth string) (string, string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(basicAuth)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", errors.New("credentials must be in the username:password format")
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// pullAuthsKey Key of the credentials of the pulls in a context
+type pullAuthsKey struct{}
+
+// WithPullAuths Returns a context in which the images are pulled with the credentials
+// of their registries, e.g., the ones that a pod sent along with its image pulls.
+// The credentials are not kept after the pulls and are only used for the registries
+// that the operator configured no credentials for.
+func WithPullAuths(ctx context.Context, auths map[string]RegistryAuth) context.Context {
+	normalized := make(map[string]RegistryAuth, len(auths))
+	for registry, auth := range auths {
+		normalized[normalizeRegistry(registry)] = auth
+	}
+
+	return context.WithValue(ctx, pullAuthsKey{}, normalized)
+}
+
+// getPullAuth Returns the credentials of the registry for the pulls in the context, if any
+func getPullAuth(ctx context.Context, registry string) (RegistryAuth, bool) {
+	auths, _ := ctx.Value(pullAuthsKey{}).(map[string]RegistryAuth)
+	auth, ok := auths[normalizeRegistry(registry)]
+
+	return auth, ok
+}
+
+// detachPullAuths Returns a context that is not cancelled with the context,
+// e.g., for a pull that the requests for an image share, but that keeps
+// the credentials of the pulls in the context
+func detachPullAuths(ctx context.Context) context.Context {
+	detached := context.Background()
+	if auths, ok := ctx.Value(pullAuthsKey{}).(map[string]RegistryAuth); ok {
+		detached = context.WithValue(detached, pullAuthsKey{}, auths)
+	}
+
+	return detached
+}
+
+// registryHosts Resolves the endpoints, the TLS settings and the credentials
+// of the registries that the images are pulled from
+type registryHosts struct {
+	cfg         RegistryConfig
+	dockerAuths map[string]RegistryAuth // registry -> credentials from the docker config
+}
+
+func newRegistryHosts(cfg RegistryConfig) (*registryHosts, error) {
+	r := new(registryHosts)
+	r.cfg = cfg
+	r.dockerAuths = make(map[string]RegistryAuth)
+
+	if cfg.DockerConfig != "" {
+		auths, err := loadDockerConfig(cfg.DockerConfig)
+		if err != nil {
+			return nil, err
+		}
+		r.dockerAuths = auths
+	}
+
+	return r, nil
+}
+
+// getAuth Returns the credentials of the registry, if any. The configured credentials
+// take precedence over the credentials of the pull in the context.
+func (r *registryHosts) getAuth(ctx context.Context, registry string) (RegistryAuth, bool) {
+	registry = normalizeRegistry(registry)
+
+	if hostCfg, ok := r.cfg.Registries[registry]; ok && hostCfg.Auth != nil {
+		return *hostCfg.Auth, true
+	}
+
+	if auth, ok := r.dockerAuths[registry]; ok {
+		return auth, true
+	}
+
+	return getPullAuth(ctx, registry)
+}
+
+// getCreds Returns the credentials that the authorizer uses for the registry,
+// an identity token is returned as the secret with an empty username
+func (r *registryHosts) getCreds(ctx context.Context, registry string) (string, string, error) {
+	auth, ok := r.getAuth(ctx, registry)
+	if !ok {
+		return "", "", nil
+	}
+
+	if auth.IdentityToken != "" {
+		return "", auth.IdentityToken, nil
+	}
+
+	return auth.Username, auth.Password, nil
+}
+
+// getHostConfig Returns the settings of the registry
+func (r *registryHosts) getHostConfig(registry string) RegistryHostConfig {
+	hostCfg, ok := r.cfg.Registries[normalizeRegistry(registry)]
+	if !ok && strings.HasSuffix(registry, ".local") {
+		hostCfg.PlainHTTP = true
+	}
+
+	return hostCfg
+}
+
+// newResolver Returns a resolver that pulls the images through the mirrors
+// of their registries and authenticates to the registries,
+// with the credentials of the pull in the context if none are configured
+func (r *registryHosts) newResolver(ctx context.Context) remotes.Resolver {
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: func(registry string) ([]docker.RegistryHost, error) {
+			return r.getRegistryHosts(ctx, registry)
+		},
+	})
+}
+
+// getRegistryHosts Returns the mirrors of the registry, followed by the registry itself
+func (r *registryHosts) getRegistryHosts(ctx context.Context, registry string) ([]docker.RegistryHost, error) {
+	hostCfg := r.getHostConfig(registry)
+
+	var hosts []docker.RegistryHost
+	for _, mirror := range hostCfg.Mirrors {
+		if !strings.Contains(mirror, "://") {
+			mirror = "https://" + mirror
+		}
+
+		u, err := url.Parse(mirror)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid mirror %s of registry %s", mirror, registry)
+		}
+
+		host, err := r.newRegistryHost(ctx, u.Host, u.Scheme, u.Path, r.getHostConfig(u.Host),
+			docker.HostCapabilityPull|docker.HostCapabilityResolve)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+
+	scheme := "https"
+	if hostCfg.PlainHTTP {
+		scheme = "http"
+	}
+
+	address := registry
+	if normalizeRegistry(registry) == defaultRegistry {
+		address = dockerHubRegistry
+	}
+
+	host, err := r.newRegistryHost(ctx, address, scheme, "", hostCfg,
+		docker.HostCapabilityPull|docker.HostCapabilityResolve|docker.HostCapabilityPush)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(hosts, host), nil
+}
+
+// newRegistryHost Returns the endpoint of a registry or a mirror
+func (r *registryHosts) newRegistryHost(ctx context.Context, address, scheme, path string, hostCfg RegistryHostConfig, caps docker.HostCapabilities) (docker.RegistryHost, error) {
+	client, err := newRegistryClient(hostCfg)
+	if err != nil {
+		return docker.RegistryHost{}, errors.Wrapf(err, "failed to configure TLS for registry %s", address)
+	}
+
+	if path == "" || path == "/" {
+		path = "/v2"
+	}
+
+	header := make(http.Header)
+	if auth, ok := r.getAuth(ctx, address); ok && auth.RegistryToken != "" {
+		header.Set("Authorization", "Bearer "+auth.RegistryToken)
+	}
+
+	return docker.RegistryHost{
+		Client: client,
+		Authorizer: docker.NewDockerAuthorizer(
+			docker.WithAuthClient(client),
+			docker.WithAuthCreds(func(host string) (string, string, error) {
+				return r.getCreds(ctx, host)
+			}),
+		),
+		Host:         address,
+		Scheme:       scheme,
+		Path:         path,
+		Capabilities: caps,
+		Header:       header,
+	}, nil
+}
+
+// newRegistryClient Returns an HTTP client with the TLS settings of the registry
+func newRegistryClient(hostCfg RegistryHostConfig) (*http.Client, error) {
+	if !hostCfg.InsecureSkipVerify && hostCfg.CAFile == "" {
+		return http.DefaultClient, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: hostCfg.InsecureSkipVerify}
+
+	if hostCfg.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := ioutil.ReadFile(hostCfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no CA certificates in %s", hostCfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,148 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetImageURL(t *testing.T) {
+	for imageName, imageURL := range map[string]string{
+		"alpine":                               "docker.io/library/alpine:latest",
+		"vhiveease/helloworld:var_workload":    "docker.io/vhiveease/helloworld:var_workload",
+		"ghcr.io/ease-lab/helloworld:latest":   "ghcr.io/ease-lab/helloworld:latest",
+		"localhost:5000/helloworld":            "localhost:5000/helloworld:latest",
+		"docker-registry.registry.svc.local/a": "docker-registry.registry.svc.local/a:latest",
+	} {
+		require.Equal(t, imageURL, getImageURL(imageName))
+	}
+
+	registry, err := GetImageRegistry("localhost:5000/helloworld")
+	require.NoError(t, err)
+	require.Equal(t, "localhost:5000", registry)
+
+	registry, err = GetImageRegistry("alpine")
+	require.NoError(t, err)
+	require.Equal(t, "docker.io", registry)
+}
+
+func TestRegistryAuth(t *testing.T) {
+	ctx := context.Background()
+	dockerConfig := filepath.Join(t.TempDir(), "config.json")
+	basicAuth := base64.StdEncoding.EncodeToString([]byte("hub-user:hub-pass"))
+	require.NoError(t, ioutil.WriteFile(dockerConfig, []byte(`{"auths": {
+		"https://index.docker.io/v1/": {"auth": "`+basicAuth+`"},
+		"ghcr.io": {"username": "gh-user", "password": "gh-pass"},
+		"quay.io": {"identitytoken": "refresh-token"}
+	}}`), 0644))
+
+	r, err := newRegistryHosts(RegistryConfig{
+		DockerConfig: dockerConfig,
+		Registries: map[string]RegistryHostConfig{
+			"ghcr.io": {Auth: &RegistryAuth{Username: "static-user", Password: "static-pass"}},
+		},
+	})
+	require.NoError(t, err, "Failed to load registry config")
+
+	for registry, creds := range map[string][2]string{
+		dockerHubRegistry: {"hub-user", "hub-pass"},
+		"ghcr.io":         {"static-user", "static-pass"},
+		"quay.io":         {"", "refresh-token"},
+		"example.com":     {"", ""},
+	} {
+		username, secret, err := r.getCreds(ctx, registry)
+		require.NoError(t, err)
+		require.Equal(t, creds, [2]string{username, secret}, "Wrong credentials for %s", registry)
+	}
+
+	podAuth := RegistryAuth{Username: "pod-user", Password: "pod-pass"}
+	podCtx := WithPullAuths(ctx, map[string]RegistryAuth{
+		"ghcr.io":                     podAuth,
+		"https://example.com/v2/":     podAuth,
+		"https://index.docker.io/v1/": podAuth,
+	})
+
+	username, _, err := r.getCreds(podCtx, "ghcr.io")
+	require.NoError(t, err)
+	require.Equal(t, "static-user", username, "Configured credentials must take precedence")
+
+	username, _, err = r.getCreds(podCtx, dockerHubRegistry)
+	require.NoError(t, err)
+	require.Equal(t, "hub-user", username, "Docker config credentials must take precedence")
+
+	username, _, err = r.getCreds(podCtx, "example.com")
+	require.NoError(t, err)
+	require.Equal(t, "pod-user", username, "Credentials of the pulls must be used for unconfigured registries")
+
+	username, _, err = r.getCreds(detachPullAuths(podCtx), "example.com")
+	require.NoError(t, err)
+	require.Equal(t, "pod-user", username, "Detached pull must keep the credentials")
+
+	username, _, err = r.getCreds(ctx, "example.com")
+	require.NoError(t, err)
+	require.Empty(t, username, "Credentials of the pulls must not outlive their context")
+
+	_, err = newRegistryHosts(RegistryConfig{DockerConfig: filepath.Join(t.TempDir(), "missing.json")})
+	require.Error(t, err, "Loaded a missing docker config")
+}
+
+func TestRegistryHosts(t *testing.T) {
+	ctx := context.Background()
+	r, err := newRegistryHosts(RegistryConfig{
+		Registries: map[string]RegistryHostConfig{
+			"docker.io": {Mirrors: []string{"mirror.example.com", "http://cache.example.com:5000/v2/hub"}},
+			"ghcr.io":   {InsecureSkipVerify: true, Auth: &RegistryAuth{RegistryToken: "token"}},
+			"bad.io":    {CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		},
+	})
+	require.NoError(t, err, "Failed to load registry config")
+
+	hosts, err := r.getRegistryHosts(ctx, "docker.io")
+	require.NoError(t, err)
+	require.Len(t, hosts, 3, "Mirrors must precede the registry")
+	require.Equal(t, []string{"mirror.example.com", "cache.example.com:5000", dockerHubRegistry},
+		[]string{hosts[0].Host, hosts[1].Host, hosts[2].Host})
+	require.Equal(t, []string{"https", "http", "https"}, []string{hosts[0].Scheme, hosts[1].Scheme, hosts[2].Scheme})
+	require.Equal(t, "/v2/hub", hosts[1].Path)
+	require.False(t, hosts[0].Capabilities.Has(docker.HostCapabilityPush), "Mirrors must not be pushed to")
+
+	hosts, err = r.getRegistryHosts(ctx, "ghcr.io")
+	require.NoError(t, err)
+	require.Len(t, hosts, 1)
+	require.Equal(t, "Bearer token", hosts[0].Header.Get("Authorization"))
+	require.NotNil(t, hosts[0].Client.Transport, "Insecure registry must have its own TLS settings")
+
+	hosts, err = r.getRegistryHosts(ctx, "registry.svc.local")
+	require.NoError(t, err)
+	require.Equal(t, "http", hosts[0].Scheme, "Registries in .local must use plain HTTP")
+
+	_, err = r.getRegistryHosts(ctx, "bad.io")
+	require.Error(t, err, "Accepted a missing CA file")
+}
@@ -0,0 +1,487 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/taps"
+)
+
+const (
+	// SnapshotFormatVersion Version of the on-disk layout of the snapshots.
+	// Snapshots of other versions are skipped when the catalog is loaded.
+	SnapshotFormatVersion = 2
+
+	snapshotFileName   = "snap_file"
+	memoryFileName     = "mem_file"
+	workingSetFileName = "working_set_pages"
+	traceFileName      = "trace" // written by the memory manager
+	snapshotInfoName   = "snapshot_info.json"
+
+	sharedSnapshotsDirName = "shared"
+)
+
+// SnapshotInfo Metadata of a snapshot, stored next to the snapshot's files.
+// A snapshot is shared by all the VMs that run the same image with the same spec.
+type SnapshotInfo struct {
+	// FormatVersion Version of the on-disk layout of the snapshot
+	FormatVersion int `json:"formatVersion"`
+	// ID Key of the snapshot, derived from the image name and the VM spec
+	ID string `json:"id"`
+	// VMID ID of the VM that the snapshot was taken of
+	VMID string `json:"vmID"`
+	// ImageName Image of the function that runs in the VM
+	ImageName string `json:"imageName"`
+	// ImageDigest Digest of the image, empty if the VMM does not report it
+	ImageDigest string `json:"imageDigest,omitempty"`
+	// VMSpec Resources and boot parameters of the VM
+	VMSpec VMSpec `json:"vmSpec"`
+	// Network Network interface of the guest, which is part of the guest state
+	Network *taps.NetworkInterface `json:"network,omitempty"`
+	// CreatedAt Creation time of the snapshot
+	CreatedAt time.Time `json:"createdAt"`
+	// LastUsedAt Last time a VM was started from the snapshot, or its creation time
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	// UseCount Number of VMs started from the snapshot
+	UseCount uint64 `json:"useCount"`
+	// SizeBytes Total size of the snapshot's files
+	SizeBytes int64 `json:"sizeBytes"`
+	// HasWorkingSet Whether the working set trace of the VM was recorded
+	HasWorkingSet bool `json:"hasWorkingSet"`
+}
+
+// getSnapshotID Returns the key of the snapshot of the VMs
+// that run the image with the spec
+func getSnapshotID(imageName string, spec VMSpec) string {
+	// The spec has only plain fields, so it is always serialized
+	data, _ := json.Marshal(spec.WithDefaults())
+
+	return fmt.Sprintf("%x", sha256.Sum256(append([]byte(imageName+"\n"), data...)))[:16]
+}
+
+// snapshotCatalog The shared snapshots, one per subdirectory of the catalog's dir.
+// The catalog is persisted in the subdirectories so that it survives
+// the restarts of the daemon.
+type snapshotCatalog struct {
+	sync.Mutex
+	dir       string
+	snapshots map[string]*SnapshotInfo // snapshot ID -> info
+	clones    map[string]int           // snapshot ID -> number of ongoing copies
+}
+
+func newSnapshotCatalog(dir string) *snapshotCatalog {
+	c := new(snapshotCatalog)
+	c.dir = dir
+	c.snapshots = make(map[string]*SnapshotInfo)
+	c.clones = make(map[string]int)
+
+	return c
+}
+
+// load Reads the snapshots' metadata from the catalog's dir,
+// skipping the snapshots that are incomplete or of another format version
+func (c *snapshotCatalog) load() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if err := os.MkdirAll(c.dir, 0777); err != nil {
+		return errors.Wrap(err, "failed to create snapshot catalog dir")
+	}
+
+	entries, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to read snapshot catalog dir")
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		logger := log.WithFields(log.Fields{"snapshotID": entry.Name()})
+
+		info, err := c.readInfo(entry.Name())
+		if err != nil {
+			logger.WithError(err).Warn("Skipping snapshot")
+			continue
+		}
+
+		c.snapshots[info.ID] = info
+	}
+
+	return nil
+}
+
+func (c *snapshotCatalog) readInfo(id string) (*SnapshotInfo, error) {
+	data, err := ioutil.ReadFile(c.getPath(id, snapshotInfoName))
+	if err != nil {
+		return nil, err
+	}
+
+	info := new(SnapshotInfo)
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, errors.Wrapf(misc.SnapshotCorruptErr(id), "failed to parse snapshot metadata: %v", err)
+	}
+
+	if info.FormatVersion != SnapshotFormatVersion {
+		return nil, errors.Wrapf(misc.SnapshotCorruptErr(id), "unsupported snapshot format version %d", info.FormatVersion)
+	}
+
+	if info.ID != id {
+		return nil, errors.Wrapf(misc.SnapshotCorruptErr(id), "snapshot metadata belongs to snapshot %s", info.ID)
+	}
+
+	for _, name := range []string{snapshotFileName, memoryFileName} {
+		if _, err := os.Stat(c.getPath(id, name)); err != nil {
+			return nil, errors.Wrapf(misc.SnapshotCorruptErr(id), "snapshot is incomplete: %v", err)
+		}
+	}
+
+	return info, nil
+}
+
+// publish Adds the snapshot in srcDir to the catalog, unless the catalog
+// already has a snapshot with the same ID. Returns whether the snapshot was added.
+func (c *snapshotCatalog) publish(info *SnapshotInfo, srcDir string) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.snapshots[info.ID]; ok {
+		return false, nil
+	}
+
+	// Snapshots appear in the catalog dir only when they are complete
+	tmpDir := filepath.Join(c.dir, "."+info.ID)
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return false, err
+	}
+
+	if err := cloneFiles(srcDir, tmpDir); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return false, errors.Wrap(err, "failed to copy snapshot files")
+	}
+
+	info.FormatVersion = SnapshotFormatVersion
+	info.LastUsedAt = info.CreatedAt
+	c.updateFromFiles(info, tmpDir)
+
+	if err := writeInfo(info, tmpDir); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return false, err
+	}
+
+	if err := os.Rename(tmpDir, filepath.Join(c.dir, info.ID)); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return false, errors.Wrap(err, "failed to add snapshot to catalog dir")
+	}
+
+	c.snapshots[info.ID] = info
+
+	return true, nil
+}
+
+// addWorkingSet Adds the working set that was recorded in srcDir to the snapshot,
+// replacing the snapshot's working set if the one in srcDir was recorded later
+func (c *snapshotCatalog) addWorkingSet(id, srcDir string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	info, ok := c.snapshots[id]
+	if !ok {
+		return nil
+	}
+
+	srcTrace, err := os.Stat(filepath.Join(srcDir, traceFileName))
+	if err != nil {
+		// The working set is not recorded yet
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(srcDir, workingSetFileName)); err != nil {
+		return nil
+	}
+
+	if info.HasWorkingSet {
+		dstTrace, err := os.Stat(c.getPath(id, traceFileName))
+		if err == nil && !srcTrace.ModTime().After(dstTrace.ModTime()) {
+			return nil
+		}
+		if c.clones[id] > 0 {
+			// The trace must match the working set of the copies, the next offload replaces them
+			return nil
+		}
+	}
+
+	for _, name := range []string{workingSetFileName, traceFileName} {
+		dst := c.getPath(id, name)
+		if err := cloneFile(filepath.Join(srcDir, name), dst+".tmp"); err != nil {
+			_ = os.Remove(dst + ".tmp")
+			return errors.Wrap(err, "failed to copy working set")
+		}
+		if err := os.Rename(dst+".tmp", dst); err != nil {
+			return errors.Wrap(err, "failed to copy working set")
+		}
+	}
+
+	c.updateFromFiles(info, filepath.Join(c.dir, id))
+
+	return writeInfo(info, filepath.Join(c.dir, id))
+}
+
+// touch Records that a VM is started from the snapshot
+func (c *snapshotCatalog) touch(id string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	info, ok := c.snapshots[id]
+	if !ok {
+		return misc.NonExistErr("snapshot " + id)
+	}
+
+	info.LastUsedAt = time.Now()
+	info.UseCount++
+
+	return writeInfo(info, filepath.Join(c.dir, id))
+}
+
+// sizeBytes Returns the total size of the snapshots
+func (c *snapshotCatalog) sizeBytes() int64 {
+	c.Lock()
+	defer c.Unlock()
+
+	var size int64
+	for _, info := range c.snapshots {
+		size += info.SizeBytes
+	}
+
+	return size
+}
+
+// cloneTo Records that a VM is started from the snapshot and makes copy-on-write
+// copies of the snapshot's files in dstDir. The snapshot cannot be removed meanwhile.
+func (c *snapshotCatalog) cloneTo(id, dstDir string) error {
+	c.Lock()
+	if _, ok := c.snapshots[id]; !ok {
+		c.Unlock()
+		return misc.NonExistErr("snapshot " + id)
+	}
+	c.clones[id]++
+	c.Unlock()
+
+	defer func() {
+		c.Lock()
+		if c.clones[id]--; c.clones[id] == 0 {
+			delete(c.clones, id)
+		}
+		c.Unlock()
+	}()
+
+	if err := c.touch(id); err != nil {
+		log.WithError(err).Warnf("Failed to record the use of snapshot %s", id)
+	}
+
+	if err := cloneFiles(filepath.Join(c.dir, id), dstDir); err != nil {
+		if os.IsNotExist(err) {
+			return errors.Wrapf(misc.SnapshotCorruptErr(id), "snapshot is incomplete: %v", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// get Returns a copy of the metadata of a snapshot
+func (c *snapshotCatalog) get(id string) (*SnapshotInfo, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	info, ok := c.snapshots[id]
+	if !ok {
+		return nil, misc.NonExistErr("snapshot " + id)
+	}
+
+	infoCopy := *info
+
+	return &infoCopy, nil
+}
+
+// list Returns copies of the metadata of all the snapshots, oldest first
+func (c *snapshotCatalog) list() []*SnapshotInfo {
+	c.Lock()
+	defer c.Unlock()
+
+	infos := make([]*SnapshotInfo, 0, len(c.snapshots))
+	for _, info := range c.snapshots {
+		infoCopy := *info
+		infos = append(infos, &infoCopy)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].CreatedAt.Before(infos[j].CreatedAt)
+	})
+
+	return infos
+}
+
+// remove Deletes the snapshot's files and removes it from the catalog.
+// The VMs that were restored from the snapshot keep their copies.
+// A snapshot cannot be removed while it is being copied.
+func (c *snapshotCatalog) remove(id string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.snapshots[id]; !ok {
+		return misc.NonExistErr("snapshot " + id)
+	}
+
+	if c.clones[id] > 0 {
+		return errors.Errorf("snapshot %s is being copied", id)
+	}
+
+	delete(c.snapshots, id)
+
+	return os.RemoveAll(filepath.Join(c.dir, id))
+}
+
+func (c *snapshotCatalog) updateFromFiles(info *SnapshotInfo, dir string) {
+	var size int64
+
+	if entries, err := ioutil.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			if entry.Mode().IsRegular() && entry.Name() != snapshotInfoName {
+				size += entry.Size()
+			}
+		}
+	}
+
+	info.SizeBytes = size
+
+	_, wsErr := os.Stat(filepath.Join(dir, workingSetFileName))
+	_, traceErr := os.Stat(filepath.Join(dir, traceFileName))
+	info.HasWorkingSet = wsErr == nil && traceErr == nil
+}
+
+func (c *snapshotCatalog) getPath(id, name string) string {
+	return filepath.Join(c.dir, id, name)
+}
+
+// writeInfo Writes the metadata atomically, so that a crash
+// cannot leave a partially written file behind
+func writeInfo(info *SnapshotInfo, dir string) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize snapshot metadata")
+	}
+
+	path := filepath.Join(dir, snapshotInfoName)
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write snapshot metadata")
+	}
+
+	return errors.Wrap(os.Rename(path+".tmp", path), "failed to write snapshot metadata")
+}
+
+// cloneFiles Makes copy-on-write copies of the snapshot files in srcDir in dstDir
+func cloneFiles(srcDir, dstDir string) error {
+	if err := os.MkdirAll(dstDir, 0777); err != nil {
+		return err
+	}
+
+	for _, name := range []string{snapshotFileName, memoryFileName, workingSetFileName, traceFileName} {
+		src := filepath.Join(srcDir, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) && name != snapshotFileName && name != memoryFileName {
+			// The working set is optional
+			continue
+		}
+
+		if err := cloneFile(src, filepath.Join(dstDir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cloneFile Makes a copy-on-write copy of a file on the file systems that support
+// reflinks (e.g., XFS and Btrfs), and a sparse copy of the file otherwise
+func cloneFile(src, dst string) error {
+	fSrc, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fSrc.Close()
+
+	fDst, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer fDst.Close()
+
+	if err := unix.IoctlFileClone(int(fDst.Fd()), int(fSrc.Fd())); err == nil {
+		return nil
+	}
+
+	srcInfo, err := fSrc.Stat()
+	if err != nil {
+		return err
+	}
+
+	var (
+		buf    = make([]byte, 1024*1024)
+		zeroes = make([]byte, len(buf))
+		offset int64
+	)
+
+	for {
+		n, err := fSrc.Read(buf)
+		if n > 0 && !bytes.Equal(buf[:n], zeroes[:n]) {
+			if _, err := fDst.WriteAt(buf[:n], offset); err != nil {
+				return err
+			}
+		}
+		offset += int64(n)
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return fDst.Truncate(srcInfo.Size())
+}
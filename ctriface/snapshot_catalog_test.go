@@ -0,0 +1,249 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/taps"
+)
+
+func TestSharedSnapshots(t *testing.T) {
+	ctx := context.Background()
+	snapshotsDir := t.TempDir()
+	spec := VMSpec{MemSizeMib: 512}.WithDefaults()
+
+	vmm := NewFakeVMM(FakeVMMCfg{})
+	orch := NewOrchestrator(
+		"devmapper",
+		"",
+		WithTestModeOn(true),
+		WithSnapshotsDir(snapshotsDir),
+		WithPersistentSnapshots(true),
+		WithVMM(vmm),
+		WithVMPool(misc.NewVMPoolWithTapManager(taps.NewFakeTapManager())),
+		WithVMSpecs(map[string]VMSpec{testImageName: spec}),
+	)
+
+	_, _, err := orch.StartVMFromSnapshot(ctx, "2", testImageName, spec)
+	require.IsType(t, misc.NonExistErr(""), err, "Started VM without a snapshot")
+
+	resp, _, err := orch.StartVM(ctx, "1", testImageName)
+	require.NoError(t, err, "Failed to start VM")
+
+	err = orch.PauseVM(ctx, "1")
+	require.NoError(t, err, "Failed to pause VM")
+
+	err = orch.CreateSnapshot(ctx, "1")
+	require.NoError(t, err, "Failed to create snapshot of VM")
+
+	_, err = orch.ResumeVM(ctx, "1")
+	require.NoError(t, err, "Failed to resume VM")
+
+	info, err := orch.GetSnapshot(testImageName, spec)
+	require.NoError(t, err, "Snapshot is not in the catalog")
+	require.Equal(t, SnapshotFormatVersion, info.FormatVersion)
+	require.Equal(t, "1", info.VMID)
+	require.Equal(t, testImageName, info.ImageName)
+	require.NotEmpty(t, info.ImageDigest)
+	require.Equal(t, spec, info.VMSpec)
+	require.Equal(t, int64(512*1024*1024+len("1")), info.SizeBytes)
+	require.False(t, info.HasWorkingSet)
+
+	_, err = orch.GetSnapshot(testImageName, DefaultVMSpec())
+	require.Error(t, err, "Snapshots of VMs with other specs must not be shared")
+
+	// Scale out from the snapshot
+	guestIPs := map[string]bool{resp.GuestIP: true}
+	for _, vmID := range []string{"2", "3"} {
+		resp, startMetric, err := orch.StartVMFromSnapshot(ctx, vmID, testImageName, spec)
+		require.NoError(t, err, "Failed to start VM from snapshot")
+		require.Contains(t, startMetric.MetricMap, metrics.CloneSnapshot)
+		require.Equal(t, FakeVMRunning, vmm.GetVMState(vmID))
+
+		require.False(t, guestIPs[resp.GuestIP], "VMs started from a snapshot must have their own network")
+		guestIPs[resp.GuestIP] = true
+
+		memFileInfo, err := os.Stat(orch.getMemoryFile(vmID))
+		require.NoError(t, err, "VM must have its own guest memory file")
+		require.Equal(t, int64(512*1024*1024), memFileInfo.Size())
+	}
+
+	// The VMs started from the snapshot can be offloaded and loaded in place
+	err = orch.Offload(ctx, "2")
+	require.NoError(t, err, "Failed to offload VM")
+
+	_, err = orch.LoadSnapshot(ctx, "2")
+	require.NoError(t, err, "Failed to load snapshot of VM")
+
+	// Snapshots of an unknown format version are skipped
+	badDir := filepath.Join(snapshotsDir, sharedSnapshotsDirName, "bad")
+	require.NoError(t, os.MkdirAll(badDir, 0777))
+	err = ioutil.WriteFile(filepath.Join(badDir, snapshotInfoName), []byte(`{"formatVersion": 0, "id": "bad"}`), 0644)
+	require.NoError(t, err, "Failed to write snapshot metadata")
+
+	_ = orch.StopActiveVMs()
+	orch.Cleanup()
+
+	// The daemon restarts with a new VMM and without the VMs
+	orch = NewOrchestrator(
+		"devmapper",
+		"",
+		WithTestModeOn(true),
+		WithSnapshotsDir(snapshotsDir),
+		WithVMM(NewFakeVMM(FakeVMMCfg{})),
+		WithVMPool(misc.NewVMPoolWithTapManager(taps.NewFakeTapManager())),
+	)
+
+	snapshots := orch.ListSnapshots()
+	require.Len(t, snapshots, 1, "Catalog must survive the restart")
+	require.Equal(t, info.ID, snapshots[0].ID)
+	require.Equal(t, info.ImageDigest, snapshots[0].ImageDigest)
+	require.Equal(t, info.VMSpec, snapshots[0].VMSpec)
+	require.True(t, info.CreatedAt.Equal(snapshots[0].CreatedAt))
+
+	_, _, err = orch.StartVMFromSnapshot(ctx, "1", testImageName, spec)
+	require.NoError(t, err, "Failed to start VM from snapshot after restart")
+
+	err = orch.RemoveSnapshot(info.ID)
+	require.NoError(t, err, "Failed to remove snapshot")
+	require.Empty(t, orch.ListSnapshots())
+
+	// The VM keeps its copy of the snapshot
+	err = orch.Offload(ctx, "1")
+	require.NoError(t, err, "Failed to offload VM")
+
+	_, err = orch.LoadSnapshot(ctx, "1")
+	require.NoError(t, err, "Failed to load snapshot of VM")
+
+	err = orch.StopSingleVM(ctx, "1")
+	require.NoError(t, err, "Failed to stop VM")
+
+	orch.Cleanup()
+}
+
+func TestCloneFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+
+	f, err := os.Create(src)
+	require.NoError(t, err, "Failed to create file")
+	require.NoError(t, f.Truncate(8*1024*1024))
+	_, err = f.WriteAt([]byte("data"), 3*1024*1024)
+	require.NoError(t, err, "Failed to write file")
+	require.NoError(t, f.Close())
+
+	require.NoError(t, cloneFile(src, dst), "Failed to clone file")
+
+	srcData, err := ioutil.ReadFile(src)
+	require.NoError(t, err)
+	dstData, err := ioutil.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, srcData, dstData)
+}
+
+func TestSnapshotRemoveWhileCopied(t *testing.T) {
+	dir := t.TempDir()
+	srcDir := filepath.Join(dir, "vm")
+	require.NoError(t, os.MkdirAll(srcDir, 0777))
+
+	for _, name := range []string{snapshotFileName, memoryFileName} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, name), []byte(name), 0644))
+	}
+
+	c := newSnapshotCatalog(filepath.Join(dir, sharedSnapshotsDirName))
+	require.NoError(t, c.load())
+
+	info := &SnapshotInfo{ID: "snap", VMID: "vm", CreatedAt: time.Now()}
+	isPublished, err := c.publish(info, srcDir)
+	require.NoError(t, err, "Failed to publish snapshot")
+	require.True(t, isPublished)
+
+	// A copy in progress
+	c.clones["snap"]++
+	require.Error(t, c.remove("snap"), "Removed snapshot while it is being copied")
+	c.clones["snap"]--
+
+	require.NoError(t, c.cloneTo("snap", filepath.Join(dir, "clone")), "Failed to copy snapshot")
+
+	copied, err := c.get("snap")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, copied.UseCount, "Copy of snapshot is not recorded")
+
+	require.NoError(t, c.remove("snap"), "Failed to remove snapshot")
+}
+
+func TestAddWorkingSet(t *testing.T) {
+	dir := t.TempDir()
+	srcDir := filepath.Join(dir, "vm")
+	require.NoError(t, os.MkdirAll(srcDir, 0777))
+
+	for _, name := range []string{snapshotFileName, memoryFileName} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, name), []byte(name), 0644))
+	}
+
+	c := newSnapshotCatalog(filepath.Join(dir, sharedSnapshotsDirName))
+	require.NoError(t, c.load())
+
+	info := &SnapshotInfo{ID: "snap", VMID: "vm", CreatedAt: time.Now()}
+	_, err := c.publish(info, srcDir)
+	require.NoError(t, err, "Failed to publish snapshot")
+
+	writeWorkingSet := func(data string, modTime time.Time) {
+		for _, name := range []string{workingSetFileName, traceFileName} {
+			path := filepath.Join(srcDir, name)
+			require.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+			require.NoError(t, os.Chtimes(path, modTime, modTime))
+		}
+	}
+	readTrace := func() string {
+		data, err := ioutil.ReadFile(c.getPath("snap", traceFileName))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	writeWorkingSet("first", time.Now().Add(-time.Hour))
+	require.NoError(t, c.addWorkingSet("snap", srcDir), "Failed to add working set")
+	require.Equal(t, "first", readTrace())
+
+	info, err = c.get("snap")
+	require.NoError(t, err)
+	require.True(t, info.HasWorkingSet)
+
+	writeWorkingSet("older", time.Now().Add(-2*time.Hour))
+	require.NoError(t, c.addWorkingSet("snap", srcDir))
+	require.Equal(t, "first", readTrace(), "Working set recorded earlier must not replace the snapshot's one")
+
+	writeWorkingSet("rerecorded", time.Now().Add(time.Hour))
+	require.NoError(t, c.addWorkingSet("snap", srcDir))
+	require.Equal(t, "rerecorded", readTrace(), "Working set recorded later must replace the snapshot's one")
+}
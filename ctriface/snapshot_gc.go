@@ -0,0 +1,236 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// EvictionPolicy Order in which the idle shared snapshots are evicted
+// when the snapshots exceed the quota
+type EvictionPolicy string
+
+const (
+	// EvictLRU Evicts the least recently used snapshots first
+	EvictLRU EvictionPolicy = "lru"
+	// EvictLFU Evicts the least frequently used snapshots first
+	EvictLFU EvictionPolicy = "lfu"
+)
+
+// ParseEvictionPolicy Converts the name of an eviction policy to the policy
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch policy := EvictionPolicy(name); policy {
+	case EvictLRU, EvictLFU:
+		return policy, nil
+	default:
+		return "", errors.Errorf("unknown snapshot eviction policy %s", name)
+	}
+}
+
+// SnapshotStoreStats Disk usage of the snapshots and the evictions
+type SnapshotStoreStats struct {
+	// QuotaBytes Maximum size of the snapshots, unlimited if zero
+	QuotaBytes int64
+	// UsedBytes Total size of the shared snapshots and the snapshots of the VMs
+	UsedBytes int64
+	// SharedBytes Total size of the shared snapshots
+	SharedBytes int64
+	// SharedSnapshots Number of shared snapshots
+	SharedSnapshots int
+	// PinnedSnapshots Number of shared snapshots that cannot be evicted
+	PinnedSnapshots int
+	// Evictions Number of shared snapshots evicted so far
+	Evictions uint64
+	// EvictedBytes Total size of the shared snapshots evicted so far
+	EvictedBytes int64
+}
+
+// snapshotGC Evicts idle shared snapshots to keep the snapshots under the quota
+type snapshotGC struct {
+	sync.Mutex
+	quotaBytes   int64
+	policy       EvictionPolicy
+	pinned       map[string]bool // snapshot ID -> pinned
+	evictions    uint64
+	evictedBytes int64
+}
+
+func newSnapshotGC() *snapshotGC {
+	gc := new(snapshotGC)
+	gc.policy = EvictLRU
+	gc.pinned = make(map[string]bool)
+
+	return gc
+}
+
+// PinSnapshot Protects the shared snapshot of the image and the spec
+// from eviction, even if the snapshot is not created yet
+func (o *Orchestrator) PinSnapshot(imageName string, spec VMSpec) {
+	o.snapshotGC.Lock()
+	defer o.snapshotGC.Unlock()
+
+	o.snapshotGC.pinned[getSnapshotID(imageName, spec)] = true
+}
+
+// UnpinSnapshot Allows the shared snapshot of the image and the spec to be evicted
+func (o *Orchestrator) UnpinSnapshot(imageName string, spec VMSpec) {
+	o.snapshotGC.Lock()
+	defer o.snapshotGC.Unlock()
+
+	delete(o.snapshotGC.pinned, getSnapshotID(imageName, spec))
+}
+
+// GetSnapshotStoreStats Returns the disk usage of the snapshots and the evictions
+func (o *Orchestrator) GetSnapshotStoreStats() SnapshotStoreStats {
+	o.snapshotGC.Lock()
+	defer o.snapshotGC.Unlock()
+
+	stats := SnapshotStoreStats{
+		QuotaBytes:   o.snapshotGC.quotaBytes,
+		Evictions:    o.snapshotGC.evictions,
+		EvictedBytes: o.snapshotGC.evictedBytes,
+	}
+
+	for _, info := range o.snapshots.list() {
+		stats.SharedSnapshots++
+		stats.SharedBytes += info.SizeBytes
+		if o.snapshotGC.pinned[info.ID] {
+			stats.PinnedSnapshots++
+		}
+	}
+
+	stats.UsedBytes = stats.SharedBytes + o.getVMSnapshotsBytes()
+
+	return stats
+}
+
+// collectSnapshots Evicts idle shared snapshots, in the order of the eviction policy,
+// until the snapshots fit in the quota. The snapshots that are pinned or
+// in use by active VMs are never evicted.
+func (o *Orchestrator) collectSnapshots() {
+	o.snapshotGC.Lock()
+	defer o.snapshotGC.Unlock()
+
+	quotaBytes := o.snapshotGC.quotaBytes
+	if quotaBytes <= 0 {
+		return
+	}
+
+	usedBytes := o.snapshots.sizeBytes() + o.getVMSnapshotsBytes()
+	if usedBytes <= quotaBytes {
+		return
+	}
+
+	inUse := o.getSnapshotsInUse()
+
+	candidates := make([]*SnapshotInfo, 0)
+	for _, info := range o.snapshots.list() {
+		if !o.snapshotGC.pinned[info.ID] && !inUse[info.ID] {
+			candidates = append(candidates, info)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if o.snapshotGC.policy == EvictLFU && a.UseCount != b.UseCount {
+			return a.UseCount < b.UseCount
+		}
+		return a.LastUsedAt.Before(b.LastUsedAt)
+	})
+
+	for _, info := range candidates {
+		if usedBytes <= quotaBytes {
+			break
+		}
+
+		logger := log.WithFields(log.Fields{"snapshotID": info.ID, "image": info.ImageName})
+
+		if err := o.snapshots.remove(info.ID); err != nil {
+			logger.WithError(err).Error("Failed to evict snapshot")
+			continue
+		}
+
+		logger.Infof("Evicted snapshot of %d bytes (policy %s)", info.SizeBytes, o.snapshotGC.policy)
+
+		usedBytes -= info.SizeBytes
+		o.snapshotGC.evictions++
+		o.snapshotGC.evictedBytes += info.SizeBytes
+	}
+
+	if usedBytes > quotaBytes {
+		log.Warnf("Snapshots exceed the quota by %d bytes, the rest are pinned or in use", usedBytes-quotaBytes)
+	}
+}
+
+// getSnapshotsInUse Returns the shared snapshots that the active VMs
+// were started from or that they created
+func (o *Orchestrator) getSnapshotsInUse() map[string]bool {
+	inUse := make(map[string]bool)
+
+	o.vmConfigs.Range(func(_, value interface{}) bool {
+		if id := value.(*vmConfig).snapshotID; id != "" {
+			inUse[id] = true
+		}
+		return true
+	})
+
+	return inUse
+}
+
+// getVMSnapshotsBytes Returns the total size of the VMs' own snapshots on disk,
+// which are removed along with the VMs. The holes of the sparse copies
+// of the shared snapshots are not counted.
+func (o *Orchestrator) getVMSnapshotsBytes() int64 {
+	var size int64
+
+	for vmID := range o.vmPool.GetVMMap() {
+		entries, err := ioutil.ReadDir(o.getVMBaseDir(vmID))
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.Mode().IsRegular() {
+				size += getAllocatedBytes(entry)
+			}
+		}
+	}
+
+	return size
+}
+
+// getAllocatedBytes Returns the size of the blocks that are allocated to the file
+func getAllocatedBytes(info os.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Blocks * 512
+	}
+
+	return info.Size()
+}
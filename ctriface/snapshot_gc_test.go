@@ -0,0 +1,202 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/taps"
+)
+
+const testSnapshotBytes = 16*1024*1024 + 1
+
+func newTestGCOrchestrator(t *testing.T, opts ...OrchestratorOption) *Orchestrator {
+	opts = append([]OrchestratorOption{
+		WithTestModeOn(true),
+		WithSnapshotsDir(t.TempDir()),
+		WithVMM(NewFakeVMM(FakeVMMCfg{})),
+		WithVMPool(misc.NewVMPoolWithTapManager(taps.NewFakeTapManager())),
+	}, opts...)
+
+	orch := NewOrchestrator("devmapper", "", opts...)
+	t.Cleanup(func() {
+		_ = orch.StopActiveVMs()
+		orch.Cleanup()
+	})
+
+	return orch
+}
+
+// createTestSnapshot Creates the shared snapshot of the image with a VM that is stopped afterwards
+func createTestSnapshot(t *testing.T, orch *Orchestrator, imageName string) *SnapshotInfo {
+	ctx := context.Background()
+	spec := VMSpec{MemSizeMib: 16}
+
+	_, _, err := orch.StartVMWithSpec(ctx, "0", imageName, spec)
+	require.NoError(t, err, "Failed to start VM")
+	require.NoError(t, orch.PauseVM(ctx, "0"), "Failed to pause VM")
+	require.NoError(t, orch.CreateSnapshot(ctx, "0"), "Failed to create snapshot of VM")
+	require.NoError(t, orch.StopSingleVM(ctx, "0"), "Failed to stop VM")
+
+	info, err := orch.GetSnapshot(imageName, spec)
+	require.NoError(t, err, "Snapshot is not in the catalog")
+	require.Equal(t, int64(testSnapshotBytes), info.SizeBytes)
+
+	return info
+}
+
+// useTestSnapshot Starts and stops a VM from the shared snapshot of the image
+func useTestSnapshot(t *testing.T, orch *Orchestrator, imageName string) {
+	ctx := context.Background()
+
+	_, _, err := orch.StartVMFromSnapshot(ctx, "1", imageName, VMSpec{MemSizeMib: 16})
+	require.NoError(t, err, "Failed to start VM from snapshot")
+	require.NoError(t, orch.StopSingleVM(ctx, "1"), "Failed to stop VM")
+}
+
+func getTestSnapshotImages(orch *Orchestrator) []string {
+	images := make([]string, 0)
+	for _, info := range orch.ListSnapshots() {
+		images = append(images, info.ImageName)
+	}
+
+	return images
+}
+
+func TestSnapshotEviction(t *testing.T) {
+	for _, tc := range []struct {
+		policy    EvictionPolicy
+		remaining []string
+	}{
+		// a is used last, b is used the least
+		{policy: EvictLRU, remaining: []string{"b", "a"}},
+		{policy: EvictLFU, remaining: []string{"c", "a"}},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			orch := newTestGCOrchestrator(t, WithSnapshotEvictionPolicy(tc.policy))
+
+			for _, imageName := range []string{"a", "b", "c"} {
+				createTestSnapshot(t, orch, imageName)
+			}
+
+			useTestSnapshot(t, orch, "c")
+			useTestSnapshot(t, orch, "c")
+			useTestSnapshot(t, orch, "b")
+			useTestSnapshot(t, orch, "a")
+			useTestSnapshot(t, orch, "a")
+			useTestSnapshot(t, orch, "a")
+
+			stats := orch.GetSnapshotStoreStats()
+			require.Equal(t, int64(3*testSnapshotBytes), stats.UsedBytes)
+			require.Equal(t, 3, stats.SharedSnapshots)
+
+			orch.snapshotGC.quotaBytes = 2 * testSnapshotBytes
+			orch.collectSnapshots()
+
+			require.ElementsMatch(t, tc.remaining, getTestSnapshotImages(orch))
+
+			stats = orch.GetSnapshotStoreStats()
+			require.Equal(t, int64(2*testSnapshotBytes), stats.UsedBytes)
+			require.Equal(t, uint64(1), stats.Evictions)
+			require.Equal(t, int64(testSnapshotBytes), stats.EvictedBytes)
+		})
+	}
+}
+
+func TestSnapshotEvictionProtected(t *testing.T) {
+	ctx := context.Background()
+	spec := VMSpec{MemSizeMib: 16}
+
+	orch := newTestGCOrchestrator(t)
+	orch.PinSnapshot("a", spec)
+
+	for _, imageName := range []string{"a", "b", "c"} {
+		createTestSnapshot(t, orch, imageName)
+	}
+
+	_, _, err := orch.StartVMFromSnapshot(ctx, "1", "b", spec)
+	require.NoError(t, err, "Failed to start VM from snapshot")
+
+	// The VM's copy of the snapshot counts towards the quota, without its holes
+	vmSnapshotsBytes := orch.getVMSnapshotsBytes()
+	require.Greater(t, vmSnapshotsBytes, int64(0))
+	require.Less(t, vmSnapshotsBytes, int64(testSnapshotBytes))
+	stats := orch.GetSnapshotStoreStats()
+	require.Equal(t, int64(3*testSnapshotBytes)+vmSnapshotsBytes, stats.UsedBytes)
+	require.Equal(t, 1, stats.PinnedSnapshots)
+
+	orch.snapshotGC.quotaBytes = 1
+	orch.collectSnapshots()
+
+	require.ElementsMatch(t, []string{"a", "b"}, getTestSnapshotImages(orch),
+		"Pinned snapshots and snapshots in use must not be evicted")
+
+	require.NoError(t, orch.StopSingleVM(ctx, "1"), "Failed to stop VM")
+	orch.UnpinSnapshot("a", spec)
+
+	// Creating a snapshot enforces the quota, while the new snapshot is in use
+	createTestSnapshot(t, orch, "d")
+	require.ElementsMatch(t, []string{"d"}, getTestSnapshotImages(orch))
+
+	orch.collectSnapshots()
+	require.Empty(t, orch.ListSnapshots())
+
+	stats = orch.GetSnapshotStoreStats()
+	require.Equal(t, int64(0), stats.UsedBytes)
+	require.Equal(t, uint64(4), stats.Evictions)
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	policy, err := ParseEvictionPolicy("lfu")
+	require.NoError(t, err)
+	require.Equal(t, EvictLFU, policy)
+
+	_, err = ParseEvictionPolicy("fifo")
+	require.Error(t, err, "Parsed unknown policy")
+}
+
+func TestGetAllocatedBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mem_file")
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	_, err = f.WriteAt(make([]byte, 4096), 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{1}, testSnapshotBytes-1)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(testSnapshotBytes), info.Size())
+
+	allocated := getAllocatedBytes(info)
+	require.GreaterOrEqual(t, allocated, int64(4096))
+	require.Less(t, allocated, info.Size()/2, "Holes of a sparse file must not be counted")
+}
@@ -0,0 +1,103 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"sort"
+
+	"github.com/ease-lab/vhive/misc"
+)
+
+// VMState State of a VM as seen by the orchestrator
+type VMState string
+
+const (
+	// VMRunning The VM runs its function
+	VMRunning VMState = "running"
+	// VMPaused The VM is paused, e.g., to be snapshotted, or loaded but not resumed yet
+	VMPaused VMState = "paused"
+	// VMOffloaded The VM is shut down but its shim, tap and snapshot are kept to load it later
+	VMOffloaded VMState = "offloaded"
+)
+
+// VMInfo Description of a VM that the orchestrator manages
+type VMInfo struct {
+	ID        string
+	ImageName string
+	VMSpec    VMSpec
+	GuestIP   string
+	// Bridge Bridge that the VM's tap is attached to
+	Bridge string
+	State  VMState
+	// SnapshotID Shared snapshot that the VM was started from or published, if any
+	SnapshotID string
+}
+
+// ListVMs Returns the VMs that the orchestrator manages, ordered by their IDs
+func (o *Orchestrator) ListVMs() []VMInfo {
+	vms := make([]VMInfo, 0)
+	for _, vm := range o.vmPool.GetVMMap() {
+		vms = append(vms, o.getVMInfo(vm))
+	}
+
+	sort.Slice(vms, func(i, j int) bool { return vms[i].ID < vms[j].ID })
+
+	return vms
+}
+
+// GetVM Returns the description of a VM
+func (o *Orchestrator) GetVM(vmID string) (VMInfo, error) {
+	vm, err := o.vmPool.GetVM(vmID)
+	if err != nil {
+		return VMInfo{}, misc.NonExistErr("VM " + vmID)
+	}
+
+	return o.getVMInfo(vm), nil
+}
+
+func (o *Orchestrator) getVMInfo(vm *misc.VM) VMInfo {
+	info := VMInfo{ID: vm.ID, State: VMRunning}
+
+	if vm.Ni != nil {
+		info.GuestIP = vm.Ni.PrimaryAddress
+		info.Bridge = vm.Ni.BridgeName
+	}
+
+	if state, ok := o.vmStates.Load(vm.ID); ok {
+		info.State = state.(VMState)
+	}
+
+	// The VMs that are still starting have no config yet
+	if cfgValue, ok := o.vmConfigs.Load(vm.ID); ok {
+		cfg := cfgValue.(*vmConfig)
+		info.ImageName = cfg.imageName
+		info.VMSpec = cfg.spec
+		info.SnapshotID = cfg.snapshotID
+	}
+
+	return info
+}
+
+func (o *Orchestrator) setVMState(vmID string, state VMState) {
+	o.vmStates.Store(vmID, state)
+}
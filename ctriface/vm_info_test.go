@@ -0,0 +1,80 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ease-lab/vhive/misc"
+)
+
+func TestListVMs(t *testing.T) {
+	ctx := context.Background()
+	orch := newTestGCOrchestrator(t)
+
+	for _, vmID := range []string{"1", "0"} {
+		_, _, err := orch.StartVMWithSpec(ctx, vmID, testImageName, VMSpec{MemSizeMib: 16})
+		require.NoError(t, err, "Failed to start VM")
+	}
+
+	vms := orch.ListVMs()
+	require.Len(t, vms, 2)
+	require.Equal(t, "0", vms[0].ID, "VMs must be ordered by their IDs")
+	require.Equal(t, testImageName, vms[0].ImageName)
+	require.Equal(t, uint32(16), vms[0].VMSpec.MemSizeMib)
+	require.Equal(t, VMRunning, vms[0].State)
+
+	require.NoError(t, orch.PauseVM(ctx, "0"), "Failed to pause VM")
+	requireVMState(t, orch, "0", VMPaused)
+	require.NoError(t, orch.CreateSnapshot(ctx, "0"), "Failed to create snapshot of VM")
+
+	info, err := orch.GetVM("0")
+	require.NoError(t, err)
+	require.NotEmpty(t, info.SnapshotID, "Snapshot must be shared")
+
+	_, err = orch.ResumeVM(ctx, "0")
+	require.NoError(t, err, "Failed to resume VM")
+	requireVMState(t, orch, "0", VMRunning)
+
+	require.NoError(t, orch.Offload(ctx, "0"), "Failed to offload VM")
+	requireVMState(t, orch, "0", VMOffloaded)
+
+	_, err = orch.LoadSnapshot(ctx, "0")
+	require.NoError(t, err, "Failed to load snapshot of VM")
+	requireVMState(t, orch, "0", VMPaused)
+
+	require.NoError(t, orch.StopSingleVM(ctx, "1"), "Failed to stop VM")
+	require.Len(t, orch.ListVMs(), 1)
+
+	_, err = orch.GetVM("1")
+	require.IsType(t, misc.NonExistErr(""), err, "Got a stopped VM")
+}
+
+func requireVMState(t *testing.T, orch *Orchestrator, vmID string, state VMState) {
+	info, err := orch.GetVM(vmID)
+	require.NoError(t, err)
+	require.Equal(t, state, info.State)
+}
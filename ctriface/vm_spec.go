@@ -0,0 +1,98 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultVcpuCount      = 1
+	defaultMemSizeMib     = 256
+	defaultTimeoutSeconds = 100
+	defaultKernelArgs     = "ro noapic reboot=k panic=1 pci=off nomodules systemd.log_color=false systemd.unit=firecracker.target init=/sbin/overlay-init tsc=reliable quiet 8250.nr_uarts=0 ipv6.disable=1"
+)
+
+// VMSpec Resources and boot parameters of a VM.
+// Zero-valued fields are replaced with the defaults.
+type VMSpec struct {
+	// VcpuCount Number of vCPUs of the VM
+	VcpuCount uint32 `json:"vcpuCount,omitempty"`
+	// MemSizeMib Guest memory size
+	MemSizeMib uint32 `json:"memSizeMib,omitempty"`
+	// KernelArgs Guest kernel command line
+	KernelArgs string `json:"kernelArgs,omitempty"`
+	// RootDrive Host path to the rootfs image, the VMM's default rootfs is used if empty
+	RootDrive string `json:"rootDrive,omitempty"`
+	// TimeoutSeconds Time to wait for the VM to boot
+	TimeoutSeconds uint32 `json:"timeoutSeconds,omitempty"`
+}
+
+// DefaultVMSpec Returns the spec of a VM with 1 vCPU and 256 MiB of memory
+func DefaultVMSpec() VMSpec {
+	return VMSpec{
+		VcpuCount:      defaultVcpuCount,
+		MemSizeMib:     defaultMemSizeMib,
+		KernelArgs:     defaultKernelArgs,
+		TimeoutSeconds: defaultTimeoutSeconds,
+	}
+}
+
+// WithDefaults Returns a copy of the spec with the unset fields set to the defaults
+func (s VMSpec) WithDefaults() VMSpec {
+	d := DefaultVMSpec()
+
+	if s.VcpuCount == 0 {
+		s.VcpuCount = d.VcpuCount
+	}
+	if s.MemSizeMib == 0 {
+		s.MemSizeMib = d.MemSizeMib
+	}
+	if s.KernelArgs == "" {
+		s.KernelArgs = d.KernelArgs
+	}
+	if s.TimeoutSeconds == 0 {
+		s.TimeoutSeconds = d.TimeoutSeconds
+	}
+
+	return s
+}
+
+// LoadVMSpecs Reads the per-image VM specs from a JSON file
+// that maps image names to specs
+func LoadVMSpecs(path string) (map[string]VMSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read VM specs file")
+	}
+
+	specs := make(map[string]VMSpec)
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, errors.Wrap(err, "failed to parse VM specs file")
+	}
+
+	return specs, nil
+}
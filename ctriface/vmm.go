@@ -0,0 +1,89 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+)
+
+// ErrNotSupported Returned by the VMMs for the operations that they do not support
+var ErrNotSupported = errors.New("operation is not supported by the VMM")
+
+// VMM The backend that hosts the microVMs on behalf of the orchestrator.
+// The orchestrator owns the VM pool (and, hence, the taps), the snapshot
+// directories and the memory manager, whereas the VMM boots, pauses,
+// snapshots, restores and tears down the VMs themselves.
+type VMM interface {
+	// PullImage Makes the image available for the VMs to boot from.
+	// Concurrent pulls of an image share a single pull.
+	PullImage(ctx context.Context, imageName string) error
+	// GetImageStoreStats Returns the usage of the store of the pulled images
+	GetImageStoreStats() ImageStoreStats
+	// CreateVM Boots a VM with the resources of the spec and a network interface
+	// that is already allocated in the VM pool, and starts the function in it.
+	// The image is kept in the image store at least until the VM is stopped.
+	// The VMM records the latency of each of the boot phases in startVMMetric.
+	CreateVM(ctx context.Context, vm *misc.VM, imageName string, spec VMSpec, startVMMetric *metrics.Metric) (*CreateVMResult, error)
+	// CreateVMForSnapshot Creates a VM with the resources of the spec and a network
+	// interface that is already allocated in the VM pool, without starting a function
+	// in it, so that the VM can be loaded from a snapshot of another VM that ran the image
+	// with the spec. The restored guest keeps the network configuration of the other VM,
+	// so the orchestrator connects it to the VM's own network interface.
+	// VMMs that cannot restore snapshots in new VMs return ErrNotSupported.
+	CreateVMForSnapshot(ctx context.Context, vm *misc.VM, imageName string, spec VMSpec) (*CreateVMResult, error)
+	// StopVM Tears down the VM and the function running inside it.
+	// The function is asked to terminate first and is killed if it does not exit
+	// within the stop timeout, or right away if the timeout is zero.
+	// The VMM records the latency of each of the stop phases in stopVMMetric.
+	StopVM(ctx context.Context, vm *misc.VM, stopTimeout time.Duration, stopVMMetric *metrics.Metric) error
+	// PauseVM Pauses the VM
+	PauseVM(ctx context.Context, vmID string) error
+	// ResumeVM Resumes the VM
+	ResumeVM(ctx context.Context, vmID string) error
+	// CreateSnapshot Stores the VMM state and the guest memory of a paused VM
+	CreateSnapshot(ctx context.Context, vmID, snapshotPath, memPath string) error
+	// LoadSnapshot Restores an offloaded VM, or a VM created for a snapshot, from a snapshot
+	LoadSnapshot(ctx context.Context, vmID, snapshotPath, memPath string, enableUserPF bool) error
+	// Offload Shuts down the VM but keeps the shim and other resources around
+	// so that the VM can be loaded from a snapshot later
+	Offload(ctx context.Context, vmID string) error
+	// Close Releases the connections to the VMM
+	Close() error
+}
+
+// CreateVMResult Describes a VM that was booted by the VMM
+type CreateVMResult struct {
+	// MemSizeMib Size of the guest memory
+	MemSizeMib uint32
+	// ImageDigest Digest of the image that the VM runs, if known
+	ImageDigest string
+	// UPFSockPath Socket to receive the guest memory's userfaultfd on,
+	// if user-level page faults are supported by the VMM
+	UPFSockPath string
+}
@@ -0,0 +1,425 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+)
+
+// FakeVMMOp An operation of the VMM that the fake VMM can delay or fail
+type FakeVMMOp string
+
+const (
+	// FakeOpPullImage PullImage operation
+	FakeOpPullImage FakeVMMOp = "PullImage"
+	// FakeOpCreateVM CreateVM operation
+	FakeOpCreateVM FakeVMMOp = "CreateVM"
+	// FakeOpCreateVMForSnapshot CreateVMForSnapshot operation
+	FakeOpCreateVMForSnapshot FakeVMMOp = "CreateVMForSnapshot"
+	// FakeOpStopVM StopVM operation
+	FakeOpStopVM FakeVMMOp = "StopVM"
+	// FakeOpTerminateTask Time for the function to exit after it is asked to terminate,
+	// it is killed if the time exceeds the stop timeout
+	FakeOpTerminateTask FakeVMMOp = "TerminateTask"
+	// FakeOpPauseVM PauseVM operation
+	FakeOpPauseVM FakeVMMOp = "PauseVM"
+	// FakeOpResumeVM ResumeVM operation
+	FakeOpResumeVM FakeVMMOp = "ResumeVM"
+	// FakeOpCreateSnapshot CreateSnapshot operation
+	FakeOpCreateSnapshot FakeVMMOp = "CreateSnapshot"
+	// FakeOpLoadSnapshot LoadSnapshot operation
+	FakeOpLoadSnapshot FakeVMMOp = "LoadSnapshot"
+	// FakeOpOffload Offload operation
+	FakeOpOffload FakeVMMOp = "Offload"
+)
+
+// FakeVMMCfg Config of the fake VMM
+type FakeVMMCfg struct {
+	// Latencies Simulated duration of the operations, zero if not present
+	Latencies map[FakeVMMOp]time.Duration
+	// FailureRate Probability for an operation to fail, in [0, 1]
+	FailureRate float64
+	// ImageSizeBytes Simulated size of each of the images
+	ImageSizeBytes int64
+	// ImageBudgetBytes Size of the images above which the unused images are evicted,
+	// zero if unlimited
+	ImageBudgetBytes int64
+}
+
+// FakeVMState State of a VM in the fake VMM
+type FakeVMState int
+
+const (
+	// FakeVMNotExist The VM does not exist
+	FakeVMNotExist FakeVMState = iota
+	// FakeVMRunning The VM is running
+	FakeVMRunning
+	// FakeVMPaused The VM is paused
+	FakeVMPaused
+	// FakeVMOffloaded The VM is offloaded, i.e., it can be loaded from a snapshot
+	FakeVMOffloaded
+)
+
+// FakeVMM An in-memory VMM that tracks the lifecycle of the VMs without
+// booting them, so that the orchestrator and the layers above it can be
+// exercised on hosts without Firecracker and KVM.
+// User-level page faults are not supported.
+type FakeVMM struct {
+	sync.Mutex
+	FakeVMMCfg
+	vms      map[string]FakeVMState
+	memSizes map[string]uint32 // vmID -> guest memory size in MiB
+	vmImages map[string]string // vmID -> image name
+	images   *imageManager
+	failures map[FakeVMMOp][]error
+	rand     *rand.Rand
+}
+
+// NewFakeVMM Initializes a fake VMM
+func NewFakeVMM(cfg FakeVMMCfg) *FakeVMM {
+	v := new(FakeVMM)
+	v.FakeVMMCfg = cfg
+	v.vms = make(map[string]FakeVMState)
+	v.memSizes = make(map[string]uint32)
+	v.vmImages = make(map[string]string)
+	v.images = newImageManager(cfg.ImageBudgetBytes, v.pullImage, nil)
+	v.failures = make(map[FakeVMMOp][]error)
+	v.rand = rand.New(rand.NewSource(42))
+
+	return v
+}
+
+// FailNext Makes the next call of the operation return the error
+func (v *FakeVMM) FailNext(op FakeVMMOp, err error) {
+	v.Lock()
+	defer v.Unlock()
+
+	v.failures[op] = append(v.failures[op], err)
+}
+
+// GetVMState Returns the state of the VM
+func (v *FakeVMM) GetVMState(vmID string) FakeVMState {
+	v.Lock()
+	defer v.Unlock()
+
+	return v.vms[vmID]
+}
+
+// PullImage Marks the image as pulled unless it is cached
+func (v *FakeVMM) PullImage(ctx context.Context, imageName string) error {
+	if _, err := v.images.acquire(ctx, imageName); err != nil {
+		return err
+	}
+	v.images.release(imageName)
+
+	return nil
+}
+
+// GetImageStoreStats Returns the usage of the simulated image store
+func (v *FakeVMM) GetImageStoreStats() ImageStoreStats {
+	return v.images.getStats()
+}
+
+// CreateVM Registers a running VM
+func (v *FakeVMM) CreateVM(ctx context.Context, vm *misc.VM, imageName string, spec VMSpec, startVMMetric *metrics.Metric) (_ *CreateVMResult, retErr error) {
+	tStart := time.Now()
+	if _, err := v.images.acquire(ctx, imageName); err != nil {
+		return nil, err
+	}
+	startVMMetric.MetricMap[metrics.GetImage] = metrics.ToUS(time.Since(tStart))
+
+	defer func() {
+		if retErr != nil {
+			v.images.release(imageName)
+		}
+	}()
+
+	tStart = time.Now()
+	if err := v.simulate(ctx, FakeOpCreateVM); err != nil {
+		return nil, err
+	}
+	startVMMetric.MetricMap[metrics.FcCreateVM] = metrics.ToUS(time.Since(tStart))
+
+	v.Lock()
+	defer v.Unlock()
+
+	if v.vms[vm.ID] != FakeVMNotExist {
+		return nil, misc.AlreadyExistErr("fake VMM: VM " + vm.ID)
+	}
+
+	v.vms[vm.ID] = FakeVMRunning
+	v.memSizes[vm.ID] = spec.MemSizeMib
+	v.vmImages[vm.ID] = imageName
+
+	return &CreateVMResult{
+		MemSizeMib:  spec.MemSizeMib,
+		ImageDigest: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(imageName))),
+	}, nil
+}
+
+// CreateVMForSnapshot Registers an offloaded VM that can be loaded from any snapshot
+func (v *FakeVMM) CreateVMForSnapshot(ctx context.Context, vm *misc.VM, imageName string, spec VMSpec) (*CreateVMResult, error) {
+	if err := v.simulate(ctx, FakeOpCreateVMForSnapshot); err != nil {
+		return nil, err
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	if v.vms[vm.ID] != FakeVMNotExist {
+		return nil, misc.AlreadyExistErr("fake VMM: VM " + vm.ID)
+	}
+
+	v.vms[vm.ID] = FakeVMOffloaded
+	v.memSizes[vm.ID] = spec.MemSizeMib
+
+	return &CreateVMResult{MemSizeMib: spec.MemSizeMib}, nil
+}
+
+// StopVM Terminates the function, killing it if it does not exit within the stop timeout,
+// and removes the VM
+func (v *FakeVMM) StopVM(ctx context.Context, vm *misc.VM, stopTimeout time.Duration, stopVMMetric *metrics.Metric) error {
+	isExited := false
+	if stopTimeout > 0 {
+		v.Lock()
+		termLatency := v.Latencies[FakeOpTerminateTask]
+		v.Unlock()
+
+		isExited = termLatency <= stopTimeout
+		if !isExited {
+			termLatency = stopTimeout
+		}
+
+		tStart := time.Now()
+		select {
+		case <-time.After(termLatency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		stopVMMetric.MetricMap[metrics.TaskTerm] = metrics.ToUS(time.Since(tStart))
+	}
+
+	if !isExited {
+		stopVMMetric.MetricMap[metrics.TaskKill] = 0
+	}
+
+	tStart := time.Now()
+	if err := v.simulate(ctx, FakeOpStopVM); err != nil {
+		return err
+	}
+	stopVMMetric.MetricMap[metrics.FcStopVM] = metrics.ToUS(time.Since(tStart))
+
+	v.Lock()
+
+	if v.vms[vm.ID] == FakeVMNotExist {
+		v.Unlock()
+		return misc.NonExistErr("fake VMM: VM " + vm.ID)
+	}
+
+	imageName, hasImage := v.vmImages[vm.ID]
+	delete(v.vms, vm.ID)
+	delete(v.memSizes, vm.ID)
+	delete(v.vmImages, vm.ID)
+	v.Unlock()
+
+	if hasImage {
+		v.images.release(imageName)
+	}
+
+	return nil
+}
+
+// PauseVM Pauses a running VM
+func (v *FakeVMM) PauseVM(ctx context.Context, vmID string) error {
+	if err := v.simulate(ctx, FakeOpPauseVM); err != nil {
+		return err
+	}
+
+	return v.transition(vmID, FakeVMRunning, FakeVMPaused)
+}
+
+// ResumeVM Resumes a paused VM
+func (v *FakeVMM) ResumeVM(ctx context.Context, vmID string) error {
+	if err := v.simulate(ctx, FakeOpResumeVM); err != nil {
+		return err
+	}
+
+	return v.transition(vmID, FakeVMPaused, FakeVMRunning)
+}
+
+// CreateSnapshot Writes placeholder snapshot files for a paused VM.
+// The guest memory file is sparse but has the size of the guest memory.
+func (v *FakeVMM) CreateSnapshot(ctx context.Context, vmID, snapshotPath, memPath string) error {
+	if err := v.simulate(ctx, FakeOpCreateSnapshot); err != nil {
+		return err
+	}
+
+	v.Lock()
+	state, memSizeMib := v.vms[vmID], v.memSizes[vmID]
+	v.Unlock()
+
+	if state != FakeVMPaused {
+		return fmt.Errorf("fake VMM: cannot snapshot VM %s that is not paused", vmID)
+	}
+
+	if err := ioutil.WriteFile(snapshotPath, []byte(vmID), 0644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(memPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Truncate(int64(memSizeMib) * 1024 * 1024)
+}
+
+// LoadSnapshot Restores an offloaded VM in the paused state
+func (v *FakeVMM) LoadSnapshot(ctx context.Context, vmID, snapshotPath, memPath string, enableUserPF bool) error {
+	if err := v.simulate(ctx, FakeOpLoadSnapshot); err != nil {
+		return err
+	}
+
+	if enableUserPF {
+		return fmt.Errorf("fake VMM: user-level page faults are not supported")
+	}
+
+	if _, err := os.Stat(snapshotPath); err != nil {
+		return err
+	}
+
+	memFileInfo, err := os.Stat(memPath)
+	if err != nil {
+		return err
+	}
+
+	v.Lock()
+	memSizeMib := v.memSizes[vmID]
+	v.Unlock()
+
+	if memFileInfo.Size() != int64(memSizeMib)*1024*1024 {
+		return fmt.Errorf("fake VMM: guest memory file does not match the memory of VM %s", vmID)
+	}
+
+	return v.transition(vmID, FakeVMOffloaded, FakeVMPaused)
+}
+
+// Offload Offloads a VM
+func (v *FakeVMM) Offload(ctx context.Context, vmID string) error {
+	if err := v.simulate(ctx, FakeOpOffload); err != nil {
+		return err
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	switch v.vms[vmID] {
+	case FakeVMNotExist:
+		return misc.NonExistErr("fake VMM: VM " + vmID)
+	case FakeVMOffloaded:
+		return fmt.Errorf("fake VMM: VM %s is already offloaded", vmID)
+	}
+
+	v.vms[vmID] = FakeVMOffloaded
+
+	return nil
+}
+
+// Close Does nothing
+func (v *FakeVMM) Close() error {
+	return nil
+}
+
+// pullImage Simulates a pull of an image of the configured size
+func (v *FakeVMM) pullImage(ctx context.Context, imageName string, pull *imagePull) (containerd.Image, int64, error) {
+	pull.setProgress(0, v.ImageSizeBytes)
+
+	if err := v.simulate(ctx, FakeOpPullImage); err != nil {
+		return nil, 0, err
+	}
+
+	pull.setProgress(v.ImageSizeBytes, v.ImageSizeBytes)
+
+	return nil, v.ImageSizeBytes, nil
+}
+
+func (v *FakeVMM) transition(vmID string, from, to FakeVMState) error {
+	v.Lock()
+	defer v.Unlock()
+
+	state := v.vms[vmID]
+	if state == FakeVMNotExist {
+		return misc.NonExistErr("fake VMM: VM " + vmID)
+	}
+
+	if state != from {
+		return fmt.Errorf("fake VMM: VM %s is in state %d, expected %d", vmID, state, from)
+	}
+
+	v.vms[vmID] = to
+
+	return nil
+}
+
+// simulate Waits for the latency of the operation and decides whether it fails
+func (v *FakeVMM) simulate(ctx context.Context, op FakeVMMOp) error {
+	v.Lock()
+	latency := v.Latencies[op]
+
+	var err error
+	if failures := v.failures[op]; len(failures) > 0 {
+		err = failures[0]
+		v.failures[op] = failures[1:]
+	} else if v.FailureRate > 0 && v.rand.Float64() < v.FailureRate {
+		err = fmt.Errorf("fake VMM: injected %s failure", op)
+	}
+	v.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err != nil {
+		log.WithError(err).Debugf("fake VMM: %s failed", op)
+	}
+
+	return err
+}
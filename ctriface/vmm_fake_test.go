@@ -0,0 +1,243 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/taps"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestFakeVMMLifecycle(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	snapFile, memFile := filepath.Join(dir, "snap_file"), filepath.Join(dir, "mem_file")
+
+	v := NewFakeVMM(FakeVMMCfg{})
+	vm := misc.NewVM("1")
+
+	startMetric := metrics.NewMetric()
+	resp, err := v.CreateVM(ctx, vm, testImageName, VMSpec{MemSizeMib: 512}, startMetric)
+	require.NoError(t, err, "Failed to create VM")
+	require.Equal(t, uint32(512), resp.MemSizeMib)
+	require.Contains(t, startMetric.MetricMap, metrics.GetImage)
+	require.Equal(t, FakeVMRunning, v.GetVMState(vm.ID))
+
+	_, err = v.CreateVM(ctx, vm, testImageName, DefaultVMSpec(), metrics.NewMetric())
+	require.Error(t, err, "Created the same VM twice")
+
+	require.Error(t, v.CreateSnapshot(ctx, vm.ID, snapFile, memFile), "Snapshotted a running VM")
+
+	require.NoError(t, v.PauseVM(ctx, vm.ID), "Failed to pause VM")
+	require.NoError(t, v.CreateSnapshot(ctx, vm.ID, snapFile, memFile), "Failed to create snapshot")
+	require.NoError(t, v.ResumeVM(ctx, vm.ID), "Failed to resume VM")
+
+	require.NoError(t, v.Offload(ctx, vm.ID), "Failed to offload VM")
+	require.Equal(t, FakeVMOffloaded, v.GetVMState(vm.ID))
+	require.Error(t, v.LoadSnapshot(ctx, vm.ID, snapFile, memFile, true), "Loaded VM with UPF")
+	require.NoError(t, v.LoadSnapshot(ctx, vm.ID, snapFile, memFile, false), "Failed to load snapshot")
+	require.NoError(t, v.ResumeVM(ctx, vm.ID), "Failed to resume VM")
+
+	require.NoError(t, v.StopVM(ctx, vm, 0, metrics.NewMetric()), "Failed to stop VM")
+	require.Equal(t, FakeVMNotExist, v.GetVMState(vm.ID))
+
+	err = v.PauseVM(ctx, vm.ID)
+	require.IsType(t, misc.NonExistErr(""), err, "Paused a stopped VM")
+}
+
+func TestFakeVMMFailures(t *testing.T) {
+	ctx := context.Background()
+	injected := errors.New("injected")
+
+	v := NewFakeVMM(FakeVMMCfg{})
+	vm := misc.NewVM("1")
+
+	v.FailNext(FakeOpCreateVM, injected)
+	_, err := v.CreateVM(ctx, vm, testImageName, DefaultVMSpec(), metrics.NewMetric())
+	require.Equal(t, injected, err)
+	require.Equal(t, FakeVMNotExist, v.GetVMState(vm.ID))
+
+	_, err = v.CreateVM(ctx, vm, testImageName, DefaultVMSpec(), metrics.NewMetric())
+	require.NoError(t, err, "Injected failure must only apply once")
+
+	v = NewFakeVMM(FakeVMMCfg{FailureRate: 1})
+	require.Error(t, v.PullImage(ctx, testImageName), "Operation must fail with failure rate 1")
+}
+
+func TestFakeVMMLatency(t *testing.T) {
+	latency := 50 * time.Millisecond
+
+	v := NewFakeVMM(FakeVMMCfg{Latencies: map[FakeVMMOp]time.Duration{FakeOpCreateVM: latency}})
+
+	startMetric := metrics.NewMetric()
+	_, err := v.CreateVM(context.Background(), misc.NewVM("1"), testImageName, DefaultVMSpec(), startMetric)
+	require.NoError(t, err, "Failed to create VM")
+	require.GreaterOrEqual(t, startMetric.MetricMap[metrics.FcCreateVM], metrics.ToUS(latency))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	_, err = v.CreateVM(ctx, misc.NewVM("2"), testImageName, DefaultVMSpec(), metrics.NewMetric())
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestFakeVMMGracefulStop(t *testing.T) {
+	ctx := context.Background()
+	termLatency := 20 * time.Millisecond
+
+	v := NewFakeVMM(FakeVMMCfg{Latencies: map[FakeVMMOp]time.Duration{FakeOpTerminateTask: termLatency}})
+
+	for _, tc := range []struct {
+		stopTimeout time.Duration
+		isKilled    bool
+	}{
+		{stopTimeout: time.Second, isKilled: false},
+		{stopTimeout: time.Millisecond, isKilled: true},
+		{stopTimeout: 0, isKilled: true},
+	} {
+		vm := misc.NewVM("1")
+		_, err := v.CreateVM(ctx, vm, testImageName, DefaultVMSpec(), metrics.NewMetric())
+		require.NoError(t, err, "Failed to create VM")
+
+		stopMetric := metrics.NewMetric()
+		require.NoError(t, v.StopVM(ctx, vm, tc.stopTimeout, stopMetric), "Failed to stop VM")
+		require.Contains(t, stopMetric.MetricMap, metrics.FcStopVM)
+
+		_, isKilled := stopMetric.MetricMap[metrics.TaskKill]
+		require.Equal(t, tc.isKilled, isKilled, "Task must be killed only after the stop timeout")
+
+		if tc.stopTimeout > 0 {
+			require.GreaterOrEqual(t, stopMetric.MetricMap[metrics.TaskTerm], metrics.ToUS(minDuration(termLatency, tc.stopTimeout)))
+		} else {
+			require.NotContains(t, stopMetric.MetricMap, metrics.TaskTerm)
+		}
+	}
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func TestFakeVMMOrchestrator(t *testing.T) {
+	ctx := context.Background()
+	snapshotsDir := t.TempDir()
+
+	orch := NewOrchestrator(
+		"devmapper",
+		"",
+		WithTestModeOn(true),
+		WithSnapshotsDir(snapshotsDir),
+		WithVMM(NewFakeVMM(FakeVMMCfg{})),
+		WithVMPool(misc.NewVMPoolWithTapManager(taps.NewFakeTapManager())),
+		WithVMSpecs(map[string]VMSpec{testImageName: {MemSizeMib: 512}}),
+	)
+
+	vmID := "1"
+
+	spec := orch.GetVMSpec(testImageName)
+	require.Equal(t, uint32(512), spec.MemSizeMib)
+	require.Equal(t, uint32(defaultVcpuCount), spec.VcpuCount, "Unset fields must have defaults")
+
+	resp, _, err := orch.StartVM(ctx, vmID, testImageName)
+	require.NoError(t, err, "Failed to start VM")
+	require.NotEmpty(t, resp.GuestIP)
+
+	err = orch.PauseVM(ctx, vmID)
+	require.NoError(t, err, "Failed to pause VM")
+
+	err = orch.CreateSnapshot(ctx, vmID)
+	require.NoError(t, err, "Failed to create snapshot of VM")
+
+	memFileInfo, err := os.Stat(orch.getMemoryFile(vmID))
+	require.NoError(t, err, "Failed to stat guest memory file")
+	require.Equal(t, int64(512*1024*1024), memFileInfo.Size(), "Guest memory must follow the VM spec")
+
+	err = orch.Offload(ctx, vmID)
+	require.NoError(t, err, "Failed to offload VM")
+
+	_, err = orch.LoadSnapshot(ctx, vmID)
+	require.NoError(t, err, "Failed to load snapshot of VM")
+
+	_, err = orch.ResumeVM(ctx, vmID)
+	require.NoError(t, err, "Failed to resume VM")
+
+	stopMetric, err := orch.StopVM(ctx, vmID)
+	require.NoError(t, err, "Failed to stop VM")
+	require.Contains(t, stopMetric.MetricMap, metrics.TaskTerm)
+
+	orch.Cleanup()
+}
+
+func TestFakeVMMOrchestratorErrors(t *testing.T) {
+	ctx := context.Background()
+
+	vmm := NewFakeVMM(FakeVMMCfg{Latencies: map[FakeVMMOp]time.Duration{FakeOpResumeVM: time.Second}})
+	orch := NewOrchestrator(
+		"devmapper",
+		"",
+		WithTestModeOn(true),
+		WithSnapshotsDir(t.TempDir()),
+		WithVMM(vmm),
+		WithVMPool(misc.NewVMPoolWithTapManager(taps.NewFakeTapManager())),
+	)
+	defer func() {
+		_ = orch.StopActiveVMs()
+		orch.Cleanup()
+	}()
+
+	_, err := orch.StopVM(ctx, "missing")
+	require.Equal(t, codes.NotFound, misc.GRPCCode(err), "Stopped a missing VM")
+
+	err = orch.Offload(ctx, "missing")
+	require.Equal(t, codes.NotFound, misc.GRPCCode(err), "Offloaded a missing VM")
+
+	vmm.FailNext(FakeOpCreateVM, errors.New("injected"))
+	_, _, err = orch.StartVM(ctx, "1", testImageName)
+	require.Equal(t, codes.Internal, misc.GRPCCode(err), "VMM failures must be internal errors")
+
+	_, _, err = orch.StartVM(ctx, "1", testImageName)
+	require.NoError(t, err, "Failed to start VM after a failure")
+
+	_, _, err = orch.StartVM(ctx, "1", testImageName)
+	require.Equal(t, codes.AlreadyExists, misc.GRPCCode(err), "Started the same VM twice")
+
+	require.NoError(t, orch.PauseVM(ctx, "1"), "Failed to pause VM")
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	_, err = orch.ResumeVM(timeoutCtx, "1")
+	require.Equal(t, codes.DeadlineExceeded, misc.GRPCCode(err), "Resume must time out")
+}
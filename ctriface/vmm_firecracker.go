@@ -0,0 +1,583 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/oci"
+
+	fcclient "github.com/firecracker-microvm/firecracker-containerd/firecracker-control/client"
+	"github.com/firecracker-microvm/firecracker-containerd/proto" // note: from the original repo
+	"github.com/firecracker-microvm/firecracker-containerd/runtime/firecrackeroci"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/tracing"
+)
+
+// firecrackerVMM Runs the VMs in Firecracker by means of firecracker-containerd
+type firecrackerVMM struct {
+	images      *imageManager
+	registries  *registryHosts
+	vmImages    sync.Map // vmID string -> image name string
+	workloadIo  sync.Map // vmID string -> WorkloadIoWriter
+	snapshotter string
+	client      *containerd.Client
+	fcClient    *fcclient.Client
+}
+
+func newFirecrackerVMM(snapshotter string, imageBudgetBytes int64, registries *registryHosts) *firecrackerVMM {
+	var err error
+
+	v := new(firecrackerVMM)
+	v.registries = registries
+	v.images = newImageManager(imageBudgetBytes, v.pullImage, v.removeImage)
+	v.snapshotter = snapshotter
+
+	log.Info("Creating containerd client")
+	v.client, err = containerd.New(containerdAddress)
+	if err != nil {
+		log.Fatal("Failed to start containerd client", err)
+	}
+	log.Info("Created containerd client")
+
+	log.Info("Creating firecracker client")
+	v.fcClient, err = fcclient.New(containerdTTRPCAddress)
+	if err != nil {
+		log.Fatal("Failed to start firecracker client", err)
+	}
+	log.Info("Created firecracker client")
+
+	return v
+}
+
+// PullImage Pulls the image unless it is cached
+func (v *firecrackerVMM) PullImage(ctx context.Context, imageName string) error {
+	if _, err := v.images.acquire(ctx, imageName); err != nil {
+		return err
+	}
+	v.images.release(imageName)
+
+	return nil
+}
+
+// GetImageStoreStats Returns the usage of the image store
+func (v *firecrackerVMM) GetImageStoreStats() ImageStoreStats {
+	return v.images.getStats()
+}
+
+// CreateVM Boots a VM and starts the function container inside it
+func (v *firecrackerVMM) CreateVM(ctx context.Context, vm *misc.VM, imageName string, spec VMSpec, startVMMetric *metrics.Metric) (_ *CreateVMResult, retErr error) {
+	var (
+		tStart time.Time
+		err    error
+		vmID   = vm.ID
+	)
+
+	logger := log.WithFields(log.Fields{"vmID": vmID, "image": imageName})
+
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+	tStart = time.Now()
+	_, span := tracing.StartSpan(ctx, metrics.GetImage)
+	image, err := v.images.acquire(ctx, imageName)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get/pull image")
+	}
+	startVMMetric.MetricMap[metrics.GetImage] = metrics.ToUS(time.Since(tStart))
+	vm.Image = &image
+
+	defer func() {
+		if retErr != nil {
+			v.images.release(imageName)
+		}
+	}()
+
+	tStart = time.Now()
+	conf := v.getVMConfig(vm, spec)
+	_, span = tracing.StartSpan(ctx, metrics.FcCreateVM)
+	resp, err := v.fcClient.CreateVM(ctx, conf)
+	tracing.EndSpan(span, err)
+	startVMMetric.MetricMap[metrics.FcCreateVM] = metrics.ToUS(time.Since(tStart))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the microVM in firecracker-containerd")
+	}
+
+	defer func() {
+		if retErr != nil {
+			if _, err := v.fcClient.StopVM(ctx, &proto.StopVMRequest{VMID: vmID}); err != nil {
+				logger.WithError(err).Errorf("failed to stop firecracker-containerd VM after failure")
+			}
+		}
+	}()
+
+	logger.Debug("StartVM: Creating a new container")
+	tStart = time.Now()
+	_, span = tracing.StartSpan(ctx, metrics.NewContainer)
+	container, err := v.client.NewContainer(
+		ctx,
+		vmID,
+		containerd.WithSnapshotter(v.snapshotter),
+		containerd.WithNewSnapshot(vmID, *vm.Image),
+		containerd.WithNewSpec(
+			oci.WithImageConfig(*vm.Image),
+			firecrackeroci.WithVMID(vmID),
+			firecrackeroci.WithVMNetwork,
+		),
+		containerd.WithRuntime("aws.firecracker", nil),
+	)
+	tracing.EndSpan(span, err)
+	startVMMetric.MetricMap[metrics.NewContainer] = metrics.ToUS(time.Since(tStart))
+	vm.Container = &container
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create a container")
+	}
+
+	defer func() {
+		if retErr != nil {
+			if err := container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+				logger.WithError(err).Errorf("failed to delete container after failure")
+			}
+		}
+	}()
+
+	iologger := NewWorkloadIoWriter(vmID)
+	v.workloadIo.Store(vmID, &iologger)
+	logger.Debug("StartVM: Creating a new task")
+	tStart = time.Now()
+	_, span = tracing.StartSpan(ctx, metrics.NewTask)
+	task, err := container.NewTask(ctx, cio.NewCreator(cio.WithStreams(os.Stdin, iologger, iologger)))
+	tracing.EndSpan(span, err)
+	startVMMetric.MetricMap[metrics.NewTask] = metrics.ToUS(time.Since(tStart))
+	vm.Task = &task
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create a task")
+	}
+
+	defer func() {
+		if retErr != nil {
+			if _, err := task.Delete(ctx); err != nil {
+				logger.WithError(err).Errorf("failed to delete task after failure")
+			}
+		}
+	}()
+
+	logger.Debug("StartVM: Waiting for the task to get ready")
+	tStart = time.Now()
+	_, span = tracing.StartSpan(ctx, metrics.TaskWait)
+	ch, err := task.Wait(ctx)
+	tracing.EndSpan(span, err)
+	startVMMetric.MetricMap[metrics.TaskWait] = metrics.ToUS(time.Since(tStart))
+	vm.TaskCh = ch
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to wait for a task")
+	}
+
+	defer func() {
+		if retErr != nil {
+			if err := task.Kill(ctx, syscall.SIGKILL); err != nil {
+				logger.WithError(err).Errorf("failed to kill task after failure")
+			}
+		}
+	}()
+
+	logger.Debug("StartVM: Starting the task")
+	tStart = time.Now()
+	_, span = tracing.StartSpan(ctx, metrics.TaskStart)
+	err = task.Start(ctx)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start a task")
+	}
+	startVMMetric.MetricMap[metrics.TaskStart] = metrics.ToUS(time.Since(tStart))
+
+	v.vmImages.Store(vmID, imageName)
+
+	return &CreateVMResult{
+		MemSizeMib:  conf.MachineCfg.MemSizeMib,
+		ImageDigest: (*vm.Image).Target().Digest.String(),
+		UPFSockPath: resp.UPFSockPath,
+	}, nil
+}
+
+// CreateVMForSnapshot Is not supported: the guest in a snapshot uses the rootfs drive
+// of the container of the VM that the snapshot was taken of, which is deleted with
+// that VM, and the new VM would hold no reference to the image of the function
+func (v *firecrackerVMM) CreateVMForSnapshot(ctx context.Context, vm *misc.VM, imageName string, spec VMSpec) (*CreateVMResult, error) {
+	return nil, ErrNotSupported
+}
+
+// StopVM Terminates the function task, killing it if it does not exit in time,
+// and tears down the container and the VM
+func (v *firecrackerVMM) StopVM(ctx context.Context, vm *misc.VM, stopTimeout time.Duration, stopVMMetric *metrics.Metric) error {
+	var tStart time.Time
+
+	logger := log.WithFields(log.Fields{"vmID": vm.ID})
+
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+
+	// VMs created for a snapshot have no task until the snapshot is loaded
+	if vm.Task != nil {
+		task := *vm.Task
+
+		isExited := false
+		if stopTimeout > 0 {
+			tStart = time.Now()
+			exited, err := signalTask(ctx, task, vm.TaskCh, syscall.SIGTERM, stopTimeout)
+			if err != nil {
+				logger.WithError(err).Warn("Failed to terminate the task")
+			}
+			stopVMMetric.MetricMap[metrics.TaskTerm] = metrics.ToUS(time.Since(tStart))
+			isExited = exited
+		}
+
+		if !isExited {
+			if stopTimeout > 0 {
+				logger.Warnf("Task did not exit within %s, killing it", stopTimeout)
+			}
+
+			tStart = time.Now()
+			if _, err := signalTask(ctx, task, vm.TaskCh, syscall.SIGKILL, 0); err != nil {
+				logger.WithError(err).Error("Failed to kill the task")
+				return err
+			}
+			stopVMMetric.MetricMap[metrics.TaskKill] = metrics.ToUS(time.Since(tStart))
+		}
+
+		tStart = time.Now()
+		if err := deleteTask(ctx, task); err != nil {
+			logger.WithError(err).Error("failed to delete task")
+			return err
+		}
+		stopVMMetric.MetricMap[metrics.TaskDelete] = metrics.ToUS(time.Since(tStart))
+	}
+
+	if vm.Container != nil {
+		tStart = time.Now()
+		container := *vm.Container
+		if err := container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+			logger.WithError(err).Error("failed to delete container")
+			return err
+		}
+		stopVMMetric.MetricMap[metrics.ContainerDelete] = metrics.ToUS(time.Since(tStart))
+	}
+
+	tStart = time.Now()
+	if _, err := v.fcClient.StopVM(ctx, &proto.StopVMRequest{VMID: vm.ID}); err != nil {
+		logger.WithError(err).Error("failed to stop firecracker-containerd VM")
+		return err
+	}
+	stopVMMetric.MetricMap[metrics.FcStopVM] = metrics.ToUS(time.Since(tStart))
+
+	v.workloadIo.Delete(vm.ID)
+
+	if imageName, ok := v.vmImages.Load(vm.ID); ok {
+		v.vmImages.Delete(vm.ID)
+		v.images.release(imageName.(string))
+	}
+
+	return nil
+}
+
+// signalTask Sends the signal to the task and waits for the task to exit,
+// for at most the timeout unless the timeout is zero.
+// Returns whether the task exited.
+func signalTask(ctx context.Context, task containerd.Task, taskCh <-chan containerd.ExitStatus, signal syscall.Signal, timeout time.Duration) (bool, error) {
+	if err := task.Kill(ctx, signal); err != nil {
+		return false, err
+	}
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case <-taskCh:
+		return true, nil
+	case <-timeoutCh:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// deleteTask Deletes an exited task. Some tasks need extra time to die after
+// they exit (Issue#15, lr_training), so the deletion is retried a few times.
+func deleteTask(ctx context.Context, task containerd.Task) error {
+	const (
+		maxAttempts = 5
+		retryDelay  = 100 * time.Millisecond
+	)
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if _, err = task.Delete(ctx); err == nil {
+			return nil
+		}
+
+		log.WithError(err).Debugf("Failed to delete task, attempt %d of %d", attempt, maxAttempts)
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// PauseVM Pauses a VM
+func (v *firecrackerVMM) PauseVM(ctx context.Context, vmID string) error {
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+	_, err := v.fcClient.PauseVM(ctx, &proto.PauseVMRequest{VMID: vmID})
+
+	return err
+}
+
+// ResumeVM Resumes a VM
+func (v *firecrackerVMM) ResumeVM(ctx context.Context, vmID string) error {
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+	_, err := v.fcClient.ResumeVM(ctx, &proto.ResumeVMRequest{VMID: vmID})
+
+	return err
+}
+
+// CreateSnapshot Creates a snapshot of a VM
+func (v *firecrackerVMM) CreateSnapshot(ctx context.Context, vmID, snapshotPath, memPath string) error {
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+
+	req := &proto.CreateSnapshotRequest{
+		VMID:             vmID,
+		SnapshotFilePath: snapshotPath,
+		MemFilePath:      memPath,
+	}
+
+	_, err := v.fcClient.CreateSnapshot(ctx, req)
+
+	return err
+}
+
+// LoadSnapshot Loads a snapshot of a VM
+func (v *firecrackerVMM) LoadSnapshot(ctx context.Context, vmID, snapshotPath, memPath string, enableUserPF bool) error {
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+
+	req := &proto.LoadSnapshotRequest{
+		VMID:             vmID,
+		SnapshotFilePath: snapshotPath,
+		MemFilePath:      memPath,
+		EnableUserPF:     enableUserPF,
+	}
+
+	_, err := v.fcClient.LoadSnapshot(ctx, req)
+
+	return err
+}
+
+// Offload Shuts down the VM but leaves shim and other resources running.
+func (v *firecrackerVMM) Offload(ctx context.Context, vmID string) error {
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+	_, err := v.fcClient.Offload(ctx, &proto.OffloadRequest{VMID: vmID})
+
+	return err
+}
+
+// Close Closes the firecracker-containerd and the containerd clients
+func (v *firecrackerVMM) Close() error {
+	log.Info("Closing fcClient")
+	if err := v.fcClient.Close(); err != nil {
+		return err
+	}
+
+	log.Info("Closing containerd client")
+	return v.client.Close()
+}
+
+// pullProgressInterval How often the progress of the image pulls is updated
+const pullProgressInterval = time.Second
+
+// pullImage Pulls the image, logging the progress of the pull periodically
+func (v *firecrackerVMM) pullImage(ctx context.Context, imageName string, pull *imagePull) (containerd.Image, int64, error) {
+	var (
+		image containerd.Image
+		err   error
+	)
+
+	logger := log.WithFields(log.Fields{"image": imageName})
+
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+
+	progress := newPullProgressTracker(v.client.ContentStore())
+
+	pullOpts := []containerd.RemoteOpt{
+		containerd.WithPullUnpack,
+		containerd.WithPullSnapshotter(v.snapshotter),
+		containerd.WithResolver(v.registries.newResolver(ctx)),
+		containerd.WithImageHandler(progress.handler()),
+	}
+
+	imageURL := getImageURL(imageName)
+
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	go func() {
+		ticker := time.NewTicker(pullProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				pull.setProgress(progress.update(ctx))
+				p := pull.getProgress()
+				logger.Infof("Pulling image: fetched %d of %d bytes in %s", p.FetchedBytes, p.TotalBytes, p.Elapsed)
+			case <-doneCh:
+				return
+			}
+		}
+	}()
+
+	image, err = v.client.Pull(ctx, imageURL, pullOpts...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sizeBytes, err := image.Size(ctx)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to get the size of image %s", imageName)
+	}
+	pull.setProgress(sizeBytes, sizeBytes)
+
+	return image, sizeBytes, nil
+}
+
+// pullProgressTracker Tracks how much of the content of an image is fetched
+type pullProgressTracker struct {
+	sync.Mutex
+	store content.Store
+	descs map[digest.Digest]int64 // content digest -> size in bytes
+}
+
+func newPullProgressTracker(store content.Store) *pullProgressTracker {
+	t := new(pullProgressTracker)
+	t.store = store
+	t.descs = make(map[digest.Digest]int64)
+
+	return t
+}
+
+// handler Returns an image handler that records the content of the image
+// as the pull discovers it
+func (t *pullProgressTracker) handler() images.HandlerFunc {
+	return func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		t.Lock()
+		t.descs[desc.Digest] = desc.Size
+		t.Unlock()
+
+		return nil, nil
+	}
+}
+
+// update Returns the number of the bytes that are fetched so far and the size
+// of the content discovered so far, from the ongoing and the completed ingests
+func (t *pullProgressTracker) update(ctx context.Context) (fetchedBytes, totalBytes int64) {
+	ongoing := make(map[digest.Digest]int64)
+
+	statuses, err := t.store.ListStatuses(ctx)
+	if err != nil {
+		log.WithError(err).Debug("Failed to list the ongoing ingests")
+	}
+	for _, status := range statuses {
+		ongoing[status.Expected] = status.Offset
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	for dgst, size := range t.descs {
+		totalBytes += size
+
+		if offset, ok := ongoing[dgst]; ok {
+			fetchedBytes += offset
+		} else if _, err := t.store.Info(ctx, dgst); err == nil {
+			fetchedBytes += size
+		}
+	}
+
+	return fetchedBytes, totalBytes
+}
+
+// removeImage Removes the image and, synchronously, its content and snapshots
+func (v *firecrackerVMM) removeImage(ctx context.Context, imageName string) error {
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+
+	return v.client.ImageService().Delete(ctx, getImageURL(imageName), images.SynchronousDelete())
+}
+
+func (v *firecrackerVMM) getVMConfig(vm *misc.VM, spec VMSpec) *proto.CreateVMRequest {
+	req := &proto.CreateVMRequest{
+		VMID:           vm.ID,
+		TimeoutSeconds: spec.TimeoutSeconds,
+		KernelArgs:     spec.KernelArgs,
+		MachineCfg: &proto.FirecrackerMachineConfiguration{
+			VcpuCount:  spec.VcpuCount,
+			MemSizeMib: spec.MemSizeMib,
+		},
+		NetworkInterfaces: []*proto.FirecrackerNetworkInterface{{
+			StaticConfig: &proto.StaticNetworkConfiguration{
+				MacAddress:  vm.Ni.MacAddress,
+				HostDevName: vm.Ni.HostDevName,
+				IPConfig: &proto.IPConfiguration{
+					PrimaryAddr: vm.Ni.PrimaryAddress + vm.Ni.Subnet,
+					GatewayAddr: vm.Ni.GatewayAddress,
+					Nameservers: getK8sDNS(),
+				},
+			},
+		}},
+	}
+
+	if spec.RootDrive != "" {
+		// The rootfs is shared by the VMs
+		req.RootDrive = &proto.FirecrackerRootDrive{HostPath: spec.RootDrive, IsWritable: false}
+	}
+
+	return req
+}
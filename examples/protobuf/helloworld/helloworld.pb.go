@@ -229,36 +229,153 @@ func (m *FwdHelloResp) GetPayload() string {
 	return ""
 }
 
+// The request message containing the raw payload to forward to a function.
+type InvokeReq struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Image                string   `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	Method               string   `protobuf:"bytes,3,opt,name=method,proto3" json:"method,omitempty"`
+	Payload              []byte   `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InvokeReq) Reset()         { *m = InvokeReq{} }
+func (m *InvokeReq) String() string { return proto.CompactTextString(m) }
+func (*InvokeReq) ProtoMessage()    {}
+func (*InvokeReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_17b8c58d586b62f2, []int{4}
+}
+
+func (m *InvokeReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InvokeReq.Unmarshal(m, b)
+}
+func (m *InvokeReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InvokeReq.Marshal(b, m, deterministic)
+}
+func (m *InvokeReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InvokeReq.Merge(m, src)
+}
+func (m *InvokeReq) XXX_Size() int {
+	return xxx_messageInfo_InvokeReq.Size(m)
+}
+func (m *InvokeReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_InvokeReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InvokeReq proto.InternalMessageInfo
+
+func (m *InvokeReq) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *InvokeReq) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *InvokeReq) GetMethod() string {
+	if m != nil {
+		return m.Method
+	}
+	return ""
+}
+
+func (m *InvokeReq) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+// The response message containing the raw payload returned by a function.
+type InvokeResp struct {
+	IsColdStart          bool     `protobuf:"varint,1,opt,name=isColdStart,proto3" json:"isColdStart,omitempty"`
+	Payload              []byte   `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InvokeResp) Reset()         { *m = InvokeResp{} }
+func (m *InvokeResp) String() string { return proto.CompactTextString(m) }
+func (*InvokeResp) ProtoMessage()    {}
+func (*InvokeResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_17b8c58d586b62f2, []int{5}
+}
+
+func (m *InvokeResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InvokeResp.Unmarshal(m, b)
+}
+func (m *InvokeResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InvokeResp.Marshal(b, m, deterministic)
+}
+func (m *InvokeResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InvokeResp.Merge(m, src)
+}
+func (m *InvokeResp) XXX_Size() int {
+	return xxx_messageInfo_InvokeResp.Size(m)
+}
+func (m *InvokeResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_InvokeResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InvokeResp proto.InternalMessageInfo
+
+func (m *InvokeResp) GetIsColdStart() bool {
+	if m != nil {
+		return m.IsColdStart
+	}
+	return false
+}
+
+func (m *InvokeResp) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*HelloRequest)(nil), "helloworld.HelloRequest")
 	proto.RegisterType((*HelloReply)(nil), "helloworld.HelloReply")
 	proto.RegisterType((*FwdHelloReq)(nil), "helloworld.FwdHelloReq")
 	proto.RegisterType((*FwdHelloResp)(nil), "helloworld.FwdHelloResp")
+	proto.RegisterType((*InvokeReq)(nil), "helloworld.InvokeReq")
+	proto.RegisterType((*InvokeResp)(nil), "helloworld.InvokeResp")
 }
 
 func init() { proto.RegisterFile("helloworld.proto", fileDescriptor_17b8c58d586b62f2) }
 
 var fileDescriptor_17b8c58d586b62f2 = []byte{
-	// 291 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x92, 0x41, 0x4b, 0xc3, 0x30,
-	0x14, 0xc7, 0xd7, 0x4e, 0x5d, 0x7d, 0x1b, 0x2a, 0x0f, 0xd1, 0x32, 0x2f, 0x23, 0x07, 0xf1, 0xd4,
-	0xc3, 0x04, 0x8f, 0x0a, 0x13, 0xe6, 0x10, 0x07, 0xa3, 0x3b, 0xec, 0x1c, 0xcd, 0x63, 0x16, 0x52,
-	0x13, 0x93, 0x4a, 0xed, 0x57, 0xf0, 0x63, 0xf8, 0x49, 0xa5, 0x59, 0xcb, 0x22, 0xec, 0xb6, 0xdb,
-	0xfb, 0xff, 0xdf, 0x3f, 0x3f, 0x5e, 0x5e, 0x02, 0x67, 0xef, 0x24, 0xa5, 0x2a, 0x95, 0x91, 0x22,
-	0xd1, 0x46, 0x15, 0x0a, 0x61, 0xeb, 0x30, 0x06, 0x83, 0x59, 0xad, 0x52, 0xfa, 0xfc, 0x22, 0x5b,
-	0x20, 0xc2, 0xc1, 0x07, 0xcf, 0x29, 0x0e, 0x46, 0xc1, 0xcd, 0x71, 0xea, 0x6a, 0x76, 0x0d, 0xd0,
-	0x64, 0xb4, 0xac, 0x30, 0x86, 0x5e, 0x4e, 0xd6, 0xf2, 0x75, 0x1b, 0x6a, 0x25, 0x9b, 0x43, 0x7f,
-	0x5a, 0x8a, 0x16, 0x87, 0x27, 0x10, 0x66, 0xa2, 0xc9, 0x84, 0x99, 0xc0, 0x73, 0x38, 0xcc, 0xf2,
-	0xfa, 0x58, 0xe8, 0xac, 0x8d, 0xa8, 0x71, 0x9a, 0x57, 0x52, 0x71, 0x11, 0x77, 0x37, 0xb8, 0x46,
-	0xb2, 0x67, 0x18, 0x6c, 0x71, 0x56, 0xe3, 0x08, 0xfa, 0x99, 0x7d, 0x54, 0x52, 0x2c, 0x0b, 0x6e,
-	0x0a, 0x07, 0x8e, 0x52, 0xdf, 0xf2, 0x59, 0xe1, 0x3f, 0xd6, 0xf8, 0x27, 0x80, 0xde, 0x93, 0x21,
-	0x2a, 0xc8, 0xe0, 0x3d, 0x44, 0x4b, 0x5e, 0x39, 0x2e, 0xc6, 0x89, 0xb7, 0x1d, 0x7f, 0x11, 0xc3,
-	0x8b, 0x1d, 0x1d, 0x2d, 0x2b, 0xd6, 0xc1, 0x07, 0x88, 0xda, 0xb9, 0xf0, 0xd2, 0x4f, 0x79, 0x97,
-	0x1f, 0xc6, 0xbb, 0x1b, 0x56, 0xb3, 0xce, 0x78, 0x0e, 0x30, 0x2d, 0x45, 0x3b, 0xce, 0xbe, 0xb8,
-	0xc9, 0x1d, 0x5c, 0x65, 0x2a, 0x59, 0x1b, 0xfd, 0x96, 0xd0, 0x37, 0xcf, 0xb5, 0x24, 0xeb, 0xa5,
-	0x27, 0xa7, 0x2e, 0xbb, 0xaa, 0xeb, 0x45, 0xfd, 0xfc, 0x8b, 0xe0, 0x37, 0xec, 0xce, 0x5e, 0x56,
-	0xaf, 0x47, 0xee, 0x37, 0xdc, 0xfe, 0x05, 0x00, 0x00, 0xff, 0xff, 0x69, 0xa1, 0x97, 0x36, 0x21,
-	0x02, 0x00, 0x00,
+	// 348 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x92, 0x4f, 0x4b, 0xf3, 0x40,
+	0x10, 0xc6, 0x9b, 0xb4, 0x6f, 0xff, 0x4c, 0xcb, 0xab, 0x0c, 0x5a, 0x43, 0xbd, 0x94, 0x3d, 0x48,
+	0x4f, 0x39, 0x54, 0x10, 0xbc, 0x28, 0x54, 0xa8, 0x55, 0x14, 0x4a, 0x7b, 0xe8, 0x79, 0xed, 0x2e,
+	0x6d, 0x70, 0xd3, 0x5d, 0xb3, 0xd1, 0x9a, 0x6f, 0x20, 0x7e, 0x0c, 0x3f, 0xa9, 0x24, 0xcd, 0x9a,
+	0x15, 0x72, 0x10, 0xbd, 0xed, 0x33, 0xfb, 0xec, 0x6f, 0x86, 0x79, 0x16, 0xf6, 0xd7, 0x5c, 0x08,
+	0xb9, 0x95, 0x91, 0x60, 0xbe, 0x8a, 0x64, 0x2c, 0x11, 0x8a, 0x0a, 0x21, 0xd0, 0x99, 0xa4, 0x6a,
+	0xc6, 0x9f, 0x9e, 0xb9, 0x8e, 0x11, 0xa1, 0xb6, 0xa1, 0x21, 0xf7, 0x9c, 0xbe, 0x33, 0x68, 0xcd,
+	0xb2, 0x33, 0x39, 0x01, 0xc8, 0x3d, 0x4a, 0x24, 0xe8, 0x41, 0x23, 0xe4, 0x5a, 0xd3, 0x95, 0x31,
+	0x19, 0x49, 0xee, 0xa1, 0x3d, 0xde, 0x32, 0x83, 0xc3, 0xff, 0xe0, 0x06, 0x2c, 0xf7, 0xb8, 0x01,
+	0xc3, 0x03, 0xf8, 0x17, 0x84, 0xe9, 0x33, 0x37, 0x2b, 0xed, 0x44, 0x8a, 0x53, 0x34, 0x11, 0x92,
+	0x32, 0xaf, 0xba, 0xc3, 0xe5, 0x92, 0xdc, 0x42, 0xa7, 0xc0, 0x69, 0x85, 0x7d, 0x68, 0x07, 0xfa,
+	0x4a, 0x0a, 0x36, 0x8f, 0x69, 0x14, 0x67, 0xe0, 0xe6, 0xcc, 0x2e, 0xd9, 0x2c, 0xf7, 0x3b, 0x6b,
+	0x09, 0xad, 0x9b, 0xcd, 0x8b, 0x7c, 0xe4, 0x3f, 0x1f, 0xac, 0x0b, 0xf5, 0x90, 0xc7, 0x6b, 0x69,
+	0xe6, 0xca, 0x95, 0xdd, 0xa4, 0xd6, 0x77, 0x06, 0x9d, 0xa2, 0xc9, 0x04, 0xc0, 0x34, 0xf9, 0xcd,
+	0xb8, 0x05, 0x69, 0xf8, 0xee, 0x40, 0xe3, 0x3a, 0xe2, 0x3c, 0xe6, 0x11, 0x5e, 0x40, 0x73, 0x4e,
+	0x93, 0x6c, 0x0d, 0xe8, 0xf9, 0x56, 0x98, 0x76, 0x6e, 0xbd, 0x6e, 0xc9, 0x8d, 0x12, 0x09, 0xa9,
+	0xe0, 0x25, 0x34, 0xcd, 0x1a, 0xf1, 0xc8, 0x76, 0x59, 0x59, 0xf5, 0xbc, 0xf2, 0x0b, 0xad, 0x48,
+	0x65, 0xf8, 0xe6, 0x00, 0x8c, 0xb7, 0xcc, 0xcc, 0xf3, 0x57, 0x1e, 0x9e, 0x43, 0x7d, 0xb7, 0x26,
+	0x3c, 0xb4, 0x5d, 0x5f, 0xf9, 0xf4, 0xba, 0x65, 0xe5, 0xf4, 0xe9, 0xe8, 0x0c, 0x8e, 0x03, 0xe9,
+	0xaf, 0x22, 0xb5, 0xf4, 0xf9, 0x2b, 0x0d, 0x95, 0xe0, 0xda, 0xf2, 0x8e, 0xf6, 0xb2, 0x36, 0x8b,
+	0xf4, 0x3c, 0x4d, 0x7f, 0xfa, 0xd4, 0xf9, 0x70, 0xab, 0x93, 0xbb, 0xc5, 0x43, 0x3d, 0xfb, 0xf8,
+	0xa7, 0x9f, 0x03, 0x00, 0x31, 0x9e, 0xeb, 0x17, 0x0c, 0x03, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -384,6 +501,8 @@ var _Greeter_serviceDesc = grpc.ServiceDesc{
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type FwdGreeterClient interface {
 	FwdHello(ctx context.Context, in *FwdHelloReq, opts ...grpc.CallOption) (*FwdHelloResp, error)
+	// Forwards a raw payload to a function
+	Invoke(ctx context.Context, in *InvokeReq, opts ...grpc.CallOption) (*InvokeResp, error)
 }
 
 type fwdGreeterClient struct {
@@ -403,9 +522,20 @@ func (c *fwdGreeterClient) FwdHello(ctx context.Context, in *FwdHelloReq, opts .
 	return out, nil
 }
 
+func (c *fwdGreeterClient) Invoke(ctx context.Context, in *InvokeReq, opts ...grpc.CallOption) (*InvokeResp, error) {
+	out := new(InvokeResp)
+	err := c.cc.Invoke(ctx, "/helloworld.FwdGreeter/Invoke", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // FwdGreeterServer is the server API for FwdGreeter service.
 type FwdGreeterServer interface {
 	FwdHello(context.Context, *FwdHelloReq) (*FwdHelloResp, error)
+	// Forwards a raw payload to a function
+	Invoke(context.Context, *InvokeReq) (*InvokeResp, error)
 }
 
 // UnimplementedFwdGreeterServer can be embedded to have forward compatible implementations.
@@ -415,6 +545,9 @@ type UnimplementedFwdGreeterServer struct {
 func (*UnimplementedFwdGreeterServer) FwdHello(ctx context.Context, req *FwdHelloReq) (*FwdHelloResp, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method FwdHello not implemented")
 }
+func (*UnimplementedFwdGreeterServer) Invoke(ctx context.Context, req *InvokeReq) (*InvokeResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Invoke not implemented")
+}
 
 func RegisterFwdGreeterServer(s *grpc.Server, srv FwdGreeterServer) {
 	s.RegisterService(&_FwdGreeter_serviceDesc, srv)
@@ -438,6 +571,24 @@ func _FwdGreeter_FwdHello_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FwdGreeter_Invoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvokeReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FwdGreeterServer).Invoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/helloworld.FwdGreeter/Invoke",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FwdGreeterServer).Invoke(ctx, req.(*InvokeReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _FwdGreeter_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "helloworld.FwdGreeter",
 	HandlerType: (*FwdGreeterServer)(nil),
@@ -446,6 +597,10 @@ var _FwdGreeter_serviceDesc = grpc.ServiceDesc{
 			MethodName: "FwdHello",
 			Handler:    _FwdGreeter_FwdHello_Handler,
 		},
+		{
+			MethodName: "Invoke",
+			Handler:    _FwdGreeter_Invoke_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "helloworld.proto",
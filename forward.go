@@ -0,0 +1,300 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	hpb "github.com/ease-lab/vhive/examples/protobuf/helloworld"
+	"github.com/ease-lab/vhive/tracing"
+)
+
+// FwdMode Protocol that the requests are forwarded to the instances of a function with
+type FwdMode string
+
+const (
+	// FwdGreeter Forwards the payload as the name of a helloworld Greeter.SayHello request
+	FwdGreeter FwdMode = "greeter"
+	// FwdGRPC Forwards the payload as the serialized message of a unary gRPC request
+	FwdGRPC FwdMode = "grpc"
+	// FwdHTTP Forwards the payload as the body of an HTTP/1.1 POST request
+	FwdHTTP FwdMode = "http"
+)
+
+const (
+	defaultGRPCPort = 50051
+	defaultHTTPPort = 8080
+
+	// rawCodecName Name of the codec that passes the payloads through as they are
+	rawCodecName = "vhive-raw"
+)
+
+// FwdCfg Forwarding configuration of a function
+type FwdCfg struct {
+	// Mode Forwarding protocol, greeter by default
+	Mode FwdMode
+	// Method Full name of the gRPC method (e.g., /helloworld.Greeter/SayHello) in the grpc mode,
+	// or the URL path (e.g., /invoke) in the http mode, of the requests that do not specify one
+	Method string
+	// Port Port that the function listens on in its instances, 50051 (gRPC) or 8080 (HTTP) if zero
+	Port int
+}
+
+// ParseFwdMode Converts the name of a forwarding mode to the mode
+func ParseFwdMode(name string) (FwdMode, error) {
+	switch mode := FwdMode(name); mode {
+	case FwdGreeter, FwdGRPC, FwdHTTP:
+		return mode, nil
+	default:
+		return "", errors.Errorf("unknown forwarding mode %s", name)
+	}
+}
+
+func (cfg FwdCfg) port() int {
+	switch {
+	case cfg.Port != 0:
+		return cfg.Port
+	case cfg.Mode == FwdHTTP:
+		return defaultHTTPPort
+	default:
+		return defaultGRPCPort
+	}
+}
+
+// forwarder Forwards the requests to an instance of a function
+type forwarder interface {
+	// forward Forwards the payload of a request to the method (ignored in the greeter mode),
+	// or to the configured method if empty, returns the payload of the response
+	forward(ctx context.Context, method string, payload []byte) ([]byte, error)
+	close() error
+}
+
+// dialForwarder Connects to the function in an instance, waiting until it listens
+func dialForwarder(cfg FwdCfg, guestIP string) (forwarder, error) {
+	address := net.JoinHostPort(guestIP, fmt.Sprint(cfg.port()))
+
+	//  This timeout must be large enough for all functions to start up (e.g., ML training takes few seconds)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if cfg.Mode == FwdHTTP {
+		conn, err := contextDialer(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		conn.Close()
+
+		return &httpForwarder{
+			client:  &http.Client{Transport: &http.Transport{}},
+			baseURL: "http://" + address,
+			path:    cfg.Method,
+		}, nil
+	}
+
+	backoffConfig := backoff.DefaultConfig
+	backoffConfig.MaxDelay = 5 * time.Second
+	connParams := grpc.ConnectParams{
+		Backoff: backoffConfig,
+	}
+
+	gopts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithInsecure(),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithConnectParams(connParams),
+		grpc.WithContextDialer(contextDialer),
+		grpc.WithUnaryInterceptor(tracing.UnaryClientInterceptor()),
+	}
+
+	conn, err := grpc.DialContext(ctx, address, gopts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Mode == FwdGRPC {
+		return &grpcForwarder{conn: conn, method: cfg.Method}, nil
+	}
+
+	return &greeterForwarder{conn: conn, client: hpb.NewGreeterClient(conn)}, nil
+}
+
+// greeterForwarder Forwards the requests to a helloworld function
+type greeterForwarder struct {
+	conn   *grpc.ClientConn
+	client hpb.GreeterClient
+}
+
+func (fw *greeterForwarder) forward(ctx context.Context, method string, payload []byte) ([]byte, error) {
+	resp, err := fw.client.SayHello(ctx, &hpb.HelloRequest{Name: string(payload)})
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(resp.GetMessage()), nil
+}
+
+func (fw *greeterForwarder) close() error {
+	return fw.conn.Close()
+}
+
+// grpcForwarder Forwards the serialized messages of unary gRPC requests
+// to any method of a function, without knowing their types
+type grpcForwarder struct {
+	conn   *grpc.ClientConn
+	method string
+}
+
+func (fw *grpcForwarder) forward(ctx context.Context, method string, payload []byte) ([]byte, error) {
+	if method == "" {
+		method = fw.method
+	}
+
+	if method == "" {
+		return nil, status.Error(codes.InvalidArgument, "no gRPC method to forward the request to")
+	}
+
+	var resp []byte
+	if err := fw.conn.Invoke(ctx, method, &payload, &resp, grpc.ForceCodec(rawCodec{})); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (fw *grpcForwarder) close() error {
+	return fw.conn.Close()
+}
+
+// rawCodec Codec that sends and receives the messages that are already serialized
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, errors.Errorf("%s codec cannot marshal %T", rawCodecName, v)
+	}
+
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return errors.Errorf("%s codec cannot unmarshal into %T", rawCodecName, v)
+	}
+
+	*b = append((*b)[:0], data...)
+
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return rawCodecName
+}
+
+// httpForwarder Forwards the payloads as the bodies of HTTP/1.1 POST requests
+type httpForwarder struct {
+	client  *http.Client
+	baseURL string
+	path    string
+}
+
+func (fw *httpForwarder) forward(ctx context.Context, method string, payload []byte) ([]byte, error) {
+	if method == "" {
+		method = fw.path
+	}
+
+	if !strings.HasPrefix(method, "/") {
+		method = "/" + method
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fw.baseURL+method, bytes.NewReader(payload))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	tracing.InjectHTTP(ctx, req.Header)
+
+	resp, err := fw.client.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, status.FromContextError(ctxErr).Err()
+		}
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, status.Errorf(httpStatusCode(resp.StatusCode), "function returned HTTP status %s: %s", resp.Status, body)
+	}
+
+	return body, nil
+}
+
+func (fw *httpForwarder) close() error {
+	fw.client.CloseIdleConnections()
+	return nil
+}
+
+// httpStatusCode Returns the gRPC status code that corresponds to an HTTP error status
+func httpStatusCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
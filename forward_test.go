@@ -0,0 +1,173 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	hpb "github.com/ease-lab/vhive/examples/protobuf/helloworld"
+	"github.com/ease-lab/vhive/tracing"
+)
+
+type testGreeter struct {
+	hpb.UnimplementedGreeterServer
+}
+
+func (s *testGreeter) SayHello(ctx context.Context, in *hpb.HelloRequest) (*hpb.HelloReply, error) {
+	return &hpb.HelloReply{Message: "Hello, " + in.GetName()}, nil
+}
+
+// startTestGreeter Starts a helloworld server, returns its port
+func startTestGreeter(t *testing.T) int {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := grpc.NewServer()
+	hpb.RegisterGreeterServer(s, &testGreeter{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+func TestParseFwdMode(t *testing.T) {
+	for _, name := range []string{"greeter", "grpc", "http"} {
+		mode, err := ParseFwdMode(name)
+		require.NoError(t, err)
+		require.Equal(t, FwdMode(name), mode)
+	}
+
+	_, err := ParseFwdMode("smtp")
+	require.Error(t, err, "Parsed an unknown mode")
+}
+
+func TestGreeterForwarder(t *testing.T) {
+	fw, err := dialForwarder(FwdCfg{Mode: FwdGreeter, Port: startTestGreeter(t)}, "127.0.0.1")
+	require.NoError(t, err)
+	defer fw.close()
+
+	resp, err := fw.forward(context.Background(), "", []byte("world"))
+	require.NoError(t, err)
+	require.Equal(t, "Hello, world", string(resp))
+}
+
+func TestGRPCForwarder(t *testing.T) {
+	cfg := FwdCfg{Mode: FwdGRPC, Port: startTestGreeter(t)}
+
+	fw, err := dialForwarder(cfg, "127.0.0.1")
+	require.NoError(t, err)
+	defer fw.close()
+
+	req, err := proto.Marshal(&hpb.HelloRequest{Name: "world"})
+	require.NoError(t, err)
+
+	_, err = fw.forward(context.Background(), "", req)
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "Forwarded without a method")
+
+	resp, err := fw.forward(context.Background(), "/helloworld.Greeter/SayHello", req)
+	require.NoError(t, err)
+
+	reply := new(hpb.HelloReply)
+	require.NoError(t, proto.Unmarshal(resp, reply))
+	require.Equal(t, "Hello, world", reply.GetMessage())
+
+	_, err = fw.forward(context.Background(), "/helloworld.Greeter/Unknown", req)
+	require.Equal(t, codes.Unimplemented, status.Code(err), "Forwarded to an unknown method")
+}
+
+func TestHTTPForwarder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/invoke" {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(append([]byte("Hello, "), body...))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+
+	fw, err := dialForwarder(FwdCfg{Mode: FwdHTTP, Method: "/invoke", Port: port}, u.Hostname())
+	require.NoError(t, err)
+	defer fw.close()
+
+	resp, err := fw.forward(context.Background(), "", []byte("world"))
+	require.NoError(t, err)
+	require.Equal(t, "Hello, world", string(resp))
+
+	_, err = fw.forward(context.Background(), "other", []byte("world"))
+	require.Equal(t, codes.Unavailable, status.Code(err), "HTTP status must be converted")
+}
+
+func TestHTTPForwarderTraceContext(t *testing.T) {
+	tp := tracing.Init("vhive-test", tracetest.NewInMemoryExporter(), true)
+	defer func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		tp.Shutdown(context.Background())
+	}()
+
+	traceparents := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+
+	fw, err := dialForwarder(FwdCfg{Mode: FwdHTTP, Port: port}, u.Hostname())
+	require.NoError(t, err)
+	defer fw.close()
+
+	ctx, span := tracing.StartSpan(context.Background(), "FuncInvocation")
+	defer span.End()
+
+	_, err = fw.forward(ctx, "/invoke", []byte("world"))
+	require.NoError(t, err)
+
+	traceID := span.SpanContext().TraceID()
+	require.Contains(t, <-traceparents, traceID.String(), "Trace context must reach the function")
+}
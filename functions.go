@@ -25,23 +25,25 @@ package main
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"net"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 
-	"golang.org/x/sync/semaphore"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/ease-lab/vhive/ctriface"
 	hpb "github.com/ease-lab/vhive/examples/protobuf/helloworld"
+	"github.com/ease-lab/vhive/memory/manager"
 	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/tracing"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
@@ -57,19 +59,64 @@ type FuncPool struct {
 	saveMemoryMode bool
 	servedTh       uint64
 	pinnedFuncNum  int
+	keepAlive      KeepAliveCfg
+	scaling        ScalingCfg
+	fwd            FwdCfg
 	stats          *Stats
+	prom           *promExporter
+}
+
+// FuncPoolOption Option of the function pool
+type FuncPoolOption func(*FuncPool)
+
+// WithKeepAlive Sets the keep-alive policy of the functions that are not pinned in memory
+func WithKeepAlive(cfg KeepAliveCfg) FuncPoolOption {
+	return func(p *FuncPool) {
+		p.keepAlive = cfg
+	}
+}
+
+// WithScaling Sets the number of the instances of each function and their concurrency
+func WithScaling(cfg ScalingCfg) FuncPoolOption {
+	return func(p *FuncPool) {
+		p.scaling = cfg
+	}
+}
+
+// WithForwarding Sets how the requests are forwarded to the instances of the functions
+func WithForwarding(cfg FwdCfg) FuncPoolOption {
+	return func(p *FuncPool) {
+		p.fwd = cfg
+	}
+}
+
+// WithPrometheus Sets the exporter that the requests are counted and timed by
+func WithPrometheus(e *promExporter) FuncPoolOption {
+	return func(p *FuncPool) {
+		p.prom = e
+	}
 }
 
 // NewFuncPool Initializes a pool of functions. Functions can only be added
-// but never removed from the map.
-func NewFuncPool(saveMemoryMode bool, servedTh uint64, pinnedFuncNum int, testModeOn bool) *FuncPool {
+// but never removed from the map. In the memory saving mode, the instances
+// of the functions that are not pinned in memory retire according to the
+// keep-alive policy, by default after serving about servedTh requests.
+// By default, each function runs a single instance that serves all its requests.
+func NewFuncPool(saveMemoryMode bool, servedTh uint64, pinnedFuncNum int, testModeOn bool, opts ...FuncPoolOption) *FuncPool {
 	p := new(FuncPool)
 	p.funcMap = make(map[string]*Function)
 	p.saveMemoryMode = saveMemoryMode
 	p.servedTh = servedTh
 	p.pinnedFuncNum = pinnedFuncNum
+	p.keepAlive = KeepAliveCfg{Policy: KeepAliveServed}
+	p.scaling = ScalingCfg{MaxInstances: 1}
+	p.fwd = FwdCfg{Mode: FwdGreeter}
 	p.stats = NewStats()
 
+	for _, opt := range opts {
+		opt(p)
+	}
+
 	if !testModeOn {
 		heartbeat := time.NewTicker(60 * time.Second)
 
@@ -103,8 +150,10 @@ func (p *FuncPool) getFunction(fID, imageName string) *Function {
 			isToPin = false
 		}
 
-		logger.Debugf("Created function, pinned=%t, shut down after %d requests", isToPin, p.servedTh)
-		p.funcMap[fID] = NewFunction(fID, imageName, p.stats, p.servedTh, isToPin)
+		logger.Debugf("Created function, pinned=%t, keep-alive policy %s", isToPin, p.keepAlive.Policy)
+		f := NewFunction(fID, imageName, p.stats, p.servedTh, p.keepAlive, p.scaling, p.fwd, isToPin)
+		f.prom = p.prom
+		p.funcMap[fID] = f
 
 		if err := p.stats.CreateStats(fID); err != nil {
 			logger.Panic("GetFunction: Function exists")
@@ -118,31 +167,150 @@ func (p *FuncPool) getFunction(fID, imageName string) *Function {
 func (p *FuncPool) Serve(ctx context.Context, fID, imageName, payload string) (*hpb.FwdHelloResp, *metrics.Metric, error) {
 	f := p.getFunction(fID, imageName)
 
-	return f.Serve(ctx, fID, imageName, payload)
+	resp, metr, err := f.Serve(ctx, fID, imageName, payload)
+	p.prom.observeRequest(imageName, resp.GetIsColdStart(), metr)
+
+	return resp, metr, err
+}
+
+// Invoke Forwards a raw payload to the method of a function, or to its configured method if empty
+func (p *FuncPool) Invoke(ctx context.Context, fID, imageName, method string, payload []byte) (*hpb.InvokeResp, *metrics.Metric, error) {
+	f := p.getFunction(fID, imageName)
+
+	resp, metr, err := f.Invoke(ctx, method, payload)
+	p.prom.observeRequest(imageName, resp.GetIsColdStart(), metr)
+
+	return resp, metr, err
 }
 
 // AddInstance Adds instance of the function
 func (p *FuncPool) AddInstance(fID, imageName string) (string, error) {
 	f := p.getFunction(fID, imageName)
 
-	logger := log.WithFields(log.Fields{"fID": f.fID})
-
-	f.OnceAddInstance.Do(
-		func() {
-			logger.Debug("Function is inactive, starting the instance...")
-			f.AddInstance()
-		})
+	if _, err := f.AddInstance(); err != nil {
+		return "Failed to start instance", err
+	}
 
 	return "Instance started", nil
 }
 
-// RemoveInstance Removes instance of the function (blocking)
+// SetVMSpec Sets the spec of the VMs that run the function's instances,
+// overriding the spec configured for the function's image
+func (p *FuncPool) SetVMSpec(fID, imageName string, spec ctriface.VMSpec) {
+	f := p.getFunction(fID, imageName)
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.vmSpec = &spec
+}
+
+// SetFwdCfg Sets how the requests are forwarded to the function's instances
+// that start afterwards, overriding the pool's configuration
+func (p *FuncPool) SetFwdCfg(fID, imageName string, cfg FwdCfg) {
+	f := p.getFunction(fID, imageName)
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.fwd = cfg
+}
+
+// RemoveInstance Removes the instances of the function (blocking)
 func (p *FuncPool) RemoveInstance(fID, imageName string, isSync bool) (string, error) {
 	f := p.getFunction(fID, imageName)
 
 	return f.RemoveInstance(isSync)
 }
 
+// FunctionInfo Description of a function in the pool
+type FunctionInfo struct {
+	FID       string
+	ImageName string
+	IsPinned  bool
+	// Served Number of the requests that the function received
+	Served uint64
+	// Queued Number of the requests that wait for an instance
+	Queued    int
+	Instances []InstanceInfo
+}
+
+// InstanceInfo Description of an instance of a function
+type InstanceInfo struct {
+	VMID     string
+	State    string
+	InFlight int
+	Served   uint64
+}
+
+// ListFunctions Returns the functions in the pool, ordered by their IDs
+func (p *FuncPool) ListFunctions() []FunctionInfo {
+	p.Lock()
+	funcs := make([]*Function, 0, len(p.funcMap))
+	for _, f := range p.funcMap {
+		funcs = append(funcs, f)
+	}
+	p.Unlock()
+
+	infos := make([]FunctionInfo, 0, len(funcs))
+	for _, f := range funcs {
+		infos = append(infos, f.info())
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].FID < infos[j].FID })
+
+	return infos
+}
+
+// GetFunctionInfo Returns the description of a function in the pool
+func (p *FuncPool) GetFunctionInfo(fID string) (FunctionInfo, error) {
+	f, err := p.lookupFunction(fID)
+	if err != nil {
+		return FunctionInfo{}, err
+	}
+
+	return f.info(), nil
+}
+
+// GetUPFStats Returns the memory manager's stats for a function about the number of
+// unique/reused pages and the latency of serving the page faults
+func (p *FuncPool) GetUPFStats(fID string) (*manager.UPFPageStats, []*metrics.Metric, error) {
+	f, err := p.lookupFunction(fID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vmID := f.getPrimaryVMID()
+	if vmID == "" {
+		return nil, nil, misc.NonExistErr("instance of function " + fID)
+	}
+
+	pageStats, err := orch.GetUPFPageStats(vmID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	latencyStats, err := orch.GetUPFLatencyStats(vmID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pageStats, latencyStats, nil
+}
+
+// lookupFunction Returns a ptr to a function unless it does not exist
+func (p *FuncPool) lookupFunction(fID string) (*Function, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	f, found := p.funcMap[fID]
+	if !found {
+		return nil, misc.NonExistErr("function " + fID)
+	}
+
+	return f, nil
+}
+
 // DumpUPFPageStats Dumps the memory manager's stats for a function about the number of
 // the unique pages and the number of the pages that are reused across invocations
 func (p *FuncPool) DumpUPFPageStats(fID, imageName, functionName, metricsOutFilePath string) error {
@@ -162,55 +330,47 @@ func (p *FuncPool) DumpUPFLatencyStats(fID, imageName, functionName, latencyOutF
 
 // Function type
 type Function struct {
-	sync.RWMutex
-	OnceAddInstance        *sync.Once
-	fID                    string
-	imageName              string
-	vmID                   string
-	lastInstanceID         int
-	isPinnedInMem          bool // if pinned, the orchestrator does not stop/offload it)
-	stats                  *Stats
-	servedTh               uint64
-	sem                    *semaphore.Weighted
-	servedSyncCounter      int64
-	isSnapshotReady        bool // if ready, the orchestrator should load the instance rather than creating it
-	OnceCreateSnapInstance *sync.Once
-	funcClient             *hpb.GreeterClient
-	conn                   *grpc.ClientConn
-	guestIP                string
+	sync.Mutex
+	changed        chan struct{} // closed when an instance gets capacity or stops retiring
+	queued         int           // number of the requests that wait for an instance
+	fID            string
+	imageName      string
+	instances      []*funcInstance // the oldest instance first
+	lastInstanceID int
+	isPinnedInMem  bool // if pinned, the orchestrator does not stop/offload it)
+	stats          *Stats
+	newKeepAlive   func() keepAlivePolicy // nil if pinned
+	scaling        ScalingCfg
+	fwd            FwdCfg
+	vmSpec         *ctriface.VMSpec // if nil, the orchestrator's spec for the image is used
+	prom           *promExporter    // of the pool, if any
 }
 
 // NewFunction Initializes a function
 // Note: for numerical fIDs, [0, hotFunctionsNum) and [hotFunctionsNum; hotFunctionsNum+warmFunctionsNum)
 // are functions that are pinned in memory (stopping or offloading by the daemon is not allowed)
-func NewFunction(fID, imageName string, Stats *Stats, servedTh uint64, isToPin bool) *Function {
+func NewFunction(fID, imageName string, Stats *Stats, servedTh uint64, keepAlive KeepAliveCfg, scaling ScalingCfg, fwd FwdCfg, isToPin bool) *Function {
 	f := new(Function)
+	f.changed = make(chan struct{})
 	f.fID = fID
 	f.imageName = imageName
-	f.OnceAddInstance = new(sync.Once)
 	f.isPinnedInMem = isToPin
 	f.stats = Stats
-	f.OnceCreateSnapInstance = new(sync.Once)
+	f.scaling = scaling
+	f.fwd = fwd
 
-	// Normal distribution with stddev=servedTh/2, mean=servedTh
-	thresh := int64(rand.NormFloat64()*float64(servedTh/2) + float64(servedTh))
-	if thresh <= 0 {
-		thresh = int64(servedTh)
-	}
-	if isTestMode && servedTh == 40 { // 40 is used in tests
-		thresh = 40
+	if !f.isPinnedInMem {
+		f.newKeepAlive = newKeepAlivePolicyFactory(keepAlive, servedTh)
 	}
 
-	f.servedTh = uint64(thresh)
-	f.sem = semaphore.NewWeighted(int64(f.servedTh))
-	f.servedSyncCounter = int64(f.servedTh) // cannot use uint64 for the counter due to the overflow
-
 	log.WithFields(
 		log.Fields{
-			"fID":      f.fID,
-			"image":    f.imageName,
-			"isPinned": f.isPinnedInMem,
-			"servedTh": f.servedTh,
+			"fID":          f.fID,
+			"image":        f.imageName,
+			"isPinned":     f.isPinnedInMem,
+			"keepAlive":    keepAlive.Policy,
+			"maxInstances": scaling.MaxInstances,
+			"fwdMode":      fwd.Mode,
 		},
 	).Info("New function added")
 
@@ -221,185 +381,310 @@ func NewFunction(fID, imageName string, Stats *Stats, servedTh uint64, isToPin b
 // function instances when necessary.
 //
 // Synchronization description:
-// 1. Function needs to start an instance (with a unique vmID) if there are none: goroutines are synchronized with do.Once
-// 2. Function (that is not pinned) can serve only up to servedTh requests (controlled by a WeightedSemaphore)
-//    a. The last goroutine needs to trigger the function's instance shutdown, then reset the semaphore,
-//       allowing new goroutines to serve their requests.
-//    b. The last goroutine is determined by the atomic counter: the goroutine with syncID==0 shuts down
-//       the instance.
-//    c. Instance shutdown is performed asynchronously because all instances have unique IDs.
+// 1. The request is admitted to the least loaded instance that serves fewer requests than its
+//    concurrency limit (see acquireInstance). If all instances are saturated, the request starts
+//    a new instance (with a unique vmID), unless the function runs its maximum number of instances,
+//    in which case the request queues until an instance gets capacity. The requests admitted to
+//    an instance that is starting queue until it starts. The requests are rejected if the queue
+//    is full, or if they queue for longer than the queueing timeout or the caller's deadline.
+// 2. Function (that is not pinned) retires its instances according to its keep-alive policy,
+//    and the instances beyond the first one retire after being idle for the scale-in timeout
+//    (see releaseInstance).
+//    a. The requests are not admitted to a retiring instance.
+//    b. The last request that an instance serves before it retires, or the idle timer armed by
+//       the last released request, removes the instance.
+// 3. The RPCs are forwarded to an instance under its read lock, so that the instance is removed
+//    once they complete. A request that finds its instance removed is admitted to another one.
 func (f *Function) Serve(ctx context.Context, fID, imageName, reqPayload string) (*hpb.FwdHelloResp, *metrics.Metric, error) {
+	resp, serveMetric, err := f.Invoke(ctx, "", []byte(reqPayload))
+
+	return &hpb.FwdHelloResp{IsColdStart: resp.IsColdStart, Payload: string(resp.Payload)}, serveMetric, err
+}
+
+// Invoke Forwards a raw payload to the method of a function's instance, or to the
+// function's configured method if empty, and returns the payload of the response.
+// The requests are served as described for Serve.
+func (f *Function) Invoke(ctx context.Context, method string, reqPayload []byte) (*hpb.InvokeResp, *metrics.Metric, error) {
+	ctx, span := tracing.StartSpan(ctx, "Function.Invoke", tracing.FunctionIDKey.String(f.fID), tracing.ImageKey.String(f.imageName))
+
+	resp, serveMetric, err := f.invoke(ctx, method, reqPayload)
+
+	span.SetAttributes(tracing.ColdStartKey.Bool(resp.GetIsColdStart()))
+	tracing.EndSpan(span, err)
+
+	return resp, serveMetric, err
+}
+
+func (f *Function) invoke(ctx context.Context, method string, reqPayload []byte) (*hpb.InvokeResp, *metrics.Metric, error) {
 	var (
 		serveMetric *metrics.Metric = metrics.NewMetric()
 		tStart      time.Time
-		syncID      int64 = -1 // default is no synchronization
-		isColdStart bool  = false
+		inst        *funcInstance
+		isColdStart bool = false
 	)
 
 	logger := log.WithFields(log.Fields{"fID": f.fID})
 
-	if !f.isPinnedInMem {
-		if err := f.sem.Acquire(context.Background(), 1); err != nil {
-			logger.Panic("Failed to acquire semaphore for serving")
+	f.stats.IncServed(f.fID)
+
+	for {
+		var (
+			isStarter bool
+			err       error
+		)
+
+		inst, isStarter, err = f.acquireInstance(ctx, true, serveMetric)
+		isColdStart = isColdStart || isStarter
+		if err != nil {
+			// The next request retries to start the instance
+			return &hpb.InvokeResp{IsColdStart: isColdStart}, serveMetric, err
+		}
+
+		inst.RLock()
+		if inst.isUp {
+			break
 		}
 
-		syncID = atomic.AddInt64(&f.servedSyncCounter, -1) // unique number for goroutines acquiring the semaphore
+		// The instance was removed after the request was admitted to it
+		inst.RUnlock()
+		f.releaseInstance(inst, nil)
 	}
 
-	f.stats.IncServed(f.fID)
+	defer f.releaseInstance(inst, serveMetric)
 
-	f.OnceAddInstance.Do(
-		func() {
-			var metr *metrics.Metric
-			isColdStart = true
-			logger.Debug("Function is inactive, starting the instance...")
-			tStart = time.Now()
-			metr = f.AddInstance()
-			serveMetric.MetricMap[metrics.AddInstance] = metrics.ToUS(time.Since(tStart))
-
-			if metr != nil {
-				for k, v := range metr.MetricMap {
-					serveMetric.MetricMap[k] = v
-				}
-			}
-		})
+	f.stats.IncInstanceServed(f.fID, inst.vmID)
 
-	f.RLock()
+	logger = logger.WithFields(log.Fields{"vmID": inst.vmID})
 
-	// FIXME: keep a strict deadline for forwarding RPCs to a warm function
-	// Eventually, it needs to be RPC-dependent and probably client-defined
-	ctxFwd, cancel := context.WithDeadline(context.Background(), time.Now().Add(20*time.Second))
-	defer cancel()
+	// The RPC is forwarded with the caller's deadline or, if there is none, with the default one
+	ctxFwd := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctxFwd, cancel = context.WithTimeout(ctx, defaultFwdTimeout)
+		defer cancel()
+	}
 
 	tStart = time.Now()
-	resp, err := f.fwdRPC(ctxFwd, reqPayload)
+	spanCtx, fwdSpan := tracing.StartSpan(ctxFwd, metrics.FuncInvocation, tracing.VMIDKey.String(inst.vmID))
+	resp, err := inst.fwdRPC(spanCtx, method, reqPayload)
+	tracing.EndSpan(fwdSpan, err)
 	serveMetric.MetricMap[metrics.FuncInvocation] = metrics.ToUS(time.Since(tStart))
 
 	if err != nil && ctxFwd.Err() == context.Canceled {
 		// context deadline exceeded
-		f.RUnlock()
-		return &hpb.FwdHelloResp{IsColdStart: isColdStart, Payload: ""}, serveMetric, err
+		inst.RUnlock()
+		return &hpb.InvokeResp{IsColdStart: isColdStart}, serveMetric, err
 	} else if err != nil {
 		if e, ok := status.FromError(err); ok {
 			switch e.Code() {
 			case codes.DeadlineExceeded:
 				// deadline exceeded
-				f.RUnlock()
-				return &hpb.FwdHelloResp{IsColdStart: isColdStart, Payload: ""}, serveMetric, err
+				inst.RUnlock()
+				return &hpb.InvokeResp{IsColdStart: isColdStart}, serveMetric, err
 			default:
 				logger.Warn("Function returned error: ", err)
-				f.RUnlock()
-				return &hpb.FwdHelloResp{IsColdStart: isColdStart, Payload: ""}, serveMetric, err
+				inst.RUnlock()
+				return &hpb.InvokeResp{IsColdStart: isColdStart}, serveMetric, err
 			}
 		} else {
-			logger.Panic("Not able to parse error returned ", err)
+			logger.Warn("Not able to parse error returned ", err)
+			inst.RUnlock()
+			return &hpb.InvokeResp{IsColdStart: isColdStart}, serveMetric, err
 		}
 	}
 
 	if orch.GetSnapshotsEnabled() {
-		f.OnceCreateSnapInstance.Do(
+		inst.OnceCreateSnapInstance.Do(
 			func() {
 				logger.Debug("First time offloading, need to create a snapshot first")
-				f.CreateInstanceSnapshot()
-				f.isSnapshotReady = true
+				if err := f.createInstanceSnapshot(inst); err != nil {
+					// The instance is stopped rather than offloaded when it retires
+					logger.WithError(err).Error("Failed to create a snapshot of the instance")
+					return
+				}
+				inst.isSnapshotReady = true
 			})
 	}
 
-	f.RUnlock()
-
-	if !f.isPinnedInMem && syncID == 0 {
-		logger.Debugf("Function has to shut down its instance, served %d requests", f.GetStatServed())
-		tStart = time.Now()
-		if _, err := f.RemoveInstance(false); err != nil {
-			logger.Panic("Failed to remove instance after servedTh expired", err)
-		}
-		serveMetric.MetricMap[metrics.RetireOld] = metrics.ToUS(time.Since(tStart))
-		f.ZeroServedStat()
-		f.servedSyncCounter = int64(f.servedTh) // reset counter
-		f.sem.Release(int64(f.servedTh))
-	}
+	inst.RUnlock()
 
-	return &hpb.FwdHelloResp{IsColdStart: isColdStart, Payload: resp.Message}, serveMetric, err
+	return &hpb.InvokeResp{IsColdStart: isColdStart, Payload: resp}, serveMetric, err
 }
 
-// FwdRPC Forward the RPC to an instance, then forwards the response back.
-func (f *Function) fwdRPC(ctx context.Context, reqPayload string) (*hpb.HelloReply, error) {
-	f.RLock()
-	defer f.RUnlock()
+// AddInstance Starts an instance of the function unless one is running, waits till it is ready.
+// If the instance fails to start, the next request or call retries to start it.
+func (f *Function) AddInstance() (*metrics.Metric, error) {
+	metr := metrics.NewMetric()
 
-	logger := log.WithFields(log.Fields{"fID": f.fID})
-
-	funcClient := *f.funcClient
+	inst, _, err := f.acquireInstance(context.Background(), false, metr)
+	if err != nil {
+		return nil, err
+	}
 
-	logger.Debug("FwdRPC: Forwarding RPC to function instance")
-	resp, err := funcClient.SayHello(ctx, &hpb.HelloRequest{Name: reqPayload})
-	logger.Debug("FwdRPC: Received a response from the  function instance")
+	f.releaseInstance(inst, nil)
 
-	return resp, err
+	return metr, nil
 }
 
-// AddInstance Starts a VM, waits till it is ready.
-// Note: this function is called from sync.Once construct
-func (f *Function) AddInstance() *metrics.Metric {
+// startInstance Starts an instance that the caller scaled out to, then
+// wakes up the requests admitted to the instance. The instance keeps
+// starting if the context of the caller is canceled.
+func (f *Function) startInstance(ctx context.Context, inst *funcInstance) (*metrics.Metric, error) {
+	inst.Lock()
+	metr, err := f.bootInstance(ctx, inst)
+	inst.isUp = err == nil
+	inst.Unlock()
+
 	f.Lock()
 	defer f.Unlock()
 
-	logger := log.WithFields(log.Fields{"fID": f.fID})
+	if err != nil {
+		if inst.isSnapshotReady {
+			f.setInstanceState(inst, instanceOffloaded)
+		} else {
+			f.dropInstance(inst)
+		}
+	} else {
+		f.setInstanceState(inst, instanceUp)
+		f.stats.IncStarted(f.fID)
+	}
+
+	inst.start.err = err
+	close(inst.start.done)
+	f.broadcast()
+
+	return metr, err
+}
+
+func (f *Function) bootInstance(ctx context.Context, inst *funcInstance) (*metrics.Metric, error) {
+	logger := log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID})
 
 	logger.Debug("Adding instance")
 
-	var metr *metrics.Metric = nil
+	var (
+		metr *metrics.Metric = nil
+		err  error
+	)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	ctx, cancel := context.WithTimeout(tracing.Detach(ctx), time.Minute*5)
 	defer cancel()
 
-	if f.isSnapshotReady {
-		metr = f.LoadInstance()
-	} else {
-		resp, _, err := orch.StartVM(ctx, f.getVMID(), f.imageName)
+	if inst.isSnapshotReady {
+		if metr, err = f.loadInstance(ctx, inst); err != nil {
+			return nil, err
+		}
+	} else if metr = f.startInstanceFromSnapshot(ctx, inst); metr == nil {
+		resp, _, err := orch.StartVMWithSpec(ctx, inst.vmID, f.imageName, f.getVMSpec())
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
-		f.guestIP = resp.GuestIP
-		f.vmID = f.getVMID()
-		f.lastInstanceID++
+		inst.guestIP = resp.GuestIP
 	}
 
 	tStart := time.Now()
-	funcClient, err := f.getFuncClient()
+	_, span := tracing.StartSpan(ctx, metrics.ConnectFuncClient)
+	fwd, err := dialForwarder(f.getFwdCfg(), inst.guestIP)
+	tracing.EndSpan(span, err)
 	if metr != nil {
 		metr.MetricMap[metrics.ConnectFuncClient] = metrics.ToUS(time.Since(tStart))
 	}
 	if err != nil {
-		logger.Panic("Failed to acquire func client")
+		logger.WithError(err).Error("Failed to acquire func client")
+		f.discardInstance(inst)
+		return nil, err
 	}
-	f.funcClient = &funcClient
+	inst.fwd = fwd
 
-	f.stats.IncStarted(f.fID)
+	return metr, nil
+}
 
-	return metr
+// discardInstance Shuts down an instance that did not get ready,
+// keeping it offloaded if it can be loaded from its snapshot later
+func (f *Function) discardInstance(inst *funcInstance) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	var err error
+	if inst.isSnapshotReady {
+		err = orch.Offload(ctx, inst.vmID)
+	} else {
+		err = orch.StopSingleVM(ctx, inst.vmID)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID}).WithError(err).Warn("Failed to discard the instance")
+	}
 }
 
-// RemoveInstanceAsync Stops an instance (VM) of the function.
-func (f *Function) RemoveInstanceAsync() {
-	logger := log.WithFields(log.Fields{"fID": f.fID})
+func (f *Function) removeInstanceAsync(vmID string, stopMetric *metrics.Metric) {
+	logger := log.WithFields(log.Fields{"fID": f.fID, "vmID": vmID})
 
 	logger.Debug("Removing instance (async)")
 
 	go func() {
-		err := orch.StopSingleVM(context.Background(), f.vmID)
+		err := f.stopInstance(vmID, stopMetric)
 		if err != nil {
 			log.Warn(err)
 		}
 	}()
 }
 
-// RemoveInstance Stops an instance (VM) of the function.
+// RemoveInstance Stops the instances (VMs) of the function,
+// once the in-flight RPCs to the instances complete.
 func (f *Function) RemoveInstance(isSync bool) (string, error) {
+	var insts []*funcInstance
+
 	f.Lock()
-	defer f.Unlock()
+	for _, inst := range f.instances {
+		if inst.state == instanceUp && !inst.isRemoving {
+			inst.isRemoving = true
+			insts = append(insts, inst)
+		}
+	}
+	f.Unlock()
 
-	logger := log.WithFields(log.Fields{"fID": f.fID, "isSync": isSync})
+	var (
+		msgs     []string
+		firstErr error
+	)
+
+	for _, inst := range insts {
+		r, err := f.removeInstance(inst, isSync)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if r != "" {
+			msgs = append(msgs, r)
+		}
+	}
+
+	f.Lock()
+	for _, inst := range insts {
+		inst.isRemoving = false
+	}
+	f.broadcast()
+	f.Unlock()
+
+	return strings.Join(msgs, "; "), firstErr
+}
+
+// removeInstance Offloads the instance if it has a snapshot or stops it otherwise,
+// once the in-flight RPCs to the instance complete
+func (f *Function) removeInstance(inst *funcInstance, isSync bool) (string, error) {
+	stopMetric := metrics.NewMetric()
+
+	// The RPCs are forwarded to the instance under the read lock,
+	// so the lock is acquired once the in-flight RPCs are drained
+	tStart := time.Now()
+	inst.Lock()
+	defer inst.Unlock()
+	stopMetric.MetricMap[metrics.DrainRPCs] = metrics.ToUS(time.Since(tStart))
+
+	if !inst.isUp {
+		return "Instance " + inst.vmID + " is not running", nil
+	}
+
+	logger := log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID, "isSync": isSync})
 
 	logger.Debug("Removing instance")
 
@@ -408,100 +693,167 @@ func (f *Function) RemoveInstance(isSync bool) (string, error) {
 		err error
 	)
 
-	f.OnceAddInstance = new(sync.Once)
+	inst.isUp = false
 
-	if orch.GetSnapshotsEnabled() {
-		f.OffloadInstance()
-		r = "Successfully offloaded instance " + f.vmID
+	if orch.GetSnapshotsEnabled() && inst.isSnapshotReady {
+		f.Lock()
+		f.setInstanceState(inst, instanceOffloaded)
+		f.Unlock()
+
+		if err = f.offloadInstance(inst); err != nil {
+			return "Failed to offload instance " + inst.vmID, err
+		}
+		r = "Successfully offloaded instance " + inst.vmID
 	} else {
+		// The function may start a new instance before this one is stopped
+		f.Lock()
+		f.dropInstance(inst)
+		f.Unlock()
+
 		if isSync {
-			err = orch.StopSingleVM(context.Background(), f.vmID)
+			if err = f.stopInstance(inst.vmID, stopMetric); err != nil {
+				return "Failed to stop instance " + inst.vmID, err
+			}
+			r = fmt.Sprintf("Successfully stopped instance %s in %.1f us", inst.vmID, stopMetric.Total())
 		} else {
-			f.RemoveInstanceAsync()
-			r = "Successfully removed (async) instance " + f.vmID
+			f.removeInstanceAsync(inst.vmID, stopMetric)
+			r = "Successfully removed (async) instance " + inst.vmID
 		}
 	}
 
 	return r, err
 }
 
+// stopInstance Stops the VM of an instance, giving the function in the VM
+// the orchestrator's stop timeout to exit, and exports the latency of the stop
+func (f *Function) stopInstance(vmID string, stopMetric *metrics.Metric) error {
+	orchMetric, err := orch.StopVM(context.Background(), vmID)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range orchMetric.MetricMap {
+		stopMetric.MetricMap[k] = v
+	}
+
+	f.prom.observeStop(f.imageName, stopMetric)
+
+	log.WithFields(log.Fields{"fID": f.fID, "vmID": vmID}).Debugf("Stopped instance in %.1f us (drained RPCs in %.1f us)",
+		stopMetric.Total(), stopMetric.MetricMap[metrics.DrainRPCs])
+
+	return nil
+}
+
 // DumpUPFPageStats Dumps the memory manager's stats about the number of
 // the unique pages and the number of the pages that are reused across invocations
 func (f *Function) DumpUPFPageStats(functionName, metricsOutFilePath string) error {
-	return orch.DumpUPFPageStats(f.vmID, functionName, metricsOutFilePath)
+	return orch.DumpUPFPageStats(f.getPrimaryVMID(), functionName, metricsOutFilePath)
 }
 
 // DumpUPFLatencyStats Dumps the memory manager's latency stats
 func (f *Function) DumpUPFLatencyStats(functionName, latencyOutFilePath string) error {
-	return orch.DumpUPFLatencyStats(f.vmID, functionName, latencyOutFilePath)
+	return orch.DumpUPFLatencyStats(f.getPrimaryVMID(), functionName, latencyOutFilePath)
 }
 
-// CreateInstanceSnapshot Creates a snapshot of the instance
-func (f *Function) CreateInstanceSnapshot() {
-	logger := log.WithFields(log.Fields{"fID": f.fID})
+// createInstanceSnapshot Creates a snapshot of the instance
+func (f *Function) createInstanceSnapshot(inst *funcInstance) error {
+	logger := log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID})
 
 	logger.Debug("Creating instance snapshot")
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	err := orch.PauseVM(ctx, f.vmID)
+	err := orch.PauseVM(ctx, inst.vmID)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 
-	err = orch.CreateSnapshot(ctx, f.vmID)
-	if err != nil {
-		log.Panic(err)
+	if f.isPinnedInMem {
+		// The snapshots of the pinned functions are never evicted
+		orch.PinSnapshot(f.imageName, f.getVMSpec())
 	}
 
-	_, err = orch.ResumeVM(ctx, f.vmID)
-	if err != nil {
-		log.Panic(err)
+	snapErr := orch.CreateSnapshot(ctx, inst.vmID)
+
+	// The instance keeps serving even if the snapshot fails
+	_, err = orch.ResumeVM(ctx, inst.vmID)
+	if snapErr != nil {
+		return snapErr
 	}
+
+	return err
 }
 
-// OffloadInstance Offloads the instance
-func (f *Function) OffloadInstance() {
-	logger := log.WithFields(log.Fields{"fID": f.fID})
+// offloadInstance Offloads the instance
+func (f *Function) offloadInstance(inst *funcInstance) error {
+	logger := log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID})
 
 	logger.Debug("Offloading instance")
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
-	err := orch.Offload(ctx, f.vmID)
+	err := orch.Offload(ctx, inst.vmID)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
-	f.conn.Close()
+	inst.fwd.close()
+
+	return nil
 }
 
-// LoadInstance Loads a new instance of the function from its snapshot and resumes it
+// loadInstance Loads the instance from its snapshot and resumes it
 // The tap, the shim and the vmID remain the same
-func (f *Function) LoadInstance() *metrics.Metric {
-	logger := log.WithFields(log.Fields{"fID": f.fID})
+func (f *Function) loadInstance(ctx context.Context, inst *funcInstance) (*metrics.Metric, error) {
+	logger := log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID})
 
 	logger.Debug("Loading instance")
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*60)
 	defer cancel()
 
-	loadMetr, err := orch.LoadSnapshot(ctx, f.vmID)
+	loadMetr, err := orch.LoadSnapshot(ctx, inst.vmID)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	resumeMetr, err := orch.ResumeVM(ctx, f.vmID)
+	resumeMetr, err := orch.ResumeVM(ctx, inst.vmID)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
 	for k, v := range resumeMetr.MetricMap {
 		loadMetr.MetricMap[k] = v
 	}
 
-	return loadMetr
+	return loadMetr, nil
+}
+
+// info Returns the description of the function and its instances
+func (f *Function) info() FunctionInfo {
+	f.Lock()
+	defer f.Unlock()
+
+	info := FunctionInfo{
+		FID:       f.fID,
+		ImageName: f.imageName,
+		IsPinned:  f.isPinnedInMem,
+		Served:    f.GetStatServed(),
+		Queued:    f.queued,
+		Instances: make([]InstanceInfo, 0, len(f.instances)),
+	}
+
+	for _, inst := range f.instances {
+		info.Instances = append(info.Instances, InstanceInfo{
+			VMID:     inst.vmID,
+			State:    inst.state.String(),
+			InFlight: inst.inFlight,
+			Served:   f.stats.GetInstanceServed(f.fID, inst.vmID),
+		})
+	}
+
+	return info
 }
 
 // GetStatServed Returns the served counter value
@@ -514,35 +866,75 @@ func (f *Function) ZeroServedStat() {
 	atomic.StoreUint64(&f.stats.statMap[f.fID].served, 0)
 }
 
-// getVMID Creates the vmID for the function
+// startInstanceFromSnapshot Starts an instance from the shared snapshot of the function's
+// image and VM spec, e.g., taken by another function or before the daemon restarted.
+// Returns nil if there is no such snapshot or the instance fails to start from it.
+func (f *Function) startInstanceFromSnapshot(ctx context.Context, inst *funcInstance) *metrics.Metric {
+	if !orch.GetSnapshotsEnabled() {
+		return nil
+	}
+
+	if _, err := orch.GetSnapshot(f.imageName, f.getVMSpec()); err != nil {
+		return nil
+	}
+
+	logger := log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID})
+
+	resp, metr, err := orch.StartVMFromSnapshot(ctx, inst.vmID, f.imageName, f.getVMSpec())
+	if err != nil {
+		if errors.Cause(err) == ctriface.ErrNotSupported {
+			logger.Debug("Cannot start instance from snapshot, booting it")
+		} else {
+			logger.WithError(err).Warn("Failed to start instance from snapshot, booting it")
+		}
+		return nil
+	}
+
+	inst.guestIP = resp.GuestIP
+
+	// The instance's own snapshot is a copy of the shared one
+	inst.OnceCreateSnapInstance.Do(func() {})
+	inst.isSnapshotReady = true
+
+	return metr
+}
+
+// getFwdCfg Returns how the requests are forwarded to the function's instances
+func (f *Function) getFwdCfg() FwdCfg {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.fwd
+}
+
+// getVMSpec Returns the spec of the VMs that run the function's instances
+func (f *Function) getVMSpec() ctriface.VMSpec {
+	f.Lock()
+	spec := f.vmSpec
+	f.Unlock()
+
+	if spec != nil {
+		return *spec
+	}
+
+	return orch.GetVMSpec(f.imageName)
+}
+
+// getVMID Creates the vmID for a new instance of the function
 func (f *Function) getVMID() string {
 	return fmt.Sprintf("%s-%d", f.fID, f.lastInstanceID)
 }
 
-func (f *Function) getFuncClient() (hpb.GreeterClient, error) {
-	backoffConfig := backoff.DefaultConfig
-	backoffConfig.MaxDelay = 5 * time.Second
-	connParams := grpc.ConnectParams{
-		Backoff: backoffConfig,
-	}
+// getPrimaryVMID Returns the vmID of the oldest instance of the function, if any
+func (f *Function) getPrimaryVMID() string {
+	f.Lock()
+	defer f.Unlock()
 
-	gopts := []grpc.DialOption{
-		grpc.WithBlock(),
-		grpc.WithInsecure(),
-		grpc.FailOnNonTempDialError(true),
-		grpc.WithConnectParams(connParams),
-		grpc.WithContextDialer(contextDialer),
+	if len(f.instances) == 0 {
+		return ""
 	}
 
-	//  This timeout must be large enough for all functions to start up (e.g., ML training takes few seconds)
-	ctxx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	conn, err := grpc.DialContext(ctxx, f.guestIP+":50051", gopts...)
-	f.conn = conn
-	if err != nil {
-		return nil, err
-	}
-	return hpb.NewGreeterClient(conn), nil
+	return f.instances[0].vmID
 }
 
 func contextDialer(ctx context.Context, address string) (net.Conn, error) {
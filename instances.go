@@ -0,0 +1,385 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultFwdTimeout Deadline of the RPCs to the instances if the caller has none
+const defaultFwdTimeout = 20 * time.Second
+
+// ScalingCfg Number of the instances of each function, their concurrency,
+// and the queue of the requests that wait for an instance
+type ScalingCfg struct {
+	// MaxInstances Maximum number of the running instances of a function, unlimited if zero
+	MaxInstances int
+	// InstanceConcurrency Maximum number of the requests that an instance
+	// serves concurrently, unlimited if zero
+	InstanceConcurrency int
+	// ScaleInTimeout Idle period after which the instances beyond
+	// the first one retire, they never retire if zero
+	ScaleInTimeout time.Duration
+	// MaxQueueDepth Maximum number of the requests that wait for an instance
+	// of a function, unlimited if zero
+	MaxQueueDepth int
+	// QueueTimeout Maximum time a request waits for an instance, unlimited if zero
+	QueueTimeout time.Duration
+}
+
+type instanceState int
+
+const (
+	instanceStarting instanceState = iota
+	instanceUp
+	instanceOffloaded
+)
+
+func (s instanceState) String() string {
+	switch s {
+	case instanceStarting:
+		return "starting"
+	case instanceUp:
+		return "running"
+	case instanceOffloaded:
+		return "offloaded"
+	default:
+		return "unknown"
+	}
+}
+
+// instanceStart Start of an instance, which the requests admitted to the instance wait for
+type instanceStart struct {
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+// funcInstance Instance (VM) of a function. The fields below the lock of the
+// instance are guarded by the lock of the function.
+type funcInstance struct {
+	sync.RWMutex           // the RPCs are forwarded under the read lock
+	vmID                   string
+	isUp                   bool // if not up, the admitted requests need another instance
+	isSnapshotReady        bool // if ready, the orchestrator should load the instance rather than creating it
+	OnceCreateSnapInstance *sync.Once
+	fwd                    forwarder
+	guestIP                string
+
+	state      instanceState
+	start      *instanceStart
+	inFlight   int
+	isRemoving bool // if removing, the requests are not admitted to the instance
+	isRetiring bool // if retiring, the requests are not admitted to the instance
+	keepAlive  keepAlivePolicy
+	idleSince  time.Time
+	idleGen    uint64 // invalidates the idle timers armed before a request arrived
+	idleTimer  *time.Timer
+}
+
+func newFuncInstance(vmID string, keepAlive keepAlivePolicy) *funcInstance {
+	return &funcInstance{
+		vmID:                   vmID,
+		OnceCreateSnapInstance: new(sync.Once),
+		keepAlive:              keepAlive,
+	}
+}
+
+// fwdRPC Forward the RPC to an instance, then forwards the response back.
+// Must be called with the read lock of the instance held.
+func (inst *funcInstance) fwdRPC(ctx context.Context, method string, reqPayload []byte) ([]byte, error) {
+	logger := log.WithFields(log.Fields{"vmID": inst.vmID})
+
+	logger.Debug("FwdRPC: Forwarding RPC to function instance")
+	resp, err := inst.fwd.forward(ctx, method, reqPayload)
+	logger.Debug("FwdRPC: Received a response from the  function instance")
+
+	return resp, err
+}
+
+// acquireInstance Admits a request (or, if isRequest is false, a call that only needs
+// a running instance) to an instance of the function, then waits until the instance
+// starts. Returns true if the caller started the instance. Only the requests are
+// subject to the limits of the queue.
+func (f *Function) acquireInstance(ctx context.Context, isRequest bool, serveMetric *metrics.Metric) (*funcInstance, bool, error) {
+	tStart := time.Now()
+
+	_, queueSpan := tracing.StartSpan(ctx, metrics.QueueWait)
+	endQueueWait := func(err error) {
+		serveMetric.MetricMap[metrics.QueueWait] = metrics.ToUS(time.Since(tStart))
+		tracing.EndSpan(queueSpan, err)
+	}
+
+	var queueTimeout <-chan time.Time
+	if isRequest && f.scaling.QueueTimeout > 0 {
+		timer := time.NewTimer(f.scaling.QueueTimeout)
+		defer timer.Stop()
+		queueTimeout = timer.C
+	}
+
+	f.Lock()
+	inst, isStarter, err := f.selectInstance(ctx, isRequest, queueTimeout)
+	if err != nil {
+		f.Unlock()
+		endQueueWait(err)
+		return nil, false, err
+	}
+
+	start := inst.start
+	isQueued := false
+
+	select {
+	case <-start.done:
+	default:
+		if !isStarter && isRequest {
+			// The request queues until the instance starts
+			if err := f.enqueue(); err != nil {
+				f.Unlock()
+				endQueueWait(err)
+				return nil, false, err
+			}
+			isQueued = true
+		}
+	}
+
+	f.admitInstance(inst, isRequest)
+	f.Unlock()
+
+	if isStarter {
+		endQueueWait(nil)
+
+		logger := log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID})
+		logger.Debug("Function has no instance with capacity, starting an instance...")
+
+		tStart := time.Now()
+		startCtx, startSpan := tracing.StartSpan(ctx, metrics.AddInstance, tracing.VMIDKey.String(inst.vmID))
+		metr, err := f.startInstance(startCtx, inst)
+		tracing.EndSpan(startSpan, err)
+		serveMetric.MetricMap[metrics.AddInstance] = metrics.ToUS(time.Since(tStart))
+
+		if err != nil {
+			logger.WithError(err).Error("Failed to start the instance")
+		}
+
+		if metr != nil {
+			for k, v := range metr.MetricMap {
+				serveMetric.MetricMap[k] = v
+			}
+		}
+	}
+
+	if isStarter {
+		err = start.err
+	} else {
+		select {
+		case <-start.done:
+			err = start.err
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-queueTimeout:
+			err = misc.ResourceExhaustedErr("no instance of function " + f.fID + " started within the queueing timeout")
+		}
+	}
+
+	if isQueued {
+		f.Lock()
+		f.queued--
+		f.Unlock()
+	}
+
+	if !isStarter {
+		endQueueWait(err)
+	}
+
+	if err != nil {
+		f.releaseInstance(inst, nil)
+		return nil, isStarter, err
+	}
+
+	return inst, isStarter, nil
+}
+
+// selectInstance Selects the instance to admit a request to, queueing the request if all
+// instances are saturated and the function cannot scale out. Returns true if the caller
+// needs to start the instance. Must be called with the function's lock held.
+func (f *Function) selectInstance(ctx context.Context, isRequest bool, queueTimeout <-chan time.Time) (*funcInstance, bool, error) {
+	for {
+		if inst := f.leastLoadedInstance(); inst != nil {
+			return inst, false, nil
+		}
+
+		if f.scaling.MaxInstances <= 0 || f.numActiveInstances() < f.scaling.MaxInstances {
+			return f.scaleOut(), true, nil
+		}
+
+		if isRequest {
+			if err := f.enqueue(); err != nil {
+				return nil, false, err
+			}
+		}
+
+		err := f.waitChange(ctx, queueTimeout)
+
+		if isRequest {
+			f.queued--
+		}
+
+		if err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// enqueue Queues a request that waits for an instance, unless the queue is full.
+// Must be called with the function's lock held.
+func (f *Function) enqueue() error {
+	if f.scaling.MaxQueueDepth > 0 && f.queued >= f.scaling.MaxQueueDepth {
+		return misc.ResourceExhaustedErr("request queue of function " + f.fID + " is full")
+	}
+
+	f.queued++
+
+	return nil
+}
+
+// waitChange Waits until an instance gets capacity or stops retiring. Must be called
+// with the function's lock held, which is released while waiting.
+func (f *Function) waitChange(ctx context.Context, queueTimeout <-chan time.Time) error {
+	changed := f.changed
+	f.Unlock()
+	defer f.Lock()
+
+	select {
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-queueTimeout:
+		return misc.ResourceExhaustedErr("no instance of function " + f.fID + " got capacity within the queueing timeout")
+	}
+}
+
+// broadcast Wakes up the requests that wait for an instance to get capacity.
+// Must be called with the function's lock held.
+func (f *Function) broadcast() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// leastLoadedInstance Returns the running instance with the fewest in-flight requests
+// that is below its concurrency limit or, if there is none, such an instance that is starting
+func (f *Function) leastLoadedInstance() *funcInstance {
+	var best *funcInstance
+
+	for _, inst := range f.instances {
+		if inst.state == instanceOffloaded || inst.isRemoving || inst.isRetiring {
+			continue
+		}
+
+		if f.scaling.InstanceConcurrency > 0 && inst.inFlight >= f.scaling.InstanceConcurrency {
+			continue
+		}
+
+		switch {
+		case best == nil:
+			best = inst
+		case best.state == instanceStarting && inst.state == instanceUp:
+			best = inst
+		case best.state == inst.state && inst.inFlight < best.inFlight:
+			best = inst
+		}
+	}
+
+	return best
+}
+
+// scaleOut Adds an instance to the function, reusing an offloaded instance if there is one
+func (f *Function) scaleOut() *funcInstance {
+	var inst *funcInstance
+
+	for _, i := range f.instances {
+		if i.state == instanceOffloaded {
+			inst = i
+			break
+		}
+	}
+
+	if inst == nil {
+		var keepAlive keepAlivePolicy
+		if f.newKeepAlive != nil {
+			keepAlive = f.newKeepAlive()
+		}
+
+		inst = newFuncInstance(f.getVMID(), keepAlive)
+		f.lastInstanceID++
+		f.instances = append(f.instances, inst)
+	}
+
+	inst.start = &instanceStart{done: make(chan struct{})}
+	f.setInstanceState(inst, instanceStarting)
+
+	return inst
+}
+
+// numActiveInstances Returns the number of the instances that are starting or running
+func (f *Function) numActiveInstances() int {
+	n := 0
+	for _, inst := range f.instances {
+		if inst.state != instanceOffloaded {
+			n++
+		}
+	}
+
+	return n
+}
+
+// setInstanceState Sets the state of the instance. Must be called with the function's lock held.
+func (f *Function) setInstanceState(inst *funcInstance, state instanceState) {
+	inst.state = state
+	f.stats.SetInstanceState(f.fID, inst.vmID, state.String())
+	f.broadcast()
+}
+
+// dropInstance Removes a stopped instance from the function. Must be called with the function's lock held.
+func (f *Function) dropInstance(inst *funcInstance) {
+	for i, other := range f.instances {
+		if other == inst {
+			f.instances = append(f.instances[:i], f.instances[i+1:]...)
+			break
+		}
+	}
+
+	if inst.idleTimer != nil {
+		inst.idleTimer.Stop()
+		inst.idleTimer = nil
+	}
+
+	f.stats.RemoveInstanceStats(f.fID, inst.vmID)
+	f.broadcast()
+}
@@ -0,0 +1,147 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+)
+
+func TestInstanceLoadBalancing(t *testing.T) {
+	f, _ := newTestFunction(t, "lb", ScalingCfg{MaxInstances: 3, InstanceConcurrency: 2}, nil)
+	instA, instB := addTestInstance(f), addTestInstance(f)
+
+	admitted := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		inst, isStarter, err := f.acquireInstance(context.Background(), true, metrics.NewMetric())
+		require.NoError(t, err)
+		require.False(t, isStarter, "Scaled out before the instances were saturated")
+		admitted[inst.vmID]++
+	}
+	require.Equal(t, map[string]int{instA.vmID: 2, instB.vmID: 2}, admitted, "Requests must be balanced across instances")
+
+	f.Lock()
+	inst, isStarter, err := f.selectInstance(context.Background(), true, nil)
+	f.Unlock()
+	require.NoError(t, err)
+	require.True(t, isStarter, "Did not scale out when the instances were saturated")
+	require.Equal(t, "lb-2", inst.vmID)
+	require.Equal(t, instanceStarting, inst.state)
+
+	stats := f.stats.SprintStats()
+	require.Contains(t, stats, "lb-0, running, 0")
+	require.Contains(t, stats, "lb-2, starting, 0")
+}
+
+func TestInstanceSaturation(t *testing.T) {
+	f, _ := newTestFunction(t, "sat", ScalingCfg{MaxInstances: 1, InstanceConcurrency: 1}, nil)
+	addTestInstance(f)
+
+	inst, _, err := f.acquireInstance(context.Background(), true, metrics.NewMetric())
+	require.NoError(t, err)
+
+	var isAdmitted int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		other, _, err := f.acquireInstance(context.Background(), true, metrics.NewMetric())
+		require.NoError(t, err)
+		atomic.StoreInt32(&isAdmitted, 1)
+		f.releaseInstance(other, nil)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	require.Zero(t, atomic.LoadInt32(&isAdmitted), "Admitted a request to a saturated instance")
+
+	f.releaseInstance(inst, nil)
+	<-done
+}
+
+func TestInstanceQueue(t *testing.T) {
+	queueTimeout := 50 * time.Millisecond
+	f, _ := newTestFunction(t, "queue", ScalingCfg{
+		MaxInstances:        1,
+		InstanceConcurrency: 1,
+		MaxQueueDepth:       1,
+		QueueTimeout:        queueTimeout,
+	}, nil)
+	addTestInstance(f)
+
+	inst, _, err := f.acquireInstance(context.Background(), true, metrics.NewMetric())
+	require.NoError(t, err)
+	defer f.releaseInstance(inst, nil)
+
+	queuedMetric := metrics.NewMetric()
+	queuedErr := make(chan error)
+	go func() {
+		_, _, err := f.acquireInstance(context.Background(), true, queuedMetric)
+		queuedErr <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		f.Lock()
+		defer f.Unlock()
+		return f.queued == 1
+	}, time.Second, time.Millisecond, "Request did not queue")
+
+	_, _, err = f.acquireInstance(context.Background(), true, metrics.NewMetric())
+	require.Equal(t, codes.ResourceExhausted, misc.GRPCCode(err), "Admitted a request to a full queue")
+
+	err = <-queuedErr
+	require.Equal(t, codes.ResourceExhausted, misc.GRPCCode(err), "Request must time out in the queue")
+	require.GreaterOrEqual(t, queuedMetric.MetricMap[metrics.QueueWait], metrics.ToUS(queueTimeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), queueTimeout/5)
+	defer cancel()
+
+	_, _, err = f.acquireInstance(ctx, true, metrics.NewMetric())
+	require.Equal(t, codes.DeadlineExceeded, misc.GRPCCode(err), "Request must time out with the caller's deadline")
+
+	f.Lock()
+	defer f.Unlock()
+	require.Zero(t, f.queued, "Queue must be empty")
+}
+
+func TestInstanceScaleIn(t *testing.T) {
+	timeout := 50 * time.Millisecond
+	f, p := newTestFunction(t, "scale-in", ScalingCfg{MaxInstances: 2, ScaleInTimeout: timeout}, &servedKeepAlive{servedTh: 1000})
+
+	addTestInstance(f)
+	serveTestRequest(t, f, 0)
+	time.Sleep(2 * timeout)
+	require.Zero(t, atomic.LoadInt64(&p.retired), "Retired the last instance")
+
+	addTestInstance(f)
+	serveTestRequest(t, f, 0)
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&p.retired) == 1 },
+		10*timeout, timeout/5, "Did not retire an idle instance beyond the first one")
+}
@@ -0,0 +1,351 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ease-lab/vhive/metrics"
+)
+
+// KeepAlivePolicy Policy that decides when the instances of a function that is
+// not pinned in memory are retired, i.e., offloaded or stopped
+type KeepAlivePolicy string
+
+const (
+	// KeepAliveServed Retires the instance after it serves a number of requests
+	KeepAliveServed KeepAlivePolicy = "served"
+	// KeepAliveFixed Retires the instance after it is idle for a fixed period
+	KeepAliveFixed KeepAlivePolicy = "fixed"
+	// KeepAliveAdaptive Retires the instance after it is idle for a period
+	// that covers most of the function's observed idle times
+	KeepAliveAdaptive KeepAlivePolicy = "adaptive"
+)
+
+const (
+	// adaptiveNumBins Number of the bins of the idle time histogram
+	adaptiveNumBins = 100
+	// adaptiveMinSamples Number of the idle times observed before the histogram is used
+	adaptiveMinSamples = 10
+	// adaptivePercentile Share of the idle times that the keep-alive window covers
+	adaptivePercentile = 0.99
+	// adaptiveMargin Safety margin added to the keep-alive window
+	adaptiveMargin = 0.1
+)
+
+// KeepAliveCfg Keep-alive configuration of the functions that are not pinned in memory
+type KeepAliveCfg struct {
+	// Policy Keep-alive policy, served by default
+	Policy KeepAlivePolicy
+	// IdleTimeout Keep-alive window (fixed policy), or the window until
+	// enough idle times are observed (adaptive policy)
+	IdleTimeout time.Duration
+	// MinIdleTimeout, MaxIdleTimeout Bounds of the adaptive keep-alive window
+	MinIdleTimeout time.Duration
+	MaxIdleTimeout time.Duration
+}
+
+// ParseKeepAlivePolicy Converts the name of a keep-alive policy to the policy
+func ParseKeepAlivePolicy(name string) (KeepAlivePolicy, error) {
+	switch policy := KeepAlivePolicy(name); policy {
+	case KeepAliveServed, KeepAliveFixed, KeepAliveAdaptive:
+		return policy, nil
+	default:
+		return "", errors.Errorf("unknown keep-alive policy %s", name)
+	}
+}
+
+// keepAlivePolicy Decides when an instance of a function retires.
+// The calls are serialized by the function's lock.
+type keepAlivePolicy interface {
+	// onArrival Records a request that arrives after the instance was idle
+	// for idleTime (zero if it was busy), returns true if the instance
+	// must retire once it serves the request
+	onArrival(idleTime time.Duration) bool
+	// idleWindow Returns how long the instance is kept alive when it is idle,
+	// zero if it is never retired for being idle
+	idleWindow() time.Duration
+	// onRetire Records that the instance retired
+	onRetire()
+}
+
+// admitInstance Admits a request to the instance, the instance starts retiring if its
+// keep-alive policy decides so. Must be called with the function's lock held.
+func (f *Function) admitInstance(inst *funcInstance, isRequest bool) {
+	var idleTime time.Duration
+	if inst.inFlight == 0 && !inst.idleSince.IsZero() {
+		idleTime = time.Since(inst.idleSince)
+	}
+
+	inst.inFlight++
+
+	inst.idleGen++
+	if inst.idleTimer != nil {
+		inst.idleTimer.Stop()
+		inst.idleTimer = nil
+	}
+
+	if isRequest && inst.keepAlive != nil && inst.keepAlive.onArrival(idleTime) {
+		inst.isRetiring = true
+	}
+}
+
+// releaseInstance Releases a request admitted to the instance. The last request released
+// by a retiring instance removes it, otherwise the last request arms the idle timer.
+func (f *Function) releaseInstance(inst *funcInstance, serveMetric *metrics.Metric) {
+	f.Lock()
+
+	inst.inFlight--
+	f.broadcast()
+
+	if inst.inFlight > 0 || inst.state != instanceUp {
+		f.Unlock()
+		return
+	}
+
+	inst.idleSince = time.Now()
+
+	if inst.isRetiring {
+		f.Unlock()
+
+		log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID}).Debugf("Function has to shut down its instance, served %d requests",
+			f.stats.GetInstanceServed(f.fID, inst.vmID))
+		tStart := time.Now()
+		f.retireInstance(inst)
+		if serveMetric != nil {
+			serveMetric.MetricMap[metrics.RetireOld] = metrics.ToUS(time.Since(tStart))
+		}
+
+		return
+	}
+
+	f.armIdleTimer(inst)
+	f.Unlock()
+}
+
+// armIdleTimer Retires the idle instance once its keep-alive window or, if the function
+// runs other instances, the scale-in timeout expires. Must be called with the function's lock held.
+func (f *Function) armIdleTimer(inst *funcInstance) {
+	var window time.Duration
+	if inst.keepAlive != nil {
+		window = inst.keepAlive.idleWindow()
+	}
+
+	isScaleIn := false
+	if timeout := f.scaling.ScaleInTimeout; timeout > 0 && f.numActiveInstances() > 1 && (window == 0 || timeout < window) {
+		window = timeout
+		isScaleIn = true
+	}
+
+	if window <= 0 {
+		return
+	}
+
+	gen := inst.idleGen
+	inst.idleTimer = time.AfterFunc(window, func() { f.retireIdleInstance(inst, gen, window, isScaleIn) })
+}
+
+// retireIdleInstance Retires the instance unless a request arrived after the idle timer was armed
+func (f *Function) retireIdleInstance(inst *funcInstance, gen uint64, window time.Duration, isScaleIn bool) {
+	f.Lock()
+
+	if gen != inst.idleGen || inst.inFlight > 0 || inst.state != instanceUp || inst.isRemoving || inst.isRetiring {
+		f.Unlock()
+		return
+	}
+
+	inst.idleTimer = nil
+
+	if isScaleIn && f.numActiveInstances() <= 1 {
+		// The function keeps its last instance, unless its keep-alive policy retires it
+		f.armIdleTimer(inst)
+		f.Unlock()
+		return
+	}
+
+	inst.isRetiring = true
+	f.Unlock()
+
+	log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID}).Debugf("Function has to shut down its instance, idle for %s", window)
+	f.retireInstance(inst)
+}
+
+// retireInstance Removes the instance, then admits the requests that wait for it
+func (f *Function) retireInstance(inst *funcInstance) {
+	if _, err := f.removeInstance(inst, false); err != nil {
+		log.WithFields(log.Fields{"fID": f.fID, "vmID": inst.vmID}).WithError(err).Error("Failed to retire instance")
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.stats.ZeroInstanceServed(f.fID, inst.vmID)
+	if inst.keepAlive != nil {
+		inst.keepAlive.onRetire()
+	}
+	inst.isRetiring = false
+	f.broadcast()
+}
+
+// newKeepAlivePolicyFactory Returns the constructor of the keep-alive policies of
+// a function's instances, servedTh is the mean number of the requests an instance
+// serves (served policy). The instances share the function's adaptive policy,
+// which learns from the idle times of all of them.
+func newKeepAlivePolicyFactory(cfg KeepAliveCfg, servedTh uint64) func() keepAlivePolicy {
+	switch cfg.Policy {
+	case KeepAliveFixed:
+		p := &fixedKeepAlive{timeout: cfg.IdleTimeout}
+		return func() keepAlivePolicy { return p }
+	case KeepAliveAdaptive:
+		p := newAdaptiveKeepAlive(cfg.IdleTimeout, cfg.MinIdleTimeout, cfg.MaxIdleTimeout)
+		return func() keepAlivePolicy { return p }
+	default:
+		return func() keepAlivePolicy { return newServedKeepAlive(servedTh) }
+	}
+}
+
+// servedKeepAlive Retires the instance after it serves servedTh requests
+type servedKeepAlive struct {
+	servedTh uint64
+	served   uint64
+}
+
+// newServedKeepAlive Draws the number of the requests served by the instance
+// from a normal distribution with stddev=servedTh/2, mean=servedTh
+func newServedKeepAlive(servedTh uint64) *servedKeepAlive {
+	thresh := int64(rand.NormFloat64()*float64(servedTh/2) + float64(servedTh))
+	if thresh <= 0 {
+		thresh = int64(servedTh)
+	}
+	if isTestMode && servedTh == 40 { // 40 is used in tests
+		thresh = 40
+	}
+
+	return &servedKeepAlive{servedTh: uint64(thresh)}
+}
+
+func (p *servedKeepAlive) onArrival(time.Duration) bool {
+	p.served++
+
+	return p.served >= p.servedTh
+}
+
+func (p *servedKeepAlive) idleWindow() time.Duration {
+	return 0
+}
+
+func (p *servedKeepAlive) onRetire() {
+	p.served = 0
+}
+
+// fixedKeepAlive Retires the instance after it is idle for the timeout
+type fixedKeepAlive struct {
+	timeout time.Duration
+}
+
+func (p *fixedKeepAlive) onArrival(time.Duration) bool {
+	return false
+}
+
+func (p *fixedKeepAlive) idleWindow() time.Duration {
+	return p.timeout
+}
+
+func (p *fixedKeepAlive) onRetire() {}
+
+// adaptiveKeepAlive Keeps the instance alive for long enough to cover
+// adaptivePercentile of the function's idle times, which are kept in a histogram
+// of adaptiveNumBins bins up to maxTimeout. The instances of the functions whose
+// idle times often exceed maxTimeout are kept alive for maxTimeout.
+type adaptiveKeepAlive struct {
+	defaultTimeout time.Duration
+	minTimeout     time.Duration
+	maxTimeout     time.Duration
+	binWidth       time.Duration
+	bins           []uint64
+	overflow       uint64
+	samples        uint64
+}
+
+func newAdaptiveKeepAlive(defaultTimeout, minTimeout, maxTimeout time.Duration) *adaptiveKeepAlive {
+	if maxTimeout <= 0 {
+		maxTimeout = defaultTimeout
+	}
+
+	return &adaptiveKeepAlive{
+		defaultTimeout: defaultTimeout,
+		minTimeout:     minTimeout,
+		maxTimeout:     maxTimeout,
+		binWidth:       maxTimeout / adaptiveNumBins,
+		bins:           make([]uint64, adaptiveNumBins),
+	}
+}
+
+func (p *adaptiveKeepAlive) onArrival(idleTime time.Duration) bool {
+	if idleTime <= 0 || p.binWidth == 0 {
+		return false
+	}
+
+	p.samples++
+	if bin := int(idleTime / p.binWidth); bin < adaptiveNumBins {
+		p.bins[bin]++
+	} else {
+		p.overflow++
+	}
+
+	return false
+}
+
+func (p *adaptiveKeepAlive) idleWindow() time.Duration {
+	if p.samples < adaptiveMinSamples {
+		return p.defaultTimeout
+	}
+
+	window := p.maxTimeout
+	target := uint64(adaptivePercentile * float64(p.samples))
+
+	var count uint64
+	for bin, n := range p.bins {
+		count += n
+		if count >= target {
+			window = time.Duration(bin+1) * p.binWidth
+			window += time.Duration(adaptiveMargin * float64(window))
+			break
+		}
+	}
+
+	if window < p.minTimeout {
+		window = p.minTimeout
+	}
+	if window > p.maxTimeout {
+		window = p.maxTimeout
+	}
+
+	return window
+}
+
+func (p *adaptiveKeepAlive) onRetire() {}
@@ -0,0 +1,185 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ease-lab/vhive/metrics"
+)
+
+// testKeepAlive Keep-alive policy that counts the retirements
+type testKeepAlive struct {
+	keepAlivePolicy
+	retired int64
+}
+
+func (p *testKeepAlive) onRetire() {
+	atomic.AddInt64(&p.retired, 1)
+	p.keepAlivePolicy.onRetire()
+}
+
+// newTestFunction Creates a function whose instances are not backed by VMs,
+// so removing them is a no-op
+func newTestFunction(t *testing.T, fID string, scaling ScalingCfg, policy keepAlivePolicy) (*Function, *testKeepAlive) {
+	stats := NewStats()
+	require.NoError(t, stats.CreateStats(fID))
+
+	f := NewFunction(fID, testImageName, stats, 0, KeepAliveCfg{Policy: KeepAliveFixed}, scaling, FwdCfg{Mode: FwdGreeter}, policy == nil)
+	if policy == nil {
+		return f, nil
+	}
+
+	p := &testKeepAlive{keepAlivePolicy: policy}
+	f.newKeepAlive = func() keepAlivePolicy { return p }
+
+	return f, p
+}
+
+// addTestInstance Adds a running instance to the function
+func addTestInstance(f *Function) *funcInstance {
+	f.Lock()
+	defer f.Unlock()
+
+	inst := f.scaleOut()
+	f.setInstanceState(inst, instanceUp)
+	close(inst.start.done)
+
+	return inst
+}
+
+func serveTestRequest(t *testing.T, f *Function, d time.Duration) *funcInstance {
+	inst, isStarter, err := f.acquireInstance(context.Background(), true, metrics.NewMetric())
+	require.NoError(t, err)
+	require.False(t, isStarter, "Started an instance")
+
+	time.Sleep(d)
+	f.releaseInstance(inst, metrics.NewMetric())
+
+	return inst
+}
+
+func TestParseKeepAlivePolicy(t *testing.T) {
+	for _, name := range []string{"served", "fixed", "adaptive"} {
+		policy, err := ParseKeepAlivePolicy(name)
+		require.NoError(t, err)
+		require.Equal(t, KeepAlivePolicy(name), policy)
+	}
+
+	_, err := ParseKeepAlivePolicy("forever")
+	require.Error(t, err, "Parsed an unknown policy")
+}
+
+func TestServedKeepAlive(t *testing.T) {
+	p := &servedKeepAlive{servedTh: 40}
+	require.Zero(t, p.idleWindow(), "Served policy must not retire idle instances")
+
+	for i := 1; i < 40; i++ {
+		require.False(t, p.onArrival(0), "Retired before the threshold")
+	}
+	require.True(t, p.onArrival(0), "Did not retire at the threshold")
+
+	p.onRetire()
+	require.False(t, p.onArrival(0), "Threshold must be reset after retiring")
+}
+
+func TestAdaptiveKeepAlive(t *testing.T) {
+	p := newAdaptiveKeepAlive(time.Minute, time.Second, 100*time.Second)
+	require.Equal(t, time.Minute, p.idleWindow(), "Default window must be used without enough samples")
+
+	for i := 0; i < 99; i++ {
+		p.onArrival(9500 * time.Millisecond)
+	}
+	p.onArrival(time.Hour)
+	require.Equal(t, 11*time.Second, p.idleWindow(), "Window must cover the 99th percentile with a margin")
+
+	for i := 0; i < 100; i++ {
+		p.onArrival(time.Hour)
+	}
+	require.Equal(t, 100*time.Second, p.idleWindow(), "Window must not exceed the maximum")
+
+	p = newAdaptiveKeepAlive(time.Minute, 5*time.Second, 100*time.Second)
+	for i := 0; i < 100; i++ {
+		p.onArrival(10 * time.Millisecond)
+	}
+	require.Equal(t, 5*time.Second, p.idleWindow(), "Window must not be below the minimum")
+}
+
+func TestKeepAliveIdleTimeout(t *testing.T) {
+	window := 50 * time.Millisecond
+	f, p := newTestFunction(t, "ka-idle", ScalingCfg{MaxInstances: 1}, &fixedKeepAlive{timeout: window})
+	addTestInstance(f)
+
+	serveTestRequest(t, f, 0)
+
+	// A request arriving in time keeps the instance alive
+	time.Sleep(window / 2)
+	serveTestRequest(t, f, window)
+	require.Zero(t, atomic.LoadInt64(&p.retired), "Retired a busy instance")
+
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&p.retired) == 1 },
+		10*window, window/5, "Did not retire an idle instance")
+}
+
+func TestKeepAliveServedParallel(t *testing.T) {
+	servedTh := 10
+	f, p := newTestFunction(t, "ka-served", ScalingCfg{MaxInstances: 1}, &servedKeepAlive{servedTh: uint64(servedTh)})
+	addTestInstance(f)
+
+	var (
+		wg       sync.WaitGroup
+		inFlight int64
+		maxBatch int64
+	)
+	for i := 0; i < 5*servedTh; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			inst, _, err := f.acquireInstance(context.Background(), true, metrics.NewMetric())
+			require.NoError(t, err)
+
+			n := atomic.AddInt64(&inFlight, 1)
+			for {
+				m := atomic.LoadInt64(&maxBatch)
+				if n <= m || atomic.CompareAndSwapInt64(&maxBatch, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt64(&inFlight, -1)
+
+			f.releaseInstance(inst, metrics.NewMetric())
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int64(5), atomic.LoadInt64(&p.retired), "Instance must retire every servedTh requests")
+	require.LessOrEqual(t, atomic.LoadInt64(&maxBatch), int64(servedTh), "Instance served more than servedTh requests")
+}
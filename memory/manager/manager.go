@@ -24,28 +24,46 @@ package manager
 
 import (
 	"encoding/csv"
-	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/stat"
 
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	serveUniqueMetric = "ServeUnique"
-	installWSMetric   = "InstallWS"
-	fetchStateMetric  = "FetchState"
+	serveUniqueMetric   = "ServeUnique"
+	installWSMetric     = "InstallWS"
+	fetchStateMetric    = "FetchState"
+	fetchWSMetric       = "FetchWS"       // reading the working set in the background
+	installWSWaitMetric = "InstallWSWait" // part of InstallWS waiting for the regions to be read
 )
 
 // MemoryManagerCfg Global config of the manager
 type MemoryManagerCfg struct {
 	MetricsModeOn bool
+	Restore       RestoreCfg
+	Record        RecordCfg
+	// FaultWorkers Number of the goroutines that serve the page faults of each VM
+	// concurrently (the number of the vCPUs of the VM if 0)
+	FaultWorkers int
+}
+
+// PageFaultCounts Numbers of the guest memory pages that the memory manager
+// installed in the VMs since it started
+type PageFaultCounts struct {
+	// Served Page faults served one page at a time
+	Served uint64
+	// WorkingSetPages Pages installed from the recorded working sets ahead of the page faults
+	WorkingSetPages uint64
 }
 
 // MemoryManager Serves page faults coming from VMs
@@ -53,6 +71,7 @@ type MemoryManager struct {
 	sync.Mutex
 	MemoryManagerCfg
 	instances map[string]*SnapshotState // Indexed by vmID
+	pfCounts  *PageFaultCounts          // updated atomically by the instances
 }
 
 // NewMemoryManager Initializes a new memory manager
@@ -61,6 +80,7 @@ func NewMemoryManager(cfg MemoryManagerCfg) *MemoryManager {
 
 	m := new(MemoryManager)
 	m.instances = make(map[string]*SnapshotState)
+	m.pfCounts = new(PageFaultCounts)
 	m.MemoryManagerCfg = cfg
 
 	return m
@@ -79,11 +99,15 @@ func (m *MemoryManager) RegisterVM(cfg SnapshotStateCfg) error {
 
 	if _, ok := m.instances[vmID]; ok {
 		logger.Error("VM already registered with the memory manager")
-		return errors.New("VM already registered with the memory manager")
+		return misc.AlreadyExistErr("VM " + vmID + " in the memory manager")
 	}
 
 	cfg.metricsModeOn = m.MetricsModeOn
+	cfg.restoreCfg = m.Restore
+	cfg.recordCfg = m.Record
+	cfg.faultWorkers = m.FaultWorkers
 	state := NewSnapshotState(cfg)
+	state.pfCounts = m.pfCounts
 
 	m.instances[vmID] = state
 
@@ -102,7 +126,7 @@ func (m *MemoryManager) DeregisterVM(vmID string) error {
 	state, ok := m.instances[vmID]
 	if !ok {
 		logger.Error("VM is not registered with the memory manager")
-		return errors.New("VM is not registered with the memory manager")
+		return misc.NonExistErr("VM " + vmID + " in the memory manager")
 	}
 
 	if state.isActive {
@@ -124,15 +148,16 @@ func (m *MemoryManager) Activate(vmID string) error {
 	var (
 		ok      bool
 		state   *SnapshotState
-		readyCh chan int = make(chan int)
+		readyCh chan error = make(chan error)
 	)
 
 	m.Lock()
 
 	state, ok = m.instances[vmID]
 	if !ok {
+		m.Unlock()
 		logger.Error("VM not registered with the memory manager")
-		return errors.New("VM not registered with the memory manager")
+		return misc.NonExistErr("VM " + vmID + " in the memory manager")
 	}
 
 	m.Unlock()
@@ -156,7 +181,13 @@ func (m *MemoryManager) Activate(vmID string) error {
 
 	go state.pollUserPageFaults(readyCh)
 
-	<-readyCh
+	if err := <-readyCh; err != nil {
+		logger.Error("Failed to start serving page faults")
+		state.isActive = false
+		_ = state.unmapGuestMemory()
+		state.userFaultFD.Close()
+		return err
+	}
 
 	return nil
 }
@@ -178,8 +209,9 @@ func (m *MemoryManager) FetchState(vmID string) error {
 
 	state, ok = m.instances[vmID]
 	if !ok {
+		m.Unlock()
 		logger.Error("VM not registered with the memory manager")
-		return errors.New("VM not registered with the memory manager")
+		return misc.NonExistErr("VM " + vmID + " in the memory manager")
 	}
 
 	m.Unlock()
@@ -212,8 +244,9 @@ func (m *MemoryManager) Deactivate(vmID string) error {
 
 	state, ok = m.instances[vmID]
 	if !ok {
+		m.Unlock()
 		logger.Error("VM not registered with the memory manager")
-		return errors.New("VM not registered with the memory manager")
+		return misc.NonExistErr("VM " + vmID + " in the memory manager")
 	}
 
 	m.Unlock()
@@ -228,6 +261,9 @@ func (m *MemoryManager) Deactivate(vmID string) error {
 	}
 
 	state.quitCh <- 0
+	// The workers may still be serving page faults from the guest memory
+	<-state.pollDoneCh
+
 	if err := state.unmapGuestMemory(); err != nil {
 		logger.Error("Failed to munmap guest memory")
 		return err
@@ -236,54 +272,121 @@ func (m *MemoryManager) Deactivate(vmID string) error {
 	state.processMetrics()
 
 	state.userFaultFD.Close()
-	if !state.isRecordReady && !state.IsLazyMode {
-		state.trace.ProcessRecord(state.GuestMemPath, state.WorkingSetPath)
+	state.isActive = false
+
+	if state.pfErr != nil {
+		err := state.pfErr
+		state.pfErr = nil
+		state.abortInvocation()
+		return errors.Wrap(err, "failed to serve page faults")
 	}
 
-	state.isRecordReady = true
-	state.isActive = false
+	if state.IsLazyMode {
+		state.isRecordReady = true
+		return nil
+	}
+
+	if !state.isRecordReady {
+		isRecorded, err := state.finishRecordIteration()
+		if err != nil {
+			logger.Error("Failed to process the record")
+			return err
+		}
+		state.isRecordReady = isRecorded
+		return nil
+	}
+
+	state.checkRerecord()
 
 	return nil
 }
 
-// DumpUPFPageStats Saves the per VM stats
+// UPFPageStats Stats about the pages of a VM that are served across its invocations
+type UPFPageStats struct {
+	IsLazyMode bool
+	// RecordedPages Number of the pages in the trace recorded upon the first invocation
+	RecordedPages int
+	// RecordedRegions Number of the contiguous regions in the trace
+	RecordedRegions int
+	// ServedPages Number of the pages served upon an invocation (lazy mode)
+	ServedPagesMean, ServedPagesStdDev float64
+	// ReusedPages Number of the served pages that are found in the trace (lazy mode)
+	ReusedPagesMean, ReusedPagesStdDev float64
+	// UniquePages Number of the served pages that are not found in the trace
+	UniquePagesMean, UniquePagesStdDev float64
+}
+
+// GetPageFaultCounts Returns the numbers of the pages installed in all the VMs
+func (m *MemoryManager) GetPageFaultCounts() PageFaultCounts {
+	return PageFaultCounts{
+		Served:          atomic.LoadUint64(&m.pfCounts.Served),
+		WorkingSetPages: atomic.LoadUint64(&m.pfCounts.WorkingSetPages),
+	}
+}
+
+// DumpUPFPageStats Dumps the stats about the number of the unique pages and the number of
+// the pages that are reused across invocations
 func (m *MemoryManager) DumpUPFPageStats(vmID, functionName, metricsOutFilePath string) error {
 	var (
 		statHeader []string
 		stats      []string
 	)
 
+	pageStats, err := m.GetUPFPageStats(vmID)
+	if err != nil {
+		return err
+	}
+
+	if pageStats.IsLazyMode {
+		statHeader, stats = getLazyHeaderStats(pageStats, functionName)
+	} else {
+		statHeader, stats = getRecRepHeaderStats(pageStats, functionName)
+	}
+
+	return writeUPFPageStats(metricsOutFilePath, statHeader, stats)
+}
+
+// GetUPFPageStats Returns the stats about the number of the unique pages and the number of
+// the pages that are reused across invocations
+func (m *MemoryManager) GetUPFPageStats(vmID string) (*UPFPageStats, error) {
 	logger := log.WithFields(log.Fields{"vmID": vmID})
 
-	logger.Debug("Dumping stats about number of page faults")
+	logger.Debug("Returning stats about number of page faults")
 
 	m.Lock()
 
 	state, ok := m.instances[vmID]
 	if !ok {
+		m.Unlock()
 		logger.Error("VM not registered with the memory manager")
-		return errors.New("VM not registered with the memory manager")
+		return nil, misc.NonExistErr("VM " + vmID + " in the memory manager")
 	}
 
 	m.Unlock()
 
 	if state.isActive {
 		logger.Error("Cannot get stats while VM is active")
-		return errors.New("Cannot get stats while VM is active")
+		return nil, errors.New("Cannot get stats while VM is active")
 	}
 
 	if !m.MetricsModeOn || !state.metricsModeOn {
 		logger.Error("Metrics mode is not on")
-		return errors.New("Metrics mode is not on")
+		return nil, errors.New("Metrics mode is not on")
+	}
+
+	pageStats := &UPFPageStats{
+		IsLazyMode:      state.IsLazyMode,
+		RecordedPages:   len(state.trace.trace),
+		RecordedRegions: len(state.trace.regions),
 	}
 
+	pageStats.UniquePagesMean, pageStats.UniquePagesStdDev = stat.MeanStdDev(state.uniquePFServed, nil)
 	if state.IsLazyMode {
-		statHeader, stats = getLazyHeaderStats(state, functionName)
-	} else {
-		statHeader, stats = getRecRepHeaderStats(state, functionName)
+		pageStats.ServedPagesMean, pageStats.ServedPagesStdDev = stat.MeanStdDev(state.totalPFServed, nil)
+		pageStats.ReusedPagesMean, pageStats.ReusedPagesStdDev = stat.MeanStdDev(state.reusedPFServed, nil)
 	}
 
-	return writeUPFPageStats(metricsOutFilePath, statHeader, stats)
+	return pageStats, nil
 }
 
 // DumpUPFLatencyStats Dumps latency stats collected for the VM
@@ -296,8 +399,9 @@ func (m *MemoryManager) DumpUPFLatencyStats(vmID, functionName, latencyOutFilePa
 
 	state, ok := m.instances[vmID]
 	if !ok {
+		m.Unlock()
 		logger.Error("VM not registered with the memory manager")
-		return errors.New("VM not registered with the memory manager")
+		return misc.NonExistErr("VM " + vmID + " in the memory manager")
 	}
 
 	m.Unlock()
@@ -326,8 +430,9 @@ func (m *MemoryManager) GetUPFLatencyStats(vmID string) ([]*metrics.Metric, erro
 
 	state, ok := m.instances[vmID]
 	if !ok {
+		m.Unlock()
 		logger.Error("VM not registered with the memory manager")
-		return nil, errors.New("VM not registered with the memory manager")
+		return nil, misc.NonExistErr("VM " + vmID + " in the memory manager")
 	}
 
 	m.Unlock()
@@ -345,7 +450,7 @@ func (m *MemoryManager) GetUPFLatencyStats(vmID string) ([]*metrics.Metric, erro
 	return state.latencyMetrics, nil
 }
 
-func getLazyHeaderStats(state *SnapshotState, functionName string) ([]string, []string) {
+func getLazyHeaderStats(pageStats *UPFPageStats, functionName string) ([]string, []string) {
 	header := []string{
 		"FuncName",
 		"RecPages",
@@ -357,25 +462,21 @@ func getLazyHeaderStats(state *SnapshotState, functionName string) ([]string, []
 		"StdDev",
 	}
 
-	uniqueMean, uniqueStd := stat.MeanStdDev(state.uniquePFServed, nil)
-	totalMean, totalStd := stat.MeanStdDev(state.totalPFServed, nil)
-	reusedMean, reusedStd := stat.MeanStdDev(state.reusedPFServed, nil)
-
 	stats := []string{
 		functionName,
-		strconv.Itoa(len(state.trace.trace)), // number of records (i.e., offsets)
-		strconv.Itoa(int(totalMean)),         // number of pages served
-		fmt.Sprintf("%.1f", totalStd),
-		strconv.Itoa(int(reusedMean)), // number of pages found in the trace
-		fmt.Sprintf("%.1f", reusedStd),
-		strconv.Itoa(int(uniqueMean)), // number of pages not found in the trace
-		fmt.Sprintf("%.1f", uniqueStd),
+		strconv.Itoa(pageStats.RecordedPages),        // number of records (i.e., offsets)
+		strconv.Itoa(int(pageStats.ServedPagesMean)), // number of pages served
+		fmt.Sprintf("%.1f", pageStats.ServedPagesStdDev),
+		strconv.Itoa(int(pageStats.ReusedPagesMean)), // number of pages found in the trace
+		fmt.Sprintf("%.1f", pageStats.ReusedPagesStdDev),
+		strconv.Itoa(int(pageStats.UniquePagesMean)), // number of pages not found in the trace
+		fmt.Sprintf("%.1f", pageStats.UniquePagesStdDev),
 	}
 
 	return header, stats
 }
 
-func getRecRepHeaderStats(state *SnapshotState, functionName string) ([]string, []string) {
+func getRecRepHeaderStats(pageStats *UPFPageStats, functionName string) ([]string, []string) {
 	header := []string{
 		"FuncName",
 		"RecPages",
@@ -384,14 +485,12 @@ func getRecRepHeaderStats(state *SnapshotState, functionName string) ([]string,
 		"StdDev",
 	}
 
-	uniqueMean, uniqueStd := stat.MeanStdDev(state.uniquePFServed, nil)
-
 	stats := []string{
 		functionName,
-		strconv.Itoa(len(state.trace.trace)),   // number of records (i.e., offsets)
-		strconv.Itoa(len(state.trace.regions)), // number of contiguous regions in the trace
-		strconv.Itoa(int(uniqueMean)),          // number of pages not found in the trace
-		fmt.Sprintf("%.1f", uniqueStd),
+		strconv.Itoa(pageStats.RecordedPages),        // number of records (i.e., offsets)
+		strconv.Itoa(pageStats.RecordedRegions),      // number of contiguous regions in the trace
+		strconv.Itoa(int(pageStats.UniquePagesMean)), // number of pages not found in the trace
+		fmt.Sprintf("%.1f", pageStats.UniquePagesStdDev),
 	}
 
 	return header, stats
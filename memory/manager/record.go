@@ -0,0 +1,205 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gonum.org/v1/gonum/stat"
+)
+
+// MergePolicy How the traces of several record iterations are merged into the working set
+type MergePolicy string
+
+const (
+	// MergeUnion The working set has the pages touched in any iteration
+	MergeUnion MergePolicy = "union"
+	// MergeFrequency The working set has the pages touched in at least
+	// RecordCfg.MinFrequency of the iterations
+	MergeFrequency MergePolicy = "frequency"
+)
+
+// DefaultRerecordWindow Number of the replays the unique page faults are averaged over by default
+const DefaultRerecordWindow = 3
+
+// ParseMergePolicy Parses the name of a merge policy, empty is MergeUnion
+func ParseMergePolicy(name string) (MergePolicy, error) {
+	switch policy := MergePolicy(name); policy {
+	case "":
+		return MergeUnion, nil
+	case MergeUnion, MergeFrequency:
+		return policy, nil
+	default:
+		return "", errors.Errorf("unknown merge policy %q (union or frequency)", name)
+	}
+}
+
+// RecordCfg Configures how the working set of a VM is recorded
+type RecordCfg struct {
+	// Iterations Number of the invocations the working set is recorded over (1 if 0)
+	Iterations int
+	// Merge How the traces of the iterations are merged (MergeUnion if empty)
+	Merge MergePolicy
+	// MinFrequency Fraction of the iterations a page must be touched in
+	// to be in the working set, with MergeFrequency
+	MinFrequency float64
+	// RerecordThreshold Unique page faults per page of the working set,
+	// averaged over the last RerecordWindow replays, above which
+	// the working set is recorded again (0 never records it again)
+	RerecordThreshold float64
+	// RerecordWindow Number of the replays the unique page faults are averaged over
+	// (DefaultRerecordWindow if 0)
+	RerecordWindow int
+}
+
+func (c RecordCfg) iterations() int {
+	if c.Iterations < 1 {
+		return 1
+	}
+
+	return c.Iterations
+}
+
+func (c RecordCfg) rerecordWindow() int {
+	if c.RerecordWindow < 1 {
+		return DefaultRerecordWindow
+	}
+
+	return c.RerecordWindow
+}
+
+// mergeRecords Merges the traces of the record iterations. The records stay in the order
+// the pages were first touched in, in the earliest iteration that touched them
+func mergeRecords(iters [][]Record, cfg RecordCfg) []Record {
+	var (
+		merged = make([]Record, 0)
+		counts = make(map[uint64]int) // number of the iterations that touched each page
+	)
+
+	for _, iter := range iters {
+		isTouched := make(map[uint64]bool, len(iter))
+		for _, rec := range iter {
+			if isTouched[rec.offset] {
+				continue
+			}
+			isTouched[rec.offset] = true
+
+			if counts[rec.offset] == 0 {
+				merged = append(merged, rec)
+			}
+			counts[rec.offset]++
+		}
+	}
+
+	if cfg.Merge != MergeFrequency {
+		return merged
+	}
+
+	minIters := int(math.Ceil(cfg.MinFrequency * float64(len(iters))))
+
+	frequent := make([]Record, 0, len(merged))
+	for _, rec := range merged {
+		if counts[rec.offset] >= minIters {
+			frequent = append(frequent, rec)
+		}
+	}
+
+	return frequent
+}
+
+// finishRecordIteration Keeps the trace of a record iteration and, after the last one,
+// merges the traces of the iterations and prepares the working set for replay.
+// Returns whether the record is done
+func (s *SnapshotState) finishRecordIteration() (bool, error) {
+	logger := log.WithFields(log.Fields{"vmID": s.VMID})
+
+	s.recordedIters = append(s.recordedIters, s.trace.trace)
+	s.trace = newTrace(s.getTraceFile(), s.SnapshotStateCfg)
+
+	if len(s.recordedIters) < s.recordCfg.iterations() {
+		logger.Debugf("Recorded %d of %d iterations of the working set", len(s.recordedIters), s.recordCfg.iterations())
+		return false, nil
+	}
+
+	for _, rec := range mergeRecords(s.recordedIters, s.recordCfg) {
+		s.trace.AppendRecord(rec)
+	}
+	s.recordedIters = nil
+
+	if err := s.trace.ProcessRecord(s.GuestMemPath, s.WorkingSetPath); err != nil {
+		return false, err
+	}
+	if err := s.trace.WriteTrace(); err != nil {
+		logger.Error("Failed to write the trace")
+		return false, err
+	}
+
+	return true, nil
+}
+
+// abortInvocation Discards the record of an invocation whose page faults failed
+// to be served, so that the invocation is recorded again. The record of the previous
+// iterations, and the working set that is replayed, if any, are kept.
+func (s *SnapshotState) abortInvocation() {
+	if s.isRecordReady {
+		return
+	}
+
+	s.trace = newTrace(s.getTraceFile(), s.SnapshotStateCfg)
+}
+
+// checkRerecord Keeps the unique page faults of a replay and, if there are too many
+// of them on average, starts recording the working set again upon the next invocation
+func (s *SnapshotState) checkRerecord() {
+	if s.recordCfg.RerecordThreshold <= 0 {
+		return
+	}
+
+	window := s.recordCfg.rerecordWindow()
+
+	s.replayUniqueNums = append(s.replayUniqueNums, s.uniqueNum)
+	if len(s.replayUniqueNums) < window {
+		return
+	}
+	s.replayUniqueNums = s.replayUniqueNums[len(s.replayUniqueNums)-window:]
+
+	uniqueNums := make([]float64, len(s.replayUniqueNums))
+	for i, num := range s.replayUniqueNums {
+		uniqueNums[i] = float64(num)
+	}
+
+	rate := stat.Mean(uniqueNums, nil) / math.Max(float64(len(s.trace.trace)), 1)
+	if rate <= s.recordCfg.RerecordThreshold {
+		return
+	}
+
+	log.WithFields(log.Fields{"vmID": s.VMID}).Infof(
+		"%.2f unique page faults per page of the working set over the last %d replays, recording it again",
+		rate, window)
+
+	s.trace = newTrace(s.getTraceFile(), s.SnapshotStateCfg)
+	s.replayUniqueNums = nil
+	s.isRecordReady = false
+}
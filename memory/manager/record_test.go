@@ -0,0 +1,162 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func records(pages ...uint64) []Record {
+	recs := make([]Record, len(pages))
+	for i, page := range pages {
+		recs[i] = Record{offset: page * uint64(os.Getpagesize())}
+	}
+
+	return recs
+}
+
+func TestMergeRecords(t *testing.T) {
+	iters := [][]Record{
+		records(3, 1, 2),
+		records(1, 4, 3, 1),
+		records(5, 1),
+	}
+
+	require.Equal(t, records(3, 1, 2, 4, 5), mergeRecords(iters, RecordCfg{}),
+		"Union must keep all the pages in the order they were first touched")
+	require.Equal(t, records(3, 1), mergeRecords(iters, RecordCfg{Merge: MergeFrequency, MinFrequency: 0.5}),
+		"Frequency merge must keep the pages touched in at least half of the iterations")
+	require.Equal(t, records(1), mergeRecords(iters, RecordCfg{Merge: MergeFrequency, MinFrequency: 1}),
+		"Frequency merge must keep the pages touched in all the iterations")
+	require.Equal(t, records(3, 1, 2), mergeRecords(iters[:1], RecordCfg{Merge: MergeFrequency, MinFrequency: 0.5}),
+		"A single iteration must be kept as is")
+}
+
+func newTestSnapshotState(t *testing.T, recordCfg RecordCfg) *SnapshotState {
+	pageSize := os.Getpagesize()
+	dir := t.TempDir()
+
+	guestMemPath := filepath.Join(dir, "mem_file")
+	require.NoError(t, ioutil.WriteFile(guestMemPath, make([]byte, 8*pageSize), 0644))
+
+	return NewSnapshotState(SnapshotStateCfg{
+		VMID:           "1",
+		BaseDir:        dir,
+		GuestMemPath:   guestMemPath,
+		WorkingSetPath: filepath.Join(dir, "working_set_pages"),
+		GuestMemSize:   8 * pageSize,
+		recordCfg:      recordCfg,
+	})
+}
+
+func TestRecordIterations(t *testing.T) {
+	s := newTestSnapshotState(t, RecordCfg{Iterations: 3, Merge: MergeFrequency, MinFrequency: 0.6})
+
+	for i, iter := range [][]Record{records(0, 1, 2), records(2, 3), records(1, 2, 4)} {
+		for _, rec := range iter {
+			s.trace.AppendRecord(rec)
+		}
+
+		isRecorded, err := s.finishRecordIteration()
+		require.NoError(t, err, "Failed to finish the record iteration")
+		require.Equal(t, i == 2, isRecorded, "The record must be done after the last iteration only")
+	}
+
+	require.Equal(t, records(1, 2), s.trace.trace, "Pages touched in 2 of 3 iterations must be kept")
+	require.Equal(t, map[uint64]int{uint64(os.Getpagesize()): 2}, s.trace.regions)
+
+	ws, err := ioutil.ReadFile(s.WorkingSetPath)
+	require.NoError(t, err, "Working set must be written")
+	require.Len(t, ws, 2*os.Getpagesize())
+
+	loaded, err := LoadTrace(s.getTraceFile(), s.SnapshotStateCfg)
+	require.NoError(t, err, "Trace must be written")
+	require.Equal(t, s.trace.trace, loaded.trace)
+}
+
+func TestRerecord(t *testing.T) {
+	s := newTestSnapshotState(t, RecordCfg{RerecordThreshold: 0.5, RerecordWindow: 2})
+
+	for _, rec := range records(0, 1, 2, 3) {
+		s.trace.AppendRecord(rec)
+	}
+	isRecorded, err := s.finishRecordIteration()
+	require.NoError(t, err, "Failed to finish the record")
+	require.True(t, isRecorded)
+	s.isRecordReady = true
+
+	for _, uniqueNum := range []int{4, 0, 1, 3} {
+		s.uniqueNum = uniqueNum
+		s.checkRerecord()
+		require.True(t, s.isRecordReady, "Working set must be kept while the unique page faults are few")
+	}
+
+	s.uniqueNum = 2
+	s.checkRerecord()
+	require.False(t, s.isRecordReady, "Working set must be recorded again when the unique page faults are many")
+	require.Empty(t, s.trace.trace, "The new record must start from scratch")
+}
+
+func TestAbortInvocation(t *testing.T) {
+	s := newTestSnapshotState(t, RecordCfg{Iterations: 2})
+
+	for _, iter := range [][]Record{records(0, 1), records(2, 3)} {
+		for _, rec := range iter {
+			s.trace.AppendRecord(rec)
+		}
+		s.abortInvocation()
+		require.Empty(t, s.trace.trace, "A failed record iteration must be discarded")
+
+		for _, rec := range iter {
+			s.trace.AppendRecord(rec)
+		}
+		isRecorded, err := s.finishRecordIteration()
+		require.NoError(t, err, "Failed to finish the record iteration")
+		s.isRecordReady = isRecorded
+	}
+	require.True(t, s.isRecordReady)
+
+	s.abortInvocation()
+	require.True(t, s.isRecordReady, "A failed replay must keep the working set")
+	require.Equal(t, records(0, 1, 2, 3), s.trace.trace, "A failed replay must keep the working set")
+}
+
+func TestCountServedPage(t *testing.T) {
+	s := newTestSnapshotState(t, RecordCfg{})
+	for _, rec := range records(0, 1) {
+		s.trace.AppendRecord(rec)
+	}
+	s.isRecordReady = true
+
+	// A vCPU faults on a page of the working set before it is installed
+	s.countServedPage(records(1)[0], 0)
+	require.Zero(t, s.uniqueNum, "The pages of the working set must not be counted as unique")
+
+	s.countServedPage(records(2)[0], 0)
+	require.Equal(t, 1, s.uniqueNum, "The pages missing from the working set must be counted as unique")
+}
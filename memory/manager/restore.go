@@ -0,0 +1,233 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultRestoreChunkPages Number of pages a restore worker reads at once by default
+const DefaultRestoreChunkPages = 256
+
+// RestoreCfg Configures how the working set is fetched and installed
+// when a VM is loaded from its snapshot
+type RestoreCfg struct {
+	// Workers Number of goroutines that read the working set file in chunks,
+	// the regions are installed as soon as their chunks are read.
+	// 0 reads the whole file at once before the installation starts
+	Workers int
+	// ChunkPages Maximum number of pages a worker reads at once
+	// (DefaultRestoreChunkPages if 0)
+	ChunkPages int
+	// Mode Order the working set is stored in upon the record and installed in
+	// upon the replays (ReplaySorted if empty). ReplayFirstTouch streams
+	// the working set even without Workers
+	Mode ReplayMode
+}
+
+// wsRegion Contiguous region of the working set
+type wsRegion struct {
+	offset    uint64 // in the guest memory
+	pages     int
+	srcOffset int // in the working set file
+}
+
+// wsChunk Part of a region that a restore worker reads at once
+type wsChunk struct {
+	region    int // index in the installation order
+	srcOffset int
+	size      int
+}
+
+// planRegions Lists the regions of the trace in the installation order of the mode.
+// The working set file stores the regions in the order of the mode of the trace
+func planRegions(t *Trace, mode ReplayMode) []wsRegion {
+	srcOffsets := make(map[uint64]int, len(t.regions))
+	srcOffset := 0
+	for _, offset := range t.regionsInOrder(t.mode) {
+		srcOffsets[offset] = srcOffset
+		srcOffset += t.regions[offset] * os.Getpagesize()
+	}
+
+	keys := t.regionsInOrder(mode)
+	regions := make([]wsRegion, 0, len(keys))
+	for _, offset := range keys {
+		regions = append(regions, wsRegion{offset: offset, pages: t.regions[offset], srcOffset: srcOffsets[offset]})
+	}
+
+	return regions
+}
+
+// planChunks Splits the regions into the chunks of at most chunkPages pages,
+// in the installation order of the regions
+func planChunks(regions []wsRegion, chunkPages int) []wsChunk {
+	chunks := make([]wsChunk, 0, len(regions))
+	chunkSize := chunkPages * os.Getpagesize()
+
+	for i, reg := range regions {
+		regSize := reg.pages * os.Getpagesize()
+		for done := 0; done < regSize; done += chunkSize {
+			size := chunkSize
+			if regSize-done < size {
+				size = regSize - done
+			}
+			chunks = append(chunks, wsChunk{region: i, srcOffset: reg.srcOffset + done, size: size})
+		}
+	}
+
+	return chunks
+}
+
+// wsRestore Reads the working set file in chunks on several goroutines
+// and tells which regions are read
+type wsRestore struct {
+	regions []wsRegion // in the installation order
+	buf     []byte
+
+	pending []int32         // chunks left to read per region
+	ready   []chan struct{} // closed when a region is read (or failed)
+
+	errMu sync.Mutex
+	err   error
+
+	done     chan struct{} // closed when all chunks are read
+	readTime time.Duration // valid once done is closed
+}
+
+// startRestore Opens the working set file for direct-io
+// and starts reading it in the background
+func startRestore(path string, t *Trace, cfg RestoreCfg) (*wsRestore, error) {
+	chunkPages := cfg.ChunkPages
+	if chunkPages <= 0 {
+		chunkPages = DefaultRestoreChunkPages
+	}
+
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	// O_DIRECT allows to fully leverage disk bandwidth by bypassing the OS page cache
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_DIRECT, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the working set file for direct-io")
+	}
+
+	r := &wsRestore{
+		regions: planRegions(t, cfg.Mode),
+		buf:     AlignedBlock(len(t.trace) * os.Getpagesize()), // direct io requires aligned buffer
+		done:    make(chan struct{}),
+	}
+
+	chunks := planChunks(r.regions, chunkPages)
+
+	r.pending = make([]int32, len(r.regions))
+	r.ready = make([]chan struct{}, len(r.regions))
+	for i := range r.regions {
+		r.ready[i] = make(chan struct{})
+	}
+	for _, c := range chunks {
+		r.pending[c.region]++
+	}
+
+	// The chunks are queued in the installation order, so the first regions are read first
+	chunkCh := make(chan wsChunk, len(chunks))
+	for _, c := range chunks {
+		chunkCh <- c
+	}
+	close(chunkCh)
+
+	tStart := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunkCh {
+				r.readChunk(f, c)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		r.readTime = time.Since(tStart)
+		if err := f.Close(); err != nil {
+			log.Errorf("Failed to close the working set file: %v\n", err)
+		}
+		close(r.done)
+	}()
+
+	return r, nil
+}
+
+func (r *wsRestore) readChunk(f *os.File, c wsChunk) {
+	if r.getErr() == nil {
+		if n, err := f.ReadAt(r.buf[c.srcOffset:c.srcOffset+c.size], int64(c.srcOffset)); n != c.size {
+			r.setErr(errors.Errorf("failed to read %d bytes of the working set at %d: %v", c.size, c.srcOffset, err))
+		}
+	}
+
+	// The region is released even if reading it failed, the installation checks the error
+	if atomic.AddInt32(&r.pending[c.region], -1) == 0 {
+		close(r.ready[c.region])
+	}
+}
+
+func (r *wsRestore) setErr(err error) {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *wsRestore) getErr() error {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+
+	return r.err
+}
+
+// waitRegion Blocks until the region with the index i is read
+func (r *wsRestore) waitRegion(i int) error {
+	<-r.ready[i]
+
+	return r.getErr()
+}
+
+// wait Blocks until the whole working set is read and returns how long it took
+func (r *wsRestore) wait() (time.Duration, error) {
+	<-r.done
+
+	return r.readTime, r.getErr()
+}
@@ -0,0 +1,129 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordTrace Records the pages with the given numbers in the given order
+func recordTrace(mode ReplayMode, pages ...uint64) *Trace {
+	t := initTrace("", mode)
+	for _, page := range pages {
+		t.AppendRecord(Record{offset: page * uint64(os.Getpagesize())})
+	}
+	t.buildRegions()
+
+	return t
+}
+
+func TestPlanRegions(t *testing.T) {
+	pageSize := os.Getpagesize()
+	// Regions: pages 1-2 (touched 3rd), 5 (touched 1st), 8-10 (touched 2nd)
+	trace := recordTrace(ReplaySorted, 5, 9, 8, 1, 10, 2)
+
+	regions := planRegions(trace, ReplaySorted)
+	require.Equal(t, []wsRegion{
+		{offset: 1 * uint64(pageSize), pages: 2, srcOffset: 0},
+		{offset: 5 * uint64(pageSize), pages: 1, srcOffset: 2 * pageSize},
+		{offset: 8 * uint64(pageSize), pages: 3, srcOffset: 3 * pageSize},
+	}, regions, "Regions must be sorted by address")
+
+	regions = planRegions(trace, ReplayFirstTouch)
+	require.Equal(t, []wsRegion{
+		{offset: 5 * uint64(pageSize), pages: 1, srcOffset: 2 * pageSize},
+		{offset: 8 * uint64(pageSize), pages: 3, srcOffset: 3 * pageSize},
+		{offset: 1 * uint64(pageSize), pages: 2, srcOffset: 0},
+	}, regions, "Regions must be sorted by first touch")
+
+	trace = recordTrace(ReplayFirstTouch, 5, 9, 8, 1, 10, 2)
+
+	regions = planRegions(trace, ReplayFirstTouch)
+	require.Equal(t, []wsRegion{
+		{offset: 5 * uint64(pageSize), pages: 1, srcOffset: 0},
+		{offset: 8 * uint64(pageSize), pages: 3, srcOffset: pageSize},
+		{offset: 1 * uint64(pageSize), pages: 2, srcOffset: 4 * pageSize},
+	}, regions, "First-touch working set must be streamed sequentially")
+
+	regions = planRegions(trace, ReplaySorted)
+	require.Equal(t, uint64(pageSize), regions[0].offset, "Regions must be sorted by address")
+	require.Equal(t, 4*pageSize, regions[0].srcOffset, "Regions must be found in a first-touch working set")
+}
+
+func TestPlanChunks(t *testing.T) {
+	pageSize := os.Getpagesize()
+	regions := []wsRegion{
+		{offset: 0, pages: 5, srcOffset: 0},
+		{offset: 8 * uint64(pageSize), pages: 2, srcOffset: 5 * pageSize},
+	}
+
+	chunks := planChunks(regions, 2)
+	require.Equal(t, []wsChunk{
+		{region: 0, srcOffset: 0, size: 2 * pageSize},
+		{region: 0, srcOffset: 2 * pageSize, size: 2 * pageSize},
+		{region: 0, srcOffset: 4 * pageSize, size: pageSize},
+		{region: 1, srcOffset: 5 * pageSize, size: 2 * pageSize},
+	}, chunks)
+}
+
+func TestRestore(t *testing.T) {
+	pageSize := os.Getpagesize()
+	trace := recordTrace(ReplaySorted, 3, 4, 5, 0, 7, 8, 9, 10, 12)
+
+	wsPath := filepath.Join(t.TempDir(), "working_set_pages")
+	ws := make([]byte, len(trace.trace)*pageSize)
+	for i := range ws {
+		ws[i] = byte(i / pageSize)
+	}
+	require.NoError(t, ioutil.WriteFile(wsPath, ws, 0600))
+
+	f, err := os.OpenFile(wsPath, os.O_RDONLY|syscall.O_DIRECT, 0600)
+	if err != nil {
+		t.Skipf("Direct-io is not supported in %s: %v", filepath.Dir(wsPath), err)
+	}
+	f.Close()
+
+	restore, err := startRestore(wsPath, trace, RestoreCfg{Workers: 3, ChunkPages: 1, Mode: ReplayFirstTouch})
+	require.NoError(t, err, "Failed to start the restore")
+
+	require.Equal(t, uint64(3*pageSize), restore.regions[0].offset, "The first touched region must go first")
+
+	for i, reg := range restore.regions {
+		require.NoError(t, restore.waitRegion(i), "Failed to read a region")
+		regSize := reg.pages * pageSize
+		require.Equal(t, ws[reg.srcOffset:reg.srcOffset+regSize], restore.buf[reg.srcOffset:reg.srcOffset+regSize])
+	}
+
+	_, err = restore.wait()
+	require.NoError(t, err, "Failed to read the working set")
+	require.Equal(t, ws, restore.buf)
+
+	_, err = startRestore(filepath.Join(t.TempDir(), "missing"), trace, RestoreCfg{Workers: 1})
+	require.Error(t, err, "Restore must fail without the working set file")
+}
@@ -36,8 +36,8 @@ import (
 	"net"
 	"os"
 	"path/filepath"
-	"sort"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -57,11 +57,16 @@ type SnapshotStateCfg struct {
 	VMMStatePath, GuestMemPath, WorkingSetPath string
 
 	InstanceSockAddr string
+	VMConfigHash     string // identifies the image and the spec of the VM, traces of other VMs are not replayed
 	BaseDir          string // base directory for the instance
 	MetricsPath      string // path to csv file where the metrics should be stored
 	IsLazyMode       bool
 	GuestMemSize     int
+	VCPUs            int // number of the vCPUs of the VM, which fault concurrently
 	metricsModeOn    bool
+	faultWorkers     int
+	restoreCfg       RestoreCfg
+	recordCfg        RecordCfg
 }
 
 // SnapshotState Stores the state of the snapshot
@@ -70,10 +75,14 @@ type SnapshotState struct {
 	SnapshotStateCfg
 	firstPageFaultOnce *sync.Once // to initialize the start virtual address and replay
 	startAddress       uint64
+	firstFaultTime     time.Time // the records are timestamped relative to it
 	userFaultFD        *os.File
 	trace              *Trace
 	epfd               int
 	quitCh             chan int
+	pollDoneCh         chan struct{} // closed when the page faults are not served anymore
+	// pfErr Why the page faults stopped being served, if they did
+	pfErr error
 
 	// to indicate whether the instance has even been activated. this is to
 	// get around cases where offload is called for the first time
@@ -82,9 +91,14 @@ type SnapshotState struct {
 	isActive bool
 
 	isRecordReady bool
+	// recordedIters Traces of the record iterations that are done, until the last one
+	recordedIters [][]Record
+	// replayUniqueNums Unique page faults of the last replays, to decide whether to record again
+	replayUniqueNums []int
 
 	guestMem   []byte
 	workingSet []byte
+	restore    *wsRestore // reads the working set in the background, if enabled
 
 	// Stats
 	totalPFServed  []float64
@@ -92,17 +106,40 @@ type SnapshotState struct {
 	reusedPFServed []float64
 	latencyMetrics []*metrics.Metric
 
-	replayedNum   int // only valid for lazy serving
+	statsMu       sync.Mutex // the page faults are served concurrently
+	replayedNum   int        // only valid for lazy serving
 	uniqueNum     int
 	currentMetric *metrics.Metric
+	pfCounts      *PageFaultCounts // of the memory manager, if any
 }
 
 // NewSnapshotState Initializes a snapshot state
 func NewSnapshotState(cfg SnapshotStateCfg) *SnapshotState {
 	s := new(SnapshotState)
 	s.SnapshotStateCfg = cfg
+	if s.restoreCfg.Mode == "" {
+		s.restoreCfg.Mode = ReplaySorted
+	}
 
-	s.trace = initTrace(s.getTraceFile())
+	s.trace = newTrace(s.getTraceFile(), s.SnapshotStateCfg)
+	if s.isRecordOnDisk() {
+		logger := log.WithFields(log.Fields{"vmID": s.VMID})
+
+		// The record survives the restarts of the daemon
+		if isLegacy, err := s.trace.readTrace(); err != nil {
+			logger.WithError(err).Warn("Failed to read the trace, recording it again")
+			s.trace = newTrace(s.getTraceFile(), s.SnapshotStateCfg)
+		} else {
+			if isLegacy {
+				logger.Info("Converting the trace to the binary format")
+				if err := s.trace.WriteTrace(); err != nil {
+					logger.WithError(err).Warn("Failed to convert the trace")
+				}
+			}
+			s.trace.buildRegions()
+			s.isRecordReady = true
+		}
+	}
 	if s.metricsModeOn {
 		s.totalPFServed = make([]float64, 0)
 		s.uniquePFServed = make([]float64, 0)
@@ -118,9 +155,10 @@ func (s *SnapshotState) setupStateOnActivate() {
 	s.isEverActivated = true
 	s.firstPageFaultOnce = new(sync.Once)
 	s.quitCh = make(chan int)
+	s.pollDoneCh = make(chan struct{})
+	s.uniqueNum = 0
 
 	if s.metricsModeOn {
-		s.uniqueNum = 0
 		s.replayedNum = 0
 		s.currentMetric = metrics.NewMetric()
 	}
@@ -178,6 +216,22 @@ func (s *SnapshotState) getTraceFile() string {
 	return filepath.Join(s.BaseDir, "trace")
 }
 
+// isRecordOnDisk Checks whether the trace and the working set file
+// of a previous record are present
+func (s *SnapshotState) isRecordOnDisk() bool {
+	if s.IsLazyMode || s.WorkingSetPath == "" {
+		return false
+	}
+
+	for _, path := range []string{s.getTraceFile(), s.WorkingSetPath} {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (s *SnapshotState) mapGuestMemory() error {
 	fd, err := os.OpenFile(s.GuestMemPath, os.O_RDONLY, 0444)
 	if err != nil {
@@ -246,6 +300,22 @@ func (s *SnapshotState) fetchState() error {
 		return err
 	}
 
+	if s.restoreCfg.Workers > 0 || s.restoreCfg.Mode == ReplayFirstTouch {
+		restore, err := startRestore(s.WorkingSetPath, s.trace, s.restoreCfg)
+		if err != nil {
+			log.Errorf("Failed to start fetching the working set: %v\n", err)
+			return err
+		}
+
+		s.restore = restore
+		s.workingSet = restore.buf
+
+		log.Debug("Started fetching the working set")
+		return nil
+	}
+
+	s.restore = nil
+
 	size := len(s.trace.trace) * os.Getpagesize()
 
 	// O_DIRECT allows to fully leverage disk bandwidth by bypassing the OS page cache
@@ -271,35 +341,114 @@ func (s *SnapshotState) fetchState() error {
 	return nil
 }
 
-func (s *SnapshotState) pollUserPageFaults(readyCh chan int) {
+// pollUserPageFaults Serves the page faults of the VM until it is told to quit.
+// If serving fails, the VM cannot make progress, so the failure is recorded
+// for Deactivate to report and the loop waits to quit, keeping the daemon up.
+func (s *SnapshotState) pollUserPageFaults(readyCh chan error) {
 	logger := log.WithFields(log.Fields{"vmID": s.VMID})
 
-	var events [1]syscall.EpollEvent
+	defer close(s.pollDoneCh)
 
 	if err := s.registerEpoller(); err != nil {
-		logger.Fatalf("register_epoller: %v", err)
+		logger.Errorf("register_epoller: %v", err)
+		readyCh <- err
+		return
 	}
 
 	logger.Debug("Starting polling loop")
 
 	defer syscall.Close(s.epfd)
 
-	readyCh <- 0
+	readyCh <- nil
+
+	if err := s.servePageFaults(); err != nil {
+		logger.WithError(err).Error("Stopped serving page faults")
+		s.pfErr = err
+		<-s.quitCh
+	}
+
+	logger.Debug("Handler received a signal to quit")
+}
+
+// pageFault Page fault to serve by a worker
+type pageFault struct {
+	address uint64
+	// isFirst Whether it is the first page fault since the VM is activated
+	isFirst bool
+}
+
+const (
+	// maxUFFDMsgs Number of the page faults read from the uffd at once
+	maxUFFDMsgs = 16
+	// pollTimeoutMs How often the poller checks whether to quit
+	// and whether the workers failed, if there are no page faults
+	pollTimeoutMs = 100
+)
+
+// getFaultWorkers Number of the goroutines that serve the page faults of the VM
+func (s *SnapshotState) getFaultWorkers() int {
+	switch {
+	case s.faultWorkers > 0:
+		return s.faultWorkers
+	case s.VCPUs > 0:
+		return s.VCPUs
+	default:
+		return 1
+	}
+}
+
+// servePageFaults Serves the page faults until the VM is told to quit.
+// The page faults are read in one goroutine and served by a pool of workers,
+// so that the vCPUs of the VM do not wait for the page faults of each other
+func (s *SnapshotState) servePageFaults() error {
+	var (
+		events  [1]syscall.EpollEvent
+		wg      sync.WaitGroup
+		workers = s.getFaultWorkers()
+		faultCh = make(chan pageFault, workers*maxUFFDMsgs)
+		errCh   = make(chan error, 1)
+		stateFd = int(s.userFaultFD.Fd())
+		msgSize = sizeOfUFFDMsg()
+		goMsgs  = make([]byte, msgSize*maxUFFDMsgs)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pf := range faultCh {
+				if err := s.servePageFault(stateFd, pf.address, pf.isFirst); err != nil {
+					select {
+					case errCh <- fmt.Errorf("failed to serve page fault at 0x%x: %v", pf.address, err):
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	defer func() {
+		close(faultCh)
+		wg.Wait()
+	}()
 
 	for {
 		select {
 		case <-s.quitCh:
-			logger.Debug("Handler received a signal to quit")
-			return
+			return nil
+		case err := <-errCh:
+			return err
 		default:
-			nevents, err := syscall.EpollWait(s.epfd, events[:], -1)
+			nevents, err := syscall.EpollWait(s.epfd, events[:], pollTimeoutMs)
 			if err != nil {
-				logger.Fatalf("epoll_wait: %v", err)
-				break
+				if errors.Is(err, syscall.EINTR) {
+					continue
+				}
+				return fmt.Errorf("epoll_wait: %v", err)
 			}
 
-			if nevents < 1 {
-				panic("Wrong number of events")
+			if nevents < 0 {
+				return fmt.Errorf("wrong number of events: %d", nevents)
 			}
 
 			for i := 0; i < nevents; i++ {
@@ -307,29 +456,40 @@ func (s *SnapshotState) pollUserPageFaults(readyCh chan int) {
 
 				fd := int(event.Fd)
 
-				stateFd := int(s.userFaultFD.Fd())
-
 				if fd != stateFd && stateFd != -1 {
-					logger.Fatalf("Received event from unknown fd")
+					return fmt.Errorf("received event from unknown fd %d", fd)
 				}
 
-				goMsg := make([]byte, sizeOfUFFDMsg())
-
-				if nread, err := syscall.Read(fd, goMsg); err != nil || nread != len(goMsg) {
+				nread, err := syscall.Read(fd, goMsgs)
+				if err != nil || nread%msgSize != 0 || nread == 0 {
+					if errors.Is(err, syscall.EAGAIN) {
+						// The page faults of the event are read already
+						continue
+					}
 					if !errors.Is(err, syscall.EBADF) {
-						log.Fatalf("Read uffd_msg failed: %v", err)
+						return fmt.Errorf("read uffd_msg failed: %v", err)
 					}
 					break
 				}
 
-				if event := uint8(goMsg[0]); event != uffdPageFault() {
-					log.Fatal("Received wrong event type")
-				}
+				for off := 0; off < nread; off += msgSize {
+					goMsg := goMsgs[off : off+msgSize]
+
+					if event := uint8(goMsg[0]); event != uffdPageFault() {
+						return fmt.Errorf("received wrong event type %d", event)
+					}
 
-				address := binary.LittleEndian.Uint64(goMsg[16:])
+					address := binary.LittleEndian.Uint64(goMsg[16:])
 
-				if err := s.servePageFault(fd, address); err != nil {
-					log.Fatalf("Failed to serve page fault")
+					// The start address is taken from the first page fault the VM sends
+					isFirst := false
+					s.firstPageFaultOnce.Do(func() {
+						s.startAddress = address
+						s.firstFaultTime = time.Now()
+						isFirst = true
+					})
+
+					faultCh <- pageFault{address: address, isFirst: isFirst}
 				}
 			}
 		}
@@ -369,31 +529,21 @@ func (s *SnapshotState) registerEpoller() error {
 	return nil
 }
 
-func (s *SnapshotState) servePageFault(fd int, address uint64) error {
-	var (
-		tStart              time.Time
-		workingSetInstalled bool
-	)
-
-	s.firstPageFaultOnce.Do(
-		func() {
-			s.startAddress = address
-
-			if s.isRecordReady && !s.IsLazyMode {
-				if s.metricsModeOn {
-					tStart = time.Now()
-				}
-				s.installWorkingSetPages(fd)
-				if s.metricsModeOn {
-					s.currentMetric.MetricMap[installWSMetric] = metrics.ToUS(time.Since(tStart))
-				}
+// servePageFault Serves a page fault, concurrently with the other page faults of the VM.
+// The first page fault installs the working set instead, if it is recorded
+func (s *SnapshotState) servePageFault(fd int, address uint64, isFirst bool) error {
+	var tStart time.Time
 
-				workingSetInstalled = true
-			}
-		})
+	if isFirst && s.isRecordReady && !s.IsLazyMode {
+		if s.metricsModeOn {
+			tStart = time.Now()
+		}
+		err := s.installWorkingSetPages(fd)
+		if s.metricsModeOn {
+			s.setMetric(installWSMetric, metrics.ToUS(time.Since(tStart)))
+		}
 
-	if workingSetInstalled {
-		return nil
+		return err
 	}
 
 	offset := address - s.startAddress
@@ -403,86 +553,170 @@ func (s *SnapshotState) servePageFault(fd int, address uint64) error {
 	mode := uint64(0)
 
 	rec := Record{
-		offset: offset,
+		offset:    offset,
+		timestamp: time.Since(s.firstFaultTime),
+	}
+
+	tStart = time.Now()
+
+	if _, err := copyPages(fd, src, dst, mode, 1); err != nil {
+		if errors.Is(err, unix.EEXIST) {
+			// Another vCPU faulted on the same page, or the page is in the working set
+			// that is being installed, and the vCPU of this page fault may not be woken up
+			return wake(fd, dst, os.Getpagesize())
+		}
+		return err
 	}
 
+	serveTime := time.Since(tStart)
+
 	if !s.isRecordReady {
 		s.trace.AppendRecord(rec)
 	} else {
 		log.Debug("Serving a page that is missing from the working set")
 	}
 
+	s.countServedPage(rec, serveTime)
+
+	if s.pfCounts != nil {
+		atomic.AddUint64(&s.pfCounts.Served, 1)
+	}
+
+	return nil
+}
+
+// countServedPage Updates the stats with a page served upon a page fault
+func (s *SnapshotState) countServedPage(rec Record, serveTime time.Duration) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	// The pages of the working set are served upon the page faults too if the vCPUs fault on them
+	// before they are installed, so only the pages missing from the working set are unique
+	isUnique := s.isRecordReady && !s.trace.containsRecord(rec)
+
+	if isUnique && !s.IsLazyMode {
+		// Counted even without the metrics to decide whether to record the working set again
+		s.uniqueNum++
+	}
+
 	if s.metricsModeOn {
-		if s.isRecordReady {
-			if s.IsLazyMode {
-				if !s.trace.containsRecord(rec) {
-					s.uniqueNum++
-				}
-				s.replayedNum++
-			} else {
+		if s.isRecordReady && s.IsLazyMode {
+			if isUnique {
 				s.uniqueNum++
 			}
-
+			s.replayedNum++
 		}
 
-		tStart = time.Now()
+		s.currentMetric.MetricMap[serveUniqueMetric] += metrics.ToUS(serveTime)
 	}
+}
 
-	err := installRegion(fd, src, dst, mode, 1)
-
-	if s.metricsModeOn {
-		s.currentMetric.MetricMap[serveUniqueMetric] += metrics.ToUS(time.Since(tStart))
-	}
+// setMetric Sets a component of the latency metric of the current invocation
+func (s *SnapshotState) setMetric(name string, us float64) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
 
-	return err
+	s.currentMetric.MetricMap[name] = us
 }
 
-func (s *SnapshotState) installWorkingSetPages(fd int) {
+func (s *SnapshotState) installWorkingSetPages(fd int) error {
 	log.Debug("Installing the working set pages")
 
-	// build a list of sorted regions
-	keys := make([]uint64, 0)
-	for k := range s.trace.regions {
-		keys = append(keys, k)
-	}
-	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
-
 	var (
-		srcOffset uint64
+		regions  []wsRegion
+		waitTime time.Duration
 	)
 
-	for _, offset := range keys {
-		regLength := s.trace.regions[offset]
-		regAddress := s.startAddress + offset
+	if s.restore != nil {
+		regions = s.restore.regions
+	} else {
+		regions = planRegions(s.trace, s.restoreCfg.Mode)
+	}
+
+	for i, reg := range regions {
+		if s.restore != nil {
+			// The region can be installed as soon as it is read, the rest is still being fetched
+			tWait := time.Now()
+			if err := s.restore.waitRegion(i); err != nil {
+				return fmt.Errorf("fetch_region: %v", err)
+			}
+			waitTime += time.Since(tWait)
+		}
+
 		mode := uint64(C.const_UFFDIO_COPY_MODE_DONTWAKE)
-		src := uint64(uintptr(unsafe.Pointer(&s.workingSet[srcOffset])))
-		dst := regAddress
+		src := uint64(uintptr(unsafe.Pointer(&s.workingSet[reg.srcOffset])))
+		dst := s.startAddress + reg.offset
 
-		if err := installRegion(fd, src, dst, mode, uint64(regLength)); err != nil {
-			log.Fatalf("install_region: %v", err)
+		installed, err := installRegion(fd, src, dst, mode, uint64(reg.pages))
+		if err != nil {
+			return fmt.Errorf("install_region: %v", err)
 		}
 
-		srcOffset += uint64(regLength) * 4096
+		if s.pfCounts != nil {
+			atomic.AddUint64(&s.pfCounts.WorkingSetPages, installed)
+		}
 	}
 
-	wake(fd, s.startAddress, os.Getpagesize())
+	if s.restore != nil && s.metricsModeOn {
+		readTime, _ := s.restore.wait()
+		s.setMetric(fetchWSMetric, metrics.ToUS(readTime))
+		s.setMetric(installWSWaitMetric, metrics.ToUS(waitTime))
+	}
+
+	return wake(fd, s.startAddress, os.Getpagesize())
 }
 
-func installRegion(fd int, src, dst, mode, len uint64) error {
+// installRegion Installs the pages of a region, skipping those that are installed already
+// upon the page faults served concurrently. Returns the number of the installed pages
+func installRegion(fd int, src, dst, mode, len uint64) (uint64, error) {
+	var (
+		pageSize  = uint64(os.Getpagesize())
+		installed uint64
+	)
+
+	for done := uint64(0); done < len; {
+		copied, err := copyPages(fd, src+done*pageSize, dst+done*pageSize, mode, len-done)
+		installed += copied
+		done += copied
+
+		switch {
+		case err == nil:
+		case errors.Is(err, unix.EAGAIN):
+			// Copied partially, the rest is copied with the next UFFDIO_COPY
+		case errors.Is(err, unix.EEXIST):
+			// The page after the copied ones is installed already
+			done++
+		default:
+			return installed, err
+		}
+	}
+
+	return installed, nil
+}
+
+// copyPages Copies the pages into the guest memory with a single UFFDIO_COPY.
+// Returns the number of the copied pages, which is less than len upon an error
+func copyPages(fd int, src, dst, mode, len uint64) (uint64, error) {
+	pageSize := uint64(os.Getpagesize())
+
 	cUC := C.struct_uffdio_copy{
 		mode: C.ulonglong(mode),
 		copy: 0,
 		src:  C.ulonglong(src),
 		dst:  C.ulonglong(dst),
-		len:  C.ulonglong(uint64(os.Getpagesize()) * len),
+		len:  C.ulonglong(pageSize * len),
 	}
 
 	err := ioctl(uintptr(fd), int(C.const_UFFDIO_COPY), unsafe.Pointer(&cUC))
 	if err != nil {
-		return err
+		// The number of the bytes copied before the error, or the negative errno
+		if copied := int64(cUC.copy); copied > 0 {
+			return uint64(copied) / pageSize, err
+		}
+		return 0, err
 	}
 
-	return nil
+	return len, nil
 }
 
 func ioctl(fd uintptr, request int, argp unsafe.Pointer) error {
@@ -496,13 +730,13 @@ func ioctl(fd uintptr, request int, argp unsafe.Pointer) error {
 		uintptr(argp),
 	)
 	if errno != 0 {
-		return os.NewSyscallError("ioctl", fmt.Errorf("%d", int(errno)))
+		return os.NewSyscallError("ioctl", errno)
 	}
 
 	return nil
 }
 
-func wake(fd int, startAddress uint64, len int) {
+func wake(fd int, startAddress uint64, len int) error {
 	cUR := C.struct_uffdio_range{
 		start: C.ulonglong(startAddress),
 		len:   C.ulonglong(len),
@@ -510,8 +744,10 @@ func wake(fd int, startAddress uint64, len int) {
 
 	err := ioctl(uintptr(fd), int(C.const_UFFDIO_WAKE), unsafe.Pointer(&cUR))
 	if err != nil {
-		log.Fatalf("ioctl failed: %v", err)
+		return fmt.Errorf("wake: %v", err)
 	}
+
+	return nil
 }
 
 //nolint:deadcode,unused
@@ -0,0 +1,152 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// newUFFDRegion Maps a region of the given number of pages, whose page faults
+// are reported to the returned userfaultfd
+func newUFFDRegion(t *testing.T, pages int) ([]byte, *os.File) {
+	// register_for_upf exits if userfaultfd is not available
+	fd, _, errno := unix.Syscall(unix.SYS_USERFAULTFD, unix.O_CLOEXEC|unix.O_NONBLOCK, 0, 0)
+	if errno != 0 {
+		t.Skipf("userfaultfd is not available: %v", errno)
+	}
+	unix.Close(int(fd))
+
+	region, err := unix.Mmap(-1, 0, pages*os.Getpagesize(), unix.PROT_READ, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	require.NoError(t, err, "Failed to map the region")
+	t.Cleanup(func() { _ = unix.Munmap(region) })
+
+	uffd := registerForUpf(region, uint64(len(region)))
+	uffdFile := os.NewFile(uintptr(uffd), "uffd")
+	t.Cleanup(func() { uffdFile.Close() })
+
+	return region, uffdFile
+}
+
+func newGuestMemFile(t *testing.T, pages int) (string, []byte) {
+	guestMem := make([]byte, pages*os.Getpagesize())
+	for i := range guestMem {
+		guestMem[i] = byte(i/os.Getpagesize() + 1)
+	}
+
+	guestMemPath := filepath.Join(t.TempDir(), "mem_file")
+	require.NoError(t, ioutil.WriteFile(guestMemPath, guestMem, 0644))
+
+	return guestMemPath, guestMem
+}
+
+func TestConcurrentPageFaults(t *testing.T) {
+	const (
+		pages = 64
+		vCPUs = 4
+	)
+
+	pageSize := os.Getpagesize()
+
+	// The goroutines that fault hold their Ps until the faults are served
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2*vCPUs + 2))
+
+	region, uffdFile := newUFFDRegion(t, pages)
+	guestMemPath, guestMem := newGuestMemFile(t, pages)
+
+	s := NewSnapshotState(SnapshotStateCfg{
+		VMID:         "1",
+		BaseDir:      t.TempDir(),
+		GuestMemPath: guestMemPath,
+		GuestMemSize: len(guestMem),
+		VCPUs:        vCPUs,
+	})
+	s.userFaultFD = uffdFile
+	require.NoError(t, s.mapGuestMemory(), "Failed to map the guest memory")
+	defer s.unmapGuestMemory()
+
+	s.setupStateOnActivate()
+	readyCh := make(chan error)
+	go s.pollUserPageFaults(readyCh)
+	require.NoError(t, <-readyCh, "Failed to start serving the page faults")
+
+	// The first page fault sets the start of the guest memory
+	require.Equal(t, guestMem[0], region[0])
+
+	// The vCPUs fault on the same pages at the same time
+	var wg sync.WaitGroup
+	for vcpu := 0; vcpu < vCPUs; vcpu++ {
+		wg.Add(1)
+		go func(vcpu int) {
+			defer wg.Done()
+			for i := 0; i < pages; i++ {
+				page := (i + vcpu*3) % pages
+				if region[page*pageSize] != guestMem[page*pageSize] {
+					t.Errorf("Wrong contents of page %d", page)
+				}
+			}
+		}(vcpu)
+	}
+	wg.Wait()
+
+	s.quitCh <- 0
+	<-s.pollDoneCh
+
+	require.NoError(t, s.pfErr, "Failed to serve the page faults")
+	require.Equal(t, guestMem, region, "Wrong contents of the guest memory")
+	require.Len(t, s.trace.trace, pages, "Each page must be recorded once")
+	require.Len(t, s.trace.containedOffsets, pages, "Each page must be recorded once")
+}
+
+func TestInstallRegionSkipsInstalledPages(t *testing.T) {
+	const pages = 8
+
+	pageSize := os.Getpagesize()
+
+	region, uffdFile := newUFFDRegion(t, pages)
+	_, guestMem := newGuestMemFile(t, pages)
+
+	fd := int(uffdFile.Fd())
+	start := uint64(uintptr(unsafe.Pointer(&region[0])))
+	src := uint64(uintptr(unsafe.Pointer(&guestMem[0])))
+
+	// Pages served upon the page faults while the working set is installed
+	for _, page := range []uint64{0, 3, 4} {
+		copied, err := copyPages(fd, src+page*uint64(pageSize), start+page*uint64(pageSize), 0, 1)
+		require.NoError(t, err, "Failed to copy a page")
+		require.Equal(t, uint64(1), copied)
+	}
+
+	installed, err := installRegion(fd, src, start, 0, pages)
+	require.NoError(t, err, "Failed to install the region")
+	require.Equal(t, uint64(pages-3), installed, "Installed pages must be skipped")
+	require.Equal(t, guestMem, region, "Wrong contents of the region")
+}
@@ -23,35 +23,74 @@
 package manager
 
 import (
-	"encoding/csv"
+	"bytes"
+	"io/ioutil"
 	"os"
 	"sort"
-	"strconv"
 	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-// Record A tuple with an address
+// ReplayMode How the working set of a record is laid out in its file
+// and installed upon the replays
+type ReplayMode string
+
+const (
+	// ReplaySorted Regions are stored in the order of their addresses
+	// and installed in bulk
+	ReplaySorted ReplayMode = "sorted"
+	// ReplayFirstTouch Regions are stored in the order the VM first touched them
+	// upon the record and installed in that order while they are streamed from the file
+	ReplayFirstTouch ReplayMode = "first-touch"
+)
+
+// ParseReplayMode Parses the name of a replay mode, empty is ReplaySorted
+func ParseReplayMode(name string) (ReplayMode, error) {
+	switch mode := ReplayMode(name); mode {
+	case "":
+		return ReplaySorted, nil
+	case ReplaySorted, ReplayFirstTouch:
+		return mode, nil
+	default:
+		return "", errors.Errorf("unknown replay mode %q (sorted or first-touch)", name)
+	}
+}
+
+// Record A tuple with an address and the time it was first touched at
 type Record struct {
 	offset uint64
+	// timestamp Time since the first page fault of the record
+	timestamp time.Duration
 }
 
 // Trace Contains records
 type Trace struct {
 	sync.Mutex
 	traceFileName string
+	// mode The working set file is laid out for
+	mode ReplayMode
+	// guestMemSize, vmConfigHash Of the VM the trace is recorded for
+	guestMemSize int
+	vmConfigHash string
 
 	containedOffsets map[uint64]int
-	trace            []Record
+	trace            []Record // in the order of the page faults
 	regions          map[uint64]int
+	// firstTouch Position of the first record of each region in the order
+	// of the page faults
+	firstTouch map[uint64]int
 }
 
-func initTrace(traceFileName string) *Trace {
+func initTrace(traceFileName string, mode ReplayMode) *Trace {
 	t := new(Trace)
 
 	t.traceFileName = traceFileName
+	t.mode = mode
 	t.regions = make(map[uint64]int)
+	t.firstTouch = make(map[uint64]int)
 	t.containedOffsets = make(map[uint64]int)
 	t.trace = make([]Record, 0)
 
@@ -67,61 +106,33 @@ func (t *Trace) AppendRecord(r Record) {
 	t.containedOffsets[r.offset] = 0
 }
 
-// WriteTrace Writes all the records to a file
-func (t *Trace) WriteTrace() {
+// WriteTrace Writes all the records to a file in the binary trace format
+func (t *Trace) WriteTrace() error {
 	t.Lock()
 	defer t.Unlock()
 
-	file, err := os.Create(t.traceFileName)
+	data, err := t.encode()
 	if err != nil {
-		log.Fatalf("Failed to open trace file for writing: %v", err)
+		return errors.Wrap(err, "failed to write trace")
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	for _, rec := range t.trace {
-		err := writer.Write([]string{
-			strconv.FormatUint(rec.offset, 16)})
-		if err != nil {
-			log.Fatalf("Failed to write trace: %v", err)
-		}
-	}
+	return errors.Wrap(ioutil.WriteFile(t.traceFileName, data, 0644), "failed to write trace")
 }
 
-// readTrace Reads all the records from a CSV file
-//nolint:deadcode,unused
-func (t *Trace) readTrace() {
-	f, err := os.Open(t.traceFileName)
-	if err != nil {
-		log.Fatalf("Failed to open trace file for reading: %v", err)
-	}
-	defer f.Close()
-
-	lines, err := csv.NewReader(f).ReadAll()
+// readTrace Reads the records from a file in the binary trace format,
+// which must have been recorded with the page size, the guest memory size and the VM config
+// of the trace, or in the legacy CSV format
+func (t *Trace) readTrace() (isLegacy bool, err error) {
+	data, err := ioutil.ReadFile(t.traceFileName)
 	if err != nil {
-		log.Fatalf("Failed to read from the trace file: %v", err)
+		return false, errors.Wrap(err, "failed to open trace file for reading")
 	}
 
-	for _, line := range lines {
-		rec := readRecord(line)
-		t.AppendRecord(rec)
+	if !isBinaryTrace(data) {
+		return true, t.readLegacyTrace(bytes.NewReader(data))
 	}
-}
 
-// readRecord Parses a record from a line
-//nolint:deadcode,unused
-func readRecord(line []string) Record {
-	offset, err := strconv.ParseUint(line[0], 16, 64)
-	if err != nil {
-		log.Fatalf("Failed to convert string to offset: %v", err)
-	}
-
-	rec := Record{
-		offset: offset,
-	}
-	return rec
+	return false, t.decode(data)
 }
 
 // Search trace for the record with the same offset
@@ -133,41 +144,77 @@ func (t *Trace) containsRecord(rec Record) bool {
 
 // ProcessRecord Prepares the trace, the regions map, and the working set file for replay
 // Must be called when record is done (i.e., it is not concurrency-safe vs. AppendRecord)
-func (t *Trace) ProcessRecord(GuestMemPath, WorkingSetPath string) {
+func (t *Trace) ProcessRecord(GuestMemPath, WorkingSetPath string) error {
 	log.Debug("Preparing replay structures")
 
-	// sort trace records in the ascending order by offset
-	sort.Slice(t.trace, func(i, j int) bool {
-		return t.trace[i].offset < t.trace[j].offset
+	t.buildRegions()
+	return t.writeWorkingSetPagesToFile(GuestMemPath, WorkingSetPath)
+}
+
+// buildRegions Builds the map of contiguous regions from the trace records,
+// which stay in the order of the page faults
+func (t *Trace) buildRegions() {
+	// sort a copy of the trace records in the ascending order by offset
+	sorted := make([]Record, len(t.trace))
+	copy(sorted, t.trace)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].offset < sorted[j].offset
 	})
 
+	touchOrder := make(map[uint64]int, len(t.trace))
+	for i, rec := range t.trace {
+		if _, ok := touchOrder[rec.offset]; !ok {
+			touchOrder[rec.offset] = i
+		}
+	}
+
 	// build the map of contiguous regions from the trace records
 	var last, regionStart uint64
-	for _, rec := range t.trace {
-		if rec.offset != last+uint64(os.Getpagesize()) {
+	for i, rec := range sorted {
+		if i == 0 || rec.offset != last+uint64(os.Getpagesize()) {
 			regionStart = rec.offset
 			t.regions[regionStart] = 1
+			t.firstTouch[regionStart] = touchOrder[rec.offset]
 		} else {
 			t.regions[regionStart]++
+			if touchOrder[rec.offset] < t.firstTouch[regionStart] {
+				t.firstTouch[regionStart] = touchOrder[rec.offset]
+			}
 		}
 
 		last = rec.offset
 	}
+}
+
+// regionsInOrder Lists the offsets of the regions in the order
+// of the given replay mode
+func (t *Trace) regionsInOrder(mode ReplayMode) []uint64 {
+	keys := make([]uint64, 0, len(t.regions))
+	for k := range t.regions {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
 
-	t.writeWorkingSetPagesToFile(GuestMemPath, WorkingSetPath)
+	if mode == ReplayFirstTouch {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return t.firstTouch[keys[i]] < t.firstTouch[keys[j]]
+		})
+	}
+
+	return keys
 }
 
-func (t *Trace) writeWorkingSetPagesToFile(guestMemFileName, WorkingSetPath string) {
+func (t *Trace) writeWorkingSetPagesToFile(guestMemFileName, WorkingSetPath string) error {
 	log.Debug("Writing the working set pages to a disk")
 
 	fSrc, err := os.Open(guestMemFileName)
 	if err != nil {
-		log.Fatalf("Failed to open guest memory file for reading")
+		return errors.Wrap(err, "failed to open guest memory file for reading")
 	}
 	defer fSrc.Close()
 	fDst, err := os.Create(WorkingSetPath)
 	if err != nil {
-		log.Fatalf("Failed to open ws file for writing")
+		return errors.Wrap(err, "failed to open ws file for writing")
 	}
 	defer fDst.Close()
 
@@ -176,25 +223,19 @@ func (t *Trace) writeWorkingSetPagesToFile(guestMemFileName, WorkingSetPath stri
 		count     int
 	)
 
-	// Form a sorted slice of keys to access the map in a predetermined order
-	keys := make([]uint64, 0)
-	for k := range t.regions {
-		keys = append(keys, k)
-	}
-	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
-
-	for _, offset := range keys {
+	// The regions are stored in the order they are installed in upon the replays
+	for _, offset := range t.regionsInOrder(t.mode) {
 		regLength := t.regions[offset]
 		copyLen := regLength * os.Getpagesize()
 
 		buf := make([]byte, copyLen)
 
 		if n, err := fSrc.ReadAt(buf, int64(offset)); n != copyLen || err != nil {
-			log.Fatalf("Read file failed for src")
+			return errors.Errorf("read file failed for src: %v", err)
 		}
 
 		if n, err := fDst.WriteAt(buf, dstOffset); n != copyLen || err != nil {
-			log.Fatalf("Write file failed for dst")
+			return errors.Errorf("write file failed for dst: %v", err)
 		}
 
 		dstOffset += int64(copyLen)
@@ -202,7 +243,5 @@ func (t *Trace) writeWorkingSetPagesToFile(guestMemFileName, WorkingSetPath stri
 		count += regLength
 	}
 
-	if err := fDst.Sync(); err != nil {
-		log.Fatalf("Sync file failed for dst")
-	}
+	return errors.Wrap(fDst.Sync(), "sync file failed for dst")
 }
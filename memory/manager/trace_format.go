@@ -0,0 +1,274 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ease-lab/vhive/misc"
+)
+
+// TraceFormatVersion Version of the binary trace format that is written
+const TraceFormatVersion = 1
+
+// traceMagic First bytes of a binary trace file
+var traceMagic = [8]byte{'V', 'H', 'V', 'T', 'R', 'A', 'C', 'E'}
+
+// traceModes Replay modes by their codes in the trace files
+var traceModes = []ReplayMode{ReplaySorted, ReplayFirstTouch}
+
+var traceCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// traceHeader Header of a binary trace file. It is followed by RecordCount
+// traceRecords and the CRC-32C of the header and the records, all little-endian
+type traceHeader struct {
+	Magic        [8]byte
+	Version      uint32
+	Mode         uint32 // index in traceModes
+	PageSize     uint32
+	Reserved     uint32
+	GuestMemSize uint64
+	VMConfigHash [sha256.Size]byte
+	RecordCount  uint64
+}
+
+// traceRecord Record as stored in a binary trace file
+type traceRecord struct {
+	Offset    uint64
+	Timestamp int64 // in microseconds
+}
+
+var (
+	traceHeaderSize = binary.Size(traceHeader{})
+	traceRecordSize = binary.Size(traceRecord{})
+)
+
+func isBinaryTrace(data []byte) bool {
+	return len(data) >= len(traceMagic) && bytes.Equal(data[:len(traceMagic)], traceMagic[:])
+}
+
+func hashVMConfig(vmConfigHash string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(vmConfigHash))
+}
+
+func traceModeCode(mode ReplayMode) uint32 {
+	for code, m := range traceModes {
+		if m == mode {
+			return uint32(code)
+		}
+	}
+
+	return 0
+}
+
+// encode Serializes the trace in the binary trace format
+func (t *Trace) encode() ([]byte, error) {
+	hdr := traceHeader{
+		Magic:        traceMagic,
+		Version:      TraceFormatVersion,
+		Mode:         traceModeCode(t.mode),
+		PageSize:     uint32(os.Getpagesize()),
+		GuestMemSize: uint64(t.guestMemSize),
+		VMConfigHash: hashVMConfig(t.vmConfigHash),
+		RecordCount:  uint64(len(t.trace)),
+	}
+
+	recs := make([]traceRecord, len(t.trace))
+	for i, rec := range t.trace {
+		recs[i] = traceRecord{Offset: rec.offset, Timestamp: rec.timestamp.Microseconds()}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, traceHeaderSize+len(recs)*traceRecordSize+4))
+	if err := binary.Write(buf, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, recs); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, crc32.Checksum(buf.Bytes(), traceCRCTable)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decode Parses the trace from the binary trace format and validates it
+// against the page size, the guest memory size and the VM config of the trace
+func (t *Trace) decode(data []byte) error {
+	corruptErr := misc.SnapshotCorruptErr("trace " + t.traceFileName)
+
+	if len(data) < traceHeaderSize+4 || !isBinaryTrace(data) {
+		return errors.Wrap(corruptErr, "not a binary trace")
+	}
+
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, traceCRCTable) != sum {
+		return errors.Wrap(corruptErr, "checksum mismatch")
+	}
+
+	var hdr traceHeader
+	reader := bytes.NewReader(body)
+	if err := binary.Read(reader, binary.LittleEndian, &hdr); err != nil {
+		return errors.Wrapf(corruptErr, "failed to read the header: %v", err)
+	}
+
+	switch {
+	case hdr.Version != TraceFormatVersion:
+		return errors.Wrapf(corruptErr, "unsupported trace format version %d", hdr.Version)
+	case int(hdr.Mode) >= len(traceModes):
+		return errors.Wrapf(corruptErr, "unknown replay mode %d", hdr.Mode)
+	case uint64(reader.Len()) != hdr.RecordCount*uint64(traceRecordSize):
+		return errors.Wrapf(corruptErr, "%d bytes of records instead of %d records", reader.Len(), hdr.RecordCount)
+	case int(hdr.PageSize) != os.Getpagesize():
+		return errors.Errorf("trace is recorded with %d bytes pages instead of %d", hdr.PageSize, os.Getpagesize())
+	case t.guestMemSize != 0 && hdr.GuestMemSize != uint64(t.guestMemSize):
+		return errors.Errorf("trace is recorded with %d bytes of guest memory instead of %d", hdr.GuestMemSize, t.guestMemSize)
+	case hdr.VMConfigHash != hashVMConfig(t.vmConfigHash):
+		return errors.New("trace is recorded with another VM config")
+	}
+
+	recs := make([]traceRecord, hdr.RecordCount)
+	if err := binary.Read(reader, binary.LittleEndian, recs); err != nil {
+		return errors.Wrapf(corruptErr, "failed to read the records: %v", err)
+	}
+
+	t.mode = traceModes[hdr.Mode]
+	for _, rec := range recs {
+		t.AppendRecord(Record{offset: rec.Offset, timestamp: time.Duration(rec.Timestamp) * time.Microsecond})
+	}
+
+	return nil
+}
+
+// readLegacyTrace Reads the replay mode and all the records from a CSV trace.
+// The traces without the mode and the timestamps are laid out by ReplaySorted
+func (t *Trace) readLegacyTrace(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return errors.Wrap(err, "failed to read from the trace file")
+	}
+
+	t.mode = ReplaySorted
+	if len(lines) > 0 && lines[0][0] == "mode" {
+		if len(lines[0]) != 2 {
+			return errors.New("malformed replay mode in the trace file")
+		}
+		if t.mode, err = ParseReplayMode(lines[0][1]); err != nil {
+			return err
+		}
+		lines = lines[1:]
+	}
+
+	for _, line := range lines {
+		rec, err := readRecord(line)
+		if err != nil {
+			return err
+		}
+		t.AppendRecord(rec)
+	}
+
+	return nil
+}
+
+// readRecord Parses a record from a line
+func readRecord(line []string) (Record, error) {
+	offset, err := strconv.ParseUint(line[0], 16, 64)
+	if err != nil {
+		return Record{}, errors.Wrap(err, "failed to convert string to offset")
+	}
+
+	rec := Record{
+		offset: offset,
+	}
+
+	if len(line) > 1 {
+		us, err := strconv.ParseInt(line[1], 10, 64)
+		if err != nil {
+			return Record{}, errors.Wrap(err, "failed to convert string to timestamp")
+		}
+		rec.timestamp = time.Duration(us) * time.Microsecond
+	}
+
+	return rec, nil
+}
+
+// LoadTrace Loads a trace, in the binary or the legacy CSV format, for the VM
+// of the config and builds its regions. A binary trace is rejected if it was recorded
+// with another page size, guest memory size or VM config
+func LoadTrace(path string, cfg SnapshotStateCfg) (*Trace, error) {
+	t := newTrace(path, cfg)
+
+	if _, err := t.readTrace(); err != nil {
+		return nil, err
+	}
+	t.buildRegions()
+
+	return t, nil
+}
+
+// ConvertLegacyTrace Converts a trace in the legacy CSV format
+// into the binary format for the VM of the config
+func ConvertLegacyTrace(csvPath, tracePath string, cfg SnapshotStateCfg) error {
+	f, err := os.Open(csvPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to open trace file for reading")
+	}
+	defer f.Close()
+
+	t := newTrace(tracePath, cfg)
+	if err := t.readLegacyTrace(f); err != nil {
+		return err
+	}
+
+	log.Debugf("Converted the trace %s with %d records", csvPath, len(t.trace))
+
+	return t.WriteTrace()
+}
+
+// newTrace Initializes an empty trace for the VM of the config
+func newTrace(traceFileName string, cfg SnapshotStateCfg) *Trace {
+	mode := cfg.restoreCfg.Mode
+	if mode == "" {
+		mode = ReplaySorted
+	}
+
+	t := initTrace(traceFileName, mode)
+	t.guestMemSize = cfg.GuestMemSize
+	t.vmConfigHash = cfg.VMConfigHash
+
+	return t
+}
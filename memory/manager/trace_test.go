@@ -0,0 +1,146 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ease-lab/vhive/misc"
+)
+
+func TestTraceFile(t *testing.T) {
+	pageSize := os.Getpagesize()
+	traceFile := filepath.Join(t.TempDir(), "trace")
+	cfg := SnapshotStateCfg{
+		GuestMemSize: 16 * pageSize,
+		VMConfigHash: "image-spec",
+		restoreCfg:   RestoreCfg{Mode: ReplayFirstTouch},
+	}
+
+	trace := newTrace(traceFile, cfg)
+	trace.AppendRecord(Record{offset: 5 * uint64(pageSize), timestamp: 0})
+	trace.AppendRecord(Record{offset: 1 * uint64(pageSize), timestamp: 150 * time.Microsecond})
+	trace.AppendRecord(Record{offset: 2 * uint64(pageSize), timestamp: 2 * time.Millisecond})
+	require.NoError(t, trace.WriteTrace(), "Failed to write the trace")
+
+	cfg.restoreCfg.Mode = ReplaySorted
+	loaded, err := LoadTrace(traceFile, cfg)
+	require.NoError(t, err, "Failed to load the trace")
+	require.Equal(t, ReplayFirstTouch, loaded.mode, "The mode of the record must be kept")
+	require.Equal(t, trace.trace, loaded.trace, "The records must stay in the order of the page faults")
+	require.Equal(t, []uint64{5 * uint64(pageSize), 1 * uint64(pageSize)}, loaded.regionsInOrder(ReplayFirstTouch))
+	require.Equal(t, []uint64{1 * uint64(pageSize), 5 * uint64(pageSize)}, loaded.regionsInOrder(ReplaySorted))
+
+	otherCfg := cfg
+	otherCfg.GuestMemSize *= 2
+	_, err = LoadTrace(traceFile, otherCfg)
+	require.Error(t, err, "Traces of another guest memory size must be rejected")
+
+	otherCfg = cfg
+	otherCfg.VMConfigHash = "other-image-spec"
+	_, err = LoadTrace(traceFile, otherCfg)
+	require.Error(t, err, "Traces of another VM config must be rejected")
+
+	data, err := ioutil.ReadFile(traceFile)
+	require.NoError(t, err, "Failed to read the trace file")
+	data[traceHeaderSize] ^= 0xff
+	require.NoError(t, ioutil.WriteFile(traceFile, data, 0644))
+	_, err = LoadTrace(traceFile, cfg)
+	require.Error(t, err, "Corrupt traces must be rejected")
+	require.True(t, errors.As(err, new(misc.SnapshotCorruptErr)), "Corrupt traces must be reported as such")
+}
+
+func TestLegacyTrace(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "trace.csv")
+	traceFile := filepath.Join(dir, "trace")
+	cfg := SnapshotStateCfg{GuestMemSize: 16 * os.Getpagesize()}
+
+	// Traces written before the mode and the timestamps were recorded
+	require.NoError(t, ioutil.WriteFile(csvFile, []byte("1000\n2000\n5000\n"), 0644))
+
+	legacy, err := LoadTrace(csvFile, cfg)
+	require.NoError(t, err, "Failed to load the legacy trace")
+	require.Equal(t, ReplaySorted, legacy.mode, "Legacy working sets are sorted")
+	require.Equal(t, []Record{{offset: 0x1000}, {offset: 0x2000}, {offset: 0x5000}}, legacy.trace)
+
+	require.NoError(t, ConvertLegacyTrace(csvFile, traceFile, cfg), "Failed to convert the legacy trace")
+	converted, err := LoadTrace(traceFile, cfg)
+	require.NoError(t, err, "Failed to load the converted trace")
+	require.Equal(t, legacy.trace, converted.trace)
+
+	isLegacy, err := newTrace(traceFile, cfg).readTrace()
+	require.NoError(t, err)
+	require.False(t, isLegacy, "The converted trace must be binary")
+
+	require.NoError(t, ioutil.WriteFile(csvFile, []byte("mode,first-touch\n1000,0\n3000,12\n"), 0644))
+	legacy, err = LoadTrace(csvFile, cfg)
+	require.NoError(t, err, "Failed to load the legacy trace with the mode")
+	require.Equal(t, ReplayFirstTouch, legacy.mode)
+	require.Equal(t, 12*time.Microsecond, legacy.trace[1].timestamp)
+
+	require.NoError(t, ioutil.WriteFile(csvFile, []byte("mode,random\n1000,0\n"), 0644))
+	_, err = LoadTrace(csvFile, cfg)
+	require.Error(t, err, "Unknown modes must be rejected")
+}
+
+func TestWorkingSetLayout(t *testing.T) {
+	pageSize := os.Getpagesize()
+	dir := t.TempDir()
+
+	guestMem := make([]byte, 8*pageSize)
+	for i := range guestMem {
+		guestMem[i] = byte(i / pageSize)
+	}
+	guestMemPath := filepath.Join(dir, "mem_file")
+	require.NoError(t, ioutil.WriteFile(guestMemPath, guestMem, 0644))
+
+	for _, mode := range []ReplayMode{ReplaySorted, ReplayFirstTouch} {
+		trace := recordTrace(mode, 6, 2, 3, 7)
+		wsPath := filepath.Join(dir, "working_set_pages_"+string(mode))
+		require.NoError(t, trace.ProcessRecord(guestMemPath, wsPath), "Failed to process the record")
+
+		ws, err := ioutil.ReadFile(wsPath)
+		require.NoError(t, err, "Failed to read the working set")
+
+		regions := planRegions(trace, mode)
+		for _, reg := range regions {
+			for page := 0; page < reg.pages; page++ {
+				require.Equal(t, byte(reg.offset/uint64(pageSize))+byte(page), ws[reg.srcOffset+page*pageSize],
+					"Wrong page of the region at %#x in the %s working set", reg.offset, mode)
+			}
+		}
+
+		if mode == ReplayFirstTouch {
+			require.Equal(t, 0, regions[0].srcOffset, "The first touched region must be stored first")
+			require.Equal(t, uint64(6*pageSize), regions[0].offset)
+		}
+	}
+}
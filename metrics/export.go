@@ -0,0 +1,199 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// ExportFormat Format of the exported raw samples
+type ExportFormat string
+
+const (
+	// JSONLines One JSON object per sample and line, appended to the file
+	JSONLines ExportFormat = "jsonl"
+	// Parquet Columnar Parquet file, with one row per sample, that replaces the file
+	Parquet ExportFormat = "parquet"
+)
+
+// ParseExportFormat Returns the export format with the name
+func ParseExportFormat(name string) (ExportFormat, error) {
+	switch f := ExportFormat(name); f {
+	case JSONLines, Parquet:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q", name)
+	}
+}
+
+// RunInfo Metadata of the run that the samples were measured in
+type RunInfo struct {
+	Function string `json:"function"`
+	// Flags Modes of the run, e.g., snapshots, upf or lazy
+	Flags     map[string]string `json:"flags,omitempty"`
+	Host      string            `json:"host"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// NewRunInfo Returns the metadata of a run of the function with the flags on this host, started now
+func NewRunInfo(function string, flags map[string]string) RunInfo {
+	host, err := os.Hostname()
+	if err != nil {
+		log.WithError(err).Warn("Failed to get the hostname")
+	}
+
+	return RunInfo{Function: function, Flags: flags, Host: host, Timestamp: time.Now()}
+}
+
+// Sample A raw measurement with the metadata of its run
+type Sample struct {
+	RunInfo
+	// Index Position of the sample in the run
+	Index   int                `json:"index"`
+	Metrics map[string]float64 `json:"metrics"`
+	Total   float64            `json:"total"`
+}
+
+// parquetSample Row of a sample in a Parquet file
+type parquetSample struct {
+	Function  string             `parquet:"name=function, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Flags     map[string]string  `parquet:"name=flags, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Host      string             `parquet:"name=host, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Timestamp int64              `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Index     int64              `parquet:"name=index, type=INT64"`
+	Metrics   map[string]float64 `parquet:"name=metrics, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=DOUBLE"`
+	Total     float64            `parquet:"name=total, type=DOUBLE"`
+}
+
+// NewSamples Returns the raw samples of the metrics of the run
+func NewSamples(run RunInfo, metricsList ...*Metric) []Sample {
+	samples := make([]Sample, 0, len(metricsList))
+	for i, m := range metricsList {
+		samples = append(samples, Sample{RunInfo: run, Index: i, Metrics: m.MetricMap, Total: m.Total()})
+	}
+
+	return samples
+}
+
+// ExportSamples Exports the raw samples of the metrics, with the metadata of the run, to the file
+func ExportSamples(path string, format ExportFormat, run RunInfo, metricsList ...*Metric) error {
+	var (
+		f   *os.File
+		err error
+	)
+
+	switch format {
+	case JSONLines:
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	case Parquet:
+		f, err = os.Create(path)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+	if err != nil {
+		log.Error("Failed to open samples output file")
+		return err
+	}
+	defer f.Close()
+
+	samples := NewSamples(run, metricsList...)
+
+	if format == Parquet {
+		err = WriteParquet(f, samples)
+	} else {
+		err = WriteJSONLines(f, samples)
+	}
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// WriteJSONLines Writes the samples as JSON Lines
+func WriteJSONLines(w io.Writer, samples []Sample) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	for _, s := range samples {
+		if err := enc.Encode(s); err != nil {
+			log.Error("Failed to encode sample")
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ReadJSONLines Reads the samples written as JSON Lines, e.g., to compare runs
+func ReadJSONLines(r io.Reader) ([]Sample, error) {
+	var samples []Sample
+
+	dec := json.NewDecoder(r)
+	for {
+		var s Sample
+		if err := dec.Decode(&s); err == io.EOF {
+			return samples, nil
+		} else if err != nil {
+			return samples, err
+		}
+		samples = append(samples, s)
+	}
+}
+
+// WriteParquet Writes the samples as a Snappy-compressed Parquet file
+func WriteParquet(w io.Writer, samples []Sample) error {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetSample), 1)
+	if err != nil {
+		log.Error("Failed to create Parquet writer")
+		return err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for _, s := range samples {
+		row := parquetSample{
+			Function:  s.Function,
+			Flags:     s.Flags,
+			Host:      s.Host,
+			Timestamp: s.Timestamp.UnixNano() / int64(time.Microsecond),
+			Index:     int64(s.Index),
+			Metrics:   s.Metrics,
+			Total:     s.Total,
+		}
+		if err := pw.Write(row); err != nil {
+			log.Error("Failed to write Parquet row")
+			return err
+		}
+	}
+
+	return pw.WriteStop()
+}
@@ -42,9 +42,13 @@ const (
 
 	// LoadVMM Name of LoadVMM metric
 	LoadVMM = "LoadVMM"
+	// CloneSnapshot Time to copy the snapshot files for a new VM
+	CloneSnapshot = "CloneSnapshot"
 
 	// AddInstance Time to add instance - load snap or start vm
 	AddInstance = "AddInstance"
+	// QueueWait Time the request waits for an instance to get capacity or to start
+	QueueWait = "QueueWait"
 	// FuncInvocation Time to get response from function
 	FuncInvocation = "FuncInvocation"
 	// RetireOld Time to offload/stop instance if threshold exceeded
@@ -62,6 +66,19 @@ const (
 	TaskWait = "TaskWait"
 	// TaskStart Time to start task
 	TaskStart = "TaskStart"
+
+	// DrainRPCs Time to wait for the in-flight RPCs to an instance to complete
+	DrainRPCs = "DrainRPCs"
+	// TaskTerm Time for the task to exit after SIGTERM
+	TaskTerm = "TaskTerm"
+	// TaskKill Time for the task to exit after SIGKILL
+	TaskKill = "TaskKill"
+	// TaskDelete Time to delete the task
+	TaskDelete = "TaskDelete"
+	// ContainerDelete Time to delete the container
+	ContainerDelete = "ContainerDelete"
+	// FcStopVM Time to stop VM
+	FcStopVM = "FcStopVM"
 )
 
 // Metric A general metric
@@ -101,41 +118,85 @@ func (m *Metric) PrintAll() {
 }
 
 // PrintMeanStd prints the mean and standard
-// deviation of each component of Metric
+// deviation of each component of Metric.
+// The components are the union of those of all the metrics.
 func PrintMeanStd(resultsPath, funcName string, metricsList ...*Metric) error {
 	var (
-		mean, std   float64
-		f           *os.File
-		err         error
-		agg         map[string][]float64 = make(map[string][]float64)
-		totals      []float64            = make([]float64, 0, len(metricsList))
-		keys        []string             = make([]string, 0)
-		forPrinting []string             = make([]string, 0)
-		header                           = []string{"FuncName"}
+		keys        []string = make([]string, 0)
+		forPrinting []string = make([]string, 0)
+		header               = []string{"FuncName"}
 	)
 
 	if len(metricsList) == 0 {
 		return nil
 	}
 
-	for k := range metricsList[0].MetricMap {
-		keys = append(keys, k)
-		agg[k] = make([]float64, 0, len(metricsList))
+	sums := Summarize(metricsList...)
+
+	for k := range sums {
+		if k != "Total" {
+			keys = append(keys, k)
+		}
 	}
 	sort.Strings(keys)
+	keys = append(keys, "Total")
 
 	for _, key := range keys {
 		header = append(header, key, "StdDev")
 	}
-	header = append(header, "Total", "StdDev")
 
-	for _, m := range metricsList {
-		totals = append(totals, m.Total())
+	forPrinting = append(forPrinting, funcName)
 
-		for k, v := range m.MetricMap {
-			agg[k] = append(agg[k], v)
+	for _, k := range keys {
+		forPrinting = append(forPrinting, strconv.Itoa(int(sums[k].Mean)))
+		forPrinting = append(forPrinting, fmt.Sprintf("%.1f", sums[k].StdDev))
+	}
+
+	return appendCSV(resultsPath, header, [][]string{forPrinting})
+}
+
+// PrintPercentiles prints the count, mean, standard deviation, minimum,
+// percentiles and maximum of each component of the metrics, one per row
+func PrintPercentiles(resultsPath, funcName string, metricsList ...*Metric) error {
+	var (
+		keys   []string = make([]string, 0)
+		rows   [][]string
+		header = []string{"FuncName", "Metric", "Count", "Mean", "StdDev", "Min", "P50", "P90", "P99", "P99.9", "Max"}
+	)
+
+	if len(metricsList) == 0 {
+		return nil
+	}
+
+	sums := Summarize(metricsList...)
+
+	for k := range sums {
+		if k != "Total" {
+			keys = append(keys, k)
 		}
 	}
+	sort.Strings(keys)
+	keys = append(keys, "Total")
+
+	for _, k := range keys {
+		s := sums[k]
+		row := []string{funcName, k, strconv.Itoa(s.Count)}
+		for _, v := range []float64{s.Mean, s.StdDev, s.Min, s.P50, s.P90, s.P99, s.P999, s.Max} {
+			row = append(row, fmt.Sprintf("%.1f", v))
+		}
+		rows = append(rows, row)
+	}
+
+	return appendCSV(resultsPath, header, rows)
+}
+
+// appendCSV Appends the rows to the CSV file, or prints them if the path
+// is empty, writing the header first if the file is empty
+func appendCSV(resultsPath string, header []string, rows [][]string) error {
+	var (
+		f   *os.File
+		err error
+	)
 
 	if resultsPath == "" {
 		f = os.Stdout
@@ -164,25 +225,79 @@ func PrintMeanStd(resultsPath, funcName string, metricsList ...*Metric) error {
 		}
 	}
 
-	forPrinting = append(forPrinting, funcName)
+	if err := w.WriteAll(rows); err != nil {
+		log.Error("Failed to write to csv file")
+		return err
+	}
 
-	for _, k := range keys {
-		v := agg[k]
-		mean, std = stat.MeanStdDev(v, nil)
-		forPrinting = append(forPrinting, strconv.Itoa(int(mean)))
-		forPrinting = append(forPrinting, fmt.Sprintf("%.1f", std))
+	return nil
+}
+
+// Summary Statistics of a metric across several measurements
+type Summary struct {
+	Count  int
+	Mean   float64
+	StdDev float64
+	Min    float64
+	Max    float64
+	P50    float64
+	P90    float64
+	P99    float64
+	P999   float64
+}
+
+// Summarize Returns the statistics of each component of the metrics and, with
+// the Total key, of their totals. A component is summarized across the metrics
+// that have it, so the metrics do not need to have the same components.
+func Summarize(metricsList ...*Metric) map[string]Summary {
+	var (
+		agg    map[string][]float64 = make(map[string][]float64)
+		totals []float64            = make([]float64, 0, len(metricsList))
+		sums   map[string]Summary   = make(map[string]Summary)
+	)
+
+	if len(metricsList) == 0 {
+		return sums
 	}
 
-	mean, std = stat.MeanStdDev(totals, nil)
-	forPrinting = append(forPrinting, strconv.Itoa(int(mean)))
-	forPrinting = append(forPrinting, fmt.Sprintf("%.1f", std))
+	for _, m := range metricsList {
+		totals = append(totals, m.Total())
 
-	if err := w.Write(forPrinting); err != nil {
-		log.Error("Failed to write to csv file")
-		return err
+		for k, v := range m.MetricMap {
+			agg[k] = append(agg[k], v)
+		}
 	}
 
-	return nil
+	for k, v := range agg {
+		sums[k] = summarize(v)
+	}
+
+	sums["Total"] = summarize(totals)
+
+	return sums
+}
+
+// summarize Returns the statistics of the values, sorting them.
+// The standard deviation of a single value is zero.
+func summarize(values []float64) Summary {
+	sort.Float64s(values)
+
+	mean, std := stat.MeanStdDev(values, nil)
+	if len(values) == 1 {
+		std = 0
+	}
+
+	return Summary{
+		Count:  len(values),
+		Mean:   mean,
+		StdDev: std,
+		Min:    values[0],
+		Max:    values[len(values)-1],
+		P50:    stat.Quantile(0.5, stat.LinInterp, values, nil),
+		P90:    stat.Quantile(0.9, stat.LinInterp, values, nil),
+		P99:    stat.Quantile(0.99, stat.LinInterp, values, nil),
+		P999:   stat.Quantile(0.999, stat.LinInterp, values, nil),
+	}
 }
 
 // ToUS Converts Duration to microseconds
@@ -23,9 +23,17 @@
 package metrics
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
 )
 
 func TestMetrics(t *testing.T) {
@@ -41,3 +49,158 @@ func TestMetrics(t *testing.T) {
 	err := PrintMeanStd("placeholder", "placeholderFunc", s1, s2)
 	require.NoError(t, err, "Failed to print mean and std dev")
 }
+
+func TestSummarize(t *testing.T) {
+	s1 := NewMetric()
+	s1.MetricMap[GetImage] = 10.0
+	s1.MetricMap[TaskStart] = 15.0
+
+	s2 := NewMetric()
+	s2.MetricMap[GetImage] = 30.0
+	s2.MetricMap[TaskStart] = 15.0
+
+	sums := Summarize(s1, s2)
+	require.Len(t, sums, 3)
+	require.Equal(t, 20.0, sums[GetImage].Mean)
+	require.InDelta(t, 14.14, sums[GetImage].StdDev, 0.01)
+	require.Equal(t, Summary{Count: 2, Mean: 15.0, Min: 15.0, Max: 15.0, P50: 15.0, P90: 15.0, P99: 15.0, P999: 15.0}, sums[TaskStart])
+	require.Equal(t, 35.0, sums["Total"].Mean)
+
+	require.Empty(t, Summarize(), "Summarized no measurements")
+}
+
+func TestSummarizePercentiles(t *testing.T) {
+	var metricsList []*Metric
+	for i := 100; i >= 1; i-- {
+		m := NewMetric()
+		m.MetricMap[FuncInvocation] = float64(i)
+		if i%2 == 0 {
+			m.MetricMap[GetImage] = 1000.0
+		}
+		metricsList = append(metricsList, m)
+	}
+
+	sums := Summarize(metricsList...)
+
+	inv := sums[FuncInvocation]
+	require.Equal(t, 100, inv.Count)
+	require.Equal(t, 1.0, inv.Min)
+	require.Equal(t, 100.0, inv.Max)
+	require.Equal(t, 50.0, inv.P50)
+	require.Equal(t, 90.0, inv.P90)
+	require.Equal(t, 99.0, inv.P99)
+	require.InDelta(t, 99.9, inv.P999, 0.01)
+
+	require.Equal(t, 50, sums[GetImage].Count, "Components must be summarized across the metrics that have them")
+	require.Equal(t, 1000.0, sums[GetImage].Mean)
+	require.Equal(t, 100, sums["Total"].Count)
+	require.Equal(t, 1100.0, sums["Total"].Max)
+}
+
+func TestPrintHeterogeneous(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s1 := NewMetric()
+	s1.MetricMap[FuncInvocation] = 10.0
+
+	s2 := NewMetric()
+	s2.MetricMap[FuncInvocation] = 30.0
+	s2.MetricMap[GetImage] = 100.0
+
+	meanStdPath := filepath.Join(dir, "serve.csv")
+	require.NoError(t, PrintMeanStd(meanStdPath, "helloworld", s1, s2))
+
+	out, err := ioutil.ReadFile(meanStdPath)
+	require.NoError(t, err)
+	require.Equal(t, "FuncName,FuncInvocation,StdDev,GetImage,StdDev,Total,StdDev\n"+
+		"helloworld,20,14.1,100,0.0,70,84.9\n", string(out))
+
+	percentilesPath := filepath.Join(dir, "percentiles.csv")
+	require.NoError(t, PrintPercentiles(percentilesPath, "helloworld", s1, s2))
+	require.NoError(t, PrintPercentiles(percentilesPath, "helloworld", s1))
+
+	out, err = ioutil.ReadFile(percentilesPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	require.Len(t, lines, 6, "The header must be written once")
+	require.Equal(t, "FuncName,Metric,Count,Mean,StdDev,Min,P50,P90,P99,P99.9,Max", lines[0])
+	require.Equal(t, "helloworld,GetImage,1,100.0,0.0,100.0,100.0,100.0,100.0,100.0,100.0", lines[2])
+}
+
+func testSamples() (RunInfo, []*Metric) {
+	run := RunInfo{
+		Function:  "helloworld",
+		Flags:     map[string]string{"snapshots": "true", "upf": "false"},
+		Host:      "node-1",
+		Timestamp: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	s1 := NewMetric()
+	s1.MetricMap[FuncInvocation] = 10.0
+
+	s2 := NewMetric()
+	s2.MetricMap[FuncInvocation] = 30.0
+	s2.MetricMap[GetImage] = 100.0
+
+	return run, []*Metric{s1, s2}
+}
+
+func TestExportJSONLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	run, metricsList := testSamples()
+	path := filepath.Join(dir, "serve.jsonl")
+
+	require.NoError(t, ExportSamples(path, JSONLines, run, metricsList...))
+	require.NoError(t, ExportSamples(path, JSONLines, run, metricsList[0]))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	samples, err := ReadJSONLines(f)
+	require.NoError(t, err)
+	require.Len(t, samples, 3, "Samples must be appended")
+	require.Equal(t, NewSamples(run, metricsList...), samples[:2])
+	require.Equal(t, 0, samples[2].Index)
+	require.Equal(t, 130.0, samples[1].Total)
+}
+
+func TestExportParquet(t *testing.T) {
+	run, metricsList := testSamples()
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteParquet(&buf, NewSamples(run, metricsList...)))
+
+	pf, err := buffer.NewBufferFile(buf.Bytes())
+	require.NoError(t, err)
+
+	pr, err := reader.NewParquetReader(pf, new(parquetSample), 1)
+	require.NoError(t, err)
+	defer pr.ReadStop()
+
+	require.Equal(t, int64(2), pr.GetNumRows())
+
+	rows := make([]parquetSample, 2)
+	require.NoError(t, pr.Read(&rows))
+	require.Equal(t, "helloworld", rows[1].Function)
+	require.Equal(t, "node-1", rows[1].Host)
+	require.Equal(t, run.Timestamp.UnixNano()/1000, rows[1].Timestamp)
+	require.Equal(t, int64(1), rows[1].Index)
+	require.Equal(t, map[string]float64{FuncInvocation: 30.0, GetImage: 100.0}, rows[1].Metrics)
+	require.Equal(t, run.Flags, rows[0].Flags)
+	require.Equal(t, 130.0, rows[1].Total)
+}
+
+func TestParseExportFormat(t *testing.T) {
+	f, err := ParseExportFormat("parquet")
+	require.NoError(t, err)
+	require.Equal(t, Parquet, f)
+
+	_, err = ParseExportFormat("csv")
+	require.Error(t, err)
+}
@@ -23,7 +23,12 @@
 package misc
 
 import (
+	"context"
+	"errors"
 	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // NonExistErr VM, funcClient, etc does not exist.
@@ -32,3 +37,116 @@ type NonExistErr string
 func (e NonExistErr) Error() string {
 	return fmt.Sprintf("%v does not exist", string(e))
 }
+
+// AlreadyExistErr VM, container, etc already exists.
+type AlreadyExistErr string
+
+func (e AlreadyExistErr) Error() string {
+	return fmt.Sprintf("%v already exists", string(e))
+}
+
+// TimeoutErr An operation did not complete in time.
+type TimeoutErr string
+
+func (e TimeoutErr) Error() string {
+	return fmt.Sprintf("%v timed out", string(e))
+}
+
+// ResourceExhaustedErr A queue, pool, etc is full or did not get capacity in time.
+type ResourceExhaustedErr string
+
+func (e ResourceExhaustedErr) Error() string {
+	return fmt.Sprintf("resource exhausted: %v", string(e))
+}
+
+// SnapshotCorruptErr The files or the metadata of a snapshot are missing or invalid.
+type SnapshotCorruptErr string
+
+func (e SnapshotCorruptErr) Error() string {
+	return fmt.Sprintf("snapshot %v is corrupt", string(e))
+}
+
+// VMMErr The VMM failed to carry out an operation on a VM.
+type VMMErr struct {
+	Op   string
+	VMID string
+	Err  error
+}
+
+func (e *VMMErr) Error() string {
+	return fmt.Sprintf("VMM failed to %s VM %s: %v", e.Op, e.VMID, e.Err)
+}
+
+// Unwrap Returns the error of the VMM
+func (e *VMMErr) Unwrap() error {
+	return e.Err
+}
+
+// NewVMMErr Wraps an error of the VMM operation on the VM, unless the error
+// is one of the typed errors already or the operation timed out
+func NewVMMErr(ctx context.Context, op, vmID string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded {
+		return TimeoutErr(fmt.Sprintf("%s of VM %s", op, vmID))
+	}
+
+	if GRPCCode(err) != codes.Unknown {
+		return err
+	}
+
+	return &VMMErr{Op: op, VMID: vmID, Err: err}
+}
+
+// GRPCCode Returns the gRPC status code that corresponds to the error
+func GRPCCode(err error) codes.Code {
+	var (
+		nonExistErr        NonExistErr
+		alreadyExistErr    AlreadyExistErr
+		timeoutErr         TimeoutErr
+		snapshotCorruptErr SnapshotCorruptErr
+		exhaustedErr       ResourceExhaustedErr
+		vmmErr             *VMMErr
+	)
+
+	switch {
+	case err == nil:
+		return codes.OK
+	case errors.As(err, &nonExistErr):
+		return codes.NotFound
+	case errors.As(err, &alreadyExistErr):
+		return codes.AlreadyExists
+	case errors.As(err, &timeoutErr), errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.As(err, &snapshotCorruptErr):
+		return codes.DataLoss
+	case errors.As(err, &exhaustedErr):
+		return codes.ResourceExhausted
+	case errors.As(err, &vmmErr):
+		return codes.Internal
+	}
+
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+
+	return codes.Unknown
+}
+
+// ToGRPCError Converts the error to a gRPC status error with the corresponding code,
+// so that the error can be returned by a gRPC service
+func ToGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	return status.Error(GRPCCode(err), err.Error())
+}
@@ -23,6 +23,7 @@
 package misc
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sync"
@@ -30,8 +31,11 @@ import (
 	"time"
 
 	ctrdlog "github.com/containerd/containerd/log"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestMain(m *testing.M) {
@@ -146,3 +150,36 @@ func TestRecreateParallel(t *testing.T) {
 
 	vmPool.RemoveBridges()
 }
+
+func TestErrorCodes(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{err: nil, code: codes.OK},
+		{err: NonExistErr("VM 1"), code: codes.NotFound},
+		{err: errors.Wrap(NonExistErr("VM 1"), "failed to stop VM"), code: codes.NotFound},
+		{err: AlreadyExistErr("VM 1"), code: codes.AlreadyExists},
+		{err: TimeoutErr("CreateVM of VM 1"), code: codes.DeadlineExceeded},
+		{err: errors.Wrap(context.DeadlineExceeded, "failed to create VM"), code: codes.DeadlineExceeded},
+		{err: context.Canceled, code: codes.Canceled},
+		{err: SnapshotCorruptErr("1"), code: codes.DataLoss},
+		{err: ResourceExhaustedErr("request queue of function 1 is full"), code: codes.ResourceExhausted},
+		{err: NewVMMErr(ctx, "CreateVM", "1", errors.New("boom")), code: codes.Internal},
+		{err: NewVMMErr(ctx, "StopVM", "1", NonExistErr("VM 1")), code: codes.NotFound},
+		{err: status.Error(codes.Unavailable, "unavailable"), code: codes.Unavailable},
+		{err: errors.New("boom"), code: codes.Unknown},
+	} {
+		require.Equal(t, tc.code, GRPCCode(tc.err), "Wrong code for %v", tc.err)
+		require.Equal(t, tc.code, status.Code(ToGRPCError(tc.err)), "Wrong status for %v", tc.err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 0)
+	defer cancel()
+	<-timeoutCtx.Done()
+
+	err := NewVMMErr(timeoutCtx, "CreateVM", "1", errors.New("rpc error"))
+	require.IsType(t, TimeoutErr(""), err, "Operations that time out must return a timeout error")
+}
@@ -43,7 +43,17 @@ type VM struct {
 // VMPool Pool of active VMs (can be in several states though)
 type VMPool struct {
 	vmMap      sync.Map
-	tapManager *taps.TapManager
+	tapManager TapManager
+}
+
+// TapManager Manages the taps of the VMs in a pool, e.g., taps.TapManager
+// or taps.FakeTapManager
+type TapManager interface {
+	AddTap(tapName, hostIface string) (*taps.NetworkInterface, error)
+	RestoreTap(tapName, hostIface string, ni *taps.NetworkInterface) error
+	RemoveTap(tapName string) error
+	ConnectClone(tapName, guestAddress string) error
+	RemoveBridges()
 }
 
 // NewVM Initialize a VM
@@ -30,8 +30,15 @@ import (
 
 // NewVMPool Initializes a pool of VMs
 func NewVMPool() *VMPool {
+	return NewVMPoolWithTapManager(taps.NewTapManager())
+}
+
+// NewVMPoolWithTapManager Initializes a pool of VMs whose taps are managed by
+// the tap manager, e.g., a taps.FakeTapManager in the tests without the privileges
+// to create the bridges
+func NewVMPoolWithTapManager(tm TapManager) *VMPool {
 	p := new(VMPool)
-	p.tapManager = taps.NewTapManager()
+	p.tapManager = tm
 
 	return p
 }
@@ -44,7 +51,8 @@ func (p *VMPool) Allocate(vmID, hostIface string) (*VM, error) {
 	logger.Debug("Allocating a VM instance")
 
 	if _, isPresent := p.vmMap.Load(vmID); isPresent {
-		logger.Panic("Allocate (VM): VM exists in the map")
+		logger.Error("Allocate (VM): VM exists in the map")
+		return nil, AlreadyExistErr("Allocate: VM " + vmID)
 	}
 
 	vm := NewVM(vmID)
@@ -61,6 +69,36 @@ func (p *VMPool) Allocate(vmID, hostIface string) (*VM, error) {
 	return vm, nil
 }
 
+// AllocateWithNetwork Initializes a VM with the network interface that it had
+// before, e.g., in a snapshot, activates it and then adds it to VM map
+func (p *VMPool) AllocateWithNetwork(vmID, hostIface string, ni *taps.NetworkInterface) (*VM, error) {
+	logger := log.WithFields(log.Fields{"vmID": vmID})
+
+	logger.Debug("Allocating a VM instance with a network interface")
+
+	if _, isPresent := p.vmMap.Load(vmID); isPresent {
+		logger.Error("AllocateWithNetwork (VM): VM exists in the map")
+		return nil, AlreadyExistErr("AllocateWithNetwork: VM " + vmID)
+	}
+
+	vm := NewVM(vmID)
+
+	// The network interface may be of another VM, e.g., the one that the snapshot was taken of
+	tapName := vmID + "_tap"
+	vmNi := *ni
+	vmNi.HostDevName = tapName
+
+	if err := p.tapManager.RestoreTap(tapName, hostIface, &vmNi); err != nil {
+		logger.Warn("Ni restoration failed")
+		return nil, err
+	}
+	vm.Ni = &vmNi
+
+	p.vmMap.Store(vmID, vm)
+
+	return vm, nil
+}
+
 // Free Removes a VM from the pool and transitions it to Deactivating
 func (p *VMPool) Free(vmID string) error {
 	logger := log.WithFields(log.Fields{"vmID": vmID})
@@ -91,8 +129,8 @@ func (p *VMPool) RecreateTap(vmID, hostIface string) error {
 
 	_, isPresent := p.vmMap.Load(vmID)
 	if !isPresent {
-		log.WithFields(log.Fields{"vmID": vmID}).Panic("RecreateTap: VM does not exist in the map")
-		return NonExistErr("RecreateTap: VM does not exist when recreating its tap")
+		logger.Error("RecreateTap: VM does not exist in the map")
+		return NonExistErr("RecreateTap: VM " + vmID)
 	}
 
 	if err := p.tapManager.RemoveTap(vmID + "_tap"); err != nil {
@@ -109,6 +147,25 @@ func (p *VMPool) RecreateTap(vmID, hostIface string) error {
 	return nil
 }
 
+// ConnectClone Connects the tap of a VM to its guest that keeps the network
+// interface of another VM, e.g., of the VM that the guest's snapshot was taken of,
+// so that the guest is reachable at the VM's own primary address
+func (p *VMPool) ConnectClone(vmID, guestAddress string) error {
+	logger := log.WithFields(log.Fields{"vmID": vmID})
+
+	if _, isPresent := p.vmMap.Load(vmID); !isPresent {
+		logger.Error("ConnectClone: VM does not exist in the map")
+		return NonExistErr("ConnectClone: VM " + vmID)
+	}
+
+	if err := p.tapManager.ConnectClone(vmID+"_tap", guestAddress); err != nil {
+		logger.Error("Failed to connect tap to the clone")
+		return err
+	}
+
+	return nil
+}
+
 // GetVMMap Returns a copy of vmMap as a regular concurrency-unsafe map
 func (p *VMPool) GetVMMap() map[string]*VM {
 	m := make(map[string]*VM)
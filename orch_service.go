@@ -0,0 +1,324 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ctriface "github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/memory/manager"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+	pb "github.com/ease-lab/vhive/proto"
+)
+
+// PauseVM, ResumeVM, CreateSnapshot, LoadSnapshot and Offload manage the VMs directly,
+// bypassing the function pool, to drive experiments remotely.
+// They fail on the instances of the functions in the function pool, which manages them.
+func (s *server) PauseVM(ctx context.Context, in *pb.VMReq) (*pb.Status, error) {
+	vmID := in.GetId()
+	log.WithFields(log.Fields{"vmID": vmID}).Info("Received direct PauseVM")
+
+	if err := checkNotFunctionInstance(vmID); err != nil {
+		return &pb.Status{Message: "Failed to pause VM"}, err
+	}
+
+	if err := orch.PauseVM(ctx, vmID); err != nil {
+		return &pb.Status{Message: "Failed to pause VM"}, misc.ToGRPCError(err)
+	}
+
+	return &pb.Status{Message: "Paused VM " + vmID}, nil
+}
+
+func (s *server) ResumeVM(ctx context.Context, in *pb.VMReq) (*pb.VMOpResp, error) {
+	vmID := in.GetId()
+	log.WithFields(log.Fields{"vmID": vmID}).Info("Received direct ResumeVM")
+
+	if err := checkNotFunctionInstance(vmID); err != nil {
+		return &pb.VMOpResp{Message: "Failed to resume VM"}, err
+	}
+
+	metr, err := orch.ResumeVM(ctx, vmID)
+	if err != nil {
+		return &pb.VMOpResp{Message: "Failed to resume VM"}, misc.ToGRPCError(err)
+	}
+
+	return &pb.VMOpResp{Message: "Resumed VM " + vmID, Metrics: toPBMetrics(metr)}, nil
+}
+
+func (s *server) CreateSnapshot(ctx context.Context, in *pb.VMReq) (*pb.Status, error) {
+	vmID := in.GetId()
+	log.WithFields(log.Fields{"vmID": vmID}).Info("Received direct CreateSnapshot")
+
+	if err := checkNotFunctionInstance(vmID); err != nil {
+		return &pb.Status{Message: "Failed to create snapshot of VM"}, err
+	}
+
+	if err := orch.CreateSnapshot(ctx, vmID); err != nil {
+		return &pb.Status{Message: "Failed to create snapshot of VM"}, misc.ToGRPCError(err)
+	}
+
+	return &pb.Status{Message: "Created snapshot of VM " + vmID}, nil
+}
+
+func (s *server) LoadSnapshot(ctx context.Context, in *pb.VMReq) (*pb.VMOpResp, error) {
+	vmID := in.GetId()
+	log.WithFields(log.Fields{"vmID": vmID}).Info("Received direct LoadSnapshot")
+
+	if err := checkNotFunctionInstance(vmID); err != nil {
+		return &pb.VMOpResp{Message: "Failed to load snapshot of VM"}, err
+	}
+
+	metr, err := orch.LoadSnapshot(ctx, vmID)
+	if err != nil {
+		return &pb.VMOpResp{Message: "Failed to load snapshot of VM"}, misc.ToGRPCError(err)
+	}
+
+	return &pb.VMOpResp{Message: "Loaded snapshot of VM " + vmID, Metrics: toPBMetrics(metr)}, nil
+}
+
+func (s *server) Offload(ctx context.Context, in *pb.VMReq) (*pb.Status, error) {
+	vmID := in.GetId()
+	log.WithFields(log.Fields{"vmID": vmID}).Info("Received direct Offload")
+
+	if err := checkNotFunctionInstance(vmID); err != nil {
+		return &pb.Status{Message: "Failed to offload VM"}, err
+	}
+
+	if err := orch.Offload(ctx, vmID); err != nil {
+		return &pb.Status{Message: "Failed to offload VM"}, misc.ToGRPCError(err)
+	}
+
+	return &pb.Status{Message: "Offloaded VM " + vmID}, nil
+}
+
+func (s *server) ListVMs(ctx context.Context, in *pb.ListVMsReq) (*pb.ListVMsResp, error) {
+	fIDs := getInstanceFunctions(funcPool.ListFunctions())
+
+	resp := &pb.ListVMsResp{}
+	for _, info := range orch.ListVMs() {
+		resp.Vms = append(resp.Vms, toPBVM(info, fIDs[info.ID]))
+	}
+
+	return resp, nil
+}
+
+func (s *server) GetVM(ctx context.Context, in *pb.VMReq) (*pb.VM, error) {
+	info, err := orch.GetVM(in.GetId())
+	if err != nil {
+		return nil, misc.ToGRPCError(err)
+	}
+
+	fIDs := getInstanceFunctions(funcPool.ListFunctions())
+
+	return toPBVM(info, fIDs[info.ID]), nil
+}
+
+func (s *server) ListFunctions(ctx context.Context, in *pb.ListFunctionsReq) (*pb.ListFunctionsResp, error) {
+	resp := &pb.ListFunctionsResp{}
+	for _, info := range funcPool.ListFunctions() {
+		resp.Functions = append(resp.Functions, toPBFunction(info))
+	}
+
+	return resp, nil
+}
+
+func (s *server) GetStats(ctx context.Context, in *pb.GetStatsReq) (*pb.GetStatsResp, error) {
+	fID := in.GetFunctionId()
+
+	resp := &pb.GetStatsResp{
+		Snapshots: toPBSnapshotStoreStats(orch.GetSnapshotStoreStats()),
+		Images:    toPBImageStoreStats(orch.GetImageStoreStats()),
+	}
+
+	if fID == "" {
+		if in.GetUpf() {
+			return nil, status.Error(codes.InvalidArgument, "UPF stats require a function")
+		}
+
+		for _, info := range funcPool.ListFunctions() {
+			resp.Functions = append(resp.Functions, toPBFunction(info))
+		}
+
+		return resp, nil
+	}
+
+	info, err := funcPool.GetFunctionInfo(fID)
+	if err != nil {
+		return nil, misc.ToGRPCError(err)
+	}
+	resp.Functions = append(resp.Functions, toPBFunction(info))
+
+	if !in.GetUpf() {
+		return resp, nil
+	}
+
+	if !orch.GetUPFEnabled() {
+		return nil, status.Error(codes.FailedPrecondition, "user-level page faults are not enabled")
+	}
+
+	pageStats, latencyStats, err := funcPool.GetUPFStats(fID)
+	if err != nil {
+		return nil, misc.ToGRPCError(err)
+	}
+
+	resp.UpfPages = toPBUPFPageStats(pageStats)
+	resp.UpfLatency = toPBMetricSummaries(metrics.Summarize(latencyStats...))
+
+	return resp, nil
+}
+
+// getInstanceFunctions Returns the IDs of the functions that the instances belong to, indexed by vmID
+// checkNotFunctionInstance Returns a FailedPrecondition error if the VM is an instance
+// of a function in the function pool
+func checkNotFunctionInstance(vmID string) error {
+	if fID, ok := getInstanceFunctions(funcPool.ListFunctions())[vmID]; ok {
+		return status.Errorf(codes.FailedPrecondition, "VM %s is an instance of function %s, which the function pool manages", vmID, fID)
+	}
+
+	return nil
+}
+
+func getInstanceFunctions(funcs []FunctionInfo) map[string]string {
+	fIDs := make(map[string]string)
+	for _, f := range funcs {
+		for _, inst := range f.Instances {
+			fIDs[inst.VMID] = f.FID
+		}
+	}
+
+	return fIDs
+}
+
+func toPBMetrics(metr *metrics.Metric) []*pb.Metric {
+	if metr == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(metr.MetricMap))
+	for name := range metr.MetricMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pbMetrics := make([]*pb.Metric, 0, len(names))
+	for _, name := range names {
+		pbMetrics = append(pbMetrics, &pb.Metric{Name: name, Value: metr.MetricMap[name]})
+	}
+
+	return pbMetrics
+}
+
+func toPBMetricSummaries(sums map[string]metrics.Summary) []*pb.MetricSummary {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pbSums := make([]*pb.MetricSummary, 0, len(names))
+	for _, name := range names {
+		pbSums = append(pbSums, &pb.MetricSummary{Name: name, Mean: sums[name].Mean, StdDev: sums[name].StdDev})
+	}
+
+	return pbSums
+}
+
+func toPBVM(info ctriface.VMInfo, fID string) *pb.VM {
+	return &pb.VM{
+		Id:      info.ID,
+		Image:   info.ImageName,
+		State:   string(info.State),
+		GuestIp: info.GuestIP,
+		Spec: &pb.VMSpec{
+			VcpuCount:      info.VMSpec.VcpuCount,
+			MemSizeMib:     info.VMSpec.MemSizeMib,
+			KernelArgs:     info.VMSpec.KernelArgs,
+			RootDrive:      info.VMSpec.RootDrive,
+			TimeoutSeconds: info.VMSpec.TimeoutSeconds,
+		},
+		SnapshotId: info.SnapshotID,
+		FunctionId: fID,
+	}
+}
+
+func toPBFunction(info FunctionInfo) *pb.Function {
+	f := &pb.Function{
+		Id:       info.FID,
+		Image:    info.ImageName,
+		IsPinned: info.IsPinned,
+		Served:   info.Served,
+		Queued:   int32(info.Queued),
+	}
+
+	for _, inst := range info.Instances {
+		f.Instances = append(f.Instances, &pb.Instance{
+			VmId:     inst.VMID,
+			State:    inst.State,
+			InFlight: int32(inst.InFlight),
+			Served:   inst.Served,
+		})
+	}
+
+	return f
+}
+
+func toPBSnapshotStoreStats(stats ctriface.SnapshotStoreStats) *pb.SnapshotStoreStats {
+	return &pb.SnapshotStoreStats{
+		QuotaBytes:      stats.QuotaBytes,
+		UsedBytes:       stats.UsedBytes,
+		SharedBytes:     stats.SharedBytes,
+		SharedSnapshots: int32(stats.SharedSnapshots),
+		PinnedSnapshots: int32(stats.PinnedSnapshots),
+		Evictions:       stats.Evictions,
+		EvictedBytes:    stats.EvictedBytes,
+	}
+}
+
+func toPBImageStoreStats(stats ctriface.ImageStoreStats) *pb.ImageStoreStats {
+	return &pb.ImageStoreStats{
+		BudgetBytes:   stats.BudgetBytes,
+		UsedBytes:     stats.UsedBytes,
+		CachedImages:  int32(stats.CachedImages),
+		ActiveImages:  int32(stats.ActiveImages),
+		Pulls:         stats.Pulls,
+		Evictions:     stats.Evictions,
+		PullsInFlight: int32(len(stats.PullsInFlight)),
+	}
+}
+
+func toPBUPFPageStats(stats *manager.UPFPageStats) *pb.UPFPageStats {
+	return &pb.UPFPageStats{
+		IsLazyMode:      stats.IsLazyMode,
+		RecordedPages:   int64(stats.RecordedPages),
+		RecordedRegions: int64(stats.RecordedRegions),
+		ServedPages:     &pb.MetricSummary{Name: "ServedPages", Mean: stats.ServedPagesMean, StdDev: stats.ServedPagesStdDev},
+		ReusedPages:     &pb.MetricSummary{Name: "ReusedPages", Mean: stats.ReusedPagesMean, StdDev: stats.ReusedPagesStdDev},
+		UniquePages:     &pb.MetricSummary{Name: "UniquePages", Mean: stats.UniquePagesMean, StdDev: stats.UniquePagesStdDev},
+	}
+}
@@ -0,0 +1,111 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+	pb "github.com/ease-lab/vhive/proto"
+)
+
+func TestListFunctions(t *testing.T) {
+	p := NewFuncPool(false, 0, 0, true)
+
+	for _, fID := range []string{"list-b", "list-a"} {
+		addTestInstance(p.getFunction(fID, testImageName))
+	}
+
+	f := p.getFunction("list-b", testImageName)
+	inst, _, err := f.acquireInstance(context.Background(), true, metrics.NewMetric())
+	require.NoError(t, err)
+	p.stats.IncInstanceServed(f.fID, inst.vmID)
+
+	infos := p.ListFunctions()
+	require.Len(t, infos, 2)
+	require.Equal(t, "list-a", infos[0].FID, "Functions must be ordered by their IDs")
+
+	info, err := p.GetFunctionInfo("list-b")
+	require.NoError(t, err)
+	require.Equal(t, infos[1], info)
+	require.Equal(t, testImageName, info.ImageName)
+	require.True(t, info.IsPinned, "Functions must be pinned without the memory saving mode")
+	require.Equal(t, []InstanceInfo{{VMID: "list-b-0", State: "running", InFlight: 1, Served: 1}}, info.Instances)
+
+	f.releaseInstance(inst, metrics.NewMetric())
+
+	require.Equal(t, map[string]string{"list-a-0": "list-a", "list-b-0": "list-b"}, getInstanceFunctions(infos))
+
+	_, err = p.GetFunctionInfo("list-c")
+	require.IsType(t, misc.NonExistErr(""), err, "Got a function that does not exist")
+}
+
+func TestDirectVMOpsOnFunctionInstances(t *testing.T) {
+	ctx := context.Background()
+	s := &server{}
+
+	funcPool = NewFuncPool(false, 0, 0, true)
+	addTestInstance(funcPool.getFunction("direct", testImageName))
+
+	for op, call := range map[string]func(*pb.VMReq) error{
+		"PauseVM":        func(in *pb.VMReq) error { _, err := s.PauseVM(ctx, in); return err },
+		"ResumeVM":       func(in *pb.VMReq) error { _, err := s.ResumeVM(ctx, in); return err },
+		"CreateSnapshot": func(in *pb.VMReq) error { _, err := s.CreateSnapshot(ctx, in); return err },
+		"LoadSnapshot":   func(in *pb.VMReq) error { _, err := s.LoadSnapshot(ctx, in); return err },
+		"Offload":        func(in *pb.VMReq) error { _, err := s.Offload(ctx, in); return err },
+	} {
+		err := call(&pb.VMReq{Id: "direct-0"})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err), "%s must reject the instances of the function pool", op)
+	}
+
+	vmID := "direct-vm"
+	_, _, err := orch.StartVM(ctx, vmID, testImageName)
+	require.NoError(t, err, "Failed to start VM")
+	defer func() {
+		require.NoError(t, orch.StopSingleVM(ctx, vmID), "Failed to stop VM")
+	}()
+
+	_, err = s.PauseVM(ctx, &pb.VMReq{Id: vmID})
+	require.NoError(t, err, "Failed to pause VM outside of the function pool")
+	_, err = s.ResumeVM(ctx, &pb.VMReq{Id: vmID})
+	require.NoError(t, err, "Failed to resume VM outside of the function pool")
+}
+
+func TestToPBMetrics(t *testing.T) {
+	metr := metrics.NewMetric()
+	metr.MetricMap[metrics.LoadVMM] = 2
+	metr.MetricMap[metrics.FcResume] = 1
+
+	require.Equal(t, []*pb.Metric{
+		{Name: metrics.FcResume, Value: 1},
+		{Name: metrics.LoadVMM, Value: 2},
+	}, toPBMetrics(metr), "Metrics must be ordered by their names")
+
+	require.Nil(t, toPBMetrics(nil))
+}
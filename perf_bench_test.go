@@ -592,6 +592,8 @@ func dumpMetrics(t *testing.T, metrics []map[string]float64, outfile string) {
 		require.NoError(t, err, "Failed writting file")
 		writer.Flush()
 	}
+
+	exportMetricMaps(t, *funcNames, outfile, metrics)
 }
 
 // getCloseLoopRPS returns the number of requests per second that stress CPU for each image.
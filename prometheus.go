@@ -0,0 +1,226 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	ctriface "github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/taps"
+)
+
+const (
+	// vmActive The VM serves requests, or runs a function outside of the function pool
+	vmActive = "active"
+	// vmIdle The VM is an instance without in-flight requests, or is paused
+	vmIdle = "idle"
+	// vmOffloaded The VM is offloaded
+	vmOffloaded = "offloaded"
+)
+
+// phaseBuckets Buckets of the phase latencies, from 100us to about a minute
+var phaseBuckets = prometheus.ExponentialBuckets(0.0001, 2, 20)
+
+// promExporter Exports the metrics of the daemon in the Prometheus format
+type promExporter struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	phases   *prometheus.HistogramVec
+}
+
+// newPromExporter Initializes an exporter with the request metrics and the metrics of the Go runtime
+func newPromExporter() *promExporter {
+	e := &promExporter{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "vhive_requests_total",
+			Help: "Requests served by the function pool, by whether they cold-started an instance.",
+		}, []string{"image", "start"}),
+		phases: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "vhive_phase_duration_seconds",
+			Help:    "Latency of the phases of the requests served by the function pool and of the stops of their instances, e.g., GetImage, LoadVMM, FuncInvocation or FcStopVM.",
+			Buckets: phaseBuckets,
+		}, []string{"image", "phase"}),
+	}
+
+	e.registry.MustRegister(
+		e.requests,
+		e.phases,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	return e
+}
+
+// observeRequest Counts a request as a cold or a warm start and records the latency of its phases
+func (e *promExporter) observeRequest(imageName string, isColdStart bool, metr *metrics.Metric) {
+	if e == nil {
+		return
+	}
+
+	start := "warm"
+	if isColdStart {
+		start = "cold"
+	}
+	e.requests.WithLabelValues(imageName, start).Inc()
+
+	e.observePhases(imageName, metr)
+}
+
+// observeStop Records the latency of the phases of stopping an instance, e.g., DrainRPCs or FcStopVM
+func (e *promExporter) observeStop(imageName string, metr *metrics.Metric) {
+	if e == nil {
+		return
+	}
+
+	e.observePhases(imageName, metr)
+}
+
+func (e *promExporter) observePhases(imageName string, metr *metrics.Metric) {
+	if metr == nil {
+		return
+	}
+
+	for phase, us := range metr.MetricMap {
+		e.phases.WithLabelValues(imageName, phase).Observe(us / 1000000)
+	}
+}
+
+// registerState Exports the state of the VMs, the taps and the page faults
+func (e *promExporter) registerState(o *ctriface.Orchestrator, p *FuncPool) {
+	e.registry.MustRegister(newStateCollector(o, p))
+}
+
+func (e *promExporter) handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+}
+
+// stateCollector Collects the state of the orchestrator and the function pool on every scrape
+type stateCollector struct {
+	orch *ctriface.Orchestrator
+	pool *FuncPool
+
+	vms             *prometheus.Desc
+	taps            *prometheus.Desc
+	pageFaults      *prometheus.Desc
+	workingSetPages *prometheus.Desc
+}
+
+func newStateCollector(o *ctriface.Orchestrator, p *FuncPool) *stateCollector {
+	return &stateCollector{
+		orch: o,
+		pool: p,
+		vms: prometheus.NewDesc("vhive_vms",
+			"VMs per image that are active (serving requests), idle (instances without requests or paused VMs) or offloaded.",
+			[]string{"image", "state"}, nil),
+		taps: prometheus.NewDesc("vhive_taps",
+			"Taps of the VMs attached to each bridge.",
+			[]string{"bridge"}, nil),
+		pageFaults: prometheus.NewDesc("vhive_upf_page_faults_total",
+			"Page faults served by the memory manager one page at a time.",
+			nil, nil),
+		workingSetPages: prometheus.NewDesc("vhive_upf_working_set_pages_total",
+			"Pages installed by the memory manager from the recorded working sets ahead of the page faults.",
+			nil, nil),
+	}
+}
+
+// Describe Implements prometheus.Collector
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.vms
+	ch <- c.taps
+	ch <- c.pageFaults
+	ch <- c.workingSetPages
+}
+
+// Collect Implements prometheus.Collector
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	vms, bridges := countVMs(c.orch.ListVMs(), c.pool.ListFunctions())
+
+	for imageName, states := range vms {
+		for state, num := range states {
+			ch <- prometheus.MustNewConstMetric(c.vms, prometheus.GaugeValue, num, imageName, state)
+		}
+	}
+
+	for bridge, num := range bridges {
+		ch <- prometheus.MustNewConstMetric(c.taps, prometheus.GaugeValue, num, bridge)
+	}
+
+	pf := c.orch.GetPageFaultCounts()
+	ch <- prometheus.MustNewConstMetric(c.pageFaults, prometheus.CounterValue, float64(pf.Served))
+	ch <- prometheus.MustNewConstMetric(c.workingSetPages, prometheus.CounterValue, float64(pf.WorkingSetPages))
+}
+
+// countVMs Returns the number of the VMs per image and state,
+// and the number of the taps per bridge
+func countVMs(vms []ctriface.VMInfo, functions []FunctionInfo) (map[string]map[string]float64, map[string]float64) {
+	inFlight := make(map[string]int)
+	for _, f := range functions {
+		for _, inst := range f.Instances {
+			inFlight[inst.VMID] = inst.InFlight
+		}
+	}
+
+	byImage := make(map[string]map[string]float64)
+	byBridge := make(map[string]float64)
+
+	for _, bridge := range taps.BridgeNames() {
+		byBridge[bridge] = 0
+	}
+
+	for _, vm := range vms {
+		if _, ok := byImage[vm.ImageName]; !ok {
+			byImage[vm.ImageName] = map[string]float64{vmActive: 0, vmIdle: 0, vmOffloaded: 0}
+		}
+		byImage[vm.ImageName][vmLoad(vm, inFlight)]++
+
+		if vm.Bridge != "" {
+			byBridge[vm.Bridge]++
+		}
+	}
+
+	return byImage, byBridge
+}
+
+// vmLoad Returns whether a VM is active, idle or offloaded. The running VMs that are
+// not instances of the function pool, e.g., those of the CRI service, are active.
+func vmLoad(vm ctriface.VMInfo, inFlight map[string]int) string {
+	switch vm.State {
+	case ctriface.VMOffloaded:
+		return vmOffloaded
+	case ctriface.VMPaused:
+		return vmIdle
+	}
+
+	if n, ok := inFlight[vm.ID]; ok && n == 0 {
+		return vmIdle
+	}
+
+	return vmActive
+}
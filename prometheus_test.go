@@ -0,0 +1,103 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	ctriface "github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/metrics"
+)
+
+func TestPromObserveRequest(t *testing.T) {
+	e := newPromExporter()
+
+	metr := metrics.NewMetric()
+	metr.MetricMap[metrics.GetImage] = 2000000
+	metr.MetricMap[metrics.FuncInvocation] = 1500
+
+	e.observeRequest(testImageName, true, metr)
+	e.observeRequest(testImageName, false, nil)
+	e.observeRequest(testImageName, false, nil)
+
+	require.Equal(t, 1.0, testutil.ToFloat64(e.requests.WithLabelValues(testImageName, "cold")))
+	require.Equal(t, 2.0, testutil.ToFloat64(e.requests.WithLabelValues(testImageName, "warm")))
+	require.Equal(t, 2, testutil.CollectAndCount(e.phases), "Each phase must have a histogram")
+
+	rec := httptest.NewRecorder()
+	e.handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(rec.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `vhive_phase_duration_seconds_sum{image="`+testImageName+`",phase="GetImage"} 2`)
+	require.Contains(t, string(body), `vhive_phase_duration_seconds_count{image="`+testImageName+`",phase="FuncInvocation"} 1`)
+	require.Contains(t, string(body), "go_goroutines")
+
+	var nilExporter *promExporter
+	require.NotPanics(t, func() { nilExporter.observeRequest(testImageName, true, metr) })
+}
+
+func TestPromObserveStop(t *testing.T) {
+	e := newPromExporter()
+
+	metr := metrics.NewMetric()
+	metr.MetricMap[metrics.DrainRPCs] = 500
+	metr.MetricMap[metrics.FcStopVM] = 300000
+
+	e.observeStop(testImageName, metr)
+
+	require.Equal(t, 0, testutil.CollectAndCount(e.requests), "A stop is not a request")
+	require.Equal(t, 2, testutil.CollectAndCount(e.phases), "Each phase of the stop must have a histogram")
+
+	var nilExporter *promExporter
+	require.NotPanics(t, func() { nilExporter.observeStop(testImageName, metr) })
+}
+
+func TestCountVMs(t *testing.T) {
+	vms := []ctriface.VMInfo{
+		{ID: "0-0", ImageName: "a", Bridge: "br0", State: ctriface.VMRunning},
+		{ID: "0-1", ImageName: "a", Bridge: "br0", State: ctriface.VMRunning},
+		{ID: "1-0", ImageName: "a", Bridge: "br1", State: ctriface.VMOffloaded},
+		{ID: "cri", ImageName: "b", Bridge: "br0", State: ctriface.VMRunning},
+		{ID: "warm", ImageName: "b", Bridge: "br0", State: ctriface.VMPaused},
+	}
+	functions := []FunctionInfo{
+		{FID: "0", Instances: []InstanceInfo{{VMID: "0-0", InFlight: 2}, {VMID: "0-1"}}},
+		{FID: "1", Instances: []InstanceInfo{{VMID: "1-0", State: "offloaded"}}},
+	}
+
+	byImage, byBridge := countVMs(vms, functions)
+
+	require.Equal(t, map[string]map[string]float64{
+		"a": {vmActive: 1, vmIdle: 1, vmOffloaded: 1},
+		"b": {vmActive: 1, vmIdle: 1, vmOffloaded: 0},
+	}, byImage)
+	require.Equal(t, map[string]float64{"br0": 4, "br1": 1}, byBridge)
+
+	_, byBridge = countVMs(nil, nil)
+	require.Equal(t, map[string]float64{"br0": 0, "br1": 0}, byBridge, "All bridges must be reported")
+}
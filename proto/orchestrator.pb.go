@@ -212,50 +212,1069 @@ func (m *Status) GetMessage() string {
 }
 
 type StartVMResp struct {
-	Message              string   `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
-	Profile              string   `protobuf:"bytes,2,opt,name=profile,proto3" json:"profile,omitempty"`
+	Message string `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Profile string `protobuf:"bytes,2,opt,name=profile,proto3" json:"profile,omitempty"`
+	// Latency breakdown of the first request, in microseconds
+	Metrics              []*Metric `protobuf:"bytes,3,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *StartVMResp) Reset()         { *m = StartVMResp{} }
+func (m *StartVMResp) String() string { return proto.CompactTextString(m) }
+func (*StartVMResp) ProtoMessage()    {}
+func (*StartVMResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{4}
+}
+
+func (m *StartVMResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StartVMResp.Unmarshal(m, b)
+}
+func (m *StartVMResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StartVMResp.Marshal(b, m, deterministic)
+}
+func (m *StartVMResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StartVMResp.Merge(m, src)
+}
+func (m *StartVMResp) XXX_Size() int {
+	return xxx_messageInfo_StartVMResp.Size(m)
+}
+func (m *StartVMResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_StartVMResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StartVMResp proto.InternalMessageInfo
+
+func (m *StartVMResp) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *StartVMResp) GetProfile() string {
+	if m != nil {
+		return m.Profile
+	}
+	return ""
+}
+
+func (m *StartVMResp) GetMetrics() []*Metric {
+	if m != nil {
+		return m.Metrics
+	}
+	return nil
+}
+
+type VMReq struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *VMReq) Reset()         { *m = VMReq{} }
+func (m *VMReq) String() string { return proto.CompactTextString(m) }
+func (*VMReq) ProtoMessage()    {}
+func (*VMReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{5}
+}
+
+func (m *VMReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_VMReq.Unmarshal(m, b)
+}
+func (m *VMReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_VMReq.Marshal(b, m, deterministic)
+}
+func (m *VMReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_VMReq.Merge(m, src)
+}
+func (m *VMReq) XXX_Size() int {
+	return xxx_messageInfo_VMReq.Size(m)
+}
+func (m *VMReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_VMReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_VMReq proto.InternalMessageInfo
+
+func (m *VMReq) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type Metric struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value                float64  `protobuf:"fixed64,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Metric) Reset()         { *m = Metric{} }
+func (m *Metric) String() string { return proto.CompactTextString(m) }
+func (*Metric) ProtoMessage()    {}
+func (*Metric) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{6}
+}
+
+func (m *Metric) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Metric.Unmarshal(m, b)
+}
+func (m *Metric) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Metric.Marshal(b, m, deterministic)
+}
+func (m *Metric) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Metric.Merge(m, src)
+}
+func (m *Metric) XXX_Size() int {
+	return xxx_messageInfo_Metric.Size(m)
+}
+func (m *Metric) XXX_DiscardUnknown() {
+	xxx_messageInfo_Metric.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Metric proto.InternalMessageInfo
+
+func (m *Metric) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Metric) GetValue() float64 {
+	if m != nil {
+		return m.Value
+	}
+	return 0
+}
+
+type VMOpResp struct {
+	Message string `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// Latency breakdown of the operation, in microseconds
+	Metrics              []*Metric `protobuf:"bytes,2,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *VMOpResp) Reset()         { *m = VMOpResp{} }
+func (m *VMOpResp) String() string { return proto.CompactTextString(m) }
+func (*VMOpResp) ProtoMessage()    {}
+func (*VMOpResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{7}
+}
+
+func (m *VMOpResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_VMOpResp.Unmarshal(m, b)
+}
+func (m *VMOpResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_VMOpResp.Marshal(b, m, deterministic)
+}
+func (m *VMOpResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_VMOpResp.Merge(m, src)
+}
+func (m *VMOpResp) XXX_Size() int {
+	return xxx_messageInfo_VMOpResp.Size(m)
+}
+func (m *VMOpResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_VMOpResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_VMOpResp proto.InternalMessageInfo
+
+func (m *VMOpResp) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *VMOpResp) GetMetrics() []*Metric {
+	if m != nil {
+		return m.Metrics
+	}
+	return nil
+}
+
+type VMSpec struct {
+	VcpuCount            uint32   `protobuf:"varint,1,opt,name=vcpu_count,json=vcpuCount,proto3" json:"vcpu_count,omitempty"`
+	MemSizeMib           uint32   `protobuf:"varint,2,opt,name=mem_size_mib,json=memSizeMib,proto3" json:"mem_size_mib,omitempty"`
+	KernelArgs           string   `protobuf:"bytes,3,opt,name=kernel_args,json=kernelArgs,proto3" json:"kernel_args,omitempty"`
+	RootDrive            string   `protobuf:"bytes,4,opt,name=root_drive,json=rootDrive,proto3" json:"root_drive,omitempty"`
+	TimeoutSeconds       uint32   `protobuf:"varint,5,opt,name=timeout_seconds,json=timeoutSeconds,proto3" json:"timeout_seconds,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *StartVMResp) Reset()         { *m = StartVMResp{} }
-func (m *StartVMResp) String() string { return proto.CompactTextString(m) }
-func (*StartVMResp) ProtoMessage()    {}
-func (*StartVMResp) Descriptor() ([]byte, []int) {
-	return fileDescriptor_96b6e6782baaa298, []int{4}
+func (m *VMSpec) Reset()         { *m = VMSpec{} }
+func (m *VMSpec) String() string { return proto.CompactTextString(m) }
+func (*VMSpec) ProtoMessage()    {}
+func (*VMSpec) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{8}
+}
+
+func (m *VMSpec) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_VMSpec.Unmarshal(m, b)
+}
+func (m *VMSpec) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_VMSpec.Marshal(b, m, deterministic)
+}
+func (m *VMSpec) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_VMSpec.Merge(m, src)
+}
+func (m *VMSpec) XXX_Size() int {
+	return xxx_messageInfo_VMSpec.Size(m)
+}
+func (m *VMSpec) XXX_DiscardUnknown() {
+	xxx_messageInfo_VMSpec.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_VMSpec proto.InternalMessageInfo
+
+func (m *VMSpec) GetVcpuCount() uint32 {
+	if m != nil {
+		return m.VcpuCount
+	}
+	return 0
+}
+
+func (m *VMSpec) GetMemSizeMib() uint32 {
+	if m != nil {
+		return m.MemSizeMib
+	}
+	return 0
+}
+
+func (m *VMSpec) GetKernelArgs() string {
+	if m != nil {
+		return m.KernelArgs
+	}
+	return ""
+}
+
+func (m *VMSpec) GetRootDrive() string {
+	if m != nil {
+		return m.RootDrive
+	}
+	return ""
+}
+
+func (m *VMSpec) GetTimeoutSeconds() uint32 {
+	if m != nil {
+		return m.TimeoutSeconds
+	}
+	return 0
+}
+
+type VM struct {
+	Id    string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Image string `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	// running, paused or offloaded
+	State   string  `protobuf:"bytes,3,opt,name=state,proto3" json:"state,omitempty"`
+	GuestIp string  `protobuf:"bytes,4,opt,name=guest_ip,json=guestIp,proto3" json:"guest_ip,omitempty"`
+	Spec    *VMSpec `protobuf:"bytes,5,opt,name=spec,proto3" json:"spec,omitempty"`
+	// Shared snapshot that the VM was started from or published, if any
+	SnapshotId string `protobuf:"bytes,6,opt,name=snapshot_id,json=snapshotId,proto3" json:"snapshot_id,omitempty"`
+	// Function of the function pool that the VM is an instance of, if any
+	FunctionId           string   `protobuf:"bytes,7,opt,name=function_id,json=functionId,proto3" json:"function_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *VM) Reset()         { *m = VM{} }
+func (m *VM) String() string { return proto.CompactTextString(m) }
+func (*VM) ProtoMessage()    {}
+func (*VM) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{9}
+}
+
+func (m *VM) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_VM.Unmarshal(m, b)
+}
+func (m *VM) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_VM.Marshal(b, m, deterministic)
+}
+func (m *VM) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_VM.Merge(m, src)
+}
+func (m *VM) XXX_Size() int {
+	return xxx_messageInfo_VM.Size(m)
+}
+func (m *VM) XXX_DiscardUnknown() {
+	xxx_messageInfo_VM.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_VM proto.InternalMessageInfo
+
+func (m *VM) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *VM) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *VM) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *VM) GetGuestIp() string {
+	if m != nil {
+		return m.GuestIp
+	}
+	return ""
+}
+
+func (m *VM) GetSpec() *VMSpec {
+	if m != nil {
+		return m.Spec
+	}
+	return nil
+}
+
+func (m *VM) GetSnapshotId() string {
+	if m != nil {
+		return m.SnapshotId
+	}
+	return ""
+}
+
+func (m *VM) GetFunctionId() string {
+	if m != nil {
+		return m.FunctionId
+	}
+	return ""
+}
+
+type ListVMsReq struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListVMsReq) Reset()         { *m = ListVMsReq{} }
+func (m *ListVMsReq) String() string { return proto.CompactTextString(m) }
+func (*ListVMsReq) ProtoMessage()    {}
+func (*ListVMsReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{10}
+}
+
+func (m *ListVMsReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListVMsReq.Unmarshal(m, b)
+}
+func (m *ListVMsReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListVMsReq.Marshal(b, m, deterministic)
+}
+func (m *ListVMsReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListVMsReq.Merge(m, src)
+}
+func (m *ListVMsReq) XXX_Size() int {
+	return xxx_messageInfo_ListVMsReq.Size(m)
+}
+func (m *ListVMsReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListVMsReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListVMsReq proto.InternalMessageInfo
+
+type ListVMsResp struct {
+	Vms                  []*VM    `protobuf:"bytes,1,rep,name=vms,proto3" json:"vms,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListVMsResp) Reset()         { *m = ListVMsResp{} }
+func (m *ListVMsResp) String() string { return proto.CompactTextString(m) }
+func (*ListVMsResp) ProtoMessage()    {}
+func (*ListVMsResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{11}
+}
+
+func (m *ListVMsResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListVMsResp.Unmarshal(m, b)
+}
+func (m *ListVMsResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListVMsResp.Marshal(b, m, deterministic)
+}
+func (m *ListVMsResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListVMsResp.Merge(m, src)
+}
+func (m *ListVMsResp) XXX_Size() int {
+	return xxx_messageInfo_ListVMsResp.Size(m)
+}
+func (m *ListVMsResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListVMsResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListVMsResp proto.InternalMessageInfo
+
+func (m *ListVMsResp) GetVms() []*VM {
+	if m != nil {
+		return m.Vms
+	}
+	return nil
+}
+
+type Instance struct {
+	VmId string `protobuf:"bytes,1,opt,name=vm_id,json=vmId,proto3" json:"vm_id,omitempty"`
+	// starting, running or offloaded
+	State                string   `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	InFlight             int32    `protobuf:"varint,3,opt,name=in_flight,json=inFlight,proto3" json:"in_flight,omitempty"`
+	Served               uint64   `protobuf:"varint,4,opt,name=served,proto3" json:"served,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Instance) Reset()         { *m = Instance{} }
+func (m *Instance) String() string { return proto.CompactTextString(m) }
+func (*Instance) ProtoMessage()    {}
+func (*Instance) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{12}
+}
+
+func (m *Instance) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Instance.Unmarshal(m, b)
+}
+func (m *Instance) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Instance.Marshal(b, m, deterministic)
+}
+func (m *Instance) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Instance.Merge(m, src)
+}
+func (m *Instance) XXX_Size() int {
+	return xxx_messageInfo_Instance.Size(m)
+}
+func (m *Instance) XXX_DiscardUnknown() {
+	xxx_messageInfo_Instance.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Instance proto.InternalMessageInfo
+
+func (m *Instance) GetVmId() string {
+	if m != nil {
+		return m.VmId
+	}
+	return ""
+}
+
+func (m *Instance) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *Instance) GetInFlight() int32 {
+	if m != nil {
+		return m.InFlight
+	}
+	return 0
+}
+
+func (m *Instance) GetServed() uint64 {
+	if m != nil {
+		return m.Served
+	}
+	return 0
+}
+
+type Function struct {
+	Id       string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Image    string `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	IsPinned bool   `protobuf:"varint,3,opt,name=is_pinned,json=isPinned,proto3" json:"is_pinned,omitempty"`
+	Served   uint64 `protobuf:"varint,4,opt,name=served,proto3" json:"served,omitempty"`
+	// Number of the requests that wait for an instance
+	Queued               int32       `protobuf:"varint,5,opt,name=queued,proto3" json:"queued,omitempty"`
+	Instances            []*Instance `protobuf:"bytes,6,rep,name=instances,proto3" json:"instances,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *Function) Reset()         { *m = Function{} }
+func (m *Function) String() string { return proto.CompactTextString(m) }
+func (*Function) ProtoMessage()    {}
+func (*Function) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{13}
+}
+
+func (m *Function) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Function.Unmarshal(m, b)
+}
+func (m *Function) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Function.Marshal(b, m, deterministic)
+}
+func (m *Function) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Function.Merge(m, src)
+}
+func (m *Function) XXX_Size() int {
+	return xxx_messageInfo_Function.Size(m)
+}
+func (m *Function) XXX_DiscardUnknown() {
+	xxx_messageInfo_Function.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Function proto.InternalMessageInfo
+
+func (m *Function) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Function) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *Function) GetIsPinned() bool {
+	if m != nil {
+		return m.IsPinned
+	}
+	return false
+}
+
+func (m *Function) GetServed() uint64 {
+	if m != nil {
+		return m.Served
+	}
+	return 0
+}
+
+func (m *Function) GetQueued() int32 {
+	if m != nil {
+		return m.Queued
+	}
+	return 0
+}
+
+func (m *Function) GetInstances() []*Instance {
+	if m != nil {
+		return m.Instances
+	}
+	return nil
+}
+
+type ListFunctionsReq struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListFunctionsReq) Reset()         { *m = ListFunctionsReq{} }
+func (m *ListFunctionsReq) String() string { return proto.CompactTextString(m) }
+func (*ListFunctionsReq) ProtoMessage()    {}
+func (*ListFunctionsReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{14}
+}
+
+func (m *ListFunctionsReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFunctionsReq.Unmarshal(m, b)
+}
+func (m *ListFunctionsReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFunctionsReq.Marshal(b, m, deterministic)
+}
+func (m *ListFunctionsReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFunctionsReq.Merge(m, src)
+}
+func (m *ListFunctionsReq) XXX_Size() int {
+	return xxx_messageInfo_ListFunctionsReq.Size(m)
+}
+func (m *ListFunctionsReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFunctionsReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFunctionsReq proto.InternalMessageInfo
+
+type ListFunctionsResp struct {
+	Functions            []*Function `protobuf:"bytes,1,rep,name=functions,proto3" json:"functions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *ListFunctionsResp) Reset()         { *m = ListFunctionsResp{} }
+func (m *ListFunctionsResp) String() string { return proto.CompactTextString(m) }
+func (*ListFunctionsResp) ProtoMessage()    {}
+func (*ListFunctionsResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{15}
+}
+
+func (m *ListFunctionsResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFunctionsResp.Unmarshal(m, b)
+}
+func (m *ListFunctionsResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFunctionsResp.Marshal(b, m, deterministic)
+}
+func (m *ListFunctionsResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFunctionsResp.Merge(m, src)
+}
+func (m *ListFunctionsResp) XXX_Size() int {
+	return xxx_messageInfo_ListFunctionsResp.Size(m)
+}
+func (m *ListFunctionsResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFunctionsResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFunctionsResp proto.InternalMessageInfo
+
+func (m *ListFunctionsResp) GetFunctions() []*Function {
+	if m != nil {
+		return m.Functions
+	}
+	return nil
+}
+
+type GetStatsReq struct {
+	// Function to get the stats of, all functions if empty
+	FunctionId string `protobuf:"bytes,1,opt,name=function_id,json=functionId,proto3" json:"function_id,omitempty"`
+	// Get the UPF stats of the function, whose instance must be offloaded, in the UPF metrics mode
+	Upf                  bool     `protobuf:"varint,2,opt,name=upf,proto3" json:"upf,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetStatsReq) Reset()         { *m = GetStatsReq{} }
+func (m *GetStatsReq) String() string { return proto.CompactTextString(m) }
+func (*GetStatsReq) ProtoMessage()    {}
+func (*GetStatsReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{16}
+}
+
+func (m *GetStatsReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetStatsReq.Unmarshal(m, b)
+}
+func (m *GetStatsReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetStatsReq.Marshal(b, m, deterministic)
+}
+func (m *GetStatsReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetStatsReq.Merge(m, src)
+}
+func (m *GetStatsReq) XXX_Size() int {
+	return xxx_messageInfo_GetStatsReq.Size(m)
+}
+func (m *GetStatsReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetStatsReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetStatsReq proto.InternalMessageInfo
+
+func (m *GetStatsReq) GetFunctionId() string {
+	if m != nil {
+		return m.FunctionId
+	}
+	return ""
+}
+
+func (m *GetStatsReq) GetUpf() bool {
+	if m != nil {
+		return m.Upf
+	}
+	return false
+}
+
+type MetricSummary struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Mean                 float64  `protobuf:"fixed64,2,opt,name=mean,proto3" json:"mean,omitempty"`
+	StdDev               float64  `protobuf:"fixed64,3,opt,name=std_dev,json=stdDev,proto3" json:"std_dev,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MetricSummary) Reset()         { *m = MetricSummary{} }
+func (m *MetricSummary) String() string { return proto.CompactTextString(m) }
+func (*MetricSummary) ProtoMessage()    {}
+func (*MetricSummary) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{17}
+}
+
+func (m *MetricSummary) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MetricSummary.Unmarshal(m, b)
+}
+func (m *MetricSummary) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MetricSummary.Marshal(b, m, deterministic)
+}
+func (m *MetricSummary) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetricSummary.Merge(m, src)
+}
+func (m *MetricSummary) XXX_Size() int {
+	return xxx_messageInfo_MetricSummary.Size(m)
+}
+func (m *MetricSummary) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetricSummary.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetricSummary proto.InternalMessageInfo
+
+func (m *MetricSummary) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *MetricSummary) GetMean() float64 {
+	if m != nil {
+		return m.Mean
+	}
+	return 0
+}
+
+func (m *MetricSummary) GetStdDev() float64 {
+	if m != nil {
+		return m.StdDev
+	}
+	return 0
+}
+
+type SnapshotStoreStats struct {
+	QuotaBytes           int64    `protobuf:"varint,1,opt,name=quota_bytes,json=quotaBytes,proto3" json:"quota_bytes,omitempty"`
+	UsedBytes            int64    `protobuf:"varint,2,opt,name=used_bytes,json=usedBytes,proto3" json:"used_bytes,omitempty"`
+	SharedBytes          int64    `protobuf:"varint,3,opt,name=shared_bytes,json=sharedBytes,proto3" json:"shared_bytes,omitempty"`
+	SharedSnapshots      int32    `protobuf:"varint,4,opt,name=shared_snapshots,json=sharedSnapshots,proto3" json:"shared_snapshots,omitempty"`
+	PinnedSnapshots      int32    `protobuf:"varint,5,opt,name=pinned_snapshots,json=pinnedSnapshots,proto3" json:"pinned_snapshots,omitempty"`
+	Evictions            uint64   `protobuf:"varint,6,opt,name=evictions,proto3" json:"evictions,omitempty"`
+	EvictedBytes         int64    `protobuf:"varint,7,opt,name=evicted_bytes,json=evictedBytes,proto3" json:"evicted_bytes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SnapshotStoreStats) Reset()         { *m = SnapshotStoreStats{} }
+func (m *SnapshotStoreStats) String() string { return proto.CompactTextString(m) }
+func (*SnapshotStoreStats) ProtoMessage()    {}
+func (*SnapshotStoreStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{18}
+}
+
+func (m *SnapshotStoreStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SnapshotStoreStats.Unmarshal(m, b)
+}
+func (m *SnapshotStoreStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SnapshotStoreStats.Marshal(b, m, deterministic)
+}
+func (m *SnapshotStoreStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SnapshotStoreStats.Merge(m, src)
+}
+func (m *SnapshotStoreStats) XXX_Size() int {
+	return xxx_messageInfo_SnapshotStoreStats.Size(m)
+}
+func (m *SnapshotStoreStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_SnapshotStoreStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SnapshotStoreStats proto.InternalMessageInfo
+
+func (m *SnapshotStoreStats) GetQuotaBytes() int64 {
+	if m != nil {
+		return m.QuotaBytes
+	}
+	return 0
+}
+
+func (m *SnapshotStoreStats) GetUsedBytes() int64 {
+	if m != nil {
+		return m.UsedBytes
+	}
+	return 0
+}
+
+func (m *SnapshotStoreStats) GetSharedBytes() int64 {
+	if m != nil {
+		return m.SharedBytes
+	}
+	return 0
+}
+
+func (m *SnapshotStoreStats) GetSharedSnapshots() int32 {
+	if m != nil {
+		return m.SharedSnapshots
+	}
+	return 0
+}
+
+func (m *SnapshotStoreStats) GetPinnedSnapshots() int32 {
+	if m != nil {
+		return m.PinnedSnapshots
+	}
+	return 0
+}
+
+func (m *SnapshotStoreStats) GetEvictions() uint64 {
+	if m != nil {
+		return m.Evictions
+	}
+	return 0
+}
+
+func (m *SnapshotStoreStats) GetEvictedBytes() int64 {
+	if m != nil {
+		return m.EvictedBytes
+	}
+	return 0
+}
+
+type ImageStoreStats struct {
+	BudgetBytes          int64    `protobuf:"varint,1,opt,name=budget_bytes,json=budgetBytes,proto3" json:"budget_bytes,omitempty"`
+	UsedBytes            int64    `protobuf:"varint,2,opt,name=used_bytes,json=usedBytes,proto3" json:"used_bytes,omitempty"`
+	CachedImages         int32    `protobuf:"varint,3,opt,name=cached_images,json=cachedImages,proto3" json:"cached_images,omitempty"`
+	ActiveImages         int32    `protobuf:"varint,4,opt,name=active_images,json=activeImages,proto3" json:"active_images,omitempty"`
+	Pulls                uint64   `protobuf:"varint,5,opt,name=pulls,proto3" json:"pulls,omitempty"`
+	Evictions            uint64   `protobuf:"varint,6,opt,name=evictions,proto3" json:"evictions,omitempty"`
+	PullsInFlight        int32    `protobuf:"varint,7,opt,name=pulls_in_flight,json=pullsInFlight,proto3" json:"pulls_in_flight,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ImageStoreStats) Reset()         { *m = ImageStoreStats{} }
+func (m *ImageStoreStats) String() string { return proto.CompactTextString(m) }
+func (*ImageStoreStats) ProtoMessage()    {}
+func (*ImageStoreStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{19}
+}
+
+func (m *ImageStoreStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ImageStoreStats.Unmarshal(m, b)
+}
+func (m *ImageStoreStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ImageStoreStats.Marshal(b, m, deterministic)
+}
+func (m *ImageStoreStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ImageStoreStats.Merge(m, src)
+}
+func (m *ImageStoreStats) XXX_Size() int {
+	return xxx_messageInfo_ImageStoreStats.Size(m)
+}
+func (m *ImageStoreStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_ImageStoreStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ImageStoreStats proto.InternalMessageInfo
+
+func (m *ImageStoreStats) GetBudgetBytes() int64 {
+	if m != nil {
+		return m.BudgetBytes
+	}
+	return 0
+}
+
+func (m *ImageStoreStats) GetUsedBytes() int64 {
+	if m != nil {
+		return m.UsedBytes
+	}
+	return 0
+}
+
+func (m *ImageStoreStats) GetCachedImages() int32 {
+	if m != nil {
+		return m.CachedImages
+	}
+	return 0
+}
+
+func (m *ImageStoreStats) GetActiveImages() int32 {
+	if m != nil {
+		return m.ActiveImages
+	}
+	return 0
+}
+
+func (m *ImageStoreStats) GetPulls() uint64 {
+	if m != nil {
+		return m.Pulls
+	}
+	return 0
+}
+
+func (m *ImageStoreStats) GetEvictions() uint64 {
+	if m != nil {
+		return m.Evictions
+	}
+	return 0
+}
+
+func (m *ImageStoreStats) GetPullsInFlight() int32 {
+	if m != nil {
+		return m.PullsInFlight
+	}
+	return 0
+}
+
+type UPFPageStats struct {
+	IsLazyMode      bool  `protobuf:"varint,1,opt,name=is_lazy_mode,json=isLazyMode,proto3" json:"is_lazy_mode,omitempty"`
+	RecordedPages   int64 `protobuf:"varint,2,opt,name=recorded_pages,json=recordedPages,proto3" json:"recorded_pages,omitempty"`
+	RecordedRegions int64 `protobuf:"varint,3,opt,name=recorded_regions,json=recordedRegions,proto3" json:"recorded_regions,omitempty"`
+	// Lazy mode only
+	ServedPages *MetricSummary `protobuf:"bytes,4,opt,name=served_pages,json=servedPages,proto3" json:"served_pages,omitempty"`
+	// Lazy mode only
+	ReusedPages          *MetricSummary `protobuf:"bytes,5,opt,name=reused_pages,json=reusedPages,proto3" json:"reused_pages,omitempty"`
+	UniquePages          *MetricSummary `protobuf:"bytes,6,opt,name=unique_pages,json=uniquePages,proto3" json:"unique_pages,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *UPFPageStats) Reset()         { *m = UPFPageStats{} }
+func (m *UPFPageStats) String() string { return proto.CompactTextString(m) }
+func (*UPFPageStats) ProtoMessage()    {}
+func (*UPFPageStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{20}
+}
+
+func (m *UPFPageStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UPFPageStats.Unmarshal(m, b)
+}
+func (m *UPFPageStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UPFPageStats.Marshal(b, m, deterministic)
+}
+func (m *UPFPageStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UPFPageStats.Merge(m, src)
+}
+func (m *UPFPageStats) XXX_Size() int {
+	return xxx_messageInfo_UPFPageStats.Size(m)
+}
+func (m *UPFPageStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_UPFPageStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UPFPageStats proto.InternalMessageInfo
+
+func (m *UPFPageStats) GetIsLazyMode() bool {
+	if m != nil {
+		return m.IsLazyMode
+	}
+	return false
+}
+
+func (m *UPFPageStats) GetRecordedPages() int64 {
+	if m != nil {
+		return m.RecordedPages
+	}
+	return 0
+}
+
+func (m *UPFPageStats) GetRecordedRegions() int64 {
+	if m != nil {
+		return m.RecordedRegions
+	}
+	return 0
 }
 
-func (m *StartVMResp) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_StartVMResp.Unmarshal(m, b)
+func (m *UPFPageStats) GetServedPages() *MetricSummary {
+	if m != nil {
+		return m.ServedPages
+	}
+	return nil
 }
-func (m *StartVMResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_StartVMResp.Marshal(b, m, deterministic)
+
+func (m *UPFPageStats) GetReusedPages() *MetricSummary {
+	if m != nil {
+		return m.ReusedPages
+	}
+	return nil
 }
-func (m *StartVMResp) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_StartVMResp.Merge(m, src)
+
+func (m *UPFPageStats) GetUniquePages() *MetricSummary {
+	if m != nil {
+		return m.UniquePages
+	}
+	return nil
 }
-func (m *StartVMResp) XXX_Size() int {
-	return xxx_messageInfo_StartVMResp.Size(m)
+
+type GetStatsResp struct {
+	Functions []*Function         `protobuf:"bytes,1,rep,name=functions,proto3" json:"functions,omitempty"`
+	Snapshots *SnapshotStoreStats `protobuf:"bytes,2,opt,name=snapshots,proto3" json:"snapshots,omitempty"`
+	Images    *ImageStoreStats    `protobuf:"bytes,3,opt,name=images,proto3" json:"images,omitempty"`
+	UpfPages  *UPFPageStats       `protobuf:"bytes,4,opt,name=upf_pages,json=upfPages,proto3" json:"upf_pages,omitempty"`
+	// Latency breakdown of serving the page faults, in microseconds
+	UpfLatency           []*MetricSummary `protobuf:"bytes,5,rep,name=upf_latency,json=upfLatency,proto3" json:"upf_latency,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
 }
-func (m *StartVMResp) XXX_DiscardUnknown() {
-	xxx_messageInfo_StartVMResp.DiscardUnknown(m)
+
+func (m *GetStatsResp) Reset()         { *m = GetStatsResp{} }
+func (m *GetStatsResp) String() string { return proto.CompactTextString(m) }
+func (*GetStatsResp) ProtoMessage()    {}
+func (*GetStatsResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{21}
 }
 
-var xxx_messageInfo_StartVMResp proto.InternalMessageInfo
+func (m *GetStatsResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetStatsResp.Unmarshal(m, b)
+}
+func (m *GetStatsResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetStatsResp.Marshal(b, m, deterministic)
+}
+func (m *GetStatsResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetStatsResp.Merge(m, src)
+}
+func (m *GetStatsResp) XXX_Size() int {
+	return xxx_messageInfo_GetStatsResp.Size(m)
+}
+func (m *GetStatsResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetStatsResp.DiscardUnknown(m)
+}
 
-func (m *StartVMResp) GetMessage() string {
+var xxx_messageInfo_GetStatsResp proto.InternalMessageInfo
+
+func (m *GetStatsResp) GetFunctions() []*Function {
 	if m != nil {
-		return m.Message
+		return m.Functions
 	}
-	return ""
+	return nil
 }
 
-func (m *StartVMResp) GetProfile() string {
+func (m *GetStatsResp) GetSnapshots() *SnapshotStoreStats {
 	if m != nil {
-		return m.Profile
+		return m.Snapshots
 	}
-	return ""
+	return nil
+}
+
+func (m *GetStatsResp) GetImages() *ImageStoreStats {
+	if m != nil {
+		return m.Images
+	}
+	return nil
+}
+
+func (m *GetStatsResp) GetUpfPages() *UPFPageStats {
+	if m != nil {
+		return m.UpfPages
+	}
+	return nil
+}
+
+func (m *GetStatsResp) GetUpfLatency() []*MetricSummary {
+	if m != nil {
+		return m.UpfLatency
+	}
+	return nil
 }
 
 func init() {
@@ -264,30 +1283,111 @@ func init() {
 	proto.RegisterType((*StopSingleVMReq)(nil), "proto.StopSingleVMReq")
 	proto.RegisterType((*Status)(nil), "proto.Status")
 	proto.RegisterType((*StartVMResp)(nil), "proto.StartVMResp")
+	proto.RegisterType((*VMReq)(nil), "proto.VMReq")
+	proto.RegisterType((*Metric)(nil), "proto.Metric")
+	proto.RegisterType((*VMOpResp)(nil), "proto.VMOpResp")
+	proto.RegisterType((*VMSpec)(nil), "proto.VMSpec")
+	proto.RegisterType((*VM)(nil), "proto.VM")
+	proto.RegisterType((*ListVMsReq)(nil), "proto.ListVMsReq")
+	proto.RegisterType((*ListVMsResp)(nil), "proto.ListVMsResp")
+	proto.RegisterType((*Instance)(nil), "proto.Instance")
+	proto.RegisterType((*Function)(nil), "proto.Function")
+	proto.RegisterType((*ListFunctionsReq)(nil), "proto.ListFunctionsReq")
+	proto.RegisterType((*ListFunctionsResp)(nil), "proto.ListFunctionsResp")
+	proto.RegisterType((*GetStatsReq)(nil), "proto.GetStatsReq")
+	proto.RegisterType((*MetricSummary)(nil), "proto.MetricSummary")
+	proto.RegisterType((*SnapshotStoreStats)(nil), "proto.SnapshotStoreStats")
+	proto.RegisterType((*ImageStoreStats)(nil), "proto.ImageStoreStats")
+	proto.RegisterType((*UPFPageStats)(nil), "proto.UPFPageStats")
+	proto.RegisterType((*GetStatsResp)(nil), "proto.GetStatsResp")
 }
 
 func init() { proto.RegisterFile("orchestrator.proto", fileDescriptor_96b6e6782baaa298) }
 
 var fileDescriptor_96b6e6782baaa298 = []byte{
-	// 281 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x91, 0x51, 0x4b, 0xfb, 0x30,
-	0x14, 0xc5, 0xd7, 0xc1, 0xda, 0xff, 0xff, 0x3a, 0x95, 0x5d, 0x44, 0xcb, 0x40, 0xd0, 0x80, 0xe0,
-	0x8b, 0x7d, 0xa8, 0x82, 0xcf, 0xee, 0x7d, 0x38, 0x5a, 0xe8, 0xab, 0xc4, 0x2d, 0xd6, 0x40, 0x6a,
-	0x62, 0x6e, 0x26, 0x7e, 0x26, 0x3f, 0xa5, 0xa4, 0x5d, 0xd7, 0xa0, 0xf8, 0x14, 0xee, 0xcd, 0xfd,
-	0x9d, 0xdc, 0x73, 0x02, 0xa8, 0xed, 0xfa, 0x55, 0x90, 0xb3, 0xdc, 0x69, 0x9b, 0x19, 0xab, 0x9d,
-	0xc6, 0x49, 0x7b, 0xb0, 0x1c, 0xa0, 0x74, 0xdc, 0xba, 0x6a, 0x59, 0x88, 0x77, 0x3c, 0x81, 0x89,
-	0x6c, 0x78, 0x2d, 0xd2, 0xe8, 0x22, 0xba, 0xfe, 0x5f, 0x74, 0x05, 0x1e, 0xc1, 0x58, 0x6e, 0xd2,
-	0x71, 0xdb, 0x1a, 0xcb, 0x0d, 0xbb, 0xf2, 0x8c, 0x36, 0xd5, 0x92, 0x3c, 0x73, 0x06, 0x09, 0x57,
-	0xea, 0xe9, 0xa3, 0xa1, 0x96, 0xfa, 0x57, 0xc4, 0x5c, 0xa9, 0xaa, 0x21, 0x76, 0x09, 0xc7, 0x7e,
-	0xac, 0x94, 0x6f, 0xb5, 0x12, 0x9d, 0x7e, 0xa7, 0x14, 0xed, 0x95, 0x18, 0xc4, 0xa5, 0xe3, 0x6e,
-	0x4b, 0x98, 0x42, 0xd2, 0x08, 0xa2, 0xe1, 0xed, 0xbe, 0x64, 0x0f, 0x70, 0xb0, 0xdf, 0x90, 0xcc,
-	0xdf, 0x83, 0xfe, 0xc6, 0x58, 0xfd, 0x22, 0x95, 0xd8, 0xed, 0xda, 0x97, 0xf9, 0x57, 0x04, 0xd3,
-	0xc7, 0x20, 0x02, 0xcc, 0x21, 0xd9, 0x69, 0xe2, 0xac, 0xcb, 0x23, 0x1b, 0x52, 0x98, 0xe3, 0xcf,
-	0x16, 0x19, 0x36, 0xc2, 0x1b, 0xcf, 0xb4, 0xae, 0x03, 0xa6, 0x4f, 0x61, 0x7e, 0x38, 0x30, 0x6e,
-	0x4b, 0x6c, 0x84, 0xf7, 0x30, 0x0d, 0xdd, 0xe3, 0x69, 0xc0, 0x04, 0x91, 0xfc, 0x02, 0x17, 0x77,
-	0x70, 0x2e, 0x75, 0x56, 0x5b, 0xb3, 0xce, 0xc4, 0x27, 0x6f, 0x8c, 0x12, 0x94, 0x85, 0xff, 0xb7,
-	0x98, 0x85, 0x56, 0x56, 0x1e, 0x5e, 0x45, 0xcf, 0x71, 0xab, 0x72, 0xfb, 0x1d, 0x00, 0x00, 0xff,
-	0xff, 0x9e, 0x34, 0x34, 0xa7, 0xeb, 0x01, 0x00, 0x00,
+	// 1299 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x57, 0xd9, 0x6e, 0xdb, 0x46,
+	0x17, 0xb6, 0x16, 0x6a, 0x39, 0xa2, 0x2c, 0x67, 0x62, 0x24, 0x8a, 0xf3, 0x07, 0xbf, 0xcd, 0x20,
+	0x8d, 0xd3, 0x22, 0x4e, 0xa1, 0x36, 0xc8, 0x6d, 0xeb, 0x04, 0x09, 0x04, 0x58, 0x88, 0x40, 0xa1,
+	0xbe, 0x25, 0xc6, 0xe4, 0x91, 0x3c, 0x29, 0x37, 0x73, 0x86, 0x42, 0xed, 0x97, 0x68, 0x1f, 0xa4,
+	0xbd, 0xe9, 0x13, 0xf4, 0x59, 0xfa, 0x16, 0xbd, 0x2b, 0x66, 0xe1, 0xe2, 0x2d, 0x4e, 0xaf, 0xac,
+	0xf3, 0xcd, 0x77, 0x96, 0xf9, 0xe6, 0x1c, 0xce, 0x18, 0x48, 0x92, 0xf9, 0xa7, 0xc8, 0x45, 0x46,
+	0x45, 0x92, 0x1d, 0xa4, 0x59, 0x22, 0x12, 0x62, 0xa9, 0x3f, 0xce, 0x04, 0x60, 0x21, 0x68, 0x26,
+	0x8e, 0x67, 0x2e, 0x9e, 0x91, 0x6d, 0xb0, 0x58, 0x44, 0x57, 0x38, 0x6e, 0xec, 0x36, 0xf6, 0xfb,
+	0xae, 0x36, 0xc8, 0x26, 0x34, 0x59, 0x30, 0x6e, 0x2a, 0xa8, 0xc9, 0x02, 0xe7, 0x99, 0xf4, 0x49,
+	0xd2, 0xe3, 0x19, 0x97, 0x3e, 0x0f, 0xa1, 0x4b, 0xc3, 0xd0, 0x5b, 0x47, 0x5c, 0x79, 0xf5, 0xdc,
+	0x0e, 0x0d, 0xc3, 0xe3, 0x88, 0x3b, 0x7b, 0x30, 0x92, 0xb4, 0x05, 0x8b, 0x57, 0x21, 0xea, 0xf8,
+	0x3a, 0x52, 0xa3, 0x8c, 0xe4, 0x40, 0x67, 0x21, 0xa8, 0xc8, 0x39, 0x19, 0x43, 0x37, 0x42, 0xce,
+	0xab, 0xdc, 0x85, 0xe9, 0x7c, 0x82, 0x41, 0x59, 0x21, 0x4f, 0x6f, 0x27, 0xca, 0x95, 0x34, 0x4b,
+	0x96, 0x2c, 0x44, 0x53, 0x6b, 0x61, 0x92, 0xe7, 0xd2, 0x47, 0x64, 0xcc, 0xe7, 0xe3, 0xd6, 0x6e,
+	0x6b, 0x7f, 0x30, 0x19, 0x6a, 0x11, 0x0e, 0x66, 0x0a, 0x75, 0x8b, 0x55, 0xe7, 0x21, 0x58, 0x37,
+	0x17, 0x3a, 0x81, 0x8e, 0xe6, 0x12, 0x02, 0xed, 0x98, 0x46, 0x45, 0x72, 0xf5, 0x5b, 0xca, 0xb6,
+	0xa6, 0x61, 0xae, 0xf3, 0x36, 0x5c, 0x6d, 0x38, 0x33, 0xe8, 0x1d, 0xcf, 0x3e, 0xa6, 0x77, 0x54,
+	0x5d, 0xab, 0xad, 0xf9, 0xd9, 0xda, 0xfe, 0x6c, 0x40, 0xe7, 0x78, 0xb6, 0x48, 0xd1, 0x27, 0x4f,
+	0x00, 0xd6, 0x7e, 0x9a, 0x7b, 0x7e, 0x92, 0xc7, 0x42, 0x05, 0x1c, 0xba, 0x7d, 0x89, 0xbc, 0x95,
+	0x00, 0xd9, 0x05, 0x3b, 0xc2, 0xc8, 0xe3, 0xec, 0x02, 0xbd, 0x88, 0x9d, 0xa8, 0xaa, 0x86, 0x2e,
+	0x44, 0x18, 0x2d, 0xd8, 0x05, 0xce, 0xd8, 0x09, 0xf9, 0x3f, 0x0c, 0x7e, 0xc6, 0x2c, 0xc6, 0xd0,
+	0xa3, 0xd9, 0x4a, 0x8a, 0x22, 0x4b, 0x02, 0x0d, 0xfd, 0x98, 0xad, 0xb8, 0xcc, 0x90, 0x25, 0x89,
+	0xf0, 0x82, 0x8c, 0xad, 0x71, 0xdc, 0x56, 0xeb, 0x7d, 0x89, 0xbc, 0x93, 0x00, 0x79, 0x0e, 0x23,
+	0xc1, 0x22, 0x4c, 0x72, 0xe1, 0x71, 0xf4, 0x93, 0x38, 0xe0, 0x63, 0x4b, 0x25, 0xd9, 0x34, 0xf0,
+	0x42, 0xa3, 0xce, 0x5f, 0x0d, 0x68, 0x1e, 0xcf, 0xae, 0xca, 0x59, 0xf5, 0x59, 0xb3, 0xde, 0x67,
+	0xdb, 0x60, 0x71, 0x41, 0x05, 0x9a, 0x7a, 0xb4, 0x41, 0x1e, 0x41, 0x6f, 0x95, 0x23, 0x17, 0x1e,
+	0x4b, 0x4d, 0x21, 0x5d, 0x65, 0x4f, 0x53, 0xb2, 0x07, 0x6d, 0x9e, 0xa2, 0xaf, 0x72, 0x57, 0xc2,
+	0x69, 0x91, 0x5c, 0xb5, 0x24, 0x77, 0xca, 0x63, 0x9a, 0xf2, 0xd3, 0x44, 0x78, 0x2c, 0x18, 0x77,
+	0xf4, 0x4e, 0x0b, 0x68, 0x1a, 0x48, 0xc2, 0x32, 0x8f, 0x7d, 0xc1, 0x92, 0x58, 0x12, 0xba, 0x9a,
+	0x50, 0x40, 0xd3, 0xc0, 0xb1, 0x01, 0x8e, 0x18, 0x17, 0xba, 0xdb, 0x9d, 0xaf, 0x61, 0x50, 0x5a,
+	0x3c, 0x25, 0x8f, 0xa1, 0xa5, 0x1b, 0x5f, 0x9e, 0x5c, 0xbf, 0x2c, 0xc0, 0x95, 0xa8, 0xf3, 0x09,
+	0x7a, 0xd3, 0x98, 0x0b, 0x1a, 0xfb, 0x48, 0xee, 0x83, 0xb5, 0x8e, 0xbc, 0x52, 0x84, 0xf6, 0x3a,
+	0x9a, 0x06, 0xd5, 0x86, 0x9b, 0xf5, 0x0d, 0x3f, 0x86, 0x3e, 0x8b, 0xbd, 0x65, 0xc8, 0x56, 0xa7,
+	0x42, 0x49, 0x61, 0xb9, 0x3d, 0x16, 0xbf, 0x57, 0x36, 0x79, 0x00, 0x1d, 0x8e, 0xd9, 0x1a, 0x03,
+	0xa5, 0x45, 0xdb, 0x35, 0x96, 0xf3, 0x7b, 0x03, 0x7a, 0xef, 0x4d, 0xd1, 0x5f, 0x28, 0xb7, 0xcc,
+	0xc3, 0xbd, 0x94, 0xc5, 0x31, 0x06, 0x2a, 0x4f, 0xcf, 0xed, 0x31, 0x3e, 0x57, 0xf6, 0x6d, 0x79,
+	0x24, 0x7e, 0x96, 0x63, 0x8e, 0x81, 0x12, 0xdd, 0x72, 0x8d, 0x45, 0x5e, 0xca, 0xa2, 0xf5, 0x5e,
+	0xf9, 0xb8, 0xa3, 0xe4, 0x18, 0x19, 0x39, 0x0a, 0x0d, 0xdc, 0x8a, 0xe1, 0x10, 0xd8, 0x92, 0x32,
+	0x16, 0x15, 0x2b, 0x69, 0x0f, 0xe1, 0xde, 0x15, 0x8c, 0xa7, 0x32, 0x6e, 0x71, 0x16, 0x85, 0xcc,
+	0x45, 0xdc, 0x82, 0xe8, 0x56, 0x0c, 0xe7, 0x07, 0x18, 0x7c, 0x40, 0x21, 0xbf, 0x29, 0xea, 0xdb,
+	0x74, 0xe5, 0x70, 0x1b, 0x57, 0x0f, 0x97, 0x6c, 0x41, 0x2b, 0x4f, 0x97, 0x4a, 0x97, 0x9e, 0x2b,
+	0x7f, 0x3a, 0x73, 0x18, 0xea, 0xc9, 0x5b, 0xe4, 0x51, 0x44, 0xb3, 0xf3, 0x1b, 0x07, 0x9e, 0x40,
+	0x3b, 0x42, 0x1a, 0x9b, 0x79, 0x57, 0xbf, 0xe5, 0x77, 0x90, 0x8b, 0xc0, 0x0b, 0x70, 0xad, 0xc4,
+	0x6c, 0xb8, 0x1d, 0x2e, 0x82, 0x77, 0xb8, 0x76, 0x7e, 0x6b, 0x02, 0x59, 0x98, 0x86, 0x5b, 0x88,
+	0x24, 0x43, 0x55, 0x9e, 0xac, 0xed, 0x2c, 0x4f, 0x04, 0xf5, 0x4e, 0xce, 0x05, 0xea, 0x6f, 0x67,
+	0xcb, 0x05, 0x05, 0x1d, 0x4a, 0x44, 0xce, 0x60, 0xce, 0x31, 0x30, 0xeb, 0x4d, 0xb5, 0xde, 0x97,
+	0x88, 0x5e, 0xde, 0x03, 0x9b, 0x9f, 0xd2, 0xac, 0x24, 0xb4, 0x14, 0x61, 0xa0, 0x31, 0x4d, 0x79,
+	0x01, 0x5b, 0x86, 0x52, 0x34, 0x3c, 0x57, 0xc7, 0x69, 0xb9, 0x23, 0x8d, 0x17, 0x65, 0x29, 0xaa,
+	0xee, 0x84, 0x1a, 0x55, 0x9f, 0xf0, 0x48, 0xe3, 0x15, 0xf5, 0x7f, 0xd0, 0xc7, 0x35, 0x33, 0x47,
+	0xd2, 0x51, 0xdd, 0x51, 0x01, 0xe4, 0x29, 0x0c, 0x95, 0x51, 0xd6, 0xd5, 0x55, 0x75, 0xd9, 0x06,
+	0x54, 0x85, 0x39, 0xff, 0x34, 0x60, 0x34, 0x95, 0x4d, 0x58, 0xd3, 0x63, 0x0f, 0xec, 0x93, 0x3c,
+	0x58, 0xa1, 0xb8, 0x24, 0xc8, 0x40, 0x63, 0x5f, 0xa4, 0xc8, 0x53, 0x18, 0xfa, 0xd4, 0x3f, 0xc5,
+	0xc0, 0x53, 0x0d, 0xce, 0xcd, 0xf0, 0xd8, 0x1a, 0x54, 0xf9, 0x14, 0x89, 0xfa, 0x82, 0xad, 0xb1,
+	0x20, 0x69, 0x41, 0x6c, 0x0d, 0x1a, 0xd2, 0x36, 0x58, 0x69, 0x1e, 0x86, 0x5a, 0x82, 0xb6, 0xab,
+	0x8d, 0x3b, 0x36, 0xfe, 0x15, 0x8c, 0x14, 0xcd, 0xab, 0x86, 0xb7, 0xab, 0x42, 0x0f, 0x15, 0x3c,
+	0x35, 0x13, 0xec, 0xfc, 0xd1, 0x04, 0xfb, 0xa7, 0xf9, 0xfb, 0x39, 0x5d, 0x99, 0x8d, 0xef, 0x82,
+	0xcd, 0xb8, 0x17, 0xd2, 0x8b, 0x73, 0x2f, 0x4a, 0x02, 0x34, 0xb7, 0x28, 0x30, 0x7e, 0x44, 0x2f,
+	0xce, 0x67, 0x49, 0x80, 0xe4, 0x19, 0x6c, 0x66, 0xe8, 0x27, 0x59, 0x80, 0x81, 0x97, 0xd2, 0x55,
+	0xb9, 0xf7, 0x61, 0x81, 0xce, 0x55, 0xd5, 0x2f, 0x60, 0xab, 0xa4, 0x65, 0xb8, 0x52, 0x65, 0xea,
+	0xae, 0x18, 0x15, 0xb8, 0xab, 0x61, 0xf2, 0x06, 0x6c, 0x3d, 0xd0, 0x5e, 0x5a, 0x8a, 0x30, 0x98,
+	0x6c, 0x5f, 0xba, 0x7a, 0xcc, 0x00, 0xb8, 0x03, 0xcd, 0xd4, 0x39, 0xde, 0x80, 0x9d, 0x61, 0xce,
+	0x4b, 0x47, 0xeb, 0x73, 0x8e, 0x9a, 0x59, 0x3a, 0xe6, 0x31, 0x3b, 0xcb, 0xd1, 0x38, 0x76, 0x3e,
+	0xe7, 0xa8, 0x99, 0xca, 0xd1, 0xf9, 0xb5, 0x09, 0x76, 0x35, 0xd3, 0xff, 0xf9, 0x93, 0x40, 0xde,
+	0x40, 0xbf, 0x6a, 0xe9, 0xa6, 0xca, 0xfa, 0xc8, 0xd0, 0xaf, 0x4f, 0xa5, 0x5b, 0x71, 0xc9, 0x01,
+	0x74, 0x6a, 0x7d, 0x34, 0x98, 0x3c, 0x28, 0xbe, 0x67, 0x97, 0x1b, 0xd7, 0x35, 0x2c, 0xf2, 0x2d,
+	0xf4, 0xf3, 0x74, 0x79, 0x49, 0xd0, 0xfb, 0xc6, 0xa5, 0x7e, 0xde, 0x6e, 0x2f, 0x4f, 0x97, 0x5a,
+	0x93, 0xd7, 0x30, 0x90, 0x1e, 0x21, 0x15, 0x18, 0xfb, 0xe7, 0x63, 0x6b, 0xb7, 0x75, 0xab, 0x24,
+	0x90, 0xa7, 0xcb, 0x23, 0xcd, 0x9b, 0xfc, 0xdd, 0x06, 0xfb, 0x63, 0xed, 0x45, 0x47, 0x26, 0xd0,
+	0x35, 0x4f, 0x24, 0x72, 0xaf, 0xd8, 0x5a, 0xf9, 0xa8, 0xdb, 0x21, 0x57, 0x21, 0x9e, 0x3a, 0x1b,
+	0xe4, 0x25, 0x74, 0xcd, 0x23, 0xae, 0xe6, 0x53, 0x3c, 0xea, 0x76, 0x86, 0x95, 0x8f, 0xc8, 0xb9,
+	0xb3, 0x21, 0x8f, 0xaf, 0xfe, 0x98, 0x23, 0x0f, 0x6a, 0x3e, 0xb5, 0x17, 0xde, 0x75, 0xc7, 0x7d,
+	0xe8, 0xce, 0x69, 0xce, 0xa5, 0x8f, 0x5d, 0xdd, 0x8f, 0x37, 0x31, 0xbf, 0x81, 0x9e, 0x8b, 0x3c,
+	0x8f, 0xae, 0x53, 0x47, 0xa5, 0xa5, 0x9f, 0x53, 0xce, 0x06, 0x79, 0x05, 0x9b, 0x6f, 0x33, 0xa4,
+	0x02, 0x8b, 0x33, 0xbc, 0x2b, 0xfa, 0x2b, 0xb0, 0x8f, 0x12, 0x1a, 0xdc, 0x42, 0xbf, 0x21, 0xc3,
+	0x3e, 0x74, 0x3f, 0x2e, 0x97, 0x61, 0x42, 0x83, 0xbb, 0x42, 0x4f, 0xa0, 0x6b, 0xde, 0x04, 0xa5,
+	0x94, 0xd5, 0x8b, 0x61, 0x87, 0x5c, 0x85, 0x54, 0x74, 0x07, 0xac, 0x0f, 0x28, 0xae, 0xed, 0xb4,
+	0x7a, 0x42, 0x38, 0x1b, 0xe4, 0x1d, 0x0c, 0x2f, 0x5d, 0x88, 0xe4, 0x61, 0x2d, 0x54, 0xfd, 0xea,
+	0xdc, 0x19, 0xdf, 0xbc, 0xa0, 0x32, 0xbd, 0x86, 0x5e, 0x31, 0x3e, 0xa4, 0xa8, 0xa5, 0x76, 0x47,
+	0xee, 0xdc, 0xbf, 0x86, 0x49, 0xb7, 0xc3, 0xef, 0xe1, 0x09, 0x4b, 0x0e, 0x56, 0x59, 0xea, 0x1f,
+	0xe0, 0x2f, 0x34, 0x4a, 0x43, 0xe4, 0x07, 0xf5, 0x7f, 0x23, 0x0e, 0xef, 0xd5, 0x5b, 0x70, 0x2e,
+	0x43, 0xcc, 0x1b, 0x27, 0x1d, 0x15, 0xeb, 0xbb, 0x7f, 0x07, 0x00, 0x7b, 0x29, 0xaf, 0x20, 0x72,
+	0x0c, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -305,6 +1405,15 @@ type OrchestratorClient interface {
 	StartVM(ctx context.Context, in *StartVMReq, opts ...grpc.CallOption) (*StartVMResp, error)
 	StopVMs(ctx context.Context, in *StopVMsReq, opts ...grpc.CallOption) (*Status, error)
 	StopSingleVM(ctx context.Context, in *StopSingleVMReq, opts ...grpc.CallOption) (*Status, error)
+	PauseVM(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*Status, error)
+	ResumeVM(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*VMOpResp, error)
+	CreateSnapshot(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*Status, error)
+	LoadSnapshot(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*VMOpResp, error)
+	Offload(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*Status, error)
+	ListVMs(ctx context.Context, in *ListVMsReq, opts ...grpc.CallOption) (*ListVMsResp, error)
+	GetVM(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*VM, error)
+	ListFunctions(ctx context.Context, in *ListFunctionsReq, opts ...grpc.CallOption) (*ListFunctionsResp, error)
+	GetStats(ctx context.Context, in *GetStatsReq, opts ...grpc.CallOption) (*GetStatsResp, error)
 }
 
 type orchestratorClient struct {
@@ -342,11 +1451,101 @@ func (c *orchestratorClient) StopSingleVM(ctx context.Context, in *StopSingleVMR
 	return out, nil
 }
 
+func (c *orchestratorClient) PauseVM(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/PauseVM", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) ResumeVM(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*VMOpResp, error) {
+	out := new(VMOpResp)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/ResumeVM", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) CreateSnapshot(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/CreateSnapshot", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) LoadSnapshot(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*VMOpResp, error) {
+	out := new(VMOpResp)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/LoadSnapshot", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) Offload(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/Offload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) ListVMs(ctx context.Context, in *ListVMsReq, opts ...grpc.CallOption) (*ListVMsResp, error) {
+	out := new(ListVMsResp)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/ListVMs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) GetVM(ctx context.Context, in *VMReq, opts ...grpc.CallOption) (*VM, error) {
+	out := new(VM)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/GetVM", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) ListFunctions(ctx context.Context, in *ListFunctionsReq, opts ...grpc.CallOption) (*ListFunctionsResp, error) {
+	out := new(ListFunctionsResp)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/ListFunctions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) GetStats(ctx context.Context, in *GetStatsReq, opts ...grpc.CallOption) (*GetStatsResp, error) {
+	out := new(GetStatsResp)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/GetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // OrchestratorServer is the server API for Orchestrator service.
 type OrchestratorServer interface {
 	StartVM(context.Context, *StartVMReq) (*StartVMResp, error)
 	StopVMs(context.Context, *StopVMsReq) (*Status, error)
 	StopSingleVM(context.Context, *StopSingleVMReq) (*Status, error)
+	PauseVM(context.Context, *VMReq) (*Status, error)
+	ResumeVM(context.Context, *VMReq) (*VMOpResp, error)
+	CreateSnapshot(context.Context, *VMReq) (*Status, error)
+	LoadSnapshot(context.Context, *VMReq) (*VMOpResp, error)
+	Offload(context.Context, *VMReq) (*Status, error)
+	ListVMs(context.Context, *ListVMsReq) (*ListVMsResp, error)
+	GetVM(context.Context, *VMReq) (*VM, error)
+	ListFunctions(context.Context, *ListFunctionsReq) (*ListFunctionsResp, error)
+	GetStats(context.Context, *GetStatsReq) (*GetStatsResp, error)
 }
 
 // UnimplementedOrchestratorServer can be embedded to have forward compatible implementations.
@@ -362,6 +1561,33 @@ func (*UnimplementedOrchestratorServer) StopVMs(ctx context.Context, req *StopVM
 func (*UnimplementedOrchestratorServer) StopSingleVM(ctx context.Context, req *StopSingleVMReq) (*Status, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method StopSingleVM not implemented")
 }
+func (*UnimplementedOrchestratorServer) PauseVM(ctx context.Context, req *VMReq) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseVM not implemented")
+}
+func (*UnimplementedOrchestratorServer) ResumeVM(ctx context.Context, req *VMReq) (*VMOpResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeVM not implemented")
+}
+func (*UnimplementedOrchestratorServer) CreateSnapshot(ctx context.Context, req *VMReq) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSnapshot not implemented")
+}
+func (*UnimplementedOrchestratorServer) LoadSnapshot(ctx context.Context, req *VMReq) (*VMOpResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoadSnapshot not implemented")
+}
+func (*UnimplementedOrchestratorServer) Offload(ctx context.Context, req *VMReq) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Offload not implemented")
+}
+func (*UnimplementedOrchestratorServer) ListVMs(ctx context.Context, req *ListVMsReq) (*ListVMsResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVMs not implemented")
+}
+func (*UnimplementedOrchestratorServer) GetVM(ctx context.Context, req *VMReq) (*VM, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVM not implemented")
+}
+func (*UnimplementedOrchestratorServer) ListFunctions(ctx context.Context, req *ListFunctionsReq) (*ListFunctionsResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFunctions not implemented")
+}
+func (*UnimplementedOrchestratorServer) GetStats(ctx context.Context, req *GetStatsReq) (*GetStatsResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
 
 func RegisterOrchestratorServer(s *grpc.Server, srv OrchestratorServer) {
 	s.RegisterService(&_Orchestrator_serviceDesc, srv)
@@ -421,6 +1647,168 @@ func _Orchestrator_StopSingleVM_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Orchestrator_PauseVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VMReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).PauseVM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/PauseVM",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).PauseVM(ctx, req.(*VMReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_ResumeVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VMReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).ResumeVM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/ResumeVM",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).ResumeVM(ctx, req.(*VMReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_CreateSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VMReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).CreateSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/CreateSnapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).CreateSnapshot(ctx, req.(*VMReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_LoadSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VMReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).LoadSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/LoadSnapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).LoadSnapshot(ctx, req.(*VMReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_Offload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VMReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).Offload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/Offload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).Offload(ctx, req.(*VMReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_ListVMs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVMsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).ListVMs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/ListVMs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).ListVMs(ctx, req.(*ListVMsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_GetVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VMReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).GetVM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/GetVM",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).GetVM(ctx, req.(*VMReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_ListFunctions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFunctionsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).ListFunctions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/ListFunctions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).ListFunctions(ctx, req.(*ListFunctionsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/GetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).GetStats(ctx, req.(*GetStatsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Orchestrator_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.Orchestrator",
 	HandlerType: (*OrchestratorServer)(nil),
@@ -437,6 +1825,42 @@ var _Orchestrator_serviceDesc = grpc.ServiceDesc{
 			MethodName: "StopSingleVM",
 			Handler:    _Orchestrator_StopSingleVM_Handler,
 		},
+		{
+			MethodName: "PauseVM",
+			Handler:    _Orchestrator_PauseVM_Handler,
+		},
+		{
+			MethodName: "ResumeVM",
+			Handler:    _Orchestrator_ResumeVM_Handler,
+		},
+		{
+			MethodName: "CreateSnapshot",
+			Handler:    _Orchestrator_CreateSnapshot_Handler,
+		},
+		{
+			MethodName: "LoadSnapshot",
+			Handler:    _Orchestrator_LoadSnapshot_Handler,
+		},
+		{
+			MethodName: "Offload",
+			Handler:    _Orchestrator_Offload_Handler,
+		},
+		{
+			MethodName: "ListVMs",
+			Handler:    _Orchestrator_ListVMs_Handler,
+		},
+		{
+			MethodName: "GetVM",
+			Handler:    _Orchestrator_GetVM_Handler,
+		},
+		{
+			MethodName: "ListFunctions",
+			Handler:    _Orchestrator_ListFunctions_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _Orchestrator_GetStats_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "orchestrator.proto",
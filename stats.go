@@ -27,13 +27,22 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"sync"
 	"sync/atomic"
 )
 
 // FuncStat Per-function stats
 type FuncStat struct {
-	served  uint64
-	started uint64
+	served    uint64
+	started   uint64
+	mu        sync.Mutex
+	instances map[string]*InstanceStat
+}
+
+// InstanceStat Per-instance stats
+type InstanceStat struct {
+	state  string
+	served uint64
 }
 
 // Stats Stats for the cold functions in the function pool
@@ -55,7 +64,7 @@ func (cs *Stats) CreateStats(fID string) error {
 		return errors.New("Stat exists")
 	}
 
-	cs.statMap[fID] = new(FuncStat)
+	cs.statMap[fID] = &FuncStat{instances: make(map[string]*InstanceStat)}
 
 	return nil
 }
@@ -70,10 +79,72 @@ func (cs *Stats) IncServed(fID string) {
 	atomic.AddUint64(&cs.statMap[fID].served, 1)
 }
 
+// SetInstanceState Sets the state of an instance, creating its stats unless they exist
+func (cs *Stats) SetInstanceState(fID, vmID, state string) {
+	fs := cs.statMap[fID]
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, isPresent := fs.instances[vmID]; !isPresent {
+		fs.instances[vmID] = new(InstanceStat)
+	}
+	fs.instances[vmID].state = state
+}
+
+// RemoveInstanceStats Removes the stats of a stopped instance
+func (cs *Stats) RemoveInstanceStats(fID, vmID string) {
+	fs := cs.statMap[fID]
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.instances, vmID)
+}
+
+// IncInstanceServed Increments per-instance requests-served counter
+func (cs *Stats) IncInstanceServed(fID, vmID string) {
+	fs := cs.statMap[fID]
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if is, isPresent := fs.instances[vmID]; isPresent {
+		is.served++
+	}
+}
+
+// ZeroInstanceServed Zeroes per-instance requests-served counter
+func (cs *Stats) ZeroInstanceServed(fID, vmID string) {
+	fs := cs.statMap[fID]
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if is, isPresent := fs.instances[vmID]; isPresent {
+		is.served = 0
+	}
+}
+
+// GetInstanceServed Returns per-instance requests-served counter
+func (cs *Stats) GetInstanceServed(fID, vmID string) uint64 {
+	fs := cs.statMap[fID]
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if is, isPresent := fs.instances[vmID]; isPresent {
+		return is.served
+	}
+
+	return 0
+}
+
 // SprintStats Prints all stats
 func (cs *Stats) SprintStats() string {
 	var s = "==== Stats by cold functions ====\n"
 	s += "fID, #started, #served\n"
+	s += "  vmID, state, #served (per instance)\n"
 
 	funcs := make([]string, 0, len(cs.statMap))
 	for fID := range cs.statMap {
@@ -89,9 +160,31 @@ func (cs *Stats) SprintStats() string {
 		s += fmt.Sprintf("%s, %d, %d\n", fID,
 			atomic.LoadUint64(&cs.statMap[fID].started),
 			atomic.LoadUint64(&cs.statMap[fID].served))
+		s += cs.sprintInstanceStats(fID)
 	}
 
 	s += "==================================="
 
 	return s
 }
+
+// sprintInstanceStats Prints the stats of a function's instances
+func (cs *Stats) sprintInstanceStats(fID string) string {
+	fs := cs.statMap[fID]
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	vmIDs := make([]string, 0, len(fs.instances))
+	for vmID := range fs.instances {
+		vmIDs = append(vmIDs, vmID)
+	}
+	sort.Strings(vmIDs)
+
+	var s string
+	for _, vmID := range vmIDs {
+		s += fmt.Sprintf("  %s, %s, %d\n", vmID, fs.instances[vmID].state, fs.instances[vmID].served)
+	}
+
+	return s
+}
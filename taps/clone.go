@@ -0,0 +1,204 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// cloneTableBase First routing table of the clone taps
+const cloneTableBase = 1000
+
+// getTapIndex Returns the index of the tap with the primary address among the taps of all the bridges
+func getTapIndex(primaryAddress string) (int, error) {
+	bridgeID, tapID, err := parsePrimaryAddress(primaryAddress)
+	if err != nil {
+		return 0, err
+	}
+
+	return bridgeID*TapsPerBridge + tapID, nil
+}
+
+// getCloneRules Returns the iptables rules, as table and rule spec, that translate
+// the primary address of the clone tap to the guest address and mark the connections
+// of the guest, so that they are routed through the tap
+func getCloneRules(tapName, primaryAddress, guestAddress string, mark int) [][]string {
+	markStr := fmt.Sprintf("%d", mark)
+
+	return [][]string{
+		{"mangle", "PREROUTING", "-d", primaryAddress, "-j", "CONNMARK", "--set-mark", markStr},
+		{"mangle", "PREROUTING", "-i", tapName, "-j", "CONNMARK", "--set-mark", markStr},
+		{"mangle", "PREROUTING", "-m", "connmark", "--mark", markStr, "-j", "MARK", "--set-mark", markStr},
+		{"mangle", "OUTPUT", "-d", primaryAddress, "-j", "CONNMARK", "--set-mark", markStr},
+		{"mangle", "OUTPUT", "-m", "connmark", "--mark", markStr, "-j", "MARK", "--set-mark", markStr},
+		{"nat", "PREROUTING", "-d", primaryAddress, "-j", "DNAT", "--to-destination", guestAddress},
+		{"nat", "OUTPUT", "-d", primaryAddress, "-j", "DNAT", "--to-destination", guestAddress},
+	}
+}
+
+// iptables Runs iptables on a rule, e.g., with -A to append it or -D to delete it
+func iptables(op string, rule []string) error {
+	args := append([]string{"iptables", "--wait", "-t", rule[0], op, rule[1]}, rule[2:]...)
+
+	out, err := exec.Command("sudo", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("iptables %v: %w: %s", args[1:], err, out)
+	}
+
+	return nil
+}
+
+// ConnectClone Connects a tap to a guest that keeps the network interface of another VM,
+// i.e., a VM restored from the snapshot of the other VM. The tap is taken off its bridge,
+// so that the guest's addresses do not clash with the other VM's, and the tap's primary
+// address is translated to the guest address, so that the guest is reachable at the
+// tap's primary address. Connecting a tap that is already connected updates it.
+func (tm *TapManager) ConnectClone(tapName, guestAddress string) error {
+	logger := log.WithFields(log.Fields{"tap": tapName, "guestAddress": guestAddress})
+
+	tm.Lock()
+	ni, ok := tm.createdTaps[tapName]
+	tm.Unlock()
+	if !ok {
+		return fmt.Errorf("tap %s does not exist", tapName)
+	}
+
+	if ni.PrimaryAddress == guestAddress {
+		return nil
+	}
+
+	logger.Debug("Connecting tap to a clone")
+
+	tapIndex, err := getTapIndex(ni.PrimaryAddress)
+	if err != nil {
+		return err
+	}
+
+	var (
+		mark  = tapIndex + 1
+		table = cloneTableBase + tapIndex
+	)
+
+	tap, err := netlink.LinkByName(tapName)
+	if err != nil {
+		logger.Error("Could not find tap")
+		return err
+	}
+
+	if err := netlink.LinkSetNoMaster(tap); err != nil {
+		logger.Error("Could not take tap off the bridge")
+		return err
+	}
+
+	// The replies of the guest come from the guest address, which is routed to the bridge
+	rpFilterPath := fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/rp_filter", tapName)
+	if err := ioutil.WriteFile(rpFilterPath, []byte("2"), 0644); err != nil {
+		logger.Error("Could not relax reverse path filtering")
+		return err
+	}
+
+	route := &netlink.Route{
+		LinkIndex: tap.Attrs().Index,
+		Dst:       &net.IPNet{IP: net.ParseIP(guestAddress), Mask: net.CIDRMask(32, 32)},
+		Scope:     netlink.SCOPE_LINK,
+		Table:     table,
+	}
+	if err := netlink.RouteReplace(route); err != nil {
+		logger.Error("Could not add route to the guest")
+		return err
+	}
+
+	rule := netlink.NewRule()
+	rule.Mark = mark
+	rule.Table = table
+	if err := netlink.RuleAdd(rule); err != nil && err != syscall.EEXIST {
+		logger.Error("Could not add routing rule")
+		return err
+	}
+
+	tm.Lock()
+	prevAddress, isConnected := tm.clones[tapName]
+	tm.clones[tapName] = guestAddress
+	tm.Unlock()
+
+	if isConnected {
+		if prevAddress == guestAddress {
+			return nil
+		}
+
+		for _, r := range getCloneRules(tapName, ni.PrimaryAddress, prevAddress, mark) {
+			_ = iptables("-D", r)
+		}
+	}
+
+	for _, r := range getCloneRules(tapName, ni.PrimaryAddress, guestAddress, mark) {
+		if err := iptables("-A", r); err != nil {
+			logger.Error("Could not configure address translation")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// disconnectClone Removes the routing and the address translation of a clone tap, if any
+func (tm *TapManager) disconnectClone(tapName string) {
+	tm.Lock()
+	guestAddress, isConnected := tm.clones[tapName]
+	ni := tm.createdTaps[tapName]
+	delete(tm.clones, tapName)
+	tm.Unlock()
+
+	if !isConnected {
+		return
+	}
+
+	logger := log.WithFields(log.Fields{"tap": tapName, "guestAddress": guestAddress})
+	logger.Debug("Disconnecting tap from a clone")
+
+	tapIndex, err := getTapIndex(ni.PrimaryAddress)
+	if err != nil {
+		logger.WithError(err).Warn("Could not disconnect tap")
+		return
+	}
+
+	for _, r := range getCloneRules(tapName, ni.PrimaryAddress, guestAddress, tapIndex+1) {
+		if err := iptables("-D", r); err != nil {
+			logger.WithError(err).Warn("Could not remove address translation")
+		}
+	}
+
+	rule := netlink.NewRule()
+	rule.Mark = tapIndex + 1
+	rule.Table = cloneTableBase + tapIndex
+	if err := netlink.RuleDel(rule); err != nil {
+		logger.WithError(err).Warn("Could not remove routing rule")
+	}
+}
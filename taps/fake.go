@@ -0,0 +1,136 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FakeTapManager A tap manager that keeps the network interfaces of the taps in memory
+// without creating the bridges and the taps, e.g., for the tests with a fake VMM that
+// run without the privileges to manage the network. The interfaces are assigned
+// as by the TapManager.
+type FakeTapManager struct {
+	sync.Mutex
+	tapCountsPerBridge []int
+	createdTaps        map[string]*NetworkInterface
+	clones             map[string]string // tap name -> guest address, see ConnectClone
+}
+
+// NewFakeTapManager Creates a new fake tap manager
+func NewFakeTapManager() *FakeTapManager {
+	tm := new(FakeTapManager)
+	tm.tapCountsPerBridge = make([]int, NumBridges)
+	tm.createdTaps = make(map[string]*NetworkInterface)
+	tm.clones = make(map[string]string)
+
+	return tm
+}
+
+// AddTap Assigns a network interface to a new tap, or returns the interface
+// that the tap was created with before
+func (tm *FakeTapManager) AddTap(tapName, hostIface string) (*NetworkInterface, error) {
+	tm.Lock()
+	defer tm.Unlock()
+
+	if ni, ok := tm.createdTaps[tapName]; ok {
+		return ni, nil
+	}
+
+	for i := range tm.tapCountsPerBridge {
+		if tm.tapCountsPerBridge[i] < TapsPerBridge {
+			tapID := tm.tapCountsPerBridge[i]
+			tm.tapCountsPerBridge[i]++
+
+			macIndex := i*TapsPerBridge + tapID
+			ni := &NetworkInterface{
+				BridgeName:     getBridgeName(i),
+				MacAddress:     fmt.Sprintf("02:FC:00:00:%02X:%02X", macIndex/256, macIndex%256),
+				PrimaryAddress: getPrimaryAddress(tapID, i),
+				HostDevName:    tapName,
+				Subnet:         Subnet,
+				GatewayAddress: getGatewayAddr(i),
+			}
+			tm.createdTaps[tapName] = ni
+
+			return ni, nil
+		}
+	}
+
+	log.Error("No space for creating taps")
+	return nil, errors.New("No space for creating taps")
+}
+
+// RestoreTap Assigns the network interface to the tap, see TapManager.RestoreTap
+func (tm *FakeTapManager) RestoreTap(tapName, hostIface string, ni *NetworkInterface) error {
+	bridgeID, tapID, err := parsePrimaryAddress(ni.PrimaryAddress)
+	if err != nil || bridgeID >= NumBridges || tapID >= TapsPerBridge {
+		return errors.New("Cannot restore tap with an address outside of the bridges")
+	}
+
+	tm.Lock()
+	defer tm.Unlock()
+
+	for name, created := range tm.createdTaps {
+		if name != tapName && created.PrimaryAddress == ni.PrimaryAddress {
+			return errors.New("Address is taken by another tap")
+		}
+	}
+
+	tm.createdTaps[tapName] = ni
+	if tm.tapCountsPerBridge[bridgeID] <= tapID {
+		tm.tapCountsPerBridge[bridgeID] = tapID + 1
+	}
+
+	return nil
+}
+
+// RemoveTap Removes the tap, which keeps its network interface if it is added again
+func (tm *FakeTapManager) RemoveTap(tapName string) error {
+	tm.Lock()
+	defer tm.Unlock()
+
+	delete(tm.clones, tapName)
+
+	return nil
+}
+
+// ConnectClone Records that the tap is connected to a guest with another address
+func (tm *FakeTapManager) ConnectClone(tapName, guestAddress string) error {
+	tm.Lock()
+	defer tm.Unlock()
+
+	if _, ok := tm.createdTaps[tapName]; !ok {
+		return errors.New("Tap does not exist")
+	}
+	tm.clones[tapName] = guestAddress
+
+	return nil
+}
+
+// RemoveBridges Does nothing, the fake tap manager creates no bridges
+func (tm *FakeTapManager) RemoveBridges() {}
@@ -48,11 +48,37 @@ func getBridgeName(id int) string {
 	return fmt.Sprintf("br%d", id)
 }
 
+// BridgeNames Returns the names of the bridges that the tap manager creates
+func BridgeNames() []string {
+	names := make([]string, 0, NumBridges)
+	for i := 0; i < NumBridges; i++ {
+		names = append(names, getBridgeName(i))
+	}
+
+	return names
+}
+
 // getPrimaryAddress Creates the primary address for a tap
 func getPrimaryAddress(curTaps, bridgeID int) string {
 	return fmt.Sprintf("19%d.128.%d.%d", bridgeID, (curTaps+2)/256, (curTaps+2)%256)
 }
 
+// parsePrimaryAddress Returns the bridge and the tap number of a primary address
+func parsePrimaryAddress(address string) (bridgeID, curTaps int, err error) {
+	var hi, lo int
+
+	if _, err := fmt.Sscanf(address, "19%d.128.%d.%d", &bridgeID, &hi, &lo); err != nil {
+		return 0, 0, err
+	}
+
+	curTaps = hi*256 + lo - 2
+	if bridgeID < 0 || curTaps < 0 {
+		return 0, 0, fmt.Errorf("invalid primary address %s", address)
+	}
+
+	return bridgeID, curTaps, nil
+}
+
 // NewTapManager Creates a new tap manager
 func NewTapManager() *TapManager {
 	tm := new(TapManager)
@@ -60,6 +86,7 @@ func NewTapManager() *TapManager {
 	tm.numBridges = NumBridges
 	tm.TapCountsPerBridge = make([]int64, NumBridges)
 	tm.createdTaps = make(map[string]*NetworkInterface)
+	tm.clones = make(map[string]string)
 
 	log.Info("Registering bridges for tap manager")
 
@@ -191,6 +218,53 @@ func (tm *TapManager) AddTap(tapName, hostIface string) (*NetworkInterface, erro
 	return nil, errors.New("No space for creating taps")
 }
 
+// RestoreTap Creates a tap with the network interface that it was created with
+// by another tap manager, e.g., before the daemon restarted, so that a VM
+// restored from a snapshot keeps its network configuration
+func (tm *TapManager) RestoreTap(tapName, hostIface string, ni *NetworkInterface) error {
+	logger := log.WithFields(log.Fields{"tap": tapName, "address": ni.PrimaryAddress})
+
+	bridgeID, tapID, err := parsePrimaryAddress(ni.PrimaryAddress)
+	if err != nil || bridgeID >= tm.numBridges || tapID >= TapsPerBridge {
+		logger.Error("Cannot restore tap with an address outside of the bridges")
+		return errors.New("Cannot restore tap with an address outside of the bridges")
+	}
+
+	tm.Lock()
+
+	for name, created := range tm.createdTaps {
+		if name != tapName && created.PrimaryAddress == ni.PrimaryAddress {
+			tm.Unlock()
+			logger.Errorf("Address is taken by tap %s", name)
+			return errors.New("Address is taken by another tap")
+		}
+	}
+
+	tm.createdTaps[tapName] = ni
+
+	// Make sure that the taps created later do not get the same address
+	for {
+		tapsInBridge := atomic.LoadInt64(&tm.TapCountsPerBridge[bridgeID])
+		if tapsInBridge > int64(tapID) ||
+			atomic.CompareAndSwapInt64(&tm.TapCountsPerBridge[bridgeID], tapsInBridge, int64(tapID+1)) {
+			break
+		}
+	}
+
+	tm.Unlock()
+
+	// Remove the tap if it was left behind
+	if err := tm.RemoveTap(tapName); err != nil {
+		return err
+	}
+
+	if err := tm.reconnectTap(tapName, ni); err != nil {
+		return err
+	}
+
+	return ConfigIPtables(tapName, hostIface)
+}
+
 // Reconnects a single tap with the same network interface that it was
 // create with previously
 func (tm *TapManager) reconnectTap(tapName string, ni *NetworkInterface) error {
@@ -302,6 +376,8 @@ func (tm *TapManager) RemoveTap(tapName string) error {
 
 	logger.Debug("Removing tap")
 
+	tm.disconnectClone(tapName)
+
 	tap, err := netlink.LinkByName(tapName)
 	if err != nil {
 		logger.Warn("Could not find tap")
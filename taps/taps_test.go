@@ -31,6 +31,7 @@ import (
 	ctrdlog "github.com/containerd/containerd/log"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
 )
 
 func TestMain(m *testing.M) {
@@ -103,3 +104,84 @@ func TestCreateRemoveExtra(t *testing.T) {
 		_ = tm.RemoveTap(fmt.Sprintf("tap_%d", i))
 	}
 }
+
+func TestRestoreTap(t *testing.T) {
+	tm := NewTapManager()
+	defer tm.RemoveBridges()
+
+	ni, err := tm.AddTap("tap_0", "")
+	require.NoError(t, err, "Failed to create tap")
+	require.NoError(t, tm.RemoveTap("tap_0"), "Failed to remove tap")
+
+	// A new tap manager, e.g., after the daemon restarted
+	tm.RemoveBridges()
+	tm = NewTapManager()
+
+	err = tm.RestoreTap("tap_0", "", ni)
+	require.NoError(t, err, "Failed to restore tap")
+
+	err = tm.RestoreTap("tap_1", "", ni)
+	require.Error(t, err, "Restored two taps with the same address")
+
+	newNi, err := tm.AddTap("tap_1", "")
+	require.NoError(t, err, "Failed to create tap")
+	require.NotEqual(t, ni.PrimaryAddress, newNi.PrimaryAddress, "New tap reuses the address of the restored tap")
+
+	for _, tapName := range []string{"tap_0", "tap_1"} {
+		require.NoError(t, tm.RemoveTap(tapName), "Failed to remove tap")
+	}
+}
+
+func TestConnectClone(t *testing.T) {
+	tm := NewTapManager()
+	defer tm.RemoveBridges()
+
+	ni, err := tm.AddTap("tap_0", "")
+	require.NoError(t, err, "Failed to create tap")
+
+	cloneNi, err := tm.AddTap("tap_1", "")
+	require.NoError(t, err, "Failed to create tap")
+
+	// The guest behind tap_1 keeps the address of the guest behind tap_0
+	err = tm.ConnectClone("tap_1", ni.PrimaryAddress)
+	require.NoError(t, err, "Failed to connect clone")
+
+	tap, err := netlink.LinkByName("tap_1")
+	require.NoError(t, err, "Failed to find tap")
+	require.Zero(t, tap.Attrs().MasterIndex, "Clone tap is still connected to the bridge")
+
+	err = tm.ConnectClone("tap_1", ni.PrimaryAddress)
+	require.NoError(t, err, "Failed to connect clone again")
+
+	require.NotEqual(t, ni.PrimaryAddress, cloneNi.PrimaryAddress)
+
+	for _, tapName := range []string{"tap_0", "tap_1"} {
+		require.NoError(t, tm.RemoveTap(tapName), "Failed to remove tap")
+	}
+}
+
+func TestFakeTapManager(t *testing.T) {
+	tm := NewFakeTapManager()
+
+	ni, err := tm.AddTap("fake_tap1", "")
+	require.NoError(t, err, "Failed to add tap")
+	require.Equal(t, getPrimaryAddress(0, 0), ni.PrimaryAddress)
+	require.Equal(t, getGatewayAddr(0), ni.GatewayAddress)
+	require.Equal(t, "fake_tap1", ni.HostDevName)
+
+	again, err := tm.AddTap("fake_tap1", "")
+	require.NoError(t, err, "Failed to add tap again")
+	require.Equal(t, ni, again, "Tap must keep its interface")
+
+	other, err := tm.AddTap("fake_tap2", "")
+	require.NoError(t, err, "Failed to add tap")
+	require.NotEqual(t, ni.PrimaryAddress, other.PrimaryAddress)
+	require.NotEqual(t, ni.MacAddress, other.MacAddress)
+
+	require.Error(t, tm.RestoreTap("fake_tap3", "", ni), "Address of another tap must not be restored")
+	require.NoError(t, tm.ConnectClone("fake_tap2", ni.PrimaryAddress), "Failed to connect clone")
+	require.Error(t, tm.ConnectClone("fake_tap3", ni.PrimaryAddress), "Clone of an unknown tap must fail")
+
+	require.NoError(t, tm.RemoveTap("fake_tap1"), "Failed to remove tap")
+	tm.RemoveBridges()
+}
@@ -41,6 +41,7 @@ type TapManager struct {
 	numBridges         int
 	TapCountsPerBridge []int64
 	createdTaps        map[string]*NetworkInterface
+	clones             map[string]string // tap name -> guest address, see ConnectClone
 }
 
 // NetworkInterface Network interface type, NI names are generated based on expected tap names
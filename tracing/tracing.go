@@ -0,0 +1,225 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package tracing instruments the vHive daemon with OpenTelemetry spans of the cold starts,
+// the snapshot loads and the invocations forwarded to the functions, and propagates
+// the trace context of the incoming requests to the functions
+package tracing
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+	"go.opentelemetry.io/otel/exporters/trace/zipkin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// instrumentationName Name of the tracer of the daemon
+const instrumentationName = "github.com/ease-lab/vhive"
+
+// Attributes of the spans
+const (
+	// FunctionIDKey ID of the function
+	FunctionIDKey = attribute.Key("vhive.function.id")
+	// ImageKey Image of the function
+	ImageKey = attribute.Key("vhive.image")
+	// VMIDKey ID of the VM
+	VMIDKey = attribute.Key("vhive.vm.id")
+	// ColdStartKey Whether the request started an instance
+	ColdStartKey = attribute.Key("vhive.cold_start")
+)
+
+// ExporterKind Backend that the spans are exported to
+type ExporterKind string
+
+const (
+	// ExporterNone Does not export the spans
+	ExporterNone ExporterKind = "none"
+	// ExporterZipkin Exports the spans to a Zipkin collector, e.g., http://localhost:9411/api/v2/spans
+	ExporterZipkin ExporterKind = "zipkin"
+	// ExporterOTLP Exports the spans to an OTLP/HTTP collector, e.g., http://localhost:4318/v1/traces
+	ExporterOTLP ExporterKind = "otlp"
+	// ExporterOTLPGRPC Exports the spans to an OTLP/gRPC collector, e.g., http://localhost:4317
+	ExporterOTLPGRPC ExporterKind = "otlp-grpc"
+)
+
+// Endpoints that the spans are exported to if none is configured
+const (
+	DefaultZipkinEndpoint   = "http://localhost:9411/api/v2/spans"
+	DefaultOTLPEndpoint     = "http://localhost:4318/v1/traces"
+	DefaultOTLPGRPCEndpoint = "http://localhost:4317"
+)
+
+// ParseExporterKind Converts the name of an exporter to its kind
+func ParseExporterKind(name string) (ExporterKind, error) {
+	switch kind := ExporterKind(name); kind {
+	case ExporterNone, ExporterZipkin, ExporterOTLP, ExporterOTLPGRPC:
+		return kind, nil
+	default:
+		return "", errors.Errorf("unknown trace exporter %s", name)
+	}
+}
+
+// NewExporter Creates an exporter of the kind that sends the spans to the endpoint,
+// or to the default endpoint of the kind if empty. Returns nil for ExporterNone.
+// The OTLP collectors are connected to without TLS if their endpoint is an http:// URL.
+func NewExporter(kind ExporterKind, endpoint string) (sdktrace.SpanExporter, error) {
+	switch kind {
+	case ExporterNone:
+		return nil, nil
+	case ExporterZipkin:
+		if endpoint == "" {
+			endpoint = DefaultZipkinEndpoint
+		}
+		logger := log.New(os.Stderr, "zipkin-exporter ", log.LstdFlags)
+		return zipkin.NewRawExporter(endpoint, zipkin.WithLogger(logger))
+	case ExporterOTLP:
+		if endpoint == "" {
+			endpoint = DefaultOTLPEndpoint
+		}
+		host, path, isInsecure, err := parseOTLPEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		opts := []otlphttp.Option{otlphttp.WithEndpoint(host)}
+		if path != "" {
+			opts = append(opts, otlphttp.WithTracesURLPath(path))
+		}
+		if isInsecure {
+			opts = append(opts, otlphttp.WithInsecure())
+		}
+		return otlp.NewExporter(context.Background(), otlphttp.NewDriver(opts...))
+	case ExporterOTLPGRPC:
+		if endpoint == "" {
+			endpoint = DefaultOTLPGRPCEndpoint
+		}
+		host, _, isInsecure, err := parseOTLPEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		opts := []otlpgrpc.Option{otlpgrpc.WithEndpoint(host)}
+		if isInsecure {
+			opts = append(opts, otlpgrpc.WithInsecure())
+		}
+		return otlp.NewExporter(context.Background(), otlpgrpc.NewDriver(opts...))
+	default:
+		return nil, errors.Errorf("unknown trace exporter %s", kind)
+	}
+}
+
+// parseOTLPEndpoint Splits the URL of an OTLP collector into its host:port and its path,
+// and returns whether to connect to it without TLS. An endpoint without a scheme
+// is the host:port of a collector that serves TLS.
+func parseOTLPEndpoint(endpoint string) (string, string, bool, error) {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, "", false, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", false, errors.Wrapf(err, "invalid OTLP endpoint %s", endpoint)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host, u.Path, u.Scheme == "http", nil
+	default:
+		return "", "", false, errors.Errorf("invalid scheme of OTLP endpoint %s", endpoint)
+	}
+}
+
+// Init Registers the global tracer provider that exports all spans of the service, and the
+// W3C trace context and baggage propagator. The spans are exported in batches, or one by one
+// if isSync (e.g., to an in-memory exporter in tests). The caller shuts the provider down
+// to flush the spans.
+func Init(serviceName string, exporter sdktrace.SpanExporter, isSync bool) *sdktrace.TracerProvider {
+	export := sdktrace.WithBatcher(exporter)
+	if isSync {
+		export = sdktrace.WithSyncer(exporter)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		export,
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(serviceName))),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return tp
+}
+
+// StartSpan Starts a span of the daemon, as a child of the span in the context if any.
+// The spans are dropped unless Init registered a tracer provider.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan Ends a span, marking it as failed with the error if not nil
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Detach Returns a context that carries the span of the context but not its deadline or
+// cancellation, for the work that a request starts and that must outlive the request
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+}
+
+// UnaryServerInterceptor Creates the spans of the incoming gRPC requests, continuing
+// the traces that the callers propagated
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return otelgrpc.UnaryServerInterceptor()
+}
+
+// UnaryClientInterceptor Creates the spans of the outgoing gRPC requests and propagates
+// their trace context in the request metadata
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return otelgrpc.UnaryClientInterceptor()
+}
+
+// InjectHTTP Propagates the trace context in the headers of an outgoing HTTP request
+func InjectHTTP(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,265 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	hpb "github.com/ease-lab/vhive/examples/protobuf/helloworld"
+)
+
+// initMemoryTracer Registers a tracer provider that keeps the spans in memory
+func initMemoryTracer(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := Init("vhive-test", exporter, true)
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		_ = tp.Shutdown(context.Background())
+	})
+
+	return exporter
+}
+
+func TestParseExporterKind(t *testing.T) {
+	for _, name := range []string{"none", "zipkin", "otlp"} {
+		kind, err := ParseExporterKind(name)
+		require.NoError(t, err)
+		require.Equal(t, ExporterKind(name), kind)
+	}
+
+	_, err := ParseExporterKind("jaeger")
+	require.Error(t, err, "Parsed an unknown exporter")
+
+	exporter, err := NewExporter(ExporterNone, "")
+	require.NoError(t, err)
+	require.Nil(t, exporter)
+}
+
+func TestSpans(t *testing.T) {
+	exporter := initMemoryTracer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, parent := StartSpan(ctx, "Function.Invoke", FunctionIDKey.String("f1"))
+
+	// The detached context continues the trace but is not canceled with the request
+	detached := Detach(ctx)
+	cancel()
+	require.NoError(t, detached.Err())
+
+	_, child := StartSpan(detached, "AddInstance")
+	EndSpan(child, errors.New("boot failed"))
+	EndSpan(parent, nil)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	childSpan, parentSpan := spans[0], spans[1]
+	require.Equal(t, "AddInstance", childSpan.Name)
+	require.Equal(t, parentSpan.SpanContext.TraceID(), childSpan.SpanContext.TraceID())
+	require.Equal(t, parentSpan.SpanContext.SpanID(), childSpan.Parent.SpanID())
+	require.Equal(t, codes.Error, childSpan.StatusCode)
+	require.Equal(t, "boot failed", childSpan.StatusMessage)
+
+	require.Equal(t, codes.Unset, parentSpan.StatusCode)
+	require.Contains(t, parentSpan.Attributes, FunctionIDKey.String("f1"))
+}
+
+type traceGreeter struct {
+	hpb.UnimplementedGreeterServer
+	traceIDs chan trace.TraceID
+}
+
+func (s *traceGreeter) SayHello(ctx context.Context, in *hpb.HelloRequest) (*hpb.HelloReply, error) {
+	s.traceIDs <- trace.SpanContextFromContext(ctx).TraceID()
+	return &hpb.HelloReply{Message: "Hello, " + in.GetName()}, nil
+}
+
+func TestGRPCPropagation(t *testing.T) {
+	exporter := initMemoryTracer(t)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	greeter := &traceGreeter{traceIDs: make(chan trace.TraceID, 1)}
+	s := grpc.NewServer(grpc.UnaryInterceptor(UnaryServerInterceptor()))
+	hpb.RegisterGreeterServer(s, greeter)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithUnaryInterceptor(UnaryClientInterceptor()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, span := StartSpan(context.Background(), "FuncInvocation")
+	_, err = hpb.NewGreeterClient(conn).SayHello(ctx, &hpb.HelloRequest{Name: "world"})
+	require.NoError(t, err)
+	span.End()
+
+	require.Equal(t, span.SpanContext().TraceID(), <-greeter.traceIDs, "Trace context must reach the function")
+
+	// The client and the server spans of the RPC are children of the invocation
+	require.Len(t, exporter.GetSpans(), 3)
+}
+
+// otlpSpans Returns the spans of an export request, which has a single resource
+func otlpSpans(t *testing.T, req *coltracepb.ExportTraceServiceRequest) []*tracepb.Span {
+	require.Len(t, req.GetResourceSpans(), 1)
+
+	var serviceName string
+	for _, kv := range req.GetResourceSpans()[0].GetResource().GetAttributes() {
+		if kv.GetKey() == "service.name" {
+			serviceName = kv.GetValue().GetStringValue()
+		}
+	}
+	require.Equal(t, "vhive-test", serviceName)
+
+	return req.GetResourceSpans()[0].GetInstrumentationLibrarySpans()[0].GetSpans()
+}
+
+// testOTLPExport Exports a span and its child, which fails, and checks the requests
+// that the collector received
+func testOTLPExport(t *testing.T, exporter sdktrace.SpanExporter, requests chan *coltracepb.ExportTraceServiceRequest) {
+	tp := Init("vhive-test", exporter, true)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	ctx, parent := StartSpan(context.Background(), "Orchestrator.LoadSnapshot", VMIDKey.String("vm1"))
+	_, child := StartSpan(ctx, "LoadVMM")
+	time.Sleep(time.Millisecond)
+	EndSpan(child, errors.New("load failed"))
+
+	spans := otlpSpans(t, <-requests)
+	require.Len(t, spans, 1)
+
+	traceID := parent.SpanContext().TraceID()
+	parentID := parent.SpanContext().SpanID()
+	require.Equal(t, "LoadVMM", spans[0].GetName())
+	require.Equal(t, traceID[:], spans[0].GetTraceId())
+	require.Equal(t, parentID[:], spans[0].GetParentSpanId())
+	require.Equal(t, tracepb.Status_STATUS_CODE_ERROR, spans[0].GetStatus().GetCode())
+	require.Equal(t, tracepb.Span_SPAN_KIND_INTERNAL, spans[0].GetKind())
+	require.Less(t, spans[0].GetStartTimeUnixNano(), spans[0].GetEndTimeUnixNano())
+
+	EndSpan(parent, nil)
+	attrs := otlpSpans(t, <-requests)[0].GetAttributes()
+	require.Len(t, attrs, 1)
+	require.Equal(t, string(VMIDKey), attrs[0].GetKey())
+	require.Equal(t, "vm1", attrs[0].GetValue().GetStringValue())
+
+	require.NoError(t, tp.Shutdown(context.Background()))
+}
+
+func TestParseOTLPEndpoint(t *testing.T) {
+	host, path, isInsecure, err := parseOTLPEndpoint(DefaultOTLPEndpoint)
+	require.NoError(t, err)
+	require.Equal(t, "localhost:4318", host)
+	require.Equal(t, "/v1/traces", path)
+	require.True(t, isInsecure)
+
+	host, path, isInsecure, err = parseOTLPEndpoint("https://collector:4317")
+	require.NoError(t, err)
+	require.Equal(t, "collector:4317", host)
+	require.Empty(t, path)
+	require.False(t, isInsecure, "Collectors with an https:// URL serve TLS")
+
+	host, _, isInsecure, err = parseOTLPEndpoint("collector:4317")
+	require.NoError(t, err)
+	require.Equal(t, "collector:4317", host)
+	require.False(t, isInsecure, "Collectors without a scheme serve TLS")
+
+	_, _, _, err = parseOTLPEndpoint("ftp://collector:4317")
+	require.Error(t, err)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := new(coltracepb.ExportTraceServiceRequest)
+		if err := proto.Unmarshal(body, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests <- req
+	}))
+	defer srv.Close()
+
+	exporter, err := NewExporter(ExporterOTLP, srv.URL+"/v1/traces")
+	require.NoError(t, err)
+
+	testOTLPExport(t, exporter, requests)
+}
+
+type traceCollector struct {
+	coltracepb.UnimplementedTraceServiceServer
+	requests chan *coltracepb.ExportTraceServiceRequest
+}
+
+func (c *traceCollector) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	c.requests <- req
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func TestOTLPGRPCExporter(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	collector := &traceCollector{requests: make(chan *coltracepb.ExportTraceServiceRequest, 1)}
+	s := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(s, collector)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	exporter, err := NewExporter(ExporterOTLPGRPC, "http://"+lis.Addr().String())
+	require.NoError(t, err)
+
+	testOTLPExport(t, exporter, collector.requests)
+}
@@ -0,0 +1,281 @@
+// MIT License
+//
+// Copyright (c) 2021 Michal Baczun and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package tracing
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ExporterKind Backend that the spans are exported to
+type ExporterKind string
+
+const (
+	// ExporterZipkin Exports the spans to a Zipkin collector
+	ExporterZipkin ExporterKind = "zipkin"
+	// ExporterOTLPGRPC Exports the spans to an OpenTelemetry collector with OTLP over gRPC
+	ExporterOTLPGRPC ExporterKind = "otlp-grpc"
+	// ExporterOTLPHTTP Exports the spans to an OpenTelemetry collector with OTLP over HTTP
+	ExporterOTLPHTTP ExporterKind = "otlp-http"
+	// ExporterFile Writes the spans to a JSON Lines file for offline analysis, see ReadFileSpans
+	ExporterFile ExporterKind = "file"
+	// ExporterNone Propagates the trace context but does not export the spans
+	ExporterNone ExporterKind = "none"
+)
+
+// SamplerKind Decides which traces are sampled, named as in the OpenTelemetry specification
+type SamplerKind string
+
+const (
+	// SamplerAlwaysOn Samples all traces
+	SamplerAlwaysOn SamplerKind = "always_on"
+	// SamplerAlwaysOff Samples no traces
+	SamplerAlwaysOff SamplerKind = "always_off"
+	// SamplerTraceIDRatio Samples the given fraction of the traces
+	SamplerTraceIDRatio SamplerKind = "traceidratio"
+	// SamplerParentBasedAlwaysOn Follows the decision of the parent span, samples the new traces
+	SamplerParentBasedAlwaysOn SamplerKind = "parentbased_always_on"
+	// SamplerParentBasedAlwaysOff Follows the decision of the parent span, does not sample the new traces
+	SamplerParentBasedAlwaysOff SamplerKind = "parentbased_always_off"
+	// SamplerParentBasedTraceIDRatio Follows the decision of the parent span, samples
+	// the given fraction of the new traces
+	SamplerParentBasedTraceIDRatio SamplerKind = "parentbased_traceidratio"
+)
+
+// Endpoints and files that the spans are exported to if none is configured
+const (
+	DefaultZipkinEndpoint   = "http://localhost:9411/api/v2/spans"
+	DefaultOTLPGRPCEndpoint = "localhost:4317"
+	DefaultOTLPHTTPEndpoint = "localhost:4318"
+	DefaultFilePath         = "traces.jsonl"
+)
+
+// Environment variables of ConfigFromEnv
+const (
+	envServiceName    = "OTEL_SERVICE_NAME"
+	envExporter       = "OTEL_TRACES_EXPORTER"
+	envZipkinEndpoint = "OTEL_EXPORTER_ZIPKIN_ENDPOINT"
+	envOTLPEndpoint   = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	envOTLPProtocol   = "OTEL_EXPORTER_OTLP_PROTOCOL"
+	envOTLPInsecure   = "OTEL_EXPORTER_OTLP_INSECURE"
+	envSampler        = "OTEL_TRACES_SAMPLER"
+	envSamplerArg     = "OTEL_TRACES_SAMPLER_ARG"
+	envFilePath       = "TRACING_FILE"
+	envSyncExport     = "TRACING_SYNC_EXPORT"
+)
+
+// Config Configuration of the tracer of a service
+type Config struct {
+	// ServiceName Name of the service that creates the spans
+	ServiceName string
+	// Exporter Backend that the spans are exported to, Zipkin by default
+	Exporter ExporterKind
+	// Endpoint URL of the Zipkin collector, host:port of the OTLP collector,
+	// or path of the file that the spans are exported to. The default one if empty.
+	Endpoint string
+	// Insecure Connects to the OTLP collector without TLS, as to the default endpoint
+	// or to an http:// endpoint
+	Insecure bool
+	// Sampler Sampler of the traces, parentbased_always_on by default
+	Sampler SamplerKind
+	// SampleRate Fraction of the traces that the ratio samplers sample
+	SampleRate float64
+	// IsSync Exports each span when it ends instead of in batches in the background
+	IsSync bool
+	// Logger Logger of the exporter errors, standard error if nil
+	Logger *log.Logger
+}
+
+// ConfigFromEnv Reads the configuration of a tracer from the environment of the service, using
+// the OpenTelemetry variables where they exist: OTEL_SERVICE_NAME (serviceName by default),
+// OTEL_TRACES_EXPORTER (zipkin, otlp, file or none), OTEL_EXPORTER_ZIPKIN_ENDPOINT,
+// OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_PROTOCOL (grpc or http/protobuf),
+// OTEL_EXPORTER_OTLP_INSECURE, OTEL_TRACES_SAMPLER, OTEL_TRACES_SAMPLER_ARG,
+// TRACING_FILE and TRACING_SYNC_EXPORT
+func ConfigFromEnv(serviceName string) (Config, error) {
+	cfg := Config{
+		ServiceName: serviceName,
+		Exporter:    ExporterZipkin,
+		Sampler:     SamplerParentBasedAlwaysOn,
+		SampleRate:  1,
+	}
+
+	if name, ok := os.LookupEnv(envServiceName); ok && name != "" {
+		cfg.ServiceName = name
+	}
+
+	switch exporter := os.Getenv(envExporter); exporter {
+	case "", string(ExporterZipkin):
+		cfg.Endpoint = os.Getenv(envZipkinEndpoint)
+	case "otlp":
+		switch protocol := os.Getenv(envOTLPProtocol); protocol {
+		case "", "grpc":
+			cfg.Exporter = ExporterOTLPGRPC
+		case "http/protobuf":
+			cfg.Exporter = ExporterOTLPHTTP
+		default:
+			return Config{}, errors.Errorf("unsupported %s value %s", envOTLPProtocol, protocol)
+		}
+		cfg.Endpoint = os.Getenv(envOTLPEndpoint)
+	case string(ExporterFile):
+		cfg.Exporter = ExporterFile
+		cfg.Endpoint = os.Getenv(envFilePath)
+	case string(ExporterNone):
+		cfg.Exporter = ExporterNone
+	default:
+		return Config{}, errors.Errorf("unsupported %s value %s", envExporter, exporter)
+	}
+
+	var err error
+
+	if cfg.Insecure, err = lookupBool(envOTLPInsecure, false); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.IsSync, err = lookupBool(envSyncExport, false); err != nil {
+		return Config{}, err
+	}
+
+	if sampler, ok := os.LookupEnv(envSampler); ok && sampler != "" {
+		cfg.Sampler = SamplerKind(sampler)
+	}
+
+	if arg, ok := os.LookupEnv(envSamplerArg); ok && arg != "" {
+		if cfg.SampleRate, err = strconv.ParseFloat(arg, 64); err != nil {
+			return Config{}, errors.Wrapf(err, "invalid %s value", envSamplerArg)
+		}
+	}
+
+	if _, err := newSampler(cfg); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func lookupBool(name string, defaultValue bool) (bool, error) {
+	val, ok := os.LookupEnv(name)
+	if !ok || val == "" {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, errors.Errorf("unexpected %s value %s", name, val)
+	}
+
+	return b, nil
+}
+
+// newSampler Creates the sampler of the configuration
+func newSampler(cfg Config) (trace.Sampler, error) {
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return nil, errors.Errorf("sample rate %v is not between 0 and 1", cfg.SampleRate)
+	}
+
+	switch cfg.Sampler {
+	case SamplerAlwaysOn:
+		return trace.AlwaysSample(), nil
+	case SamplerAlwaysOff:
+		return trace.NeverSample(), nil
+	case SamplerTraceIDRatio:
+		return trace.TraceIDRatioBased(cfg.SampleRate), nil
+	case "", SamplerParentBasedAlwaysOn:
+		return trace.ParentBased(trace.AlwaysSample()), nil
+	case SamplerParentBasedAlwaysOff:
+		return trace.ParentBased(trace.NeverSample()), nil
+	case SamplerParentBasedTraceIDRatio:
+		return trace.ParentBased(trace.TraceIDRatioBased(cfg.SampleRate)), nil
+	default:
+		return nil, errors.Errorf("unknown sampler %s", cfg.Sampler)
+	}
+}
+
+// newExporter Creates the exporter of the configuration, nil for ExporterNone
+func newExporter(ctx context.Context, cfg Config) (trace.SpanExporter, error) {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.New(os.Stderr, "tracer-log", log.Ldate|log.Ltime|log.Llongfile)
+	}
+
+	switch cfg.Exporter {
+	case "", ExporterZipkin:
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultZipkinEndpoint
+		}
+		return newZipkinExporter(endpoint, logger)
+	case ExporterOTLPGRPC:
+		endpoint, insecure := otlpEndpoint(cfg, DefaultOTLPGRPCEndpoint)
+		opts := []otlpgrpc.Option{otlpgrpc.WithEndpoint(endpoint)}
+		if insecure {
+			opts = append(opts, otlpgrpc.WithInsecure())
+		}
+		return otlp.NewExporter(ctx, otlpgrpc.NewDriver(opts...))
+	case ExporterOTLPHTTP:
+		endpoint, insecure := otlpEndpoint(cfg, DefaultOTLPHTTPEndpoint)
+		opts := []otlphttp.Option{otlphttp.WithEndpoint(endpoint)}
+		if insecure {
+			opts = append(opts, otlphttp.WithInsecure())
+		}
+		return otlp.NewExporter(ctx, otlphttp.NewDriver(opts...))
+	case ExporterFile:
+		path := cfg.Endpoint
+		if path == "" {
+			path = DefaultFilePath
+		}
+		return NewFileExporter(filepath.Clean(path))
+	case ExporterNone:
+		return nil, nil
+	default:
+		return nil, errors.Errorf("unknown exporter %s", cfg.Exporter)
+	}
+}
+
+// otlpEndpoint Returns the host:port of the OTLP collector, which may be configured as
+// a URL (e.g., http://collector:4317), and whether to connect to it without TLS
+func otlpEndpoint(cfg Config, defaultEndpoint string) (string, bool) {
+	if cfg.Endpoint == "" {
+		// The collector on the node is not expected to serve TLS
+		return defaultEndpoint, true
+	}
+
+	if strings.Contains(cfg.Endpoint, "://") {
+		if u, err := url.Parse(cfg.Endpoint); err == nil {
+			return u.Host, cfg.Insecure || u.Scheme == "http"
+		}
+	}
+
+	return cfg.Endpoint, cfg.Insecure
+}
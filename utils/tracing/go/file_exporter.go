@@ -0,0 +1,164 @@
+// MIT License
+//
+// Copyright (c) 2021 Michal Baczun and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// FileSpan A span as written by FileExporter, one per line
+type FileSpan struct {
+	TraceID      string    `json:"trace_id"`
+	SpanID       string    `json:"span_id"`
+	ParentSpanID string    `json:"parent_span_id,omitempty"`
+	Service      string    `json:"service,omitempty"`
+	Name         string    `json:"name"`
+	Kind         string    `json:"kind"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	// DurationUs Duration of the span in microseconds
+	DurationUs    int64                  `json:"duration_us"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	StatusCode    string                 `json:"status_code"`
+	StatusMessage string                 `json:"status_message,omitempty"`
+}
+
+// FileExporter Appends the spans to a JSON Lines file for offline analysis
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+var _ trace.SpanExporter = (*FileExporter)(nil)
+
+// NewFileExporter Creates an exporter that appends the spans to the file, creating it if needed
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the trace file")
+	}
+
+	return &FileExporter{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// ExportSpans Appends a batch of spans to the file
+func (e *FileExporter) ExportSpans(ctx context.Context, spans []*trace.SpanSnapshot) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.file == nil {
+		return errors.New("the file exporter is shut down")
+	}
+
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		if err := enc.Encode(toFileSpan(s)); err != nil {
+			return err
+		}
+	}
+
+	return e.w.Flush()
+}
+
+// Shutdown Closes the file
+func (e *FileExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.file == nil {
+		return nil
+	}
+
+	err := e.w.Flush()
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	e.file = nil
+
+	return err
+}
+
+func toFileSpan(s *trace.SpanSnapshot) FileSpan {
+	span := FileSpan{
+		TraceID:       s.SpanContext.TraceID().String(),
+		SpanID:        s.SpanContext.SpanID().String(),
+		Name:          s.Name,
+		Kind:          s.SpanKind.String(),
+		Start:         s.StartTime,
+		End:           s.EndTime,
+		DurationUs:    s.EndTime.Sub(s.StartTime).Microseconds(),
+		StatusCode:    s.StatusCode.String(),
+		StatusMessage: s.StatusMessage,
+	}
+
+	if s.Parent.HasSpanID() {
+		span.ParentSpanID = s.Parent.SpanID().String()
+	}
+
+	if s.Resource != nil {
+		if name, ok := s.Resource.Set().Value(semconv.ServiceNameKey); ok {
+			span.Service = name.AsString()
+		}
+	}
+
+	if len(s.Attributes) > 0 {
+		span.Attributes = make(map[string]interface{}, len(s.Attributes))
+		for _, attr := range s.Attributes {
+			span.Attributes[string(attr.Key)] = attr.Value.AsInterface()
+		}
+	}
+
+	return span
+}
+
+// ReadFileSpans Reads the spans that FileExporter wrote to a file
+func ReadFileSpans(path string) ([]FileSpan, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var spans []FileSpan
+
+	dec := json.NewDecoder(file)
+	for dec.More() {
+		var span FileSpan
+		if err := dec.Decode(&span); err != nil {
+			return nil, errors.Wrapf(err, "failed to read span %d from %s", len(spans), path)
+		}
+		spans = append(spans, span)
+	}
+
+	return spans, nil
+}
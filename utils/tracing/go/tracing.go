@@ -44,24 +44,40 @@ import (
 	"google.golang.org/grpc"
 )
 
+// IsTracingEnabled Returns whether the ENABLE_TRACING environment variable enables tracing.
+// An unexpected value is logged and disables tracing, see TracingEnabled.
 func IsTracingEnabled() bool {
-	if val, ok := os.LookupEnv("ENABLE_TRACING"); !ok || val == "false" {
-		return false
-	} else if val == "true" {
-		return true
-	} else {
-		log.Fatalf("ENABLE_TRACING has unexpected value: `%s`", val)
-		return false
+	isEnabled, err := TracingEnabled()
+	if err != nil {
+		log.Printf("warning: %v, tracing is disabled", err)
+	}
+	return isEnabled
+}
+
+// TracingEnabled Returns whether the ENABLE_TRACING environment variable is true,
+// or an error if it is neither true nor false
+func TracingEnabled() (bool, error) {
+	switch val, ok := os.LookupEnv("ENABLE_TRACING"); {
+	case !ok || val == "false":
+		return false, nil
+	case val == "true":
+		return true, nil
+	default:
+		return false, fmt.Errorf("ENABLE_TRACING has unexpected value: `%s`", val)
 	}
 }
 
+func setPropagator() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
 func initTracer(tp *trace.TracerProvider) func() {
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	setPropagator()
 	return func() {
 		err := tp.Shutdown(context.Background())
 		if err != nil {
-			log.Fatalf("Tracer shutdown error: %v", err)
+			log.Printf("warning: tracer shutdown error: %v", err)
 		}
 	}
 }
@@ -78,6 +94,44 @@ func newZipkinExporter(url string, logger *log.Logger) (*zipkin.Exporter, error)
 	return exporter, err
 }
 
+// InitTracer initialises an OpenTelemetry tracer with the given configuration, e.g., read by
+// ConfigFromEnv, and registers it as the global tracer along with the W3C trace context and baggage
+// propagator. It returns the function that flushes the spans and shuts the tracer down. The
+// ExporterNone exporter only registers the propagator, so that the service passes the trace
+// context of its requests on to the services that it calls.
+func InitTracer(cfg Config) (func(context.Context) error, error) {
+	sampler, err := newSampler(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := newExporter(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if exporter == nil {
+		setPropagator()
+		return func(context.Context) error { return nil }, nil
+	}
+
+	export := trace.WithBatcher(exporter)
+	if cfg.IsSync {
+		export = trace.WithSyncer(exporter)
+	}
+
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(sampler),
+		export,
+		trace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(cfg.ServiceName))),
+	)
+
+	otel.SetTracerProvider(tp)
+	setPropagator()
+
+	return tp.Shutdown, nil
+}
+
 // InitBasicTracer initialises a basic OpenTelemetry tracer using a zipkin exporter. The
 // exporter sends span and trace information to the provided URL. The tracer uses the name
 // provided, concatenated with the name of the host (e.g., Knative pod name or docker container),
@@ -141,6 +195,26 @@ func GetGRPCServerWithUnaryInterceptor() *grpc.Server {
 	return grpc.NewServer(grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()))
 }
 
+// GetGRPCServerWithInterceptors returns a grpc server instrumented with opentelemetry interceptors
+// of both the unary and the streaming requests.
+func GetGRPCServerWithInterceptors(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor()),
+	)
+	return grpc.NewServer(opts...)
+}
+
+// DialGRPCWithInterceptors creates a connection to the provided address, which is instrumented
+// with opentelemetry client interceptors of both the unary and the streaming requests.
+func DialGRPCWithInterceptors(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append(opts,
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	)
+	return grpc.Dial(addr, opts...)
+}
+
 // DialGRPCWithUnaryInterceptor creates a connection to the provided address, which is instrumented
 // with an opentelemetry client interceptor enabling the tracing to client grpc messages.
 func DialGRPCWithUnaryInterceptor(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
@@ -2,15 +2,24 @@ package tracing
 
 import (
 	"context"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func TestMain(m *testing.M) {
@@ -70,3 +79,138 @@ func TestSpan(t *testing.T) {
 	time.Sleep(1 * time.Second)
 	span.EndSpan()
 }
+
+func setEnv(t *testing.T, name, value string) {
+	require.NoError(t, os.Setenv(name, value))
+	t.Cleanup(func() { os.Unsetenv(name) })
+}
+
+func TestTracingEnabled(t *testing.T) {
+	setEnv(t, "ENABLE_TRACING", "true")
+	isEnabled, err := TracingEnabled()
+	require.NoError(t, err)
+	require.True(t, isEnabled)
+
+	setEnv(t, "ENABLE_TRACING", "yes")
+	_, err = TracingEnabled()
+	require.Error(t, err, "Unexpected value must be reported")
+	require.False(t, IsTracingEnabled())
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	cfg, err := ConfigFromEnv("svc")
+	require.NoError(t, err)
+	require.Equal(t, Config{ServiceName: "svc", Exporter: ExporterZipkin, Sampler: SamplerParentBasedAlwaysOn, SampleRate: 1}, cfg)
+
+	setEnv(t, "OTEL_SERVICE_NAME", "producer")
+	setEnv(t, "OTEL_TRACES_EXPORTER", "otlp")
+	setEnv(t, "OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf")
+	setEnv(t, "OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	setEnv(t, "OTEL_TRACES_SAMPLER", "parentbased_traceidratio")
+	setEnv(t, "OTEL_TRACES_SAMPLER_ARG", "0.25")
+	setEnv(t, "TRACING_SYNC_EXPORT", "true")
+
+	cfg, err = ConfigFromEnv("svc")
+	require.NoError(t, err)
+	require.Equal(t, Config{
+		ServiceName: "producer",
+		Exporter:    ExporterOTLPHTTP,
+		Endpoint:    "http://collector:4318",
+		Sampler:     SamplerParentBasedTraceIDRatio,
+		SampleRate:  0.25,
+		IsSync:      true,
+	}, cfg)
+
+	endpoint, insecure := otlpEndpoint(cfg, DefaultOTLPHTTPEndpoint)
+	require.Equal(t, "collector:4318", endpoint)
+	require.True(t, insecure)
+
+	setEnv(t, "OTEL_TRACES_SAMPLER_ARG", "2")
+	_, err = ConfigFromEnv("svc")
+	require.Error(t, err, "Sample rate must be a fraction")
+
+	setEnv(t, "OTEL_TRACES_SAMPLER", "sometimes")
+	_, err = ConfigFromEnv("svc")
+	require.Error(t, err, "Unknown sampler must be reported")
+
+	setEnv(t, "OTEL_TRACES_EXPORTER", "jaeger")
+	_, err = ConfigFromEnv("svc")
+	require.Error(t, err, "Unknown exporter must be reported")
+}
+
+func TestFileExporterAndStreamInterceptors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+
+	shutdown, err := InitTracer(Config{ServiceName: "file-test", Exporter: ExporterFile, Endpoint: path, Sampler: SamplerAlwaysOn, IsSync: true})
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := GetGRPCServerWithInterceptors()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := DialGRPCWithInterceptors(lis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	span := Span{SpanName: "watch", TracerName: "file-test"}
+	ctx, cancel := context.WithCancel(span.StartSpan(context.Background()))
+
+	stream, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+
+	// The client and the server spans of the stream end once it is canceled
+	cancel()
+	_, err = stream.Recv()
+	require.Error(t, err)
+	span.EndSpan()
+
+	var spans []FileSpan
+	require.Eventually(t, func() bool {
+		spans, err = ReadFileSpans(path)
+		return err == nil && len(spans) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, shutdown(context.Background()))
+
+	byKind := make(map[string]FileSpan)
+	for _, span := range spans {
+		require.Equal(t, "file-test", span.Service)
+		byKind[span.Kind] = span
+	}
+	require.Contains(t, byKind, "internal")
+	require.Contains(t, byKind, "client")
+	require.Contains(t, byKind, "server")
+
+	parent := byKind["internal"]
+	require.Equal(t, "watch", parent.Name)
+	require.Equal(t, parent.SpanID, byKind["client"].ParentSpanID)
+	require.Equal(t, parent.TraceID, byKind["server"].TraceID, "Trace context must be propagated in the stream")
+	require.Equal(t, "grpc.health.v1.Health/Watch", byKind["server"].Name)
+}
+
+func TestOTLPHTTPExporter(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		requests <- r
+	}))
+	defer srv.Close()
+
+	shutdown, err := InitTracer(Config{ServiceName: "otlp-test", Exporter: ExporterOTLPHTTP, Endpoint: srv.URL, IsSync: true})
+	require.NoError(t, err)
+	defer shutdown(context.Background())
+
+	span := Span{SpanName: "test-span", TracerName: "otlp-test"}
+	span.StartSpan(context.Background())
+	span.EndSpan()
+
+	req := <-requests
+	require.Equal(t, "/v1/traces", req.URL.Path)
+	require.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+}
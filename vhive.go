@@ -28,14 +28,19 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"net/http"
 	"os"
 	"runtime"
+	"time"
 
 	ctrdlog "github.com/containerd/containerd/log"
 	fccdcri "github.com/ease-lab/vhive/cri"
 	ctriface "github.com/ease-lab/vhive/ctriface"
 	hpb "github.com/ease-lab/vhive/examples/protobuf/helloworld"
+	"github.com/ease-lab/vhive/memory/manager"
+	"github.com/ease-lab/vhive/misc"
 	pb "github.com/ease-lab/vhive/proto"
+	"github.com/ease-lab/vhive/tracing"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 )
@@ -57,10 +62,44 @@ var (
 	isUPFEnabled       *bool
 	isLazyMode         *bool
 	isMetricsMode      *bool
+	upfWorkers         *int
+	wsRestoreWorkers   *int
+	wsRestoreChunk     *int
+	wsReplayMode       *string
+	wsRecordIters      *int
+	wsMergePolicy      *string
+	wsMinFrequency     *float64
+	wsRerecordRate     *float64
+	wsRerecordWindow   *int
 	servedThreshold    *uint64
 	pinnedFuncNum      *int
+	keepAliveName      *string
+	idleTimeout        *time.Duration
+	minIdleTimeout     *time.Duration
+	maxIdleTimeout     *time.Duration
+	maxInstances       *int
+	instanceConc       *int
+	scaleInTimeout     *time.Duration
+	queueDepth         *int
+	queueTimeout       *time.Duration
+	fwdModeName        *string
+	fwdMethod          *string
+	funcPort           *int
 	criSock            *string
 	hostIface          *string
+	vmSpecsPath        *string
+	registryConfigPath *string
+	isPersistSnapshots *bool
+	snapshotQuotaMib   *int64
+	imageBudgetMib     *int64
+	snapshotEviction   *string
+	stopTimeout        *time.Duration
+	warmPoolPath       *string
+	warmPoolMemMib     *uint64
+	warmPoolAddr       *string
+	promAddr           *string
+	traceExporter      *string
+	traceEndpoint      *string
 )
 
 func main() {
@@ -75,11 +114,45 @@ func main() {
 	isSnapshotsEnabled = flag.Bool("snapshots", false, "Use VM snapshots when adding function instances")
 	isUPFEnabled = flag.Bool("upf", false, "Enable user-level page faults guest memory management")
 	isMetricsMode = flag.Bool("metrics", false, "Calculate UPF metrics")
+	upfWorkers = flag.Int("upfWorkers", 0, "Number of the goroutines that serve the page faults of each VM concurrently (0 is one per vCPU of the VM)")
 	servedThreshold = flag.Uint64("st", 1000*1000, "Functions serves X RPCs before it shuts down (if saveMemory=true)")
 	pinnedFuncNum = flag.Int("hn", 0, "Number of functions pinned in memory (IDs from 0 to X)")
+	keepAliveName = flag.String("keepAlive", string(KeepAliveServed), "Keep-alive policy of the functions that are not pinned in memory (served, fixed or adaptive, if saveMemory=true)")
+	idleTimeout = flag.Duration("idleTimeout", 10*time.Minute, "Idle period after which an instance is offloaded or stopped (fixed keep-alive), or until the idle times of its function are known (adaptive keep-alive)")
+	minIdleTimeout = flag.Duration("minIdleTimeout", time.Minute, "Minimum idle period of the adaptive keep-alive policy")
+	maxIdleTimeout = flag.Duration("maxIdleTimeout", 4*time.Hour, "Maximum idle period of the adaptive keep-alive policy")
+	maxInstances = flag.Int("maxInstances", 1, "Maximum number of the instances of each function (0 is unlimited)")
+	instanceConc = flag.Int("instanceConcurrency", 0, "Number of the concurrent requests an instance serves before the function scales out (0 is unlimited)")
+	queueDepth = flag.Int("queueDepth", 0, "Maximum number of the requests that wait for an instance of each function, the others are rejected (0 is unlimited)")
+	queueTimeout = flag.Duration("queueTimeout", 0, "Maximum time a request waits for an instance before it is rejected (0 is unlimited)")
+	scaleInTimeout = flag.Duration("scaleInTimeout", time.Minute, "Idle period after which the instances beyond the first one of each function are offloaded or stopped (0 is never)")
+	fwdModeName = flag.String("fwdMode", string(FwdGreeter), "Protocol the requests are forwarded to the functions with (greeter, grpc for raw gRPC passthrough, or http for HTTP/1.1 POST)")
+	fwdMethod = flag.String("fwdMethod", "", "Full gRPC method name (grpc mode) or URL path (http mode) of the requests that do not specify one")
+	funcPort = flag.Int("funcPort", 0, "Port the functions listen on in the VMs (0 is 50051 for gRPC, 8080 for HTTP)")
 	isLazyMode = flag.Bool("lazy", false, "Enable lazy serving mode when UPFs are enabled")
+	wsRestoreWorkers = flag.Int("wsRestoreWorkers", 0, "Number of goroutines that fetch the working set of a VM in chunks while it is being installed (0 fetches it at once before installing it)")
+	wsRestoreChunk = flag.Int("wsRestoreChunkPages", manager.DefaultRestoreChunkPages, "Number of pages of the working set fetched at once by each goroutine")
+	wsRecordIters = flag.Int("wsRecordIterations", 1, "Number of the invocations the working set of a VM is recorded over")
+	wsMergePolicy = flag.String("wsMerge", string(manager.MergeUnion), "How the working sets recorded over several invocations are merged (union, or frequency for the pages touched in at least -wsMinFrequency of the invocations)")
+	wsMinFrequency = flag.Float64("wsMinFrequency", 0.5, "Fraction of the recorded invocations a page must be touched in to be in the working set (-wsMerge frequency)")
+	wsRerecordRate = flag.Float64("wsRerecordThreshold", 0, "Unique page faults per page of the working set, averaged over the last -wsRerecordWindow invocations, above which the working set is recorded again (0 is never)")
+	wsRerecordWindow = flag.Int("wsRerecordWindow", manager.DefaultRerecordWindow, "Number of the invocations the unique page faults are averaged over")
+	wsReplayMode = flag.String("wsReplay", string(manager.ReplaySorted), "Order the working set of a VM is recorded and installed in (sorted by address in bulk, or first-touch to stream the regions in the order the VM first touched them)")
 	criSock = flag.String("criSock", "/etc/firecracker-containerd/fccd-cri.sock", "Socket address for CRI service")
 	hostIface = flag.String("hostIface", "", "Host net-interface for the VMs to bind to for internet access")
+	vmSpecsPath = flag.String("vmSpecs", "", "JSON file with per-image VM specs (vCPUs, memory, kernel args, rootfs, timeout)")
+	registryConfigPath = flag.String("registryConfig", "", "JSON file with the credentials, mirrors and TLS settings of the image registries")
+	isPersistSnapshots = flag.Bool("persistSnapshots", false, "Keep the snapshots on shutdown and load them after a restart")
+	snapshotQuotaMib = flag.Int64("snapshotQuotaMib", 0, "Maximum size of the snapshots in MiB, idle snapshots are evicted beyond it (0 is unlimited)")
+	imageBudgetMib = flag.Int64("imageBudgetMib", 0, "Maximum size of the pulled images in MiB, images that no VM runs are evicted beyond it (0 is unlimited)")
+	stopTimeout = flag.Duration("stopTimeout", 5*time.Second, "Time for the functions to exit after SIGTERM when their VMs are stopped, before they are killed (0 kills them right away)")
+	warmPoolPath = flag.String("warmPool", "", "JSON file with the number of pre-booted instances to keep ready per image, e.g., [{\"image\": \"<image>\", \"size\": 2}]")
+	warmPoolMemMib = flag.Uint64("warmPoolMemMib", 0, "Maximum guest memory of the pre-booted instances in MiB (0 is unlimited)")
+	warmPoolAddr = flag.String("warmPoolAddr", ":3335", "Address of the HTTP API to get and set the warm pool sizes")
+	promAddr = flag.String("promAddr", ":3336", "Address of the Prometheus metrics endpoint (/metrics), empty disables it")
+	traceExporter = flag.String("traceExporter", string(tracing.ExporterNone), "Backend the spans of the cold starts, snapshot loads and invocations are exported to (none, zipkin, otlp or otlp-grpc)")
+	traceEndpoint = flag.String("traceEndpoint", "", "URL the spans are exported to (empty is "+tracing.DefaultZipkinEndpoint+" for zipkin, "+tracing.DefaultOTLPEndpoint+" for otlp, "+tracing.DefaultOTLPGRPCEndpoint+" for otlp-grpc)")
+	snapshotEviction = flag.String("snapshotEviction", string(ctriface.EvictLRU), "Snapshot eviction policy (lru or lfu)")
 
 	flag.Parse()
 
@@ -93,6 +166,52 @@ func main() {
 		return
 	}
 
+	if *upfWorkers < 0 {
+		log.Error("The number of the page fault serving goroutines cannot be negative")
+		return
+	}
+
+	if *wsRestoreWorkers < 0 {
+		log.Error("The number of the working set restore goroutines cannot be negative")
+		return
+	}
+
+	replayMode, err := manager.ParseReplayMode(*wsReplayMode)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	mergePolicy, err := manager.ParseMergePolicy(*wsMergePolicy)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	evictionPolicy, err := ctriface.ParseEvictionPolicy(*snapshotEviction)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	keepAlive, err := ParseKeepAlivePolicy(*keepAliveName)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	fwdMode, err := ParseFwdMode(*fwdModeName)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	traceKind, err := tracing.ParseExporterKind(*traceExporter)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
 	if flog, err = os.Create("/tmp/fccd.log"); err != nil {
 		panic(err)
 	}
@@ -117,8 +236,35 @@ func main() {
 		log.Info(fmt.Sprintf("Creating orchestrator for pinned=%d functions", *pinnedFuncNum))
 	}
 
+	if traceKind != tracing.ExporterNone {
+		exporter, err := tracing.NewExporter(traceKind, *traceEndpoint)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		tp := tracing.Init("vhive", exporter, false)
+		defer tp.Shutdown(context.Background())
+	}
+
 	testModeOn := false
 
+	vmSpecs := make(map[string]ctriface.VMSpec)
+	if *vmSpecsPath != "" {
+		if vmSpecs, err = ctriface.LoadVMSpecs(*vmSpecsPath); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	var registryConfig ctriface.RegistryConfig
+	if *registryConfigPath != "" {
+		if registryConfig, err = ctriface.LoadRegistryConfig(*registryConfigPath); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
 	orch = ctriface.NewOrchestrator(
 		*snapshotter,
 		*hostIface,
@@ -127,9 +273,63 @@ func main() {
 		ctriface.WithUPF(*isUPFEnabled),
 		ctriface.WithMetricsMode(*isMetricsMode),
 		ctriface.WithLazyMode(*isLazyMode),
+		ctriface.WithUPFWorkers(*upfWorkers),
+		ctriface.WithWSRestore(manager.RestoreCfg{
+			Workers:    *wsRestoreWorkers,
+			ChunkPages: *wsRestoreChunk,
+			Mode:       replayMode,
+		}),
+		ctriface.WithWSRecord(manager.RecordCfg{
+			Iterations:        *wsRecordIters,
+			Merge:             mergePolicy,
+			MinFrequency:      *wsMinFrequency,
+			RerecordThreshold: *wsRerecordRate,
+			RerecordWindow:    *wsRerecordWindow,
+		}),
+		ctriface.WithVMSpecs(vmSpecs),
+		ctriface.WithPersistentSnapshots(*isPersistSnapshots),
+		ctriface.WithSnapshotQuota(*snapshotQuotaMib*1024*1024),
+		ctriface.WithSnapshotEvictionPolicy(evictionPolicy),
+		ctriface.WithStopTimeout(*stopTimeout),
+		ctriface.WithImageBudget(*imageBudgetMib*1024*1024),
+		ctriface.WithRegistryConfig(registryConfig),
 	)
 
-	funcPool = NewFuncPool(*isSaveMemory, *servedThreshold, *pinnedFuncNum, testModeOn)
+	var prom *promExporter
+	if *promAddr != "" {
+		prom = newPromExporter()
+	}
+
+	funcPool = NewFuncPool(
+		*isSaveMemory,
+		*servedThreshold,
+		*pinnedFuncNum,
+		testModeOn,
+		WithKeepAlive(KeepAliveCfg{
+			Policy:         keepAlive,
+			IdleTimeout:    *idleTimeout,
+			MinIdleTimeout: *minIdleTimeout,
+			MaxIdleTimeout: *maxIdleTimeout,
+		}),
+		WithScaling(ScalingCfg{
+			MaxInstances:        *maxInstances,
+			InstanceConcurrency: *instanceConc,
+			ScaleInTimeout:      *scaleInTimeout,
+			MaxQueueDepth:       *queueDepth,
+			QueueTimeout:        *queueTimeout,
+		}),
+		WithForwarding(FwdCfg{
+			Mode:   fwdMode,
+			Method: *fwdMethod,
+			Port:   *funcPort,
+		}),
+		WithPrometheus(prom),
+	)
+
+	if prom != nil {
+		prom.registerState(orch, funcPool)
+		go promServe(prom)
+	}
 
 	go criServe()
 	go orchServe()
@@ -150,13 +350,36 @@ func criServe() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
+	s := grpc.NewServer(grpc.UnaryInterceptor(tracing.UnaryServerInterceptor()))
 
-	criService, err := fccdcri.NewService(orch)
+	criService, err := fccdcri.NewService(orch, fccdcri.WithWarmPoolMemory(*warmPoolMemMib))
 	if err != nil {
 		log.Fatalf("failed to create CRI service %v", err)
 	}
 
+	if *warmPoolPath != "" {
+		targets, err := fccdcri.LoadWarmPoolTargets(*warmPoolPath)
+		if err != nil {
+			log.Fatalf("failed to load warm pool targets: %v", err)
+		}
+
+		for _, target := range targets {
+			if err := criService.SetWarmPoolTarget(target); err != nil {
+				log.Fatalf("invalid warm pool target: %v", err)
+			}
+		}
+	}
+
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/warmpool", criService.WarmPoolHandler())
+
+		log.Println("Warm pool API listening on " + *warmPoolAddr)
+		if err := http.ListenAndServe(*warmPoolAddr, mux); err != nil {
+			log.Errorf("failed to serve the warm pool API: %v", err)
+		}
+	}()
+
 	criService.Register(s)
 
 	if err := s.Serve(lis); err != nil {
@@ -164,12 +387,22 @@ func criServe() {
 	}
 }
 
+func promServe(e *promExporter) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e.handler())
+
+	log.Println("Prometheus metrics listening on " + *promAddr)
+	if err := http.ListenAndServe(*promAddr, mux); err != nil {
+		log.Errorf("failed to serve the Prometheus metrics: %v", err)
+	}
+}
+
 func orchServe() {
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
+	s := grpc.NewServer(grpc.UnaryInterceptor(tracing.UnaryServerInterceptor()))
 	pb.RegisterOrchestratorServer(s, &server{})
 
 	log.Println("Listening on port" + port)
@@ -183,7 +416,7 @@ func fwdServe() {
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
+	s := grpc.NewServer(grpc.UnaryInterceptor(tracing.UnaryServerInterceptor()))
 	hpb.RegisterFwdGreeterServer(s, &fwdServer{})
 
 	log.Println("Listening on port" + fwdPort)
@@ -199,14 +432,12 @@ func (s *server) StartVM(ctx context.Context, in *pb.StartVMReq) (*pb.StartVMRes
 	imageName := in.GetImage()
 	log.WithFields(log.Fields{"fID": fID, "image": imageName}).Info("Received direct StartVM")
 
-	tProfile := "not supported anymore"
-
-	_, _, err := funcPool.Serve(ctx, fID, imageName, "record")
+	_, metr, err := funcPool.Serve(ctx, fID, imageName, "record")
 	if err != nil {
-		return &pb.StartVMResp{Message: "First serve failed", Profile: tProfile}, err
+		return &pb.StartVMResp{Message: "First serve failed", Metrics: toPBMetrics(metr)}, misc.ToGRPCError(err)
 	}
 
-	return &pb.StartVMResp{Message: "started VM instance for a function " + fID, Profile: tProfile}, nil
+	return &pb.StartVMResp{Message: "started VM instance for a function " + fID, Metrics: toPBMetrics(metr)}, nil
 }
 
 func (s *server) StopSingleVM(ctx context.Context, in *pb.StopSingleVMReq) (*pb.Status, error) {
@@ -218,7 +449,7 @@ func (s *server) StopSingleVM(ctx context.Context, in *pb.StopSingleVMReq) (*pb.
 		log.Warn(message, err)
 	}
 
-	return &pb.Status{Message: message}, err
+	return &pb.Status{Message: message}, misc.ToGRPCError(err)
 }
 
 // Note: this function is to be used only before tearing down the whole orchestrator
@@ -227,7 +458,7 @@ func (s *server) StopVMs(ctx context.Context, in *pb.StopVMsReq) (*pb.Status, er
 	err := orch.StopActiveVMs()
 	if err != nil {
 		log.Printf("Failed to stop VMs, err: %v\n", err)
-		return &pb.Status{Message: "Failed to stop VMs"}, err
+		return &pb.Status{Message: "Failed to stop VMs"}, misc.ToGRPCError(err)
 	}
 	os.Exit(0)
 	return &pb.Status{Message: "Stopped VMs"}, nil
@@ -242,5 +473,17 @@ func (s *fwdServer) FwdHello(ctx context.Context, in *hpb.FwdHelloReq) (*hpb.Fwd
 	logger.Debug("Received FwdHelloVM")
 
 	resp, _, err := funcPool.Serve(ctx, fID, imageName, payload)
-	return resp, err
+	return resp, misc.ToGRPCError(err)
+}
+
+func (s *fwdServer) Invoke(ctx context.Context, in *hpb.InvokeReq) (*hpb.InvokeResp, error) {
+	fID := in.GetId()
+	imageName := in.GetImage()
+	method := in.GetMethod()
+
+	logger := log.WithFields(log.Fields{"fID": fID, "image": imageName, "method": method})
+	logger.Debug("Received Invoke")
+
+	resp, _, err := funcPool.Invoke(ctx, fID, imageName, method, in.GetPayload())
+	return resp, misc.ToGRPCError(err)
 }
@@ -25,6 +25,7 @@ package main
 import (
 	"context"
 	"flag"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"sync"
@@ -32,6 +33,8 @@ import (
 
 	ctrdlog "github.com/containerd/containerd/log"
 	ctriface "github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/taps"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 )
@@ -48,6 +51,7 @@ var (
 	isLazyModeTest         = flag.Bool("lazyTest", false, "Enable lazy serving mode when UPFs are enabled")
 	isWithCache            = flag.Bool("withCache", false, "Do not drop the cache before measurements")
 	benchDir               = flag.String("benchDirTest", "bench_results", "Directory where stats should be saved")
+	isFakeVMMTest          = flag.Bool("fakeVMMTest", false, "Run the VMs in the fake VMM, without KVM and the privileges to create taps")
 )
 
 func TestMain(m *testing.M) {
@@ -71,16 +75,31 @@ func TestMain(m *testing.M) {
 	log.Infof("Orchestrator UPF metrics enabled: %t", *isMetricsModeTest)
 	log.Infof("Drop cache: %t", !*isWithCache)
 	log.Infof("Bench dir: %s", *benchDir)
+	log.Infof("Fake VMM: %t", *isFakeVMMTest)
 
-	orch = ctriface.NewOrchestrator(
-		"devmapper",
-		"",
+	opts := []ctriface.OrchestratorOption{
 		ctriface.WithTestModeOn(true),
 		ctriface.WithSnapshots(*isSnapshotsEnabledTest),
 		ctriface.WithUPF(*isUPFEnabledTest),
 		ctriface.WithMetricsMode(*isMetricsModeTest),
 		ctriface.WithLazyMode(*isLazyModeTest),
-	)
+	}
+
+	var snapshotsDir string
+	if *isFakeVMMTest {
+		var err error
+		if snapshotsDir, err = ioutil.TempDir("", "vhive-snapshots"); err != nil {
+			log.Fatalf("Failed to create the snapshots dir, err: %v", err)
+		}
+
+		opts = append(opts,
+			ctriface.WithSnapshotsDir(snapshotsDir),
+			ctriface.WithVMM(ctriface.NewFakeVMM(ctriface.FakeVMMCfg{})),
+			ctriface.WithVMPool(misc.NewVMPoolWithTapManager(taps.NewFakeTapManager())),
+		)
+	}
+
+	orch = ctriface.NewOrchestrator("devmapper", "", opts...)
 
 	ret := m.Run()
 
@@ -91,10 +110,24 @@ func TestMain(m *testing.M) {
 
 	orch.Cleanup()
 
+	if snapshotsDir != "" {
+		os.RemoveAll(snapshotsDir)
+	}
+
 	os.Exit(ret)
 }
 
+// skipWithFakeVMM Skips the tests that invoke the functions, which do not run
+// in the VMs of the fake VMM
+func skipWithFakeVMM(t *testing.T) {
+	if *isFakeVMMTest {
+		t.Skip("The functions do not run in the fake VMM")
+	}
+}
+
 func TestSendToFunctionSerial(t *testing.T) {
+	skipWithFakeVMM(t)
+
 	fID := "1"
 	var (
 		servedTh      uint64
@@ -117,6 +150,8 @@ func TestSendToFunctionSerial(t *testing.T) {
 }
 
 func TestSendToFunctionParallel(t *testing.T) {
+	skipWithFakeVMM(t)
+
 	fID := "2"
 	var (
 		servedTh      uint64
@@ -143,6 +178,8 @@ func TestSendToFunctionParallel(t *testing.T) {
 }
 
 func TestStartSendStopTwice(t *testing.T) {
+	skipWithFakeVMM(t)
+
 	fID := "3"
 	var (
 		servedTh      uint64 = 1
@@ -168,6 +205,8 @@ func TestStartSendStopTwice(t *testing.T) {
 }
 
 func TestStatsNotNumericFunction(t *testing.T) {
+	skipWithFakeVMM(t)
+
 	fID := "not-cld"
 	var (
 		servedTh      uint64 = 1
@@ -189,6 +228,8 @@ func TestStatsNotNumericFunction(t *testing.T) {
 }
 
 func TestStatsNotColdFunction(t *testing.T) {
+	skipWithFakeVMM(t)
+
 	fID := "4"
 	var (
 		servedTh      uint64 = 1
@@ -210,6 +251,8 @@ func TestStatsNotColdFunction(t *testing.T) {
 }
 
 func TestSaveMemorySerial(t *testing.T) {
+	skipWithFakeVMM(t)
+
 	fID := "5"
 	var (
 		servedTh      uint64 = 40
@@ -231,6 +274,8 @@ func TestSaveMemorySerial(t *testing.T) {
 }
 
 func TestSaveMemoryParallel(t *testing.T) {
+	skipWithFakeVMM(t)
+
 	fID := "6"
 	var (
 		servedTh      uint64 = 40
@@ -261,6 +306,8 @@ func TestSaveMemoryParallel(t *testing.T) {
 }
 
 func TestDirectStartStopVM(t *testing.T) {
+	skipWithFakeVMM(t)
+
 	fID := "7"
 	var (
 		servedTh      uint64
@@ -280,6 +327,7 @@ func TestDirectStartStopVM(t *testing.T) {
 }
 
 func TestAllFunctions(t *testing.T) {
+	skipWithFakeVMM(t)
 
 	if testing.Short() {
 		t.Skip("skipping TestAllFunctions in non-nightly runs.")